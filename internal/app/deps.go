@@ -3,14 +3,30 @@ package app
 import (
 	"github.com/axelrhd/hagg-lib/casbinx"
 	"github.com/axelrhd/hagg/internal/auth"
+	"github.com/axelrhd/hagg/internal/db"
+	"github.com/axelrhd/hagg/internal/mail"
+	"github.com/axelrhd/hagg/internal/ratelimit"
+	"github.com/axelrhd/hagg/internal/store"
 	"github.com/axelrhd/hagg/internal/user"
 
 	"github.com/casbin/casbin/v2"
 )
 
 type Deps struct {
-	Users user.Store
-	Auth  *auth.Auth
+	Stores  store.Manager   // Unit of work (transactions across stores)
+	Queries *db.QueryLogger // SQL statistics (nil for DB_DRIVER=memory)
+	Users   user.Store
+	Auth    *auth.Auth
+
+	// Email verification links (sent via Mailer)
+	Mailer        mail.Mailer
+	EmailVerifier *auth.EmailVerifier
+
+	// Login through an external identity provider (nil: disabled)
+	OIDC *auth.OIDC
+
+	// Request limits per route group (nil: disabled)
+	RateLimit *ratelimit.Limiter
 
 	// Authorization (RBAC / ABAC)
 	Enforcer *casbin.Enforcer
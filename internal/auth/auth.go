@@ -1,41 +1,423 @@
 package auth
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
 	"net/http"
+	"strings"
+	"time"
 
+	"github.com/axelrhd/hagg-lib/casbinx"
+	"github.com/axelrhd/hagg/internal/config"
+	"github.com/axelrhd/hagg/internal/mail"
 	"github.com/axelrhd/hagg/internal/session"
+	"github.com/axelrhd/hagg/internal/throttle"
+	"github.com/axelrhd/hagg/internal/token"
 	"github.com/axelrhd/hagg/internal/user"
+	"github.com/go-webauthn/webauthn/webauthn"
 )
 
-const SessionKeyUID = "uid"
+// SessionKeyUserID holds the numeric user ID of the logged-in user.
+// The login UID itself is a secret and never stored in the session.
+const SessionKeyUserID = "user_id"
+
+// SessionKeyVersion holds user.User.SessionVersion at login time.
+// A session with an outdated version is no longer valid.
+const SessionKeyVersion = "session_version"
+
+// ErrInvalidCredentials is returned by password logins instead of the exact
+// reason (unknown user, wrong or missing password), which is only recorded.
+var ErrInvalidCredentials = errors.New("Anmeldedaten sind ungültig")
+
+// Credentials are the inputs of the login form. Which of them are used
+// depends on the login mode (config.LoginMode*).
+type Credentials struct {
+	UID         string
+	DisplayName string
+	Password    string
+}
+
+// Options configure an Auth.
+type Options struct {
+	Mode   string              // login mode (config.LoginMode*)
+	Policy user.PasswordPolicy // checked by ChangePassword
+	Perms  *casbinx.Perm       // decides ActionRequire2FA; nil: 2FA is optional for everyone
+	Issuer string              // name shown in authenticator apps
+
+	WebAuthn *webauthn.WebAuthn // relying party for passkeys (see NewWebAuthn); nil: disabled
+
+	// Login links by mail (see magiclink.go); MagicLinkTTL 0: disabled
+	MagicLinkTTL time.Duration
+	Signer       *token.Signer
+	Mailer       mail.Mailer
+	BaseURL      string // public URL the links point to
+
+	Throttle *throttle.Guard // slows down guessing in Login and VerifyTOTP; nil: unlimited
+}
 
 type Auth struct {
-	users user.Store
+	users  user.Store
+	mode   string
+	policy user.PasswordPolicy
+	perms  *casbinx.Perm
+	issuer string
+
+	webauthn *webauthn.WebAuthn
+
+	magicLinkTTL time.Duration
+	signer       *token.Signer
+	mailer       mail.Mailer
+	baseURL      string
+
+	throttle *throttle.Guard
 }
 
-func New(users user.Store) *Auth {
+func New(users user.Store, opts Options) *Auth {
 	return &Auth{
-		users: users,
+		users:  users,
+		mode:   opts.Mode,
+		policy: opts.Policy,
+		perms:  opts.Perms,
+		issuer: opts.Issuer,
+
+		webauthn: opts.WebAuthn,
+
+		magicLinkTTL: opts.MagicLinkTTL,
+		signer:       opts.Signer,
+		mailer:       opts.Mailer,
+		baseURL:      strings.TrimSuffix(opts.BaseURL, "/"),
+
+		throttle: opts.Throttle,
 	}
 }
 
-// Login authenticates a user and creates a session.
-func (a *Auth) Login(req *http.Request, uid string) (*user.User, error) {
-	u, err := a.users.FindByUID(req.Context(), uid)
+// Mode returns the login mode (config.LoginMode*).
+func (a *Auth) Mode() string {
+	return a.mode
+}
+
+// Login authenticates a user and creates a session. If the user needs a
+// second factor, the session only holds a pending login and Login returns
+// ErrTOTPRequired (continue with VerifyTOTP) or ErrTOTPEnrollRequired
+// (continue with the enrolment, see EnrollingUser).
+//
+// After too many failures from the client's IP (or overall) Login returns a
+// *throttle.BlockedError without looking at the credentials.
+func (a *Auth) Login(req *http.Request, cred Credentials) (*user.User, error) {
+	ctx := req.Context()
+	withPassword := a.mode != config.LoginModeUID
+
+	if err := a.throttle.Check(ctx, ClientIP(req)); err != nil {
+		return nil, err
+	}
+
+	var (
+		u   *user.User
+		err error
+	)
+	if a.mode == config.LoginModeDisplayNamePassword {
+		u, err = a.users.FindByDisplayName(ctx, strings.TrimSpace(cred.DisplayName))
+	} else {
+		u, err = a.findByUID(ctx, cred.UID)
+	}
+	if errors.Is(err, user.ErrNotFound) {
+		a.recordLogin(req, 0, err)
+		if withPassword {
+			user.CheckDummyPassword(cred.Password)
+			return nil, a.failLogin(req, ErrInvalidCredentials)
+		}
+		return nil, a.failLogin(req, err)
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	session.Manager.Put(req.Context(), SessionKeyUID, u.UID)
+	if withPassword {
+		err := a.checkPassword(ctx, u.ID, cred.Password)
+		if errors.Is(err, user.ErrNoPassword) || errors.Is(err, user.ErrWrongPassword) {
+			a.recordLogin(req, u.ID, err)
+			return nil, a.failLogin(req, ErrInvalidCredentials)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// disabled, locked or expired is only revealed after the password
+	return a.signIn(req, u)
+}
+
+// failLogin counts a failed Login and returns loginErr, or the block that
+// the failure starts. A broken counter store does not hide loginErr.
+func (a *Auth) failLogin(req *http.Request, loginErr error) error {
+	return a.throttled(req, a.throttle.Fail(req.Context(), ClientIP(req)), loginErr)
+}
+
+// failCode counts a wrong second factor of user id like failLogin, for the
+// client and the account.
+func (a *Auth) failCode(req *http.Request, id int64, loginErr error) error {
+	return a.throttled(req, a.throttle.FailUser(req.Context(), ClientIP(req), id), loginErr)
+}
+
+// throttled returns the block err of a counted failure, else loginErr.
+func (a *Auth) throttled(req *http.Request, err, loginErr error) error {
+	var blocked *throttle.BlockedError
+	if errors.As(err, &blocked) {
+		return blocked
+	}
+	if err != nil {
+		slog.WarnContext(req.Context(), "count failed login failed", "err", err)
+	}
+	return loginErr
+}
+
+// signIn continues every login after the first factor (form, magic link):
+// it checks access and asks for the second factor or completes the login.
+// Errors are those of Login.
+func (a *Auth) signIn(req *http.Request, u *user.User) (*user.User, error) {
+	ctx := req.Context()
+
+	if err := u.CheckAccess(time.Now()); err != nil {
+		a.recordLogin(req, u.ID, err)
+		return nil, err
+	}
+
+	// second factor: the session is not logged in yet
+	f, err := a.secondFactor(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+	switch f {
+	case factorTOTP:
+		if err := a.startPending(ctx, u, false); err != nil {
+			return nil, err
+		}
+		return u, ErrTOTPRequired
+	case factorEnroll:
+		if err := a.startPending(ctx, u, true); err != nil {
+			return nil, err
+		}
+		return u, ErrTOTPEnrollRequired
+	}
+
+	if err := a.completeLogin(req, u); err != nil {
+		return nil, err
+	}
 	return u, nil
 }
 
-// Logout clears the user session.
-func (a *Auth) Logout(req *http.Request) error {
-	session.Manager.Put(req.Context(), SessionKeyUID, "")
+// completeLogin turns the session into a logged-in one under a new token
+// and indexes it (see sessions.go). All factors passed: earlier wrong
+// codes of the account are forgiven (the client's failures are not).
+func (a *Auth) completeLogin(req *http.Request, u *user.User) error {
+	a.clearPending(req.Context())
+	if err := a.renewToken(req.Context()); err != nil {
+		return err
+	}
+	if err := a.throttle.Succeed(req.Context(), u.ID); err != nil {
+		slog.WarnContext(req.Context(), "reset login throttle failed", "err", err)
+	}
+	session.Manager.Put(req.Context(), SessionKeyUserID, u.ID)
+	session.Manager.Put(req.Context(), SessionKeyVersion, u.SessionVersion)
+	a.trackSession(req, u)
+	a.recordLogin(req, u.ID, nil)
+	return nil
+}
+
+// findByUID looks up a user by login UID.
+func (a *Auth) findByUID(ctx context.Context, uid string) (*user.User, error) {
+	u, err := a.users.FindByUID(ctx, uid)
+
+	// generated UIDs may be typed in lower case, without dashes, ...
+	if errors.Is(err, user.ErrNotFound) {
+		if n := user.NormalizeUID(uid); n != uid {
+			u, err = a.users.FindByUID(ctx, n)
+		}
+	}
+
+	return u, err
+}
+
+// checkPassword compares password with the stored hash of user id.
+// A missing password costs as much time as a wrong one.
+func (a *Auth) checkPassword(ctx context.Context, id int64, password string) error {
+	hash, err := a.users.PasswordHash(ctx, id)
+	if errors.Is(err, user.ErrNoPassword) {
+		user.CheckDummyPassword(password)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	ok, err := user.CheckPassword(hash, password)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return user.ErrWrongPassword
+	}
+
+	if user.PasswordNeedsRehash(hash) {
+		a.rehashPassword(ctx, id, password)
+	}
+
 	return nil
 }
 
+// rehashPassword stores password with the current cost parameters. Like
+// recordLogin it never blocks a login: the old hash keeps working.
+func (a *Auth) rehashPassword(ctx context.Context, id int64, password string) {
+	hash, err := user.HashPassword(password)
+	if err == nil {
+		err = a.users.SetPassword(ctx, id, hash)
+	}
+	if err != nil {
+		slog.WarnContext(ctx, "password rehash failed", "user_id", id, "err", err)
+	}
+}
+
+// maxUserAgent limits the stored user agent (it is client-controlled).
+const maxUserAgent = 512
+
+// recordLogin stores a login attempt (failed if loginErr != nil).
+// Tracking must never block a login, so errors are only logged.
+func (a *Auth) recordLogin(req *http.Request, userID int64, loginErr error) {
+	ev := user.LoginEvent{
+		UserID:    userID,
+		Success:   loginErr == nil,
+		IP:        ClientIP(req),
+		UserAgent: req.UserAgent(),
+	}
+	if loginErr != nil {
+		ev.Reason = loginErr.Error()
+	}
+	if len(ev.UserAgent) > maxUserAgent {
+		ev.UserAgent = strings.ToValidUTF8(ev.UserAgent[:maxUserAgent], "")
+	}
+
+	if err := a.users.RecordLogin(req.Context(), ev); err != nil {
+		slog.WarnContext(req.Context(), "record login failed", "user_id", userID, "err", err)
+	}
+}
+
+// ClientIP returns the client address of req without port. Behind a proxy
+// this relies on middleware.RealIP (see server.go).
+func ClientIP(req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return host
+}
+
+// -----------------------------------------------------------------------------
+// Throttle
+// -----------------------------------------------------------------------------
+
+// throttleBaseDelay is the first delay after the free failures.
+const throttleBaseDelay = time.Second
+
+// NewThrottle returns the login throttle configured with AUTH_THROTTLE_*,
+// nil if it is disabled. Failures are logged to log.
+func NewThrottle(cfg config.AuthConfig, store throttle.Store, log *slog.Logger) *throttle.Guard {
+	if !cfg.Throttle {
+		return nil
+	}
+
+	ip := throttle.Policy{
+		Free:         cfg.ThrottleFree,
+		BaseDelay:    throttleBaseDelay,
+		MaxDelay:     cfg.ThrottleMaxDelay,
+		LockoutAfter: cfg.ThrottleLockoutAfter,
+		Lockout:      cfg.ThrottleLockout,
+		Window:       cfg.ThrottleWindow,
+	}
+	global := throttle.Policy{
+		Free:      cfg.ThrottleGlobalFree,
+		BaseDelay: throttleBaseDelay,
+		MaxDelay:  cfg.ThrottleGlobalMaxDelay,
+		Window:    cfg.ThrottleGlobalWindow,
+	}
+
+	return throttle.NewGuard(store, ip, global, log)
+}
+
+// -----------------------------------------------------------------------------
+// Passwords
+// -----------------------------------------------------------------------------
+
+// PasswordPolicy returns the policy configured with AUTH_PASSWORD_*.
+func PasswordPolicy(cfg config.AuthConfig) user.PasswordPolicy {
+	return user.PasswordPolicy{
+		MinLength:  cfg.PasswordMinLength,
+		MinClasses: cfg.PasswordMinClasses,
+	}
+}
+
+// HasPassword reports whether the user has a password.
+func (a *Auth) HasPassword(ctx context.Context, id int64) (bool, error) {
+	_, err := a.users.PasswordHash(ctx, id)
+	if errors.Is(err, user.ErrNoPassword) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// ChangePassword sets a new password for the logged-in user u. If u already
+// has one, current must match it. All other sessions of u end, the session
+// of req stays valid under a new token.
+func (a *Auth) ChangePassword(req *http.Request, u *user.User, current, next string) error {
+	ctx := req.Context()
+
+	hasPassword, err := a.HasPassword(ctx, u.ID)
+	if err != nil {
+		return err
+	}
+	if hasPassword {
+		if err := a.checkPassword(ctx, u.ID, current); err != nil {
+			return err
+		}
+		if next == current {
+			return fmt.Errorf("%w: identisch mit dem bisherigen", user.ErrWeakPassword)
+		}
+	}
+
+	if err := a.policy.Check(next, u); err != nil {
+		return err
+	}
+
+	hash, err := user.HashPassword(next)
+	if err != nil {
+		return err
+	}
+	if err := a.users.SetPassword(ctx, u.ID, hash); err != nil {
+		return err
+	}
+
+	updated, err := a.users.RevokeSessions(ctx, u.ID)
+	if err != nil {
+		return err
+	}
+	session.Manager.Put(ctx, SessionKeyVersion, updated.SessionVersion)
+
+	// the version already ends them, this also removes them from the list
+	if err := a.endOtherSessions(ctx, u); err != nil {
+		return err
+	}
+	return a.renewToken(ctx)
+}
+
+// Logout destroys the session of req. Values put afterwards (e.g. a flash)
+// end up in a new, anonymous session.
+func (a *Auth) Logout(req *http.Request) error {
+	a.forgetSession(req.Context())
+	return session.Manager.Destroy(req.Context())
+}
+
 // IsAuthenticated checks if a user is authenticated.
 func (a *Auth) IsAuthenticated(req *http.Request) bool {
 	_, ok := a.CurrentUser(req)
@@ -44,16 +426,29 @@ func (a *Auth) IsAuthenticated(req *http.Request) bool {
 
 // CurrentUser retrieves the currently authenticated user.
 func (a *Auth) CurrentUser(req *http.Request) (*user.User, bool) {
-	rawUID := session.Manager.Get(req.Context(), SessionKeyUID)
-	uid, ok := rawUID.(string)
-	if !ok || uid == "" {
+	id, ok := SessionUserID(req.Context())
+	if !ok {
 		return nil, false
 	}
 
-	u, err := a.users.FindByUID(req.Context(), uid)
+	u, err := a.users.FindByID(req.Context(), id)
 	if err != nil {
 		return nil, false
 	}
 
+	// sessions were revoked (e.g. UID rotation) or the user may no longer
+	// log in (disabled, locked, expired) → end this session immediately
+	version, _ := session.Manager.Get(req.Context(), SessionKeyVersion).(int64)
+	if version != u.SessionVersion || u.CheckAccess(time.Now()) != nil {
+		_ = a.Logout(req)
+		return nil, false
+	}
+
 	return u, true
 }
+
+// SessionUserID returns the user ID stored in the session, if any.
+func SessionUserID(ctx context.Context) (int64, bool) {
+	id, ok := session.Manager.Get(ctx, SessionKeyUserID).(int64)
+	return id, ok && id > 0
+}
@@ -0,0 +1,208 @@
+package auth
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/axelrhd/hagg/internal/config"
+	"github.com/axelrhd/hagg/internal/session"
+	"github.com/axelrhd/hagg/internal/user"
+	storememory "github.com/axelrhd/hagg/internal/user/store_memory"
+	"golang.org/x/crypto/argon2"
+)
+
+// -----------------------------------------------------------------------------
+// Harness
+// -----------------------------------------------------------------------------
+
+// newTestAuth returns an Auth on a fresh memory store. session.Manager is
+// global, so the tests of this package must not run in parallel.
+func newTestAuth(t *testing.T, opts Options) (*Auth, *storememory.Store) {
+	t.Helper()
+
+	session.Init(session.NewMemoryStore())
+	users := storememory.New(user.NewUIDHasher("test-pepper-0123456789abcdef0123"))
+	if opts.Mode == "" {
+		opts.Mode = config.LoginModeUID
+	}
+
+	return New(users, opts), users
+}
+
+// client is one browser: it keeps the session cookie between requests.
+type client struct {
+	t      *testing.T
+	ip     string
+	cookie *http.Cookie
+}
+
+func newClient(t *testing.T, ip string) *client {
+	return &client{t: t, ip: ip}
+}
+
+// do runs fn inside a request with the session of c.
+func (c *client) do(fn func(req *http.Request)) {
+	c.t.Helper()
+	c.serve(httptest.NewRequest(http.MethodPost, "/", nil), fn)
+}
+
+// get runs fn inside a GET request of target with the session of c.
+func (c *client) get(target string, fn func(req *http.Request)) {
+	c.t.Helper()
+	c.serve(httptest.NewRequest(http.MethodGet, target, nil), fn)
+}
+
+func (c *client) serve(req *http.Request, fn func(req *http.Request)) {
+	c.t.Helper()
+
+	req.RemoteAddr = c.ip + ":40000"
+	if c.cookie != nil {
+		req.AddCookie(c.cookie)
+	}
+
+	rec := httptest.NewRecorder()
+	session.Manager.LoadAndSave(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		fn(req)
+	})).ServeHTTP(rec, req)
+
+	for _, ck := range rec.Result().Cookies() {
+		if ck.Name == session.Manager.Cookie.Name {
+			c.cookie = ck
+		}
+	}
+}
+
+// token returns the session token of c ("" without a session).
+func (c *client) token() string {
+	if c.cookie == nil || c.cookie.MaxAge < 0 {
+		return ""
+	}
+	return c.cookie.Value
+}
+
+// login runs Auth.Login for c.
+func (c *client) login(a *Auth, cred Credentials) (*user.User, error) {
+	var (
+		u   *user.User
+		err error
+	)
+	c.do(func(req *http.Request) { u, err = a.Login(req, cred) })
+	return u, err
+}
+
+// currentUser runs Auth.CurrentUser for c.
+func (c *client) currentUser(a *Auth) (*user.User, bool) {
+	var (
+		u  *user.User
+		ok bool
+	)
+	c.do(func(req *http.Request) { u, ok = a.CurrentUser(req) })
+	return u, ok
+}
+
+func createUser(t *testing.T, users user.Store, uid, displayName string) *user.User {
+	t.Helper()
+
+	u, err := users.CreateUser(context.Background(), user.CreateUserInput{UID: uid, DisplayName: displayName})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+// -----------------------------------------------------------------------------
+// Password login
+// -----------------------------------------------------------------------------
+
+func TestLoginPassword(t *testing.T) {
+	a, users := newTestAuth(t, Options{Mode: config.LoginModePassword})
+	ctx := context.Background()
+
+	u := createUser(t, users, "UID-ALICE", "alice")
+	hash, err := user.HashPassword("Correct-Horse-7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := users.SetPassword(ctx, u.ID, hash); err != nil {
+		t.Fatal(err)
+	}
+	createUser(t, users, "UID-BOB", "bob") // no password
+
+	tests := []struct {
+		name string
+		cred Credentials
+		want error
+	}{
+		{"wrong password", Credentials{UID: "UID-ALICE", Password: "wrong"}, ErrInvalidCredentials},
+		{"unknown uid", Credentials{UID: "UID-NOBODY", Password: "Correct-Horse-7"}, ErrInvalidCredentials},
+		{"no password set", Credentials{UID: "UID-BOB", Password: ""}, ErrInvalidCredentials},
+		{"right password", Credentials{UID: "UID-ALICE", Password: "Correct-Horse-7"}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newClient(t, "192.0.2.1")
+			if _, err := c.login(a, tt.cred); !errors.Is(err, tt.want) {
+				t.Fatalf("Login = %v, want %v", err, tt.want)
+			}
+			if _, ok := c.currentUser(a); ok != (tt.want == nil) {
+				t.Errorf("logged in = %t", ok)
+			}
+		})
+	}
+}
+
+func TestLoginUpgradesPasswordHash(t *testing.T) {
+	a, users := newTestAuth(t, Options{Mode: config.LoginModePassword})
+	ctx := context.Background()
+
+	u := createUser(t, users, "UID-ALICE", "alice")
+
+	// a hash with weaker parameters than HashPassword uses today
+	salt := []byte("0123456789abcdef")
+	key := argon2.IDKey([]byte("Correct-Horse-7"), salt, 1, 8*1024, 1, 32)
+	old := fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, 8*1024, 1, 1,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key))
+	if err := users.SetPassword(ctx, u.ID, old); err != nil {
+		t.Fatal(err)
+	}
+	if !user.PasswordNeedsRehash(old) {
+		t.Fatal("test hash does not need a rehash")
+	}
+
+	// a wrong password changes nothing
+	if _, err := newClient(t, "192.0.2.1").login(a, Credentials{UID: "UID-ALICE", Password: "wrong"}); err == nil {
+		t.Fatal("login with a wrong password succeeded")
+	}
+	if got, _ := users.PasswordHash(ctx, u.ID); got != old {
+		t.Fatal("failed login replaced the hash")
+	}
+
+	if _, err := newClient(t, "192.0.2.1").login(a, Credentials{UID: "UID-ALICE", Password: "Correct-Horse-7"}); err != nil {
+		t.Fatal(err)
+	}
+
+	upgraded, err := users.PasswordHash(ctx, u.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if upgraded == old || user.PasswordNeedsRehash(upgraded) {
+		t.Fatalf("hash after login = %q, want current parameters", upgraded)
+	}
+	if ok, _ := user.CheckPassword(upgraded, "Correct-Horse-7"); !ok {
+		t.Fatal("upgraded hash does not verify")
+	}
+
+	// the next login keeps the upgraded hash
+	if _, err := newClient(t, "192.0.2.1").login(a, Credentials{UID: "UID-ALICE", Password: "Correct-Horse-7"}); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := users.PasswordHash(ctx, u.ID); got != upgraded {
+		t.Error("current hash was replaced again")
+	}
+}
@@ -0,0 +1,101 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/axelrhd/hagg/internal/mail"
+	"github.com/axelrhd/hagg/internal/token"
+	"github.com/axelrhd/hagg/internal/user"
+)
+
+// tokenPurposeVerifyEmail separates verification links from other tokens.
+const tokenPurposeVerifyEmail = "verify-email"
+
+// VerifyEmailPath is the route that confirms an address (see routes.go).
+const VerifyEmailPath = "/verify-email"
+
+// EmailVerifier sends signed confirmation links and marks addresses
+// as verified when such a link is opened.
+type EmailVerifier struct {
+	users   user.Store
+	signer  *token.Signer
+	mailer  mail.Mailer
+	baseURL string
+	ttl     time.Duration
+}
+
+func NewEmailVerifier(users user.Store, signer *token.Signer, mailer mail.Mailer, baseURL string, ttl time.Duration) *EmailVerifier {
+	return &EmailVerifier{
+		users:   users,
+		signer:  signer,
+		mailer:  mailer,
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		ttl:     ttl,
+	}
+}
+
+// verifyEmailClaims binds the token to user and address: a link for an old
+// address cannot verify a new one.
+type verifyEmailClaims struct {
+	UserID int64  `json:"uid"`
+	Email  string `json:"email"`
+}
+
+// Send mails a confirmation link for the user's current email.
+func (v *EmailVerifier) Send(ctx context.Context, u *user.User) error {
+	if u.Email == "" {
+		return fmt.Errorf("user %q has no email", u.DisplayName)
+	}
+
+	tok, err := v.signer.Sign(tokenPurposeVerifyEmail, verifyEmailClaims{
+		UserID: u.ID,
+		Email:  u.Email,
+	}, v.ttl)
+	if err != nil {
+		return err
+	}
+
+	link := v.baseURL + VerifyEmailPath + "?token=" + url.QueryEscape(tok)
+
+	return v.mailer.Send(ctx, mail.Message{
+		To:      u.Email,
+		Subject: "Bitte bestätige deine E-Mail-Adresse",
+		Text: fmt.Sprintf(
+			"Hallo %s,\n\nbitte bestätige deine E-Mail-Adresse mit diesem Link:\n\n%s\n\nDer Link ist %s gültig.\n",
+			u.FullName(),
+			link,
+			v.ttl,
+		),
+	})
+}
+
+// Verify checks tok and marks the address as verified.
+func (v *EmailVerifier) Verify(ctx context.Context, tok string) (*user.User, error) {
+	var claims verifyEmailClaims
+	if err := v.signer.Verify(tokenPurposeVerifyEmail, tok, &claims); err != nil {
+		return nil, err
+	}
+
+	u, err := v.users.FindByID(ctx, claims.UserID)
+	if err != nil {
+		return nil, token.ErrInvalid
+	}
+
+	// address changed since the link was sent
+	if u.Email != claims.Email {
+		return nil, token.ErrInvalid
+	}
+
+	if u.EmailVerified.Valid {
+		return u, nil
+	}
+
+	verified := user.At(time.Now())
+	return v.users.UpdateUser(ctx, u.ID, user.UpdateUserInput{
+		EmailVerified: &verified,
+	})
+}
@@ -0,0 +1,165 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/axelrhd/hagg/internal/mail"
+	"github.com/axelrhd/hagg/internal/token"
+	"github.com/axelrhd/hagg/internal/user"
+)
+
+// tokenPurposeMagicLink separates login links from other tokens.
+const tokenPurposeMagicLink = "magic-link"
+
+// MagicLinkPath is the page a login link opens (see routes.go). It only
+// asks for a confirmation: mail scanners that follow links must not use up
+// the single-use token.
+const MagicLinkPath = "/login/link"
+
+var ErrMagicLinkDisabled = errors.New("Anmeldung per E-Mail ist nicht aktiviert")
+
+// magicLinkClaims bind the link to user, address and session version: a
+// new address, a rotated UID or "log out everywhere" invalidate open links.
+type magicLinkClaims struct {
+	UserID  int64  `json:"uid"`
+	Email   string `json:"email"`
+	Version int64  `json:"v"`
+	Nonce   string `json:"n"` // single use, see user.Store.UseLoginToken
+}
+
+// MagicLinksEnabled reports whether login links can be requested
+// (AUTH_MAGIC_LINK).
+func (a *Auth) MagicLinksEnabled() bool {
+	return a.magicLinkTTL > 0
+}
+
+// SendMagicLink mails a login link to the user with the verified address
+// email. Unknown or unverified addresses and users who may not log in get
+// no mail, but no error either: the form must not reveal which addresses
+// exist. Only an invalid address is reported.
+func (a *Auth) SendMagicLink(ctx context.Context, email string) error {
+	if !a.MagicLinksEnabled() {
+		return ErrMagicLinkDisabled
+	}
+
+	email, err := user.NormalizeEmail(email)
+	if err != nil {
+		return err
+	}
+	if email == "" {
+		return user.ErrInvalidEmail
+	}
+
+	u, err := a.users.FindByEmail(ctx, email)
+	if errors.Is(err, user.ErrNotFound) {
+		slog.InfoContext(ctx, "magic link not sent", "reason", "unknown email")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if !u.HasVerifiedEmail() || u.CheckAccess(time.Now()) != nil {
+		slog.InfoContext(ctx, "magic link not sent", "user_id", u.ID, "reason", "unverified email or no access")
+		return nil
+	}
+
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+
+	tok, err := a.signer.Sign(tokenPurposeMagicLink, magicLinkClaims{
+		UserID:  u.ID,
+		Email:   u.Email,
+		Version: u.SessionVersion,
+		Nonce:   base64.RawURLEncoding.EncodeToString(nonce),
+	}, a.magicLinkTTL)
+	if err != nil {
+		return err
+	}
+
+	link := a.baseURL + MagicLinkPath + "?token=" + url.QueryEscape(tok)
+
+	return a.mailer.Send(ctx, mail.Message{
+		To:      u.Email,
+		Subject: "Dein Login-Link",
+		Text: fmt.Sprintf(
+			"Hallo %s,\n\nmit diesem Link meldest du dich an:\n\n%s\n\n"+
+				"Der Link ist %s gültig und funktioniert nur einmal.\n"+
+				"Wenn du keinen Link angefordert hast, ignoriere diese Mail.\n",
+			u.FullName(),
+			link,
+			a.magicLinkTTL,
+		),
+	})
+}
+
+// MagicLinkUser returns the user a login link is for, without using it up
+// (confirmation page). Errors are token.ErrInvalid or token.ErrExpired.
+func (a *Auth) MagicLinkUser(ctx context.Context, tok string) (*user.User, error) {
+	u, _, _, err := a.checkMagicLink(ctx, tok)
+	return u, err
+}
+
+// LoginWithMagicLink uses up a login link and logs its user in like Login
+// does after the credentials: with ErrTOTPRequired or ErrTOTPEnrollRequired
+// the session holds a pending login.
+func (a *Auth) LoginWithMagicLink(req *http.Request, tok string) (*user.User, error) {
+	ctx := req.Context()
+
+	u, claims, expires, err := a.checkMagicLink(ctx, tok)
+	if err != nil {
+		return nil, err
+	}
+
+	// the link stays in the mailbox: it must not work twice. The nonce is
+	// kept exactly as long as the link is valid – not longer.
+	err = a.users.UseLoginToken(ctx, u.ID, claims.Nonce, expires)
+	if errors.Is(err, user.ErrTokenUsed) {
+		a.recordLogin(req, u.ID, err)
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return a.signIn(req, u)
+}
+
+// checkMagicLink returns user and claims of a valid login link and when
+// the link expires.
+func (a *Auth) checkMagicLink(ctx context.Context, tok string) (*user.User, *magicLinkClaims, time.Time, error) {
+	if !a.MagicLinksEnabled() {
+		return nil, nil, time.Time{}, ErrMagicLinkDisabled
+	}
+
+	var claims magicLinkClaims
+	expires, err := a.signer.VerifyExpires(tokenPurposeMagicLink, tok, &claims)
+	if err != nil {
+		return nil, nil, time.Time{}, err
+	}
+
+	u, err := a.users.FindByID(ctx, claims.UserID)
+	if errors.Is(err, user.ErrNotFound) {
+		return nil, nil, time.Time{}, token.ErrInvalid
+	}
+	if err != nil {
+		return nil, nil, time.Time{}, err
+	}
+
+	// address or sessions changed since the link was sent
+	if u.Email != claims.Email || !u.HasVerifiedEmail() || u.SessionVersion != claims.Version {
+		return nil, nil, time.Time{}, token.ErrInvalid
+	}
+
+	return u, &claims, expires, nil
+}
@@ -0,0 +1,256 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/axelrhd/hagg/internal/mail"
+	"github.com/axelrhd/hagg/internal/token"
+	"github.com/axelrhd/hagg/internal/user"
+)
+
+// outbox records sent messages instead of delivering them.
+type outbox struct {
+	mu   sync.Mutex
+	sent []mail.Message
+}
+
+func (o *outbox) Send(ctx context.Context, msg mail.Message) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.sent = append(o.sent, msg)
+	return nil
+}
+
+// take returns and forgets the recorded messages.
+func (o *outbox) take() []mail.Message {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	sent := o.sent
+	o.sent = nil
+	return sent
+}
+
+const testBaseURL = "https://hagg.example.com"
+
+func newMagicLinkAuth(t *testing.T) (*Auth, user.Store, *outbox) {
+	t.Helper()
+
+	box := &outbox{}
+	a, users := newTestAuth(t, Options{
+		MagicLinkTTL: 15 * time.Minute,
+		Signer:       token.NewSigner("test-secret-0123456789abcdef"),
+		Mailer:       box,
+		BaseURL:      testBaseURL,
+	})
+	return a, users, box
+}
+
+// userWithEmail creates a user with email, verified or not.
+func userWithEmail(t *testing.T, users user.Store, uid, email string, verified bool) *user.User {
+	t.Helper()
+
+	u := createUser(t, users, uid, strings.ToLower(uid))
+	in := user.UpdateUserInput{Email: &email}
+	if verified {
+		at := user.At(time.Now())
+		in.EmailVerified = &at
+	}
+	u, err := users.UpdateUser(context.Background(), u.ID, in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+// linkToken returns the token of the login link in msg.
+func linkToken(t *testing.T, msg mail.Message) string {
+	t.Helper()
+
+	prefix := testBaseURL + MagicLinkPath + "?"
+	for _, line := range strings.Split(msg.Text, "\n") {
+		if rest, ok := strings.CutPrefix(line, prefix); ok {
+			q, err := url.ParseQuery(rest)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return q.Get("token")
+		}
+	}
+	t.Fatalf("no login link in %q", msg.Text)
+	return ""
+}
+
+// magicLogin runs Auth.LoginWithMagicLink for c.
+func (c *client) magicLogin(a *Auth, tok string) (*user.User, error) {
+	var (
+		u   *user.User
+		err error
+	)
+	c.do(func(req *http.Request) { u, err = a.LoginWithMagicLink(req, tok) })
+	return u, err
+}
+
+func TestMagicLinkLogin(t *testing.T) {
+	a, users, box := newMagicLinkAuth(t)
+	ctx := context.Background()
+	alice := userWithEmail(t, users, "UID-ALICE", "alice@example.com", true)
+
+	// the address is normalized before the lookup
+	if err := a.SendMagicLink(ctx, " Alice@Example.com "); err != nil {
+		t.Fatal(err)
+	}
+	sent := box.take()
+	if len(sent) != 1 || sent[0].To != "alice@example.com" {
+		t.Fatalf("sent = %+v, want one mail to alice", sent)
+	}
+	tok := linkToken(t, sent[0])
+
+	// the confirmation page does not use the link up
+	if u, err := a.MagicLinkUser(ctx, tok); err != nil || u.ID != alice.ID {
+		t.Fatalf("MagicLinkUser = %v, %v", u, err)
+	}
+
+	c := newClient(t, "192.0.2.1")
+	if u, err := c.magicLogin(a, tok); err != nil || u.ID != alice.ID {
+		t.Fatalf("LoginWithMagicLink = %v, %v", u, err)
+	}
+	if u, ok := c.currentUser(a); !ok || u.ID != alice.ID {
+		t.Fatal("not logged in by the link")
+	}
+
+	// used once, even from another browser
+	if _, err := newClient(t, "192.0.2.1").magicLogin(a, tok); !errors.Is(err, user.ErrTokenUsed) {
+		t.Errorf("second use: LoginWithMagicLink = %v, want ErrTokenUsed", err)
+	}
+}
+
+func TestMagicLinkRejects(t *testing.T) {
+	a, users, box := newMagicLinkAuth(t)
+	ctx := context.Background()
+	alice := userWithEmail(t, users, "UID-ALICE", "alice@example.com", true)
+
+	if err := a.SendMagicLink(ctx, "alice@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	valid := linkToken(t, box.take()[0])
+
+	claims := magicLinkClaims{UserID: alice.ID, Email: alice.Email, Version: alice.SessionVersion, Nonce: "n"}
+	expired, err := a.signer.Sign(tokenPurposeMagicLink, claims, -time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherPurpose, err := a.signer.Sign(tokenPurposeVerifyEmail, claims, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherSecret, err := token.NewSigner("another-secret-0123456789abc").Sign(tokenPurposeMagicLink, claims, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payload, sig, _ := strings.Cut(valid, ".")
+	tests := []struct {
+		name string
+		tok  string
+		want error
+	}{
+		{"expired", expired, token.ErrExpired},
+		{"tampered signature", payload + "." + strings.ToUpper(sig), token.ErrInvalid},
+		{"tampered payload", "x" + valid, token.ErrInvalid},
+		{"signature missing", payload, token.ErrInvalid},
+		{"other purpose", otherPurpose, token.ErrInvalid},
+		{"other secret", otherSecret, token.ErrInvalid},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newClient(t, "192.0.2.1")
+			if _, err := c.magicLogin(a, tt.tok); !errors.Is(err, tt.want) {
+				t.Fatalf("LoginWithMagicLink = %v, want %v", err, tt.want)
+			}
+			if _, ok := c.currentUser(a); ok {
+				t.Error("logged in")
+			}
+		})
+	}
+
+	// "log out everywhere" invalidates open links
+	if _, err := users.RevokeSessions(ctx, alice.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newClient(t, "192.0.2.1").magicLogin(a, valid); !errors.Is(err, token.ErrInvalid) {
+		t.Errorf("after a new session version: LoginWithMagicLink = %v, want ErrInvalid", err)
+	}
+}
+
+func TestMagicLinkUnknownEmail(t *testing.T) {
+	a, users, box := newMagicLinkAuth(t)
+	ctx := context.Background()
+	userWithEmail(t, users, "UID-ALICE", "alice@example.com", true)
+	userWithEmail(t, users, "UID-BOB", "bob@example.com", false)
+
+	// same answer for every valid address, but only alice gets a mail
+	for _, email := range []string{"alice@example.com", "nobody@example.com", "bob@example.com"} {
+		if err := a.SendMagicLink(ctx, email); err != nil {
+			t.Errorf("SendMagicLink(%s) = %v, want nil", email, err)
+		}
+	}
+	if sent := box.take(); len(sent) != 1 || sent[0].To != "alice@example.com" {
+		t.Errorf("sent = %+v, want only the mail to alice", sent)
+	}
+
+	// only a malformed address is reported
+	if err := a.SendMagicLink(ctx, "not an address"); err == nil {
+		t.Error("SendMagicLink(malformed) = nil, want an error")
+	}
+}
+
+// loginTokenSpy records the expiry UseLoginToken is called with.
+type loginTokenSpy struct {
+	user.Store
+	expires time.Time
+}
+
+func (s *loginTokenSpy) UseLoginToken(ctx context.Context, userID int64, nonce string, expires time.Time) error {
+	s.expires = expires
+	return s.Store.UseLoginToken(ctx, userID, nonce, expires)
+}
+
+func TestMagicLinkNonceKeptUntilExpiry(t *testing.T) {
+	a, users, box := newMagicLinkAuth(t)
+	ctx := context.Background()
+	userWithEmail(t, users, "UID-ALICE", "alice@example.com", true)
+
+	spy := &loginTokenSpy{Store: users}
+	a.users = spy
+
+	if err := a.SendMagicLink(ctx, "alice@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	tok := linkToken(t, box.take()[0])
+
+	expires, err := a.signer.VerifyExpires(tokenPurposeMagicLink, tok, &magicLinkClaims{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Until(expires); d <= 0 || d > a.magicLinkTTL {
+		t.Fatalf("link expires in %s, want at most %s", d, a.magicLinkTTL)
+	}
+
+	if _, err := newClient(t, "192.0.2.1").magicLogin(a, tok); err != nil {
+		t.Fatal(err)
+	}
+
+	// the nonce is remembered as long as the link verifies, not a full
+	// TTL from its use
+	if !spy.expires.Equal(expires) {
+		t.Errorf("nonce kept until %s, want %s (expiry of the link)", spy.expires, expires)
+	}
+}
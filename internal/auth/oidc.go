@@ -0,0 +1,570 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/casbin/casbin/v2"
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+
+	"github.com/axelrhd/hagg/internal/config"
+	"github.com/axelrhd/hagg/internal/session"
+	"github.com/axelrhd/hagg/internal/store"
+	"github.com/axelrhd/hagg/internal/user"
+)
+
+var (
+	ErrOIDCDisabled  = errors.New("Anmeldung per SSO ist nicht aktiviert")
+	ErrOIDCExpired   = errors.New("Anmeldung abgelaufen, bitte erneut versuchen")
+	ErrOIDCCancelled = errors.New("Anmeldung beim Identity Provider abgebrochen")
+	ErrOIDCFailed    = errors.New("Anmeldung per SSO fehlgeschlagen")
+	ErrOIDCNoAccount = errors.New("Für dieses Konto gibt es keinen Zugang")
+)
+
+// Routes of the SSO login (see routes.go). Register BaseURL +
+// OIDCCallbackPath as redirect URI at the identity provider.
+const (
+	OIDCLoginPath    = "/auth/oidc/login"
+	OIDCCallbackPath = "/auth/oidc/callback"
+)
+
+// SessionKeyOIDCLogin holds the state of a running SSO login (oidcFlow as
+// JSON). The callback removes it: every state is answered at most once.
+const SessionKeyOIDCLogin = "oidc_login"
+
+const (
+	// oidcFlowTTL is how long the user may take at the identity provider.
+	oidcFlowTTL = 10 * time.Minute
+
+	// oidcTimeout limits every request to the identity provider.
+	oidcTimeout = 10 * time.Second
+)
+
+// OIDC logs users in through an external OpenID Connect provider
+// (authorization code flow with PKCE). Unknown accounts are provisioned
+// just in time or, with OIDC_LINK_BY_EMAIL, linked to the user with the
+// same verified email; mapped groups become Casbin roles (in memory, see
+// syncRoles).
+//
+// A nil *OIDC is valid and means SSO is disabled.
+type OIDC struct {
+	cfg         config.OIDCConfig
+	redirectURL string
+	auth        *Auth
+	stores      store.Manager
+	enforcer    *casbin.Enforcer
+
+	// discovered lazily: the app must start while the provider is down
+	mu       sync.Mutex
+	provider *oidc.Provider
+	verifier *oidc.IDTokenVerifier
+
+	// role assignments of policy.csv, never removed by the role mapping
+	rolesMu     sync.Mutex
+	staticRoles map[[2]string]bool
+}
+
+// NewOIDC returns the SSO login for cfg.OIDC, nil if it is disabled. The
+// stored SSO roles of all users are assigned in enforcer.
+func NewOIDC(ctx context.Context, cfg *config.Config, a *Auth, stores store.Manager, enforcer *casbin.Enforcer) (*OIDC, error) {
+	if !cfg.OIDC.Enabled() {
+		return nil, nil
+	}
+
+	o := &OIDC{
+		cfg:         cfg.OIDC,
+		redirectURL: strings.TrimSuffix(cfg.BaseURL(), "/") + OIDCCallbackPath,
+		auth:        a,
+		stores:      stores,
+		enforcer:    enforcer,
+		staticRoles: make(map[[2]string]bool),
+	}
+
+	rules, err := enforcer.GetGroupingPolicy()
+	if err != nil {
+		return nil, err
+	}
+	for _, rule := range rules {
+		if len(rule) >= 2 {
+			o.staticRoles[[2]string{rule[0], rule[1]}] = true
+		}
+	}
+
+	for group, role := range o.cfg.RoleMap {
+		if perms, err := enforcer.GetFilteredPolicy(0, role); err == nil && len(perms) == 0 {
+			slog.Warn("oidc: mapped role has no permissions", "group", group, "role", role)
+		}
+	}
+
+	identities, err := stores.Stores().Users.ListIdentities(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("load sso roles: %w", err)
+	}
+	for _, id := range identities {
+		if id.Issuer == o.cfg.Issuer {
+			o.applyRoles(user.User{ID: id.UserID}.Subject(), nil, id.Roles)
+		}
+	}
+
+	return o, nil
+}
+
+// Enabled reports whether SSO login is configured (OIDC_ISSUER).
+func (o *OIDC) Enabled() bool {
+	return o != nil
+}
+
+// ButtonLabel is the text of the login button (OIDC_BUTTON_LABEL).
+func (o *OIDC) ButtonLabel() string {
+	return o.cfg.ButtonLabel
+}
+
+// -----------------------------------------------------------------------------
+// Flow
+// -----------------------------------------------------------------------------
+
+// oidcFlow is the session state between Start and Callback.
+type oidcFlow struct {
+	State    string    `json:"state"`
+	Nonce    string    `json:"nonce"`
+	Verifier string    `json:"verifier"` // PKCE code verifier
+	Expires  time.Time `json:"expires"`
+}
+
+// Start begins a login and returns the URL of the identity provider to
+// redirect the browser to.
+func (o *OIDC) Start(req *http.Request) (string, error) {
+	if !o.Enabled() {
+		return "", ErrOIDCDisabled
+	}
+
+	ctx := req.Context()
+
+	oauth, _, err := o.client(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	state, err := randomString()
+	if err != nil {
+		return "", err
+	}
+	nonce, err := randomString()
+	if err != nil {
+		return "", err
+	}
+
+	flow := oidcFlow{
+		State:    state,
+		Nonce:    nonce,
+		Verifier: oauth2.GenerateVerifier(),
+		Expires:  time.Now().Add(oidcFlowTTL),
+	}
+	data, err := json.Marshal(flow)
+	if err != nil {
+		return "", err
+	}
+	session.Manager.Put(ctx, SessionKeyOIDCLogin, string(data))
+
+	return oauth.AuthCodeURL(state,
+		oauth2.S256ChallengeOption(flow.Verifier),
+		oidc.Nonce(nonce),
+	), nil
+}
+
+// oidcClaims are the ID token claims used for linking and provisioning.
+type oidcClaims struct {
+	Subject           string `json:"sub"`
+	Email             string `json:"email"`
+	EmailVerified     bool   `json:"email_verified"`
+	PreferredUsername string `json:"preferred_username"`
+	GivenName         string `json:"given_name"`
+	FamilyName        string `json:"family_name"`
+
+	groups []string // OIDC_GROUPS_CLAIM
+}
+
+// Callback completes a login started by Start: it checks the answer of
+// the identity provider, finds or provisions the user, syncs the mapped
+// roles and logs the user in like Login (ErrTOTPRequired and
+// ErrTOTPEnrollRequired leave a pending login, the local second factor
+// still applies).
+//
+// Errors for the user are ErrOIDC*, ErrOIDCFailed hides the details
+// (logged).
+func (o *OIDC) Callback(req *http.Request) (*user.User, error) {
+	if !o.Enabled() {
+		return nil, ErrOIDCDisabled
+	}
+
+	ctx := req.Context()
+	q := req.URL.Query()
+
+	flow, err := takeOIDCFlow(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare([]byte(q.Get("state")), []byte(flow.State)) != 1 {
+		return nil, ErrOIDCExpired
+	}
+
+	// e.g. access_denied: the user cancelled or may not use this client
+	if e := q.Get("error"); e != "" {
+		slog.InfoContext(ctx, "oidc login cancelled", "error", e, "description", q.Get("error_description"))
+		return nil, ErrOIDCCancelled
+	}
+
+	claims, err := o.exchange(ctx, q.Get("code"), flow)
+	if err != nil {
+		o.auth.recordLogin(req, 0, ErrOIDCFailed)
+		slog.InfoContext(ctx, "oidc login failed", "err", err)
+		return nil, ErrOIDCFailed
+	}
+
+	u, identity, err := o.resolve(ctx, claims)
+	if errors.Is(err, ErrOIDCNoAccount) {
+		o.auth.recordLogin(req, 0, err)
+		slog.InfoContext(ctx, "oidc login refused", "subject", claims.Subject, "reason", "no account")
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := o.syncRoles(ctx, u, identity, claims.groups); err != nil {
+		return nil, err
+	}
+
+	return o.auth.signIn(req, u)
+}
+
+// exchange redeems the authorization code and verifies the ID token.
+func (o *OIDC) exchange(ctx context.Context, code string, flow *oidcFlow) (*oidcClaims, error) {
+	if code == "" {
+		return nil, errors.New("no authorization code")
+	}
+
+	oauth, verifier, err := o.client(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, oidcTimeout)
+	defer cancel()
+
+	tok, err := oauth.Exchange(ctx, code, oauth2.VerifierOption(flow.Verifier))
+	if err != nil {
+		return nil, fmt.Errorf("exchange code: %w", err)
+	}
+
+	raw, ok := tok.Extra("id_token").(string)
+	if !ok {
+		return nil, errors.New("no id_token in token response")
+	}
+
+	idToken, err := verifier.Verify(ctx, raw)
+	if err != nil {
+		return nil, fmt.Errorf("verify id_token: %w", err)
+	}
+	if subtle.ConstantTimeCompare([]byte(idToken.Nonce), []byte(flow.Nonce)) != 1 {
+		return nil, errors.New("id_token nonce mismatch")
+	}
+
+	var claims oidcClaims
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("decode claims: %w", err)
+	}
+	if claims.Subject == "" {
+		return nil, errors.New("id_token without sub")
+	}
+
+	if o.cfg.GroupsClaim != "" {
+		var all map[string]any
+		if err := idToken.Claims(&all); err != nil {
+			return nil, fmt.Errorf("decode claims: %w", err)
+		}
+		claims.groups = stringList(all[o.cfg.GroupsClaim])
+	}
+
+	return &claims, nil
+}
+
+// client returns the OAuth2 client and the ID token verifier. The
+// provider is discovered on first use and again after a failure.
+func (o *OIDC) client(ctx context.Context) (*oauth2.Config, *oidc.IDTokenVerifier, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.provider == nil {
+		ctx, cancel := context.WithTimeout(ctx, oidcTimeout)
+		defer cancel()
+
+		provider, err := oidc.NewProvider(ctx, o.cfg.Issuer)
+		if err != nil {
+			slog.WarnContext(ctx, "oidc discovery failed", "issuer", o.cfg.Issuer, "err", err)
+			return nil, nil, ErrOIDCFailed
+		}
+		o.provider = provider
+		o.verifier = provider.Verifier(&oidc.Config{ClientID: o.cfg.ClientID})
+	}
+
+	return &oauth2.Config{
+		ClientID:     o.cfg.ClientID,
+		ClientSecret: o.cfg.ClientSecret,
+		Endpoint:     o.provider.Endpoint(),
+		RedirectURL:  o.redirectURL,
+		Scopes:       o.cfg.Scopes,
+	}, o.verifier, nil
+}
+
+func takeOIDCFlow(ctx context.Context) (*oidcFlow, error) {
+	data := session.Manager.PopString(ctx, SessionKeyOIDCLogin)
+	if data == "" {
+		return nil, ErrOIDCExpired
+	}
+
+	var flow oidcFlow
+	if err := json.Unmarshal([]byte(data), &flow); err != nil {
+		return nil, err
+	}
+	if time.Now().After(flow.Expires) {
+		return nil, ErrOIDCExpired
+	}
+
+	return &flow, nil
+}
+
+// -----------------------------------------------------------------------------
+// Users
+// -----------------------------------------------------------------------------
+
+// resolve returns the user linked to the account, links the user with the
+// same verified email (OIDC_LINK_BY_EMAIL) or provisions a new one.
+func (o *OIDC) resolve(ctx context.Context, claims *oidcClaims) (*user.User, *user.Identity, error) {
+	users := o.stores.Stores().Users
+
+	identity, err := users.Identity(ctx, o.cfg.Issuer, claims.Subject)
+	if err == nil {
+		u, err := users.FindByID(ctx, identity.UserID)
+		if errors.Is(err, user.ErrNotFound) {
+			// deleted since the identity lookup (e.g. hagg user delete)
+			return nil, nil, ErrOIDCNoAccount
+		}
+		return u, identity, err
+	}
+	if !errors.Is(err, user.ErrIdentityNotFound) {
+		return nil, nil, err
+	}
+
+	// the provider's address only counts if it verified it
+	email := ""
+	if claims.EmailVerified {
+		if e, err := user.NormalizeEmail(claims.Email); err == nil {
+			email = e
+		}
+	}
+
+	var u *user.User
+	err = o.stores.WithTx(ctx, func(tx store.Stores) error {
+		var err error
+		u, err = o.linkOrProvision(ctx, tx.Users, claims, email)
+		if err != nil {
+			return err
+		}
+
+		identity, err = tx.Users.LinkIdentity(ctx, user.Identity{
+			UserID:  u.ID,
+			Issuer:  o.cfg.Issuer,
+			Subject: claims.Subject,
+		})
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return u, identity, nil
+}
+
+// linkOrProvision returns the local user for a new account. A local user
+// with the same verified email is taken over only with OIDC_LINK_BY_EMAIL:
+// the provider's claim is all that proves the address, and a provider
+// that lets users enter any address would hand out local accounts –
+// admins included.
+func (o *OIDC) linkOrProvision(ctx context.Context, users user.Store, claims *oidcClaims, email string) (*user.User, error) {
+	if email != "" {
+		u, err := users.FindByEmail(ctx, email)
+		switch {
+		case err == nil && u.HasVerifiedEmail() && o.cfg.LinkByEmail:
+			slog.InfoContext(ctx, "oidc account linked", "user_id", u.ID, "subject", claims.Subject)
+			return u, nil
+		case err == nil && u.HasVerifiedEmail():
+			// neither link nor a second user with the same address
+			slog.InfoContext(ctx, "oidc account not linked", "user_id", u.ID, "subject", claims.Subject,
+				"reason", "email of a local user (OIDC_LINK_BY_EMAIL=false)")
+			return nil, ErrOIDCNoAccount
+		case err == nil:
+			// an unverified local address proves nothing – and stays taken
+			email = ""
+		case !errors.Is(err, user.ErrNotFound):
+			return nil, err
+		}
+	}
+
+	if !o.cfg.Provision {
+		return nil, ErrOIDCNoAccount
+	}
+
+	// the UID is never shown: SSO users log in through the provider
+	// (hagg user rotate-uid hands out one if needed)
+	uid, err := user.GenerateUID()
+	if err != nil {
+		return nil, err
+	}
+
+	name, err := uniqueDisplayName(ctx, users, displayNameFor(claims, email))
+	if err != nil {
+		return nil, err
+	}
+
+	u, err := users.CreateUser(ctx, user.CreateUserInput{
+		UID:         uid,
+		DisplayName: name,
+		FirstName:   strings.TrimSpace(claims.GivenName),
+		LastName:    strings.TrimSpace(claims.FamilyName),
+		Email:       email,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if email != "" {
+		verified := user.At(time.Now())
+		u, err = users.UpdateUser(ctx, u.ID, user.UpdateUserInput{EmailVerified: &verified})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	slog.InfoContext(ctx, "oidc user provisioned", "user_id", u.ID, "display_name", u.DisplayName, "subject", claims.Subject)
+	return u, nil
+}
+
+// displayNameFor proposes a display name: preferred_username, the local
+// part of the email or a fixed fallback.
+func displayNameFor(claims *oidcClaims, email string) string {
+	if name := strings.TrimSpace(claims.PreferredUsername); name != "" {
+		return name
+	}
+	if local, _, ok := strings.Cut(email, "@"); ok && local != "" {
+		return local
+	}
+	return "sso-user"
+}
+
+// maxNameSuffix limits the tries for a free display name (name-2, name-3, ...).
+const maxNameSuffix = 100
+
+func uniqueDisplayName(ctx context.Context, users user.Store, base string) (string, error) {
+	name := base
+	for n := 2; n <= maxNameSuffix; n++ {
+		_, err := users.FindByDisplayName(ctx, name)
+		if errors.Is(err, user.ErrNotFound) {
+			return name, nil
+		}
+		if err != nil {
+			return "", err
+		}
+		name = fmt.Sprintf("%s-%d", base, n)
+	}
+	return "", fmt.Errorf("no free display name for %q", base)
+}
+
+// -----------------------------------------------------------------------------
+// Roles
+// -----------------------------------------------------------------------------
+
+// syncRoles maps the groups of the login to roles (OIDC_ROLE_MAP), stores
+// them with the identity and assigns them in the enforcer. Roles mapped at
+// the previous login but no longer now are removed again – roles from
+// policy.csv stay untouched.
+func (o *OIDC) syncRoles(ctx context.Context, u *user.User, identity *user.Identity, groups []string) error {
+	var mapped []string
+	for _, group := range groups {
+		if role, ok := o.cfg.RoleMap[group]; ok {
+			mapped = append(mapped, role)
+		}
+	}
+	roles := user.NewRoleList(mapped...)
+
+	if err := o.stores.Stores().Users.UseIdentity(ctx, identity.ID, roles); err != nil {
+		return err
+	}
+
+	o.applyRoles(u.Subject(), identity.Roles, roles)
+	return nil
+}
+
+// applyRoles replaces the SSO roles before of subject with after in the
+// enforcer (memory only: policy.csv is edited by hand and the CLI).
+func (o *OIDC) applyRoles(subject string, before, after user.RoleList) {
+	o.rolesMu.Lock()
+	defer o.rolesMu.Unlock()
+
+	for _, role := range before {
+		if slices.Contains(after, role) || o.staticRoles[[2]string{subject, role}] {
+			continue
+		}
+		if _, err := o.enforcer.DeleteRoleForUser(subject, role); err != nil {
+			slog.Warn("oidc: remove role failed", "subject", subject, "role", role, "err", err)
+		}
+	}
+
+	for _, role := range after {
+		if _, err := o.enforcer.AddRoleForUser(subject, role); err != nil {
+			slog.Warn("oidc: add role failed", "subject", subject, "role", role, "err", err)
+		}
+	}
+}
+
+// -----------------------------------------------------------------------------
+// Helper
+// -----------------------------------------------------------------------------
+
+// randomString returns 32 random bytes, base64url encoded (state, nonce).
+func randomString() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// stringList reads a groups claim: a JSON array of strings or one string.
+func stringList(v any) []string {
+	switch v := v.(type) {
+	case string:
+		return []string{v}
+	case []any:
+		list := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				list = append(list, s)
+			}
+		}
+		return list
+	}
+	return nil
+}
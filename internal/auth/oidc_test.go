@@ -0,0 +1,531 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/axelrhd/hagg/internal/config"
+	"github.com/axelrhd/hagg/internal/store"
+	"github.com/axelrhd/hagg/internal/user"
+	"github.com/casbin/casbin/v2"
+)
+
+const testClientID = "hagg"
+
+// -----------------------------------------------------------------------------
+// Identity provider
+// -----------------------------------------------------------------------------
+
+// idp is an OpenID Connect provider on httptest: discovery, JWKS and a
+// token endpoint that checks PKCE. The authorization endpoint is skipped,
+// authorize plays the user who signs in.
+type idp struct {
+	t   *testing.T
+	srv *httptest.Server
+	key *rsa.PrivateKey
+
+	mu     sync.Mutex
+	grants map[string]grant // by authorization code
+}
+
+// grant is what the provider remembers about an authorization code.
+type grant struct {
+	challenge string // PKCE S256 code challenge
+	nonce     string
+	claims    map[string]any
+}
+
+func newIDP(t *testing.T) *idp {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := &idp{t: t, key: key, grants: make(map[string]grant)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", p.discovery)
+	mux.HandleFunc("GET /jwks", p.jwks)
+	mux.HandleFunc("POST /token", p.token)
+	p.srv = httptest.NewServer(mux)
+	t.Cleanup(p.srv.Close)
+
+	return p
+}
+
+func (p *idp) issuer() string { return p.srv.URL }
+
+func (p *idp) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"issuer":                                p.issuer(),
+		"authorization_endpoint":                p.issuer() + "/authorize",
+		"token_endpoint":                        p.issuer() + "/token",
+		"jwks_uri":                              p.issuer() + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+	})
+}
+
+func (p *idp) jwks(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "test",
+			"alg": "RS256",
+			"use": "sig",
+			"n":   b64url.EncodeToString(p.key.N.Bytes()),
+			"e":   b64url.EncodeToString(big.NewInt(int64(p.key.E)).Bytes()),
+		}},
+	})
+}
+
+func (p *idp) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+
+	p.mu.Lock()
+	g, ok := p.grants[r.PostForm.Get("code")]
+	delete(p.grants, r.PostForm.Get("code"))
+	p.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !ok || b64url.EncodeToString(sum[:]) != g.challenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	claims := map[string]any{
+		"iss":   p.issuer(),
+		"aud":   testClientID,
+		"iat":   time.Now().Unix(),
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"nonce": g.nonce,
+	}
+	for k, v := range g.claims {
+		claims[k] = v
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"access_token": "access",
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     p.sign(claims),
+	})
+}
+
+// sign returns claims as RS256 JWT.
+func (p *idp) sign(claims map[string]any) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": "test", "typ": "JWT"})
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		p.t.Fatal(err)
+	}
+
+	signed := b64url.EncodeToString(header) + "." + b64url.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, p.key, crypto.SHA256, digest[:])
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	return signed + "." + b64url.EncodeToString(sig)
+}
+
+// authorize signs the user with claims in for the authorization request
+// authURL and returns state and code of the redirect back.
+func (p *idp) authorize(authURL string, claims map[string]any) (state, code string) {
+	p.t.Helper()
+
+	u, err := url.Parse(authURL)
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	q := u.Query()
+	if q.Get("client_id") != testClientID || q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" {
+		p.t.Fatalf("authorization request %s", authURL)
+	}
+
+	code, err = randomString()
+	if err != nil {
+		p.t.Fatal(err)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.grants[code] = grant{challenge: q.Get("code_challenge"), nonce: q.Get("nonce"), claims: claims}
+
+	return q.Get("state"), code
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// -----------------------------------------------------------------------------
+// Harness
+// -----------------------------------------------------------------------------
+
+type oidcTest struct {
+	p        *idp
+	o        *OIDC
+	a        *Auth
+	users    user.Store
+	enforcer *casbin.Enforcer
+}
+
+// newOIDCTest returns the SSO login against a fresh provider. policy.csv
+// assigns viewer to user:1; the groups /admins and /viewers map to admin
+// and viewer.
+func newOIDCTest(t *testing.T, edit func(cfg *config.OIDCConfig)) *oidcTest {
+	t.Helper()
+
+	p := newIDP(t)
+	a, users := newTestAuth(t, Options{})
+
+	policy := filepath.Join(t.TempDir(), "policy.csv")
+	err := os.WriteFile(policy, []byte(
+		"p, admin, user:create\n"+
+			"p, viewer, dashboard:view\n"+
+			"g, user:1, viewer\n",
+	), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	enforcer, err := casbin.NewEnforcer("../../model.conf", policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &config.Config{
+		Server: config.ServerConfig{PublicURL: "https://hagg.example.com"},
+		OIDC: config.OIDCConfig{
+			Issuer:      p.issuer(),
+			ClientID:    testClientID,
+			Scopes:      []string{"openid", "profile", "email"},
+			Provision:   true,
+			GroupsClaim: "groups",
+			RoleMap:     map[string]string{"/admins": "admin", "/viewers": "viewer"},
+		},
+	}
+	if edit != nil {
+		edit(&cfg.OIDC)
+	}
+
+	o, err := NewOIDC(context.Background(), cfg, a, store.NewMemory(users), enforcer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &oidcTest{p: p, o: o, a: a, users: users, enforcer: enforcer}
+}
+
+// start runs OIDC.Start for c and returns the authorization URL.
+func (tt *oidcTest) start(c *client) string {
+	var (
+		authURL string
+		err     error
+	)
+	c.do(func(req *http.Request) { authURL, err = tt.o.Start(req) })
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	return authURL
+}
+
+// callback runs OIDC.Callback for c with the query q.
+func (tt *oidcTest) callback(c *client, q url.Values) (*user.User, error) {
+	var (
+		u   *user.User
+		err error
+	)
+	c.get(OIDCCallbackPath+"?"+q.Encode(), func(req *http.Request) { u, err = tt.o.Callback(req) })
+	return u, err
+}
+
+// login signs in at the provider with claims and completes the login.
+func (tt *oidcTest) login(c *client, claims map[string]any) (*user.User, error) {
+	state, code := tt.p.authorize(tt.start(c), claims)
+	return tt.callback(c, url.Values{"state": {state}, "code": {code}})
+}
+
+func (tt *oidcTest) hasRole(u *user.User, role string) bool {
+	ok, err := tt.enforcer.HasRoleForUser(u.Subject(), role)
+	if err != nil {
+		panic(err)
+	}
+	return ok
+}
+
+func alice() map[string]any {
+	return map[string]any{
+		"sub":                "sub-alice",
+		"email":              "Alice@Example.com",
+		"email_verified":     true,
+		"preferred_username": "alice",
+		"given_name":         "Alice",
+		"family_name":        "Liddell",
+	}
+}
+
+// -----------------------------------------------------------------------------
+// Tests
+// -----------------------------------------------------------------------------
+
+func TestOIDCProvisioning(t *testing.T) {
+	tt := newOIDCTest(t, nil)
+	ctx := context.Background()
+
+	claims := alice()
+	claims["groups"] = []string{"/admins", "/viewers", "/unmapped"}
+
+	c := newClient(t, "192.0.2.1")
+	u, err := tt.login(c, claims)
+	if err != nil {
+		t.Fatalf("Callback = %v", err)
+	}
+	if got, ok := c.currentUser(tt.a); !ok || got.ID != u.ID {
+		t.Fatal("not logged in")
+	}
+
+	// just in time: names and the verified address from the claims
+	if u.DisplayName != "alice" || u.FirstName != "Alice" || u.LastName != "Liddell" ||
+		u.Email != "alice@example.com" || !u.HasVerifiedEmail() {
+		t.Errorf("provisioned user = %+v", u)
+	}
+	identity, err := tt.users.Identity(ctx, tt.p.issuer(), "sub-alice")
+	if err != nil || identity.UserID != u.ID {
+		t.Fatalf("identity = %+v, %v", identity, err)
+	}
+
+	// mapped groups become roles, unmapped ones are ignored
+	if !tt.hasRole(u, "admin") || !tt.hasRole(u, "viewer") {
+		t.Error("mapped roles not assigned")
+	}
+
+	// next login: the same user, admin is gone, viewer stays (policy.csv)
+	claims["groups"] = []string{}
+	again, err := tt.login(newClient(t, "192.0.2.1"), claims)
+	if err != nil || again.ID != u.ID {
+		t.Fatalf("second login = %v, %v", again, err)
+	}
+	if tt.hasRole(u, "admin") || !tt.hasRole(u, "viewer") {
+		t.Errorf("roles after losing the groups: admin %t, viewer %t", tt.hasRole(u, "admin"), tt.hasRole(u, "viewer"))
+	}
+
+	// a second account with the same preferred_username gets a free name
+	bob := map[string]any{"sub": "sub-bob", "preferred_username": "alice"}
+	other, err := tt.login(newClient(t, "192.0.2.1"), bob)
+	if err != nil || other.DisplayName != "alice-2" || other.Email != "" {
+		t.Errorf("second account = %+v, %v", other, err)
+	}
+}
+
+func TestOIDCNoProvisioning(t *testing.T) {
+	tt := newOIDCTest(t, func(cfg *config.OIDCConfig) { cfg.Provision = false })
+
+	c := newClient(t, "192.0.2.1")
+	if _, err := tt.login(c, alice()); !errors.Is(err, ErrOIDCNoAccount) {
+		t.Fatalf("Callback = %v, want ErrOIDCNoAccount", err)
+	}
+	if _, ok := c.currentUser(tt.a); ok {
+		t.Error("logged in")
+	}
+	if _, err := tt.users.FindByEmail(context.Background(), "alice@example.com"); !errors.Is(err, user.ErrNotFound) {
+		t.Errorf("user created: %v", err)
+	}
+}
+
+// deletingStores deletes the user of an identity right after looking the
+// identity up, like an admin running "hagg user delete" at that moment.
+type deletingStores struct {
+	store.Manager
+}
+
+type deleteOnIdentity struct {
+	user.Store
+}
+
+func (m deletingStores) Stores() store.Stores {
+	s := m.Manager.Stores()
+	s.Users = deleteOnIdentity{s.Users}
+	return s
+}
+
+func (u deleteOnIdentity) Identity(ctx context.Context, issuer, subject string) (*user.Identity, error) {
+	identity, err := u.Store.Identity(ctx, issuer, subject)
+	if err == nil {
+		if err := u.Store.DeleteUser(ctx, identity.UserID); err != nil {
+			return nil, err
+		}
+	}
+	return identity, err
+}
+
+func TestOIDCDeletedUser(t *testing.T) {
+	tt := newOIDCTest(t, nil)
+	ctx := context.Background()
+
+	if _, err := tt.login(newClient(t, "192.0.2.1"), alice()); err != nil {
+		t.Fatal(err)
+	}
+
+	// the linked user is deleted between the identity and the user lookup:
+	// refused like a missing account, not an internal error
+	tt.o.stores = deletingStores{tt.o.stores}
+	c := newClient(t, "192.0.2.1")
+	if _, err := tt.login(c, alice()); !errors.Is(err, ErrOIDCNoAccount) {
+		t.Fatalf("Callback = %v, want ErrOIDCNoAccount", err)
+	}
+	if _, ok := c.currentUser(tt.a); ok {
+		t.Error("logged in")
+	}
+	if users, err := tt.users.ListUsers(ctx); err != nil || len(users) != 0 {
+		t.Errorf("ListUsers = %d users, %v, want none", len(users), err)
+	}
+}
+
+func TestOIDCStateMismatch(t *testing.T) {
+	tt := newOIDCTest(t, nil)
+
+	c := newClient(t, "192.0.2.1")
+	state, code := tt.p.authorize(tt.start(c), alice())
+	if _, err := tt.callback(c, url.Values{"state": {state + "x"}, "code": {code}}); !errors.Is(err, ErrOIDCExpired) {
+		t.Fatalf("wrong state: Callback = %v, want ErrOIDCExpired", err)
+	}
+	// the flow is used up by the failed attempt
+	if _, err := tt.callback(c, url.Values{"state": {state}, "code": {code}}); !errors.Is(err, ErrOIDCExpired) {
+		t.Errorf("right state afterwards: Callback = %v, want ErrOIDCExpired", err)
+	}
+
+	// the state of another browser
+	state, code = tt.p.authorize(tt.start(newClient(t, "192.0.2.1")), alice())
+	c = newClient(t, "192.0.2.1")
+	tt.start(c)
+	if _, err := tt.callback(c, url.Values{"state": {state}, "code": {code}}); !errors.Is(err, ErrOIDCExpired) {
+		t.Errorf("state of another session: Callback = %v, want ErrOIDCExpired", err)
+	}
+
+	// no login started at all
+	if _, err := tt.callback(newClient(t, "192.0.2.1"), url.Values{"state": {state}, "code": {code}}); !errors.Is(err, ErrOIDCExpired) {
+		t.Errorf("without Start: Callback = %v, want ErrOIDCExpired", err)
+	}
+
+	// the user cancelled at the provider
+	c = newClient(t, "192.0.2.1")
+	state, _ = tt.p.authorize(tt.start(c), alice())
+	if _, err := tt.callback(c, url.Values{"state": {state}, "error": {"access_denied"}}); !errors.Is(err, ErrOIDCCancelled) {
+		t.Errorf("access_denied: Callback = %v, want ErrOIDCCancelled", err)
+	}
+}
+
+func TestOIDCNonceMismatch(t *testing.T) {
+	tt := newOIDCTest(t, nil)
+
+	claims := alice()
+	claims["nonce"] = "replayed-id-token"
+
+	c := newClient(t, "192.0.2.1")
+	if _, err := tt.login(c, claims); !errors.Is(err, ErrOIDCFailed) {
+		t.Fatalf("Callback = %v, want ErrOIDCFailed", err)
+	}
+	if _, ok := c.currentUser(tt.a); ok {
+		t.Error("logged in")
+	}
+	if _, err := tt.users.Identity(context.Background(), tt.p.issuer(), "sub-alice"); !errors.Is(err, user.ErrIdentityNotFound) {
+		t.Errorf("identity linked: %v", err)
+	}
+}
+
+func TestOIDCPKCEMismatch(t *testing.T) {
+	tt := newOIDCTest(t, nil)
+
+	c := newClient(t, "192.0.2.1")
+	state, code := tt.p.authorize(tt.start(c), alice())
+
+	// the code was issued for another code challenge (an intercepted code
+	// redeemed with the attacker's own verifier looks the same)
+	tt.p.mu.Lock()
+	g := tt.p.grants[code]
+	sum := sha256.Sum256([]byte("another verifier"))
+	g.challenge = b64url.EncodeToString(sum[:])
+	tt.p.grants[code] = g
+	tt.p.mu.Unlock()
+
+	if _, err := tt.callback(c, url.Values{"state": {state}, "code": {code}}); !errors.Is(err, ErrOIDCFailed) {
+		t.Fatalf("Callback = %v, want ErrOIDCFailed", err)
+	}
+	if _, ok := c.currentUser(tt.a); ok {
+		t.Error("logged in")
+	}
+}
+
+func TestOIDCLinkByEmail(t *testing.T) {
+	ctx := context.Background()
+
+	// local admin with the address the provider claims
+	setup := func(t *testing.T, link bool) (*oidcTest, *user.User) {
+		tt := newOIDCTest(t, func(cfg *config.OIDCConfig) { cfg.LinkByEmail = link })
+		admin := userWithEmail(t, tt.users, "UID-ADMIN", "alice@example.com", true)
+		return tt, admin
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		tt, admin := setup(t, false)
+
+		c := newClient(t, "192.0.2.1")
+		if _, err := tt.login(c, alice()); !errors.Is(err, ErrOIDCNoAccount) {
+			t.Fatalf("Callback = %v, want ErrOIDCNoAccount", err)
+		}
+		if _, ok := c.currentUser(tt.a); ok {
+			t.Error("logged in as the local admin")
+		}
+		if ids, _ := tt.users.Identities(ctx, admin.ID); len(ids) != 0 {
+			t.Errorf("admin linked to %+v", ids)
+		}
+	})
+
+	t.Run("enabled", func(t *testing.T) {
+		tt, admin := setup(t, true)
+
+		u, err := tt.login(newClient(t, "192.0.2.1"), alice())
+		if err != nil || u.ID != admin.ID {
+			t.Fatalf("Callback = %v, %v; want the local admin", u, err)
+		}
+	})
+
+	t.Run("unverified at the provider", func(t *testing.T) {
+		tt, admin := setup(t, true)
+
+		claims := alice()
+		claims["email_verified"] = false
+		u, err := tt.login(newClient(t, "192.0.2.1"), claims)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// a new user without the address: it stays the admin's
+		if u.ID == admin.ID || u.Email != "" {
+			t.Errorf("user = %+v", u)
+		}
+	})
+}
@@ -0,0 +1,345 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/axelrhd/hagg/internal/config"
+	"github.com/axelrhd/hagg/internal/session"
+	"github.com/axelrhd/hagg/internal/user"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+var (
+	ErrPasskeysDisabled = errors.New("Passkeys sind nicht aktiviert")
+	ErrPasskeyFailed    = errors.New("Passkey konnte nicht bestätigt werden")
+	ErrPasskeyExpired   = errors.New("Vorgang abgelaufen, bitte erneut versuchen")
+	ErrPasskeyName      = fmt.Errorf("Name ist zu lang (höchstens %d Zeichen)", user.MaxPasskeyNameLength)
+)
+
+// Session keys of a running WebAuthn ceremony (webauthn.SessionData as
+// JSON). Each is used once: Finish* removes it.
+const (
+	SessionKeyPasskeyRegistration = "passkey_registration"
+	SessionKeyPasskeyLogin        = "passkey_login"
+)
+
+// passkeyTimeout is how long the browser (and the server) waits for the
+// authenticator.
+const passkeyTimeout = 5 * time.Minute
+
+// NewWebAuthn returns the relying party for AUTH_PASSKEYS, nil if passkeys
+// are disabled.
+func NewWebAuthn(cfg *config.Config) (*webauthn.WebAuthn, error) {
+	if !cfg.Auth.Passkeys {
+		return nil, nil
+	}
+
+	rpID, origin, err := cfg.PasskeyRP()
+	if err != nil {
+		return nil, err
+	}
+
+	timeout := webauthn.TimeoutConfig{
+		Enforce:    true,
+		Timeout:    passkeyTimeout,
+		TimeoutUVD: passkeyTimeout,
+	}
+
+	return webauthn.New(&webauthn.Config{
+		RPID:          rpID,
+		RPDisplayName: cfg.Auth.TOTPIssuer,
+		RPOrigins:     []string{origin},
+		Timeouts: webauthn.TimeoutsConfig{
+			Login:        timeout,
+			Registration: timeout,
+		},
+	})
+}
+
+// PasskeysEnabled reports whether passkeys can be used (AUTH_PASSKEYS).
+func (a *Auth) PasskeysEnabled() bool {
+	return a.webauthn != nil
+}
+
+// passkeyUser adapts a user and its passkeys to webauthn.User.
+type passkeyUser struct {
+	u     *user.User
+	creds []webauthn.Credential
+}
+
+// WebAuthnID is the user handle stored in the authenticator: the user ID
+// (never the UID, it is a secret).
+func (p *passkeyUser) WebAuthnID() []byte          { return userHandle(p.u.ID) }
+func (p *passkeyUser) WebAuthnName() string        { return p.u.DisplayName }
+func (p *passkeyUser) WebAuthnDisplayName() string { return p.u.FullName() }
+func (p *passkeyUser) WebAuthnCredentials() []webauthn.Credential {
+	return p.creds
+}
+
+func userHandle(id int64) []byte {
+	return binary.BigEndian.AppendUint64(nil, uint64(id))
+}
+
+func (a *Auth) passkeyUser(ctx context.Context, u *user.User) (*passkeyUser, error) {
+	passkeys, err := a.users.Passkeys(ctx, u.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	pu := &passkeyUser{u: u}
+	for _, p := range passkeys {
+		var cred webauthn.Credential
+		if err := json.Unmarshal([]byte(p.Credential), &cred); err != nil {
+			return nil, fmt.Errorf("passkey %d: %w", p.ID, err)
+		}
+		pu.creds = append(pu.creds, cred)
+	}
+
+	return pu, nil
+}
+
+// -----------------------------------------------------------------------------
+// Registration
+// -----------------------------------------------------------------------------
+
+// BeginPasskeyRegistration starts adding a passkey to the logged-in user u.
+// The result is passed to navigator.credentials.create() (static/js/passkey.js).
+func (a *Auth) BeginPasskeyRegistration(req *http.Request, u *user.User) (*protocol.CredentialCreation, error) {
+	if a.webauthn == nil {
+		return nil, ErrPasskeysDisabled
+	}
+
+	pu, err := a.passkeyUser(req.Context(), u)
+	if err != nil {
+		return nil, err
+	}
+
+	// discoverable (login without UID) and with PIN/biometrics (counts as
+	// both factors); an authenticator is only registered once
+	creation, sd, err := a.webauthn.BeginRegistration(pu,
+		webauthn.WithAuthenticatorSelection(protocol.AuthenticatorSelection{
+			RequireResidentKey: protocol.ResidentKeyRequired(),
+			ResidentKey:        protocol.ResidentKeyRequirementRequired,
+			UserVerification:   protocol.VerificationRequired,
+		}),
+		webauthn.WithExclusions(webauthn.Credentials(pu.creds).CredentialDescriptors()),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := putCeremony(req.Context(), SessionKeyPasskeyRegistration, sd); err != nil {
+		return nil, err
+	}
+
+	return creation, nil
+}
+
+// FinishPasskeyRegistration verifies the response of the authenticator
+// (JSON of the PublicKeyCredential) and stores the passkey as name.
+func (a *Auth) FinishPasskeyRegistration(req *http.Request, u *user.User, name string, response []byte) (*user.Passkey, error) {
+	ctx := req.Context()
+
+	if a.webauthn == nil {
+		return nil, ErrPasskeysDisabled
+	}
+
+	name = strings.TrimSpace(name)
+	if utf8.RuneCountInString(name) > user.MaxPasskeyNameLength {
+		return nil, ErrPasskeyName
+	}
+
+	sd, err := takeCeremony(ctx, SessionKeyPasskeyRegistration)
+	if err != nil {
+		return nil, err
+	}
+
+	pu, err := a.passkeyUser(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+	if name == "" {
+		name = fmt.Sprintf("Passkey %d", len(pu.creds)+1)
+	}
+
+	parsed, err := protocol.ParseCredentialCreationResponseBytes(response)
+	if err != nil {
+		return nil, passkeyError(ctx, "passkey registration", u.ID, err)
+	}
+	cred, err := a.webauthn.CreateCredential(pu, *sd, parsed)
+	if err != nil {
+		return nil, passkeyError(ctx, "passkey registration", u.ID, err)
+	}
+
+	data, err := json.Marshal(cred)
+	if err != nil {
+		return nil, err
+	}
+
+	return a.users.AddPasskey(ctx, user.Passkey{
+		UserID:       u.ID,
+		CredentialID: base64.RawURLEncoding.EncodeToString(cred.ID),
+		Name:         name,
+		Credential:   string(data),
+	})
+}
+
+// -----------------------------------------------------------------------------
+// Login
+// -----------------------------------------------------------------------------
+
+// BeginPasskeyLogin starts a login without UID: the browser offers all
+// passkeys of this site. The result is passed to navigator.credentials.get().
+func (a *Auth) BeginPasskeyLogin(req *http.Request) (*protocol.CredentialAssertion, error) {
+	if a.webauthn == nil {
+		return nil, ErrPasskeysDisabled
+	}
+
+	assertion, sd, err := a.webauthn.BeginDiscoverableLogin(
+		webauthn.WithUserVerification(protocol.VerificationRequired),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := putCeremony(req.Context(), SessionKeyPasskeyLogin, sd); err != nil {
+		return nil, err
+	}
+
+	return assertion, nil
+}
+
+// FinishPasskeyLogin verifies the response of the authenticator and logs
+// the owner of the passkey in. The passkey was unlocked with PIN or
+// biometrics, so no second factor is asked for.
+func (a *Auth) FinishPasskeyLogin(req *http.Request, response []byte) (*user.User, error) {
+	ctx := req.Context()
+
+	if a.webauthn == nil {
+		return nil, ErrPasskeysDisabled
+	}
+
+	sd, err := takeCeremony(ctx, SessionKeyPasskeyLogin)
+	if err != nil {
+		return nil, err
+	}
+
+	parsed, err := protocol.ParseCredentialRequestResponseBytes(response)
+	if err != nil {
+		a.recordLogin(req, 0, ErrPasskeyFailed)
+		return nil, passkeyError(ctx, "passkey login", 0, err)
+	}
+
+	var passkey *user.Passkey
+	var owner *user.User
+
+	// looks up the passkey; the library checks the user handle against it
+	lookup := func(rawID, handle []byte) (webauthn.User, error) {
+		p, err := a.users.PasskeyByCredentialID(ctx, base64.RawURLEncoding.EncodeToString(rawID))
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(handle, userHandle(p.UserID)) {
+			return nil, errors.New("user handle does not match the passkey")
+		}
+
+		u, err := a.users.FindByID(ctx, p.UserID)
+		if err != nil {
+			return nil, err
+		}
+
+		passkey, owner = p, u
+		return a.passkeyUser(ctx, u)
+	}
+
+	_, cred, err := a.webauthn.ValidatePasskeyLogin(lookup, *sd, parsed)
+	if err == nil && cred.Authenticator.CloneWarning {
+		// the sign counter went backwards: the authenticator may be cloned
+		err = errors.New("sign counter did not increase (cloned authenticator?)")
+	}
+	if err != nil {
+		var id int64
+		if owner != nil {
+			id = owner.ID
+		}
+		a.recordLogin(req, id, ErrPasskeyFailed)
+		return nil, passkeyError(ctx, "passkey login", id, err)
+	}
+
+	// new sign counter and flags
+	data, err := json.Marshal(cred)
+	if err != nil {
+		return nil, err
+	}
+	if err := a.users.UsePasskey(ctx, passkey.ID, string(data)); err != nil {
+		return nil, err
+	}
+
+	if err := owner.CheckAccess(time.Now()); err != nil {
+		a.recordLogin(req, owner.ID, err)
+		return nil, err
+	}
+
+	if err := a.completeLogin(req, owner); err != nil {
+		return nil, err
+	}
+	return owner, nil
+}
+
+// -----------------------------------------------------------------------------
+// Ceremony state
+// -----------------------------------------------------------------------------
+
+func putCeremony(ctx context.Context, key string, sd *webauthn.SessionData) error {
+	data, err := json.Marshal(sd)
+	if err != nil {
+		return err
+	}
+	session.Manager.Put(ctx, key, string(data))
+	return nil
+}
+
+// takeCeremony returns and removes the ceremony state: every challenge is
+// answered at most once.
+func takeCeremony(ctx context.Context, key string) (*webauthn.SessionData, error) {
+	data := session.Manager.PopString(ctx, key)
+	if data == "" {
+		return nil, ErrPasskeyExpired
+	}
+
+	var sd webauthn.SessionData
+	if err := json.Unmarshal([]byte(data), &sd); err != nil {
+		return nil, err
+	}
+	if !sd.Expires.IsZero() && time.Now().After(sd.Expires) {
+		return nil, ErrPasskeyExpired
+	}
+
+	return &sd, nil
+}
+
+// passkeyError logs why a ceremony failed (the details help debugging, but
+// are not shown to the user) and returns ErrPasskeyFailed.
+func passkeyError(ctx context.Context, msg string, userID int64, err error) error {
+	attrs := []any{"user_id", userID, "err", err}
+
+	var perr *protocol.Error
+	if errors.As(err, &perr) && perr.DevInfo != "" {
+		attrs = append(attrs, "info", perr.DevInfo)
+	}
+
+	slog.InfoContext(ctx, msg+" failed", attrs...)
+	return ErrPasskeyFailed
+}
@@ -0,0 +1,387 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/axelrhd/hagg/internal/user"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+	"github.com/go-webauthn/webauthn/protocol/webauthncose"
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+const (
+	testRPID   = "localhost"
+	testOrigin = "http://localhost:8080"
+)
+
+var b64url = base64.RawURLEncoding
+
+// -----------------------------------------------------------------------------
+// Software authenticator
+// -----------------------------------------------------------------------------
+
+// authenticator is a passkey in software: one P-256 key, "none"
+// attestation, user verification always done.
+type authenticator struct {
+	t      *testing.T
+	key    *ecdsa.PrivateKey
+	id     []byte
+	handle []byte // user handle, set by create
+	count  uint32 // sign counter of the next answer
+}
+
+func newAuthenticator(t *testing.T) *authenticator {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := make([]byte, 16)
+	rand.Read(id)
+
+	return &authenticator{t: t, key: key, id: id, count: 1}
+}
+
+func (p *authenticator) clientData(typ string, challenge []byte) []byte {
+	data, _ := json.Marshal(map[string]string{
+		"type":      typ,
+		"challenge": b64url.EncodeToString(challenge),
+		"origin":    testOrigin,
+	})
+	return data
+}
+
+func (p *authenticator) authData(flags protocol.AuthenticatorFlags, attested []byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(testRPID))
+	data := append(rpIDHash[:], byte(flags))
+	data = binary.BigEndian.AppendUint32(data, p.count)
+	return append(data, attested...)
+}
+
+// create answers navigator.credentials.create() for challenge.
+func (p *authenticator) create(creation *protocol.CredentialCreation, challenge []byte) []byte {
+	p.t.Helper()
+
+	p.handle = creation.Response.User.ID.(protocol.URLEncodedBase64)
+	if challenge == nil {
+		challenge = creation.Response.Challenge
+	}
+
+	pub, err := webauthncbor.Marshal(webauthncose.EC2PublicKeyData{
+		PublicKeyData: webauthncose.PublicKeyData{
+			KeyType:   int64(webauthncose.EllipticKey),
+			Algorithm: int64(webauthncose.AlgES256),
+		},
+		Curve:  1, // P-256
+		XCoord: p.key.X.FillBytes(make([]byte, 32)),
+		YCoord: p.key.Y.FillBytes(make([]byte, 32)),
+	})
+	if err != nil {
+		p.t.Fatal(err)
+	}
+
+	attested := make([]byte, 16) // AAGUID
+	attested = binary.BigEndian.AppendUint16(attested, uint16(len(p.id)))
+	attested = append(attested, p.id...)
+	attested = append(attested, pub...)
+
+	object, err := webauthncbor.Marshal(map[string]any{
+		"fmt":      "none",
+		"attStmt":  map[string]any{},
+		"authData": p.authData(protocol.FlagUserPresent|protocol.FlagUserVerified|protocol.FlagAttestedCredentialData, attested),
+	})
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	p.count++
+
+	return p.response(map[string]string{
+		"clientDataJSON":    b64url.EncodeToString(p.clientData("webauthn.create", challenge)),
+		"attestationObject": b64url.EncodeToString(object),
+	})
+}
+
+// get answers navigator.credentials.get() for challenge as the owner of
+// handle.
+func (p *authenticator) get(assertion *protocol.CredentialAssertion, challenge, handle []byte) []byte {
+	p.t.Helper()
+
+	if challenge == nil {
+		challenge = assertion.Response.Challenge
+	}
+	if handle == nil {
+		handle = p.handle
+	}
+
+	clientData := p.clientData("webauthn.get", challenge)
+	authData := p.authData(protocol.FlagUserPresent|protocol.FlagUserVerified, nil)
+	clientHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(authData, clientHash[:]...))
+
+	sig, err := ecdsa.SignASN1(rand.Reader, p.key, digest[:])
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	p.count++
+
+	return p.response(map[string]string{
+		"clientDataJSON":    b64url.EncodeToString(clientData),
+		"authenticatorData": b64url.EncodeToString(authData),
+		"signature":         b64url.EncodeToString(sig),
+		"userHandle":        b64url.EncodeToString(handle),
+	})
+}
+
+func (p *authenticator) response(r map[string]string) []byte {
+	data, _ := json.Marshal(map[string]any{
+		"id":       b64url.EncodeToString(p.id),
+		"rawId":    b64url.EncodeToString(p.id),
+		"type":     "public-key",
+		"response": r,
+	})
+	return data
+}
+
+// -----------------------------------------------------------------------------
+// Harness
+// -----------------------------------------------------------------------------
+
+func newPasskeyAuth(t *testing.T) (*Auth, *user.User, user.Store) {
+	t.Helper()
+
+	wa, err := webauthn.New(&webauthn.Config{
+		RPID:          testRPID,
+		RPDisplayName: "hagg",
+		RPOrigins:     []string{testOrigin},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a, users := newTestAuth(t, Options{WebAuthn: wa})
+	return a, createUser(t, users, "UID-ALICE", "alice"), users
+}
+
+// register adds the passkey p to u and returns the stored passkey.
+func (c *client) register(a *Auth, u *user.User, p *authenticator) (*user.Passkey, error) {
+	var creation *protocol.CredentialCreation
+	c.do(func(req *http.Request) {
+		var err error
+		if creation, err = a.BeginPasskeyRegistration(req, u); err != nil {
+			c.t.Fatal(err)
+		}
+	})
+
+	var (
+		pk  *user.Passkey
+		err error
+	)
+	c.do(func(req *http.Request) { pk, err = a.FinishPasskeyRegistration(req, u, "", p.create(creation, nil)) })
+	return pk, err
+}
+
+// beginLogin runs Auth.BeginPasskeyLogin for c.
+func (c *client) beginLogin(a *Auth) *protocol.CredentialAssertion {
+	var assertion *protocol.CredentialAssertion
+	c.do(func(req *http.Request) {
+		var err error
+		if assertion, err = a.BeginPasskeyLogin(req); err != nil {
+			c.t.Fatal(err)
+		}
+	})
+	return assertion
+}
+
+// finishLogin runs Auth.FinishPasskeyLogin for c.
+func (c *client) finishLogin(a *Auth, response []byte) (*user.User, error) {
+	var (
+		u   *user.User
+		err error
+	)
+	c.do(func(req *http.Request) { u, err = a.FinishPasskeyLogin(req, response) })
+	return u, err
+}
+
+// -----------------------------------------------------------------------------
+// Tests
+// -----------------------------------------------------------------------------
+
+func TestPasskeyRegisterAndLogin(t *testing.T) {
+	a, alice, users := newPasskeyAuth(t)
+	p := newAuthenticator(t)
+
+	pk, err := newClient(t, "192.0.2.1").register(a, alice, p)
+	if err != nil {
+		t.Fatalf("FinishPasskeyRegistration = %v", err)
+	}
+	if pk.UserID != alice.ID || pk.CredentialID != b64url.EncodeToString(p.id) || pk.Name != "Passkey 1" {
+		t.Errorf("passkey = %+v", pk)
+	}
+
+	// the same authenticator is not offered a second time
+	c := newClient(t, "192.0.2.1")
+	c.do(func(req *http.Request) {
+		creation, err := a.BeginPasskeyRegistration(req, alice)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ex := creation.Response.CredentialExcludeList; len(ex) != 1 || string(ex[0].CredentialID) != string(p.id) {
+			t.Errorf("exclude list = %v", ex)
+		}
+	})
+
+	// login without UID, twice: the sign counter moves on
+	for i := range 2 {
+		c := newClient(t, "192.0.2.1")
+		u, err := c.finishLogin(a, p.get(c.beginLogin(a), nil, nil))
+		if err != nil || u.ID != alice.ID {
+			t.Fatalf("login #%d: FinishPasskeyLogin = %v, %v", i+1, u, err)
+		}
+		if got, ok := c.currentUser(a); !ok || got.ID != alice.ID {
+			t.Fatalf("login #%d: not logged in", i+1)
+		}
+	}
+
+	stored, err := users.PasskeyByCredentialID(context.Background(), pk.CredentialID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cred webauthn.Credential
+	if err := json.Unmarshal([]byte(stored.Credential), &cred); err != nil {
+		t.Fatal(err)
+	}
+	if cred.Authenticator.SignCount != 3 {
+		t.Errorf("stored sign count = %d, want 3", cred.Authenticator.SignCount)
+	}
+}
+
+func TestPasskeyChallengeMismatch(t *testing.T) {
+	a, alice, _ := newPasskeyAuth(t)
+	p := newAuthenticator(t)
+	other := []byte("another-challenge-0123456789abcd")
+
+	c := newClient(t, "192.0.2.1")
+	var creation *protocol.CredentialCreation
+	c.do(func(req *http.Request) { creation, _ = a.BeginPasskeyRegistration(req, alice) })
+	c.do(func(req *http.Request) {
+		if _, err := a.FinishPasskeyRegistration(req, alice, "", p.create(creation, other)); !errors.Is(err, ErrPasskeyFailed) {
+			t.Errorf("registration, other challenge: %v, want ErrPasskeyFailed", err)
+		}
+	})
+
+	// the challenge is used up, even by a failed attempt
+	c.do(func(req *http.Request) {
+		if _, err := a.FinishPasskeyRegistration(req, alice, "", p.create(creation, nil)); !errors.Is(err, ErrPasskeyExpired) {
+			t.Errorf("registration, second answer: %v, want ErrPasskeyExpired", err)
+		}
+	})
+
+	if _, err := newClient(t, "192.0.2.1").register(a, alice, p); err != nil {
+		t.Fatal(err)
+	}
+
+	c = newClient(t, "192.0.2.1")
+	assertion := c.beginLogin(a)
+	if _, err := c.finishLogin(a, p.get(assertion, other, nil)); !errors.Is(err, ErrPasskeyFailed) {
+		t.Errorf("login, other challenge: %v, want ErrPasskeyFailed", err)
+	}
+	if _, err := c.finishLogin(a, p.get(assertion, nil, nil)); !errors.Is(err, ErrPasskeyExpired) {
+		t.Errorf("login, second answer: %v, want ErrPasskeyExpired", err)
+	}
+
+	// the challenge of one browser does not work in another
+	response := p.get(newClient(t, "192.0.2.1").beginLogin(a), nil, nil)
+	c = newClient(t, "192.0.2.1")
+	c.beginLogin(a)
+	if _, err := c.finishLogin(a, response); !errors.Is(err, ErrPasskeyFailed) {
+		t.Errorf("login, challenge of another session: %v, want ErrPasskeyFailed", err)
+	}
+	if _, ok := c.currentUser(a); ok {
+		t.Error("logged in after failed passkey logins")
+	}
+}
+
+func TestPasskeyWrongUser(t *testing.T) {
+	a, alice, users := newPasskeyAuth(t)
+	bob := createUser(t, users, "UID-BOB", "bob")
+	p := newAuthenticator(t)
+
+	// registration begun for alice cannot be finished as bob
+	c := newClient(t, "192.0.2.1")
+	var creation *protocol.CredentialCreation
+	c.do(func(req *http.Request) { creation, _ = a.BeginPasskeyRegistration(req, alice) })
+	c.do(func(req *http.Request) {
+		if _, err := a.FinishPasskeyRegistration(req, bob, "", p.create(creation, nil)); !errors.Is(err, ErrPasskeyFailed) {
+			t.Errorf("registration as another user: %v, want ErrPasskeyFailed", err)
+		}
+	})
+	if pks, _ := users.Passkeys(context.Background(), bob.ID); len(pks) != 0 {
+		t.Errorf("bob has %d passkeys", len(pks))
+	}
+
+	// alice's passkey claiming to be bob's
+	if _, err := newClient(t, "192.0.2.1").register(a, alice, p); err != nil {
+		t.Fatal(err)
+	}
+	c = newClient(t, "192.0.2.1")
+	if _, err := c.finishLogin(a, p.get(c.beginLogin(a), nil, userHandle(bob.ID))); !errors.Is(err, ErrPasskeyFailed) {
+		t.Errorf("login with the user handle of bob: %v, want ErrPasskeyFailed", err)
+	}
+	if _, ok := c.currentUser(a); ok {
+		t.Error("logged in with another user handle")
+	}
+
+	// a passkey that is not registered
+	c = newClient(t, "192.0.2.1")
+	stranger := newAuthenticator(t)
+	stranger.handle = userHandle(alice.ID)
+	if _, err := c.finishLogin(a, stranger.get(c.beginLogin(a), nil, nil)); !errors.Is(err, ErrPasskeyFailed) {
+		t.Errorf("login with an unknown passkey: %v, want ErrPasskeyFailed", err)
+	}
+}
+
+func TestPasskeySignCountRegression(t *testing.T) {
+	a, alice, _ := newPasskeyAuth(t)
+	p := newAuthenticator(t)
+
+	if _, err := newClient(t, "192.0.2.1").register(a, alice, p); err != nil {
+		t.Fatal(err)
+	}
+
+	p.count = 5
+	c := newClient(t, "192.0.2.1")
+	if _, err := c.finishLogin(a, p.get(c.beginLogin(a), nil, nil)); err != nil {
+		t.Fatalf("login with counter 5: %v", err)
+	}
+
+	// a copy of the key with an older counter
+	for _, count := range []uint32{5, 3} {
+		p.count = count
+		c := newClient(t, "192.0.2.1")
+		if _, err := c.finishLogin(a, p.get(c.beginLogin(a), nil, nil)); !errors.Is(err, ErrPasskeyFailed) {
+			t.Errorf("login with counter %d after 5: %v, want ErrPasskeyFailed", count, err)
+		}
+		if _, ok := c.currentUser(a); ok {
+			t.Errorf("logged in with counter %d", count)
+		}
+	}
+
+	// the failed attempts did not lower the stored counter
+	p.count = 6
+	c = newClient(t, "192.0.2.1")
+	if _, err := c.finishLogin(a, p.get(c.beginLogin(a), nil, nil)); err != nil {
+		t.Errorf("login with counter 6: %v", err)
+	}
+}
@@ -0,0 +1,138 @@
+package auth
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/alexedwards/scs/v2"
+	"github.com/axelrhd/hagg/internal/session"
+	"github.com/axelrhd/hagg/internal/user"
+)
+
+// DeviceSession is a logged-in session of a user (see Sessions).
+type DeviceSession struct {
+	*user.Session
+	Current bool // the session of the request
+}
+
+// Sessions returns the logged-in sessions of u, newest first.
+func (a *Auth) Sessions(req *http.Request, u *user.User) ([]DeviceSession, error) {
+	sessions, err := a.users.Sessions(req.Context(), u.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	current := session.Manager.Token(req.Context())
+	devices := make([]DeviceSession, len(sessions))
+	for i, s := range sessions {
+		devices[i] = DeviceSession{Session: s, Current: s.Token == current}
+	}
+
+	return devices, nil
+}
+
+// LogoutEverywhere ends all sessions of u including the one of req and
+// returns the number of ended sessions.
+func (a *Auth) LogoutEverywhere(req *http.Request, u *user.User) (int, error) {
+	n, err := EndSessions(req.Context(), a.users, session.Manager.Store, u.ID)
+	if err != nil {
+		return 0, err
+	}
+	return n, session.Manager.Destroy(req.Context())
+}
+
+// EndSessions ends all sessions of user id: they are deleted from store
+// and the session version is bumped for sessions missing in the index
+// (e.g. logged in before it existed). Returns the number of deleted
+// sessions. Also used by `hagg session revoke`.
+func EndSessions(ctx context.Context, users user.Store, store scs.Store, id int64) (int, error) {
+	if _, err := users.RevokeSessions(ctx, id); err != nil {
+		return 0, err
+	}
+
+	tokens, err := users.RemoveSessions(ctx, id)
+	if err != nil {
+		return 0, err
+	}
+	for _, token := range tokens {
+		if err := store.Delete(token); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(tokens), nil
+}
+
+// endOtherSessions deletes the sessions of u except the one of ctx from
+// the session store and the index.
+func (a *Auth) endOtherSessions(ctx context.Context, u *user.User) error {
+	sessions, err := a.users.Sessions(ctx, u.ID)
+	if err != nil {
+		return err
+	}
+
+	current := session.Manager.Token(ctx)
+	for _, s := range sessions {
+		if s.Token == current {
+			continue
+		}
+		if err := a.users.RemoveSession(ctx, s.Token); err != nil {
+			return err
+		}
+		if err := session.Manager.Store.Delete(s.Token); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// renewToken gives the session of ctx a new token (session fixation: a
+// token planted before a login or privilege change becomes worthless).
+// The data stays, the index follows the token.
+func (a *Auth) renewToken(ctx context.Context) error {
+	old := session.Manager.Token(ctx)
+	if err := session.Manager.RenewToken(ctx); err != nil {
+		return err
+	}
+	if old == "" {
+		return nil // new session, not indexed yet
+	}
+
+	expires := time.Now().Add(session.Manager.Lifetime)
+	return a.users.RenewSession(ctx, old, session.Manager.Token(ctx), expires)
+}
+
+// trackSession indexes the logged-in session of req for u. Like
+// recordLogin it never blocks a login: a missing entry is still ended by
+// the session version.
+func (a *Auth) trackSession(req *http.Request, u *user.User) {
+	s := user.Session{
+		UserID:    u.ID,
+		Token:     session.Manager.Token(req.Context()),
+		IP:        ClientIP(req),
+		UserAgent: req.UserAgent(),
+	}
+	if len(s.UserAgent) > maxUserAgent {
+		s.UserAgent = strings.ToValidUTF8(s.UserAgent[:maxUserAgent], "")
+	}
+
+	expires := time.Now().Add(session.Manager.Lifetime)
+	if err := a.users.AddSession(req.Context(), s, expires); err != nil {
+		slog.WarnContext(req.Context(), "track session failed", "user_id", u.ID, "err", err)
+	}
+}
+
+// forgetSession removes the session of ctx from the index.
+func (a *Auth) forgetSession(ctx context.Context) {
+	token := session.Manager.Token(ctx)
+	if token == "" {
+		return
+	}
+	if err := a.users.RemoveSession(ctx, token); err != nil {
+		slog.WarnContext(ctx, "forget session failed", "err", err)
+	}
+}
@@ -0,0 +1,262 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/axelrhd/hagg/internal/config"
+	"github.com/axelrhd/hagg/internal/session"
+	"github.com/axelrhd/hagg/internal/user"
+)
+
+// planted returns a client with an anonymous session, e.g. a token an
+// attacker planted before the login.
+func planted(t *testing.T, ip string) *client {
+	t.Helper()
+
+	c := newClient(t, ip)
+	c.do(func(req *http.Request) { session.Manager.Put(req.Context(), "lang", "de") })
+	if c.token() == "" {
+		t.Fatal("no anonymous session")
+	}
+	return c
+}
+
+// withToken returns a client that sends the session token of c, as a
+// second browser holding a copy of the cookie.
+func withToken(c *client, token string) *client {
+	ck := *c.cookie
+	ck.Value = token
+	ck.MaxAge = 0
+	return &client{t: c.t, ip: c.ip, cookie: &ck}
+}
+
+// indexed returns the indexed session tokens of user id.
+func indexed(t *testing.T, users user.Store, id int64) []string {
+	t.Helper()
+
+	sessions, err := users.Sessions(context.Background(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokens := make([]string, len(sessions))
+	for i, s := range sessions {
+		tokens[i] = s.Token
+	}
+	return tokens
+}
+
+// stored reports if the session store still holds token.
+func stored(t *testing.T, token string) bool {
+	t.Helper()
+
+	_, found, err := session.Manager.Store.Find(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return found
+}
+
+// logoutEverywhere runs Auth.LogoutEverywhere for c.
+func (c *client) logoutEverywhere(a *Auth, u *user.User) int {
+	c.t.Helper()
+
+	var (
+		n   int
+		err error
+	)
+	c.do(func(req *http.Request) { n, err = a.LogoutEverywhere(req, u) })
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	return n
+}
+
+func TestLoginRenewsToken(t *testing.T) {
+	a, users := newTestAuth(t, Options{})
+	alice := createUser(t, users, "UID-ALICE", "alice")
+
+	c := planted(t, "192.0.2.1")
+	old := c.token()
+
+	if _, err := c.login(a, Credentials{UID: "UID-ALICE"}); err != nil {
+		t.Fatal(err)
+	}
+	if c.token() == "" || c.token() == old {
+		t.Fatalf("token after the login = %q, want a new one (was %q)", c.token(), old)
+	}
+	if _, ok := c.currentUser(a); !ok {
+		t.Fatal("not logged in under the new token")
+	}
+
+	// the planted token is worthless: gone from the store, not logged in
+	if stored(t, old) {
+		t.Error("old token still in the session store")
+	}
+	if _, ok := withToken(c, old).currentUser(a); ok {
+		t.Error("logged in with the old token")
+	}
+
+	// the index knows the new token only
+	if got := indexed(t, users, alice.ID); len(got) != 1 || got[0] != c.token() {
+		t.Errorf("indexed = %q, want [%q]", got, c.token())
+	}
+}
+
+func TestSecondFactorRenewsToken(t *testing.T) {
+	a, users := newTestAuth(t, Options{})
+	alice := createUser(t, users, "UID-ALICE", "alice")
+	secret := enrol(t, users, alice)
+
+	c := planted(t, "192.0.2.1")
+	anonymous := c.token()
+	if _, err := c.login(a, Credentials{UID: "UID-ALICE"}); !errors.Is(err, ErrTOTPRequired) {
+		t.Fatalf("Login = %v, want ErrTOTPRequired", err)
+	}
+	pending := c.token()
+	if pending == anonymous {
+		t.Fatal("pending login kept the anonymous token")
+	}
+
+	if _, err := c.verify(a, code(t, secret, 0)); err != nil {
+		t.Fatal(err)
+	}
+	if c.token() == pending || c.token() == anonymous {
+		t.Fatal("completed login kept an earlier token")
+	}
+
+	for _, old := range []string{anonymous, pending} {
+		if _, ok := withToken(c, old).currentUser(a); ok {
+			t.Errorf("logged in with the earlier token %q", old)
+		}
+	}
+	if got := indexed(t, users, alice.ID); len(got) != 1 || got[0] != c.token() {
+		t.Errorf("indexed = %q, want [%q]", got, c.token())
+	}
+}
+
+func TestLogout(t *testing.T) {
+	a, users := newTestAuth(t, Options{})
+	alice := createUser(t, users, "UID-ALICE", "alice")
+
+	c := newClient(t, "192.0.2.1")
+	if _, err := c.login(a, Credentials{UID: "UID-ALICE"}); err != nil {
+		t.Fatal(err)
+	}
+	token := c.token()
+
+	var err error
+	c.do(func(req *http.Request) { err = a.Logout(req) })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stored(t, token) {
+		t.Error("session still in the store after the logout")
+	}
+	if got := indexed(t, users, alice.ID); len(got) != 0 {
+		t.Errorf("indexed after the logout = %q, want none", got)
+	}
+	if _, ok := withToken(c, token).currentUser(a); ok {
+		t.Error("logged in with the token of the logout")
+	}
+}
+
+func TestLogoutEverywhere(t *testing.T) {
+	a, users := newTestAuth(t, Options{})
+	ctx := context.Background()
+	alice := createUser(t, users, "UID-ALICE", "alice")
+	createUser(t, users, "UID-BOB", "bob")
+
+	var devices []*client
+	for _, ip := range []string{"192.0.2.1", "192.0.2.2", "198.51.100.7"} {
+		c := newClient(t, ip)
+		if _, err := c.login(a, Credentials{UID: "UID-ALICE"}); err != nil {
+			t.Fatal(err)
+		}
+		devices = append(devices, c)
+	}
+	bob := newClient(t, "192.0.2.9")
+	if _, err := bob.login(a, Credentials{UID: "UID-BOB"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// a session missing in the index (logged in before it existed)
+	legacy := devices[2]
+	if err := users.RemoveSession(ctx, legacy.token()); err != nil {
+		t.Fatal(err)
+	}
+
+	tokens := []string{devices[0].token(), devices[1].token(), legacy.token()}
+	if n := devices[0].logoutEverywhere(a, alice); n != 2 {
+		t.Errorf("LogoutEverywhere = %d, want 2 indexed sessions", n)
+	}
+
+	if got := indexed(t, users, alice.ID); len(got) != 0 {
+		t.Errorf("indexed after LogoutEverywhere = %q, want none", got)
+	}
+	for i, token := range tokens[:2] {
+		if stored(t, token) {
+			t.Errorf("device #%d: session still in the store", i+1)
+		}
+	}
+	for i, token := range tokens {
+		if _, ok := withToken(devices[i], token).currentUser(a); ok {
+			t.Errorf("device #%d: still logged in", i+1)
+		}
+	}
+
+	// other users keep their sessions
+	if _, ok := bob.currentUser(a); !ok {
+		t.Error("bob logged out")
+	}
+}
+
+func TestChangePasswordEndsOtherSessions(t *testing.T) {
+	a, users := newTestAuth(t, Options{Mode: config.LoginModePassword})
+	ctx := context.Background()
+	alice := createUser(t, users, "UID-ALICE", "alice")
+	hash, err := user.HashPassword("Correct-Horse-7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := users.SetPassword(ctx, alice.ID, hash); err != nil {
+		t.Fatal(err)
+	}
+
+	cred := Credentials{UID: "UID-ALICE", Password: "Correct-Horse-7"}
+	current, other := newClient(t, "192.0.2.1"), newClient(t, "192.0.2.2")
+	for _, c := range []*client{current, other} {
+		if _, err := c.login(a, cred); err != nil {
+			t.Fatal(err)
+		}
+	}
+	old, otherToken := current.token(), other.token()
+
+	current.do(func(req *http.Request) {
+		err = a.ChangePassword(req, alice, "Correct-Horse-7", "Battery-Staple-42")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the changing session stays, under a new token
+	if current.token() == old {
+		t.Error("token kept after the password change")
+	}
+	if _, ok := current.currentUser(a); !ok {
+		t.Error("logged out by the own password change")
+	}
+	if got := indexed(t, users, alice.ID); len(got) != 1 || got[0] != current.token() {
+		t.Errorf("indexed = %q, want [%q]", got, current.token())
+	}
+
+	if stored(t, otherToken) {
+		t.Error("other session still in the store")
+	}
+	if _, ok := other.currentUser(a); ok {
+		t.Error("other session still logged in")
+	}
+}
@@ -0,0 +1,163 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/axelrhd/hagg/internal/config"
+	"github.com/axelrhd/hagg/internal/throttle"
+	storethrottlememory "github.com/axelrhd/hagg/internal/throttle/store_memory"
+	"github.com/axelrhd/hagg/internal/user"
+)
+
+// newThrottledAuth returns an Auth whose guard blocks from the third
+// failure on (per IP and account) for a minute.
+func newThrottledAuth(t *testing.T) (*Auth, user.Store, throttle.Store) {
+	t.Helper()
+
+	counters := storethrottlememory.New()
+	guard := throttle.NewGuard(counters,
+		throttle.Policy{Free: 2, BaseDelay: time.Minute, MaxDelay: time.Hour, Window: time.Hour},
+		throttle.Policy{Free: 1000, BaseDelay: time.Second, MaxDelay: time.Second, Window: time.Hour},
+		slog.New(slog.NewTextHandler(io.Discard, nil)),
+	)
+
+	a, users := newTestAuth(t, Options{Throttle: guard})
+	return a, users, counters
+}
+
+func failures(t *testing.T, counters throttle.Store, key string) int {
+	t.Helper()
+
+	c, err := counters.Counter(context.Background(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c.Failures
+}
+
+func TestThrottleWrongCodes(t *testing.T) {
+	a, users, counters := newThrottledAuth(t)
+	alice := createUser(t, users, "UID-ALICE", "alice")
+	secret := enrol(t, users, alice)
+
+	c := pendingLogin(t, a, "UID-ALICE")
+	for i := 1; i <= 2; i++ {
+		if _, err := c.verify(a, "000000"); !errors.Is(err, user.ErrInvalidCode) {
+			t.Fatalf("wrong code #%d: VerifyTOTP = %v, want ErrInvalidCode", i, err)
+		}
+	}
+	var blocked *throttle.BlockedError
+	if _, err := c.verify(a, "000000"); !errors.As(err, &blocked) || blocked.Global {
+		t.Fatalf("wrong code #3: VerifyTOTP = %v, want a block", err)
+	}
+
+	// counted for the client and the account
+	if n := failures(t, counters, throttle.IPKey("192.0.2.1")); n != 3 {
+		t.Errorf("ip failures = %d, want 3", n)
+	}
+	if n := failures(t, counters, throttle.UserKey(alice.ID)); n != 3 {
+		t.Errorf("account failures = %d, want 3", n)
+	}
+
+	// another address still passes the first factor, but the account
+	// takes no code – not even the right one, and it is not used up
+	other := newClient(t, "198.51.100.7")
+	if _, err := other.login(a, Credentials{UID: "UID-ALICE"}); !errors.Is(err, ErrTOTPRequired) {
+		t.Fatalf("Login from another address = %v, want ErrTOTPRequired", err)
+	}
+	if _, err := other.verify(a, code(t, secret, 0)); !errors.As(err, &blocked) {
+		t.Fatalf("right code while the account is blocked: VerifyTOTP = %v, want a block", err)
+	}
+	if _, ok := other.currentUser(a); ok {
+		t.Fatal("logged in while the account is blocked")
+	}
+
+	// the block lifted: the code was not used up by the blocked attempt
+	if err := counters.Reset(context.Background(), throttle.UserKey(alice.ID)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := other.verify(a, code(t, secret, 0)); err != nil {
+		t.Fatalf("VerifyTOTP after the block = %v", err)
+	}
+}
+
+func TestThrottleSucceedNeedsAllFactors(t *testing.T) {
+	a, users, counters := newThrottledAuth(t)
+	alice := createUser(t, users, "UID-ALICE", "alice")
+	secret := enrol(t, users, alice)
+	ip := throttle.IPKey("192.0.2.1")
+
+	// a typo, then the right first factor
+	if _, err := newClient(t, "192.0.2.1").login(a, Credentials{UID: "UID-TYPO"}); !errors.Is(err, user.ErrNotFound) {
+		t.Fatalf("Login(unknown) = %v", err)
+	}
+	c := pendingLogin(t, a, "UID-ALICE")
+	if _, err := c.verify(a, "000000"); !errors.Is(err, user.ErrInvalidCode) {
+		t.Fatal(err)
+	}
+
+	// the pending login forgives nothing
+	if n := failures(t, counters, ip); n != 2 {
+		t.Errorf("ip failures before the second factor = %d, want 2", n)
+	}
+	if n := failures(t, counters, throttle.UserKey(alice.ID)); n != 1 {
+		t.Errorf("account failures before the second factor = %d, want 1", n)
+	}
+
+	if _, err := c.verify(a, code(t, secret, 0)); err != nil {
+		t.Fatal(err)
+	}
+	if n := failures(t, counters, ip); n != 2 {
+		t.Errorf("ip failures after the login = %d, want 2 (they only expire)", n)
+	}
+	if n := failures(t, counters, throttle.UserKey(alice.ID)); n != 0 {
+		t.Errorf("account failures after the login = %d, want 0", n)
+	}
+}
+
+// TestThrottleOwnLoginKeepsIPFailures: logging in to an account of one's
+// own between guesses does not reset the backoff of the address.
+func TestThrottleOwnLoginKeepsIPFailures(t *testing.T) {
+	a, users, counters := newThrottledAuth(t)
+	createUser(t, users, "UID-MALLORY", "mallory")
+	ip := throttle.IPKey("192.0.2.1")
+
+	for _, guess := range []string{"UID-GUESS-1", "UID-GUESS-2"} {
+		if _, err := newClient(t, "192.0.2.1").login(a, Credentials{UID: guess}); !errors.Is(err, user.ErrNotFound) {
+			t.Fatalf("Login(%s) = %v, want ErrNotFound", guess, err)
+		}
+		if _, err := newClient(t, "192.0.2.1").login(a, Credentials{UID: "UID-MALLORY"}); err != nil {
+			t.Fatalf("own login after %s = %v", guess, err)
+		}
+	}
+	if n := failures(t, counters, ip); n != 2 {
+		t.Fatalf("ip failures after the own logins = %d, want 2", n)
+	}
+
+	// the third guess blocks the address, own account included
+	var blocked *throttle.BlockedError
+	if _, err := newClient(t, "192.0.2.1").login(a, Credentials{UID: "UID-GUESS-3"}); !errors.As(err, &blocked) {
+		t.Fatalf("third guess: Login = %v, want a block", err)
+	}
+	if _, err := newClient(t, "192.0.2.1").login(a, Credentials{UID: "UID-MALLORY"}); !errors.As(err, &blocked) {
+		t.Errorf("own login while blocked = %v, want a block", err)
+	}
+}
+
+func TestThrottleWrongPasswordNotPerAccount(t *testing.T) {
+	a, users, counters := newThrottledAuth(t)
+	a.mode = config.LoginModePassword
+	alice := createUser(t, users, "UID-ALICE", "alice")
+
+	if _, err := newClient(t, "192.0.2.1").login(a, Credentials{UID: "UID-ALICE", Password: "wrong"}); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("Login = %v, want ErrInvalidCredentials", err)
+	}
+	if n := failures(t, counters, throttle.UserKey(alice.ID)); n != 0 {
+		t.Errorf("account failures after a wrong password = %d, want 0", n)
+	}
+}
@@ -0,0 +1,323 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/axelrhd/hagg/internal/session"
+	"github.com/axelrhd/hagg/internal/totp"
+	"github.com/axelrhd/hagg/internal/user"
+)
+
+// ActionRequire2FA is the Casbin action that makes the second factor
+// mandatory for a role (policy.csv: "p, admin, auth:require-2fa").
+// Roles with "*" include it.
+const ActionRequire2FA = "auth:require-2fa"
+
+var (
+	// Login: the first factor was correct, the login is pending
+	ErrTOTPRequired       = errors.New("Bitte den Code aus der Authenticator-App eingeben")
+	ErrTOTPEnrollRequired = errors.New("Zwei-Faktor-Authentifizierung muss zuerst eingerichtet werden")
+
+	ErrNoPendingLogin = errors.New("Anmeldung abgelaufen, bitte erneut anmelden")
+	ErrTooManyCodes   = errors.New("Zu viele falsche Codes, bitte erneut anmelden")
+	ErrTOTPActive     = errors.New("Zwei-Faktor-Authentifizierung ist bereits eingerichtet")
+	ErrTOTPMandatory  = errors.New("Zwei-Faktor-Authentifizierung ist für deine Rolle Pflicht")
+)
+
+// Session keys of a login waiting for the second factor. The session has
+// no SessionKeyUserID yet, so CurrentUser (and RequireAuth) reject it.
+const (
+	SessionKeyPendingUserID = "pending_user_id"
+	SessionKeyPendingEnroll = "pending_enroll" // true: 2FA must be set up first
+	SessionKeyPendingSince  = "pending_since"  // unix time
+	SessionKeyPendingFails  = "pending_fails"  // wrong codes so far
+)
+
+const (
+	pendingTTL      = 10 * time.Minute // enough to set up an authenticator app
+	maxPendingFails = 5                // then the first factor is needed again
+)
+
+// factor is the second factor a login still needs.
+type factor int
+
+const (
+	factorNone   factor = iota
+	factorTOTP          // enrolled: enter a code
+	factorEnroll        // required by the role, but not set up yet
+)
+
+func (a *Auth) secondFactor(ctx context.Context, u *user.User) (factor, error) {
+	t, err := a.users.TOTP(ctx, u.ID)
+	if err != nil && !errors.Is(err, user.ErrNoTOTP) {
+		return factorNone, err
+	}
+
+	switch {
+	case t.Active():
+		return factorTOTP, nil
+	case a.TOTPRequired(u):
+		return factorEnroll, nil
+	default:
+		return factorNone, nil
+	}
+}
+
+// TOTPRequired reports whether a role of u requires the second factor
+// (ActionRequire2FA).
+func (a *Auth) TOTPRequired(u *user.User) bool {
+	return a.perms != nil && a.perms.Can(u.Subject(), ActionRequire2FA)
+}
+
+// -----------------------------------------------------------------------------
+// Pending login
+// -----------------------------------------------------------------------------
+
+// Pending is a login that passed the first factor only.
+type Pending struct {
+	User   *user.User
+	Enroll bool // 2FA must be set up before the login completes
+}
+
+// startPending turns the session into a pending login under a new token.
+func (a *Auth) startPending(ctx context.Context, u *user.User, enroll bool) error {
+	if err := a.renewToken(ctx); err != nil {
+		return err
+	}
+	session.Manager.Remove(ctx, SessionKeyUserID)
+	session.Manager.Put(ctx, SessionKeyPendingUserID, u.ID)
+	session.Manager.Put(ctx, SessionKeyPendingEnroll, enroll)
+	session.Manager.Put(ctx, SessionKeyPendingSince, time.Now().Unix())
+	session.Manager.Put(ctx, SessionKeyPendingFails, 0)
+	session.Manager.Put(ctx, SessionKeyVersion, u.SessionVersion)
+	return nil
+}
+
+func (a *Auth) clearPending(ctx context.Context) {
+	session.Manager.Remove(ctx, SessionKeyPendingUserID)
+	session.Manager.Remove(ctx, SessionKeyPendingEnroll)
+	session.Manager.Remove(ctx, SessionKeyPendingSince)
+	session.Manager.Remove(ctx, SessionKeyPendingFails)
+}
+
+// PendingLogin returns the login of req waiting for the second factor.
+// Expired or revoked pending logins are cleared.
+func (a *Auth) PendingLogin(req *http.Request) (*Pending, bool) {
+	ctx := req.Context()
+
+	id, ok := session.Manager.Get(ctx, SessionKeyPendingUserID).(int64)
+	if !ok || id <= 0 {
+		return nil, false
+	}
+
+	since, _ := session.Manager.Get(ctx, SessionKeyPendingSince).(int64)
+	if time.Since(time.Unix(since, 0)) > pendingTTL {
+		a.clearPending(ctx)
+		return nil, false
+	}
+
+	u, err := a.users.FindByID(ctx, id)
+	if err != nil {
+		a.clearPending(ctx)
+		return nil, false
+	}
+
+	version, _ := session.Manager.Get(ctx, SessionKeyVersion).(int64)
+	if version != u.SessionVersion || u.CheckAccess(time.Now()) != nil {
+		a.clearPending(ctx)
+		return nil, false
+	}
+
+	enroll, _ := session.Manager.Get(ctx, SessionKeyPendingEnroll).(bool)
+	return &Pending{User: u, Enroll: enroll}, true
+}
+
+// VerifyTOTP completes a pending login with a code from the authenticator
+// app or a recovery code. After maxPendingFails wrong codes the pending
+// login ends.
+//
+// Wrong codes are throttled for the client and the account: a
+// *throttle.BlockedError rejects further codes without looking at them.
+func (a *Auth) VerifyTOTP(req *http.Request, code string) (*user.User, error) {
+	ctx := req.Context()
+
+	p, ok := a.PendingLogin(req)
+	if !ok || p.Enroll {
+		return nil, ErrNoPendingLogin
+	}
+
+	if err := a.throttle.CheckUser(ctx, ClientIP(req), p.User.ID); err != nil {
+		return nil, err
+	}
+
+	err := a.checkCode(ctx, p.User.ID, code)
+	if errors.Is(err, user.ErrInvalidCode) {
+		a.recordLogin(req, p.User.ID, err)
+
+		fails, _ := session.Manager.Get(ctx, SessionKeyPendingFails).(int)
+		if fails+1 >= maxPendingFails {
+			a.clearPending(ctx)
+			err = ErrTooManyCodes
+		} else {
+			session.Manager.Put(ctx, SessionKeyPendingFails, fails+1)
+		}
+		return nil, a.failCode(req, p.User.ID, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := a.completeLogin(req, p.User); err != nil {
+		return nil, err
+	}
+	return p.User, nil
+}
+
+// checkCode accepts a code of the active enrolment of user id: a TOTP code
+// (each only once) or an unused recovery code.
+func (a *Auth) checkCode(ctx context.Context, id int64, code string) error {
+	t, err := a.users.TOTP(ctx, id)
+	if errors.Is(err, user.ErrNoTOTP) {
+		return user.ErrInvalidCode
+	}
+	if err != nil {
+		return err
+	}
+	if !t.Active() {
+		return user.ErrInvalidCode
+	}
+
+	code = strings.TrimSpace(code)
+	if step, ok := totp.Validate(t.Secret, code, time.Now()); ok {
+		return a.users.UseTOTPStep(ctx, id, step)
+	}
+
+	return a.users.UseRecoveryCode(ctx, id, user.NormalizeRecoveryCode(code))
+}
+
+// -----------------------------------------------------------------------------
+// Enrolment
+// -----------------------------------------------------------------------------
+
+// EnrollingUser returns the user who may set up 2FA: the logged-in user,
+// or a pending login that has to set it up first.
+func (a *Auth) EnrollingUser(req *http.Request) (*user.User, bool) {
+	if u, ok := a.CurrentUser(req); ok {
+		return u, true
+	}
+	if p, ok := a.PendingLogin(req); ok && p.Enroll {
+		return p.User, true
+	}
+	return nil, false
+}
+
+// BeginTOTP returns the unconfirmed enrolment of u, a new secret is
+// created if there is none yet. ErrTOTPActive if 2FA is already set up.
+func (a *Auth) BeginTOTP(ctx context.Context, u *user.User) (*user.TOTP, error) {
+	t, err := a.users.TOTP(ctx, u.ID)
+	switch {
+	case err == nil && t.Active():
+		return nil, ErrTOTPActive
+	case err == nil:
+		return t, nil // reload of the page: keep the scanned secret
+	case !errors.Is(err, user.ErrNoTOTP):
+		return nil, err
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+	if err := a.users.SetTOTP(ctx, u.ID, secret); err != nil {
+		return nil, err
+	}
+
+	return a.users.TOTP(ctx, u.ID)
+}
+
+// TOTPURI returns the otpauth:// URI of secret for the enrolment QR code.
+func (a *Auth) TOTPURI(u *user.User, secret string) string {
+	return totp.URI(secret, a.issuer, u.DisplayName)
+}
+
+// ConfirmTOTP activates the enrolment of u with a first code and returns
+// new recovery codes (only shown once). A pending login that had to set
+// up 2FA is completed.
+func (a *Auth) ConfirmTOTP(req *http.Request, u *user.User, code string) ([]string, error) {
+	ctx := req.Context()
+
+	t, err := a.users.TOTP(ctx, u.ID)
+	if errors.Is(err, user.ErrNoTOTP) {
+		return nil, user.ErrInvalidCode
+	}
+	if err != nil {
+		return nil, err
+	}
+	if t.Active() {
+		return nil, ErrTOTPActive
+	}
+
+	step, ok := totp.Validate(t.Secret, code, time.Now())
+	if !ok {
+		return nil, user.ErrInvalidCode
+	}
+	if err := a.users.UseTOTPStep(ctx, u.ID, step); err != nil {
+		return nil, err
+	}
+
+	codes, err := a.newRecoveryCodes(ctx, u.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	// more privileges (or a completed login): new session token
+	if p, ok := a.PendingLogin(req); ok && p.Enroll && p.User.ID == u.ID {
+		err = a.completeLogin(req, u)
+	} else {
+		err = a.renewToken(ctx)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes of u after checking
+// a current code.
+func (a *Auth) RegenerateRecoveryCodes(req *http.Request, u *user.User, code string) ([]string, error) {
+	if err := a.checkCode(req.Context(), u.ID, code); err != nil {
+		return nil, err
+	}
+	return a.newRecoveryCodes(req.Context(), u.ID)
+}
+
+// DisableTOTP removes the second factor of u after checking a current
+// code. Not allowed if a role of u requires 2FA.
+func (a *Auth) DisableTOTP(req *http.Request, u *user.User, code string) error {
+	if a.TOTPRequired(u) {
+		return ErrTOTPMandatory
+	}
+	if err := a.checkCode(req.Context(), u.ID, code); err != nil {
+		return err
+	}
+	if err := a.users.DeleteTOTP(req.Context(), u.ID); err != nil {
+		return err
+	}
+	return a.renewToken(req.Context())
+}
+
+func (a *Auth) newRecoveryCodes(ctx context.Context, id int64) ([]string, error) {
+	codes, err := user.GenerateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := a.users.SetRecoveryCodes(ctx, id, codes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
@@ -0,0 +1,258 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/axelrhd/hagg-lib/casbinx"
+	"github.com/axelrhd/hagg/internal/totp"
+	"github.com/axelrhd/hagg/internal/user"
+	"github.com/casbin/casbin/v2"
+)
+
+// enrol activates 2FA for u and returns the secret. The confirming code
+// is long ago, so the codes around now are unused.
+func enrol(t *testing.T, users user.Store, u *user.User) string {
+	t.Helper()
+	ctx := context.Background()
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := users.SetTOTP(ctx, u.ID, secret); err != nil {
+		t.Fatal(err)
+	}
+	if err := users.UseTOTPStep(ctx, u.ID, totp.Step(time.Now())-10); err != nil {
+		t.Fatal(err)
+	}
+	return secret
+}
+
+// code returns the code of secret offset steps from now.
+func code(t *testing.T, secret string, offset int64) string {
+	t.Helper()
+
+	c, err := totp.Code(secret, totp.Step(time.Now())+offset)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// verify runs Auth.VerifyTOTP for c.
+func (c *client) verify(a *Auth, code string) (*user.User, error) {
+	var (
+		u   *user.User
+		err error
+	)
+	c.do(func(req *http.Request) { u, err = a.VerifyTOTP(req, code) })
+	return u, err
+}
+
+// pendingLogin starts a login of uid that waits for the second factor.
+func pendingLogin(t *testing.T, a *Auth, uid string) *client {
+	t.Helper()
+
+	c := newClient(t, "192.0.2.1")
+	if _, err := c.login(a, Credentials{UID: uid}); !errors.Is(err, ErrTOTPRequired) {
+		t.Fatalf("Login = %v, want ErrTOTPRequired", err)
+	}
+	if _, ok := c.currentUser(a); ok {
+		t.Fatal("logged in before the second factor")
+	}
+	return c
+}
+
+func TestTOTPLogin(t *testing.T) {
+	a, users := newTestAuth(t, Options{})
+	u := createUser(t, users, "UID-ALICE", "alice")
+	secret := enrol(t, users, u)
+
+	c := pendingLogin(t, a, "UID-ALICE")
+
+	if _, err := c.verify(a, "000000"); !errors.Is(err, user.ErrInvalidCode) {
+		t.Fatalf("wrong code: VerifyTOTP = %v, want ErrInvalidCode", err)
+	}
+	if got, err := c.verify(a, code(t, secret, 0)); err != nil || got.ID != u.ID {
+		t.Fatalf("VerifyTOTP = %v, %v", got, err)
+	}
+	if got, ok := c.currentUser(a); !ok || got.ID != u.ID {
+		t.Fatal("not logged in after the second factor")
+	}
+}
+
+func TestTOTPReplay(t *testing.T) {
+	a, users := newTestAuth(t, Options{})
+	u := createUser(t, users, "UID-ALICE", "alice")
+	secret := enrol(t, users, u)
+
+	if _, err := pendingLogin(t, a, "UID-ALICE").verify(a, code(t, secret, 0)); err != nil {
+		t.Fatal(err)
+	}
+
+	// the same code, or an older one still inside the skew window, is
+	// rejected – even from another browser
+	for _, offset := range []int64{0, -1} {
+		if _, err := pendingLogin(t, a, "UID-ALICE").verify(a, code(t, secret, offset)); !errors.Is(err, user.ErrInvalidCode) {
+			t.Errorf("code of step %+d after use: VerifyTOTP = %v, want ErrInvalidCode", offset, err)
+		}
+	}
+
+	// a later step inside the window still works (once)
+	if _, err := pendingLogin(t, a, "UID-ALICE").verify(a, code(t, secret, 1)); err != nil {
+		t.Errorf("code of the next step: VerifyTOTP = %v", err)
+	}
+	if _, err := pendingLogin(t, a, "UID-ALICE").verify(a, code(t, secret, 2)); !errors.Is(err, user.ErrInvalidCode) {
+		t.Errorf("code outside the skew window: VerifyTOTP = %v, want ErrInvalidCode", err)
+	}
+}
+
+func TestRecoveryCodeSingleUse(t *testing.T) {
+	a, users := newTestAuth(t, Options{})
+	u := createUser(t, users, "UID-ALICE", "alice")
+	enrol(t, users, u)
+
+	codes, err := a.newRecoveryCodes(context.Background(), u.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// typed in lower case with spaces around
+	if _, err := pendingLogin(t, a, "UID-ALICE").verify(a, " "+codes[0]+" "); err != nil {
+		t.Fatalf("recovery code: VerifyTOTP = %v", err)
+	}
+	if _, err := pendingLogin(t, a, "UID-ALICE").verify(a, codes[0]); !errors.Is(err, user.ErrInvalidCode) {
+		t.Fatalf("used recovery code: VerifyTOTP = %v, want ErrInvalidCode", err)
+	}
+	if _, err := pendingLogin(t, a, "UID-ALICE").verify(a, codes[1]); err != nil {
+		t.Fatalf("second recovery code: VerifyTOTP = %v", err)
+	}
+
+	tt, _ := users.TOTP(context.Background(), u.ID)
+	if tt.RecoveryCodes != user.RecoveryCodeCount-2 {
+		t.Errorf("RecoveryCodes = %d, want %d", tt.RecoveryCodes, user.RecoveryCodeCount-2)
+	}
+}
+
+func TestTOTPTooManyCodes(t *testing.T) {
+	a, users := newTestAuth(t, Options{})
+	u := createUser(t, users, "UID-ALICE", "alice")
+	secret := enrol(t, users, u)
+
+	c := pendingLogin(t, a, "UID-ALICE")
+	for i := 1; i < maxPendingFails; i++ {
+		if _, err := c.verify(a, "000000"); !errors.Is(err, user.ErrInvalidCode) {
+			t.Fatalf("wrong code #%d: VerifyTOTP = %v, want ErrInvalidCode", i, err)
+		}
+	}
+	if _, err := c.verify(a, "000000"); !errors.Is(err, ErrTooManyCodes) {
+		t.Fatalf("wrong code #%d: VerifyTOTP = %v, want ErrTooManyCodes", maxPendingFails, err)
+	}
+
+	// the first factor is needed again
+	if _, err := c.verify(a, code(t, secret, 0)); !errors.Is(err, ErrNoPendingLogin) {
+		t.Errorf("right code after too many: VerifyTOTP = %v, want ErrNoPendingLogin", err)
+	}
+}
+
+// -----------------------------------------------------------------------------
+// auth:require-2fa
+// -----------------------------------------------------------------------------
+
+// require2FAPerms returns the permissions of a policy where admin
+// requires 2FA and viewer does not.
+func require2FAPerms(t *testing.T, admin, viewer *user.User) *casbinx.Perm {
+	t.Helper()
+
+	policy := filepath.Join(t.TempDir(), "policy.csv")
+	err := os.WriteFile(policy, []byte(
+		"p, admin, dashboard:view\n"+
+			"p, admin, "+ActionRequire2FA+"\n"+
+			"p, viewer, dashboard:view\n"+
+			"g, "+admin.Subject()+", admin\n"+
+			"g, "+viewer.Subject()+", viewer\n",
+	), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	enf, err := casbin.NewEnforcer("../../model.conf", policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return casbinx.NewPerm(enf)
+}
+
+func TestRequire2FA(t *testing.T) {
+	a, users := newTestAuth(t, Options{})
+	admin := createUser(t, users, "UID-ADMIN", "admin")
+	viewer := createUser(t, users, "UID-VIEWER", "viewer")
+	a.perms = require2FAPerms(t, admin, viewer)
+
+	if !a.TOTPRequired(admin) || a.TOTPRequired(viewer) {
+		t.Fatalf("TOTPRequired: admin %t, viewer %t", a.TOTPRequired(admin), a.TOTPRequired(viewer))
+	}
+
+	// a role without the action logs in with the first factor
+	if _, err := newClient(t, "192.0.2.1").login(a, Credentials{UID: "UID-VIEWER"}); err != nil {
+		t.Fatalf("viewer: Login = %v", err)
+	}
+
+	// admin without 2FA: must set it up before the login completes
+	c := newClient(t, "192.0.2.1")
+	if _, err := c.login(a, Credentials{UID: "UID-ADMIN"}); !errors.Is(err, ErrTOTPEnrollRequired) {
+		t.Fatalf("admin: Login = %v, want ErrTOTPEnrollRequired", err)
+	}
+	if _, ok := c.currentUser(a); ok {
+		t.Fatal("admin logged in without 2FA")
+	}
+	if _, err := c.verify(a, "000000"); !errors.Is(err, ErrNoPendingLogin) {
+		t.Fatalf("VerifyTOTP during enrolment = %v, want ErrNoPendingLogin", err)
+	}
+
+	var secret string
+	c.do(func(req *http.Request) {
+		u, ok := a.EnrollingUser(req)
+		if !ok || u.ID != admin.ID {
+			t.Fatalf("EnrollingUser = %v, %t", u, ok)
+		}
+		tt, err := a.BeginTOTP(req.Context(), u)
+		if err != nil {
+			t.Fatal(err)
+		}
+		secret = tt.Secret
+	})
+
+	c.do(func(req *http.Request) {
+		if _, err := a.ConfirmTOTP(req, admin, "000000"); !errors.Is(err, user.ErrInvalidCode) {
+			t.Fatalf("ConfirmTOTP(wrong code) = %v, want ErrInvalidCode", err)
+		}
+	})
+	if _, ok := c.currentUser(a); ok {
+		t.Fatal("logged in after a wrong enrolment code")
+	}
+
+	c.do(func(req *http.Request) {
+		codes, err := a.ConfirmTOTP(req, admin, code(t, secret, 0))
+		if err != nil || len(codes) != user.RecoveryCodeCount {
+			t.Fatalf("ConfirmTOTP = %d codes, %v", len(codes), err)
+		}
+	})
+	if u, ok := c.currentUser(a); !ok || u.ID != admin.ID {
+		t.Fatal("enrolment did not complete the login")
+	}
+
+	// from now on the code is asked for, and 2FA cannot be switched off
+	pendingLogin(t, a, "UID-ADMIN")
+	c.do(func(req *http.Request) {
+		if err := a.DisableTOTP(req, admin, code(t, secret, 1)); !errors.Is(err, ErrTOTPMandatory) {
+			t.Errorf("DisableTOTP = %v, want ErrTOTPMandatory", err)
+		}
+	})
+}
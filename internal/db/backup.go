@@ -0,0 +1,272 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/axelrhd/hagg/internal/config"
+	"github.com/jmoiron/sqlx"
+)
+
+// BackupInfo describes a verified SQLite database file.
+type BackupInfo struct {
+	Path          string
+	Size          int64
+	SchemaVersion int64 // goose version, 0 if no migrations were applied
+}
+
+// Backup writes a consistent copy of the live database to dest using
+// `VACUUM INTO`. It is safe to run while the server is serving requests:
+// in WAL mode the copy is taken from a read snapshot and writers are not blocked.
+//
+// The copy is written to a temporary file next to dest and renamed afterwards,
+// so dest either contains a complete backup or does not exist.
+func Backup(ctx context.Context, cfg config.SQLiteConfig, dest string) error {
+	if dest == "" {
+		return fmt.Errorf("backup destination is empty")
+	}
+
+	if _, err := os.Stat(cfg.Path); err != nil {
+		return fmt.Errorf("database %q: %w", cfg.Path, err)
+	}
+
+	if _, err := os.Stat(dest); err == nil {
+		return fmt.Errorf("backup destination %q already exists", dest)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+
+	// dedicated connection: the writer pool stays free for the app,
+	// the reader pool is query_only and cannot run VACUUM INTO
+	src, err := openSingle(cfg.Path, cfg, false)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	tmp := dest + ".tmp"
+	_ = os.Remove(tmp)
+
+	if _, err := src.ExecContext(ctx, "VACUUM INTO ?", tmp); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("vacuum into %q: %w", tmp, err)
+	}
+
+	if err := os.Rename(tmp, dest); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+
+	return nil
+}
+
+// VerifyBackup opens path read-only, runs `PRAGMA integrity_check`
+// and reads the goose schema version.
+func VerifyBackup(ctx context.Context, path string) (*BackupInfo, error) {
+	st, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	dbx, err := openSingle(path, config.SQLiteConfig{}, true)
+	if err != nil {
+		return nil, err
+	}
+	defer dbx.Close()
+
+	var results []string
+	if err := dbx.SelectContext(ctx, &results, "PRAGMA integrity_check"); err != nil {
+		return nil, fmt.Errorf("integrity check %q: %w", path, err)
+	}
+	if len(results) != 1 || results[0] != "ok" {
+		return nil, fmt.Errorf("integrity check %q failed: %s", path, strings.Join(results, "; "))
+	}
+
+	version, err := schemaVersion(ctx, dbx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &BackupInfo{
+		Path:          path,
+		Size:          st.Size(),
+		SchemaVersion: version,
+	}, nil
+}
+
+// Restore replaces the database at cfg.Path with the backup at src.
+//
+// The backup must pass the integrity check and have the same schema version
+// as the current database (unless force is set). The current database is
+// checkpointed and kept as <path>.pre-restore (with its -wal/-shm files, if
+// any are left); an existing <path>.pre-restore is never overwritten.
+//
+// The server must NOT be running while restoring: open connections would
+// keep using the old file (and its WAL).
+func Restore(ctx context.Context, cfg config.SQLiteConfig, src string, force bool) (*BackupInfo, error) {
+	info, err := VerifyBackup(ctx, src)
+	if err != nil {
+		return nil, err
+	}
+
+	keep := cfg.Path + ".pre-restore"
+	_, err = os.Stat(cfg.Path)
+	exists := err == nil
+
+	if exists {
+		if _, err := os.Stat(keep); err == nil {
+			return nil, fmt.Errorf("%q already exists (left by an earlier restore): move it away first", keep)
+		}
+
+		current, err := VerifyBackup(ctx, cfg.Path)
+		if err != nil && !force {
+			return nil, fmt.Errorf("verify current database: %w", err)
+		}
+
+		if current != nil && current.SchemaVersion != info.SchemaVersion && !force {
+			return nil, fmt.Errorf(
+				"schema version mismatch: backup=%d current=%d (use --force to restore anyway)",
+				info.SchemaVersion,
+				current.SchemaVersion,
+			)
+		}
+
+		// move the WAL into the file we keep
+		if err := checkpoint(ctx, cfg); err != nil && !force {
+			return nil, err
+		}
+	}
+
+	// copy next to the target first, so the final swap is an atomic rename
+	tmp := cfg.Path + ".restore"
+	if err := copyFile(src, tmp); err != nil {
+		_ = os.Remove(tmp)
+		return nil, err
+	}
+
+	if exists {
+		if err := os.Rename(cfg.Path, keep); err != nil {
+			_ = os.Remove(tmp)
+			return nil, err
+		}
+	}
+
+	// WAL/SHM files would be applied to the restored file: they belong to
+	// the kept one (empty after the checkpoint, unless it failed with force)
+	for _, suffix := range []string{"-wal", "-shm"} {
+		err := os.Rename(cfg.Path+suffix, keep+suffix)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+	}
+
+	if err := os.Rename(tmp, cfg.Path); err != nil {
+		return nil, err
+	}
+
+	return info, nil
+}
+
+// ------------------------------------------------------------
+// Internals
+// ------------------------------------------------------------
+
+// openSingle opens a single-connection pool outside of the app pools. The
+// file must exist: a wrong path must not turn into a new, empty database.
+func openSingle(path string, cfg config.SQLiteConfig, readOnly bool) (*sqlx.DB, error) {
+	dsn := "file:" + path + fmt.Sprintf("?_pragma=busy_timeout(%d)", cfg.BusyTimeout.Milliseconds())
+	if readOnly {
+		dsn += "&mode=ro"
+	} else {
+		dsn += "&mode=rw"
+	}
+
+	dbx, err := sqlx.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+	dbx.SetMaxOpenConns(1)
+
+	if err := dbx.Ping(); err != nil {
+		dbx.Close()
+		return nil, err
+	}
+
+	return dbx, nil
+}
+
+// checkpoint writes the WAL of the database back into the main file and
+// truncates it. It fails if another connection (a running server) is busy.
+func checkpoint(ctx context.Context, cfg config.SQLiteConfig) error {
+	dbx, err := openSingle(cfg.Path, cfg, false)
+	if err != nil {
+		return err
+	}
+	defer dbx.Close()
+
+	var res struct {
+		Busy         int `db:"busy"`
+		Log          int `db:"log"`
+		Checkpointed int `db:"checkpointed"`
+	}
+	if err := dbx.GetContext(ctx, &res, "PRAGMA wal_checkpoint(TRUNCATE)"); err != nil {
+		return fmt.Errorf("checkpoint %q: %w", cfg.Path, err)
+	}
+	if res.Busy != 0 {
+		return fmt.Errorf("checkpoint %q: database is busy (is the server still running?)", cfg.Path)
+	}
+
+	return nil
+}
+
+// schemaVersion returns the highest applied goose migration.
+func schemaVersion(ctx context.Context, dbx *sqlx.DB) (int64, error) {
+	var exists int
+	err := dbx.GetContext(ctx, &exists, `SELECT 1 FROM sqlite_master WHERE type = 'table' AND name = 'goose_db_version'`)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	var version int64
+	if err := dbx.GetContext(ctx, &version, `SELECT COALESCE(MAX(version_id), 0) FROM goose_db_version WHERE is_applied`); err != nil {
+		return 0, err
+	}
+
+	return version, nil
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+
+	return out.Close()
+}
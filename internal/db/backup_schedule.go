@@ -0,0 +1,110 @@
+package db
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/axelrhd/hagg/internal/config"
+)
+
+// backupTimeFormat sorts lexicographically in chronological order.
+const backupTimeFormat = "20060102-150405"
+
+// BackupScheduler creates periodic backups in a local directory
+// and keeps only the newest N generations.
+type BackupScheduler struct {
+	sqlite config.SQLiteConfig
+	backup config.BackupConfig
+	logger *slog.Logger
+}
+
+func NewBackupScheduler(sqlite config.SQLiteConfig, backup config.BackupConfig, logger *slog.Logger) *BackupScheduler {
+	return &BackupScheduler{
+		sqlite: sqlite,
+		backup: backup,
+		logger: logger,
+	}
+}
+
+// Run blocks until ctx is cancelled, creating one backup per interval.
+func (b *BackupScheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(b.backup.Interval)
+	defer ticker.Stop()
+
+	b.logger.Info("backup schedule started",
+		"dir", b.backup.Dir,
+		"interval", b.backup.Interval,
+		"keep", b.backup.Keep,
+	)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := b.RunOnce(ctx); err != nil {
+				b.logger.Error("scheduled backup failed", "error", err)
+			}
+		}
+	}
+}
+
+// RunOnce creates a single backup and applies the retention policy.
+func (b *BackupScheduler) RunOnce(ctx context.Context) (string, error) {
+	dest := filepath.Join(b.backup.Dir, b.prefix()+time.Now().Format(backupTimeFormat)+".sqlite3")
+
+	start := time.Now()
+	if err := Backup(ctx, b.sqlite, dest); err != nil {
+		return "", err
+	}
+
+	b.logger.Info("backup created", "path", dest, "duration", time.Since(start))
+
+	return dest, b.prune()
+}
+
+// prune deletes all but the newest Keep backups.
+func (b *BackupScheduler) prune() error {
+	entries, err := os.ReadDir(b.backup.Dir)
+	if err != nil {
+		return err
+	}
+
+	var backups []string
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		if strings.HasPrefix(e.Name(), b.prefix()) && strings.HasSuffix(e.Name(), ".sqlite3") {
+			backups = append(backups, e.Name())
+		}
+	}
+
+	if len(backups) <= b.backup.Keep {
+		return nil
+	}
+
+	// newest first
+	sort.Sort(sort.Reverse(sort.StringSlice(backups)))
+
+	for _, name := range backups[b.backup.Keep:] {
+		path := filepath.Join(b.backup.Dir, name)
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+		b.logger.Info("backup removed (retention)", "path", path)
+	}
+
+	return nil
+}
+
+// prefix is derived from the database file name, e.g. "db-" for ./db.sqlite3.
+func (b *BackupScheduler) prefix() string {
+	base := filepath.Base(b.sqlite.Path)
+	return strings.TrimSuffix(base, filepath.Ext(base)) + "-"
+}
@@ -0,0 +1,313 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/axelrhd/hagg/internal/config"
+)
+
+// testDB opens a fresh database with a goose version table at version
+// and a table of notes.
+func testDB(t *testing.T, version int64) (*SQLite, config.SQLiteConfig) {
+	t.Helper()
+
+	cfg := testSQLiteConfig(t)
+	s, err := OpenSQLite(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+
+	_, err = s.Write.Exec(`
+		CREATE TABLE goose_db_version (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			version_id INTEGER NOT NULL,
+			is_applied INTEGER NOT NULL,
+			tstamp TIMESTAMP DEFAULT (datetime('now'))
+		);
+		CREATE TABLE notes (text TEXT NOT NULL);
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	setVersion(t, s, version)
+
+	return s, cfg
+}
+
+func setVersion(t *testing.T, s *SQLite, version int64) {
+	t.Helper()
+
+	if _, err := s.Write.Exec(`INSERT INTO goose_db_version (version_id, is_applied) VALUES (?, 1)`, version); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func addNote(t *testing.T, s *SQLite, text string) {
+	t.Helper()
+
+	if _, err := s.Write.Exec(`INSERT INTO notes (text) VALUES (?)`, text); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// notes returns the notes in the database file at path.
+func notes(t *testing.T, path string) []string {
+	t.Helper()
+
+	dbx, err := openSingle(path, config.SQLiteConfig{}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dbx.Close()
+
+	var texts []string
+	if err := dbx.Select(&texts, `SELECT text FROM notes ORDER BY rowid`); err != nil {
+		t.Fatal(err)
+	}
+	return texts
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func TestBackup(t *testing.T) {
+	ctx := context.Background()
+	s, cfg := testDB(t, 15)
+	addNote(t, s, "a")
+
+	// taken while the pools are open
+	dest := filepath.Join(t.TempDir(), "sub", "backup.sqlite3")
+	if err := Backup(ctx, cfg, dest); err != nil {
+		t.Fatal(err)
+	}
+	if exists(dest + ".tmp") {
+		t.Error("temporary file left behind")
+	}
+
+	info, err := VerifyBackup(ctx, dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Path != dest || info.Size == 0 || info.SchemaVersion != 15 {
+		t.Errorf("VerifyBackup = %+v, want version 15", info)
+	}
+	if got := notes(t, dest); !slices.Equal(got, []string{"a"}) {
+		t.Errorf("notes in the backup = %q", got)
+	}
+
+	// an existing backup is never overwritten
+	if err := Backup(ctx, cfg, dest); err == nil {
+		t.Error("Backup to an existing file = nil, want an error")
+	}
+}
+
+func TestBackupMissingDatabase(t *testing.T) {
+	cfg := testSQLiteConfig(t) // never opened: the file does not exist
+	dest := filepath.Join(t.TempDir(), "backup.sqlite3")
+
+	if err := Backup(context.Background(), cfg, dest); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Backup = %v, want ErrNotExist", err)
+	}
+	if exists(cfg.Path) || exists(dest) {
+		t.Error("Backup created a file")
+	}
+
+	// the connection itself does not create the file either
+	if _, err := openSingle(cfg.Path, cfg, false); err == nil || exists(cfg.Path) {
+		t.Errorf("openSingle(missing) = %v, created %t", err, exists(cfg.Path))
+	}
+}
+
+func TestVerifyBackup(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	missing := filepath.Join(dir, "missing.sqlite3")
+	if _, err := VerifyBackup(ctx, missing); err == nil || exists(missing) {
+		t.Errorf("VerifyBackup(missing) = %v, created %t", err, exists(missing))
+	}
+
+	garbage := filepath.Join(dir, "garbage.sqlite3")
+	if err := os.WriteFile(garbage, []byte(strings.Repeat("no database ", 1000)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := VerifyBackup(ctx, garbage); err == nil {
+		t.Error("VerifyBackup(garbage) = nil, want an error")
+	}
+
+	// no migrations applied: version 0
+	s, err := OpenSQLite(testSQLiteConfig(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	empty := filepath.Join(dir, "empty.sqlite3")
+	if _, err := s.Write.Exec("VACUUM INTO ?", empty); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := VerifyBackup(ctx, empty); err != nil || info.SchemaVersion != 0 {
+		t.Errorf("VerifyBackup(empty) = %+v, %v, want version 0", info, err)
+	}
+}
+
+func TestVerifyBackupCorrupt(t *testing.T) {
+	ctx := context.Background()
+	s, cfg := testDB(t, 15)
+	for range 500 {
+		addNote(t, s, strings.Repeat("x", 100))
+	}
+
+	dest := filepath.Join(t.TempDir(), "backup.sqlite3")
+	if err := Backup(ctx, cfg, dest); err != nil {
+		t.Fatal(err)
+	}
+
+	// overwrite the pages behind the schema
+	f, err := os.OpenFile(dest, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteAt([]byte(strings.Repeat("\xff", 8192)), 8192); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	if _, err := VerifyBackup(ctx, dest); err == nil {
+		t.Error("VerifyBackup(corrupt) = nil, want an error")
+	}
+}
+
+func TestRestore(t *testing.T) {
+	ctx := context.Background()
+	s, cfg := testDB(t, 15)
+	addNote(t, s, "before")
+
+	backup := filepath.Join(t.TempDir(), "backup.sqlite3")
+	if err := Backup(ctx, cfg, backup); err != nil {
+		t.Fatal(err)
+	}
+	addNote(t, s, "after")
+	s.Close() // the server is stopped
+
+	info, err := Restore(ctx, cfg, backup, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.SchemaVersion != 15 {
+		t.Errorf("restored version = %d, want 15", info.SchemaVersion)
+	}
+
+	if got := notes(t, cfg.Path); !slices.Equal(got, []string{"before"}) {
+		t.Errorf("notes after the restore = %q, want the backup", got)
+	}
+	keep := cfg.Path + ".pre-restore"
+	if got := notes(t, keep); !slices.Equal(got, []string{"before", "after"}) {
+		t.Errorf("notes of %s = %q, want the replaced database", keep, got)
+	}
+	if exists(cfg.Path + "-wal") {
+		t.Error("WAL of the replaced database left next to the restored one")
+	}
+
+	// the kept database is never overwritten
+	if _, err := Restore(ctx, cfg, backup, false); err == nil || !strings.Contains(err.Error(), "pre-restore") {
+		t.Errorf("second Restore = %v, want a refusal", err)
+	}
+}
+
+func TestRestoreSchemaMismatch(t *testing.T) {
+	ctx := context.Background()
+	s, cfg := testDB(t, 15)
+	addNote(t, s, "old schema")
+
+	backup := filepath.Join(t.TempDir(), "backup.sqlite3")
+	if err := Backup(ctx, cfg, backup); err != nil {
+		t.Fatal(err)
+	}
+	setVersion(t, s, 16) // migrated after the backup
+	addNote(t, s, "new schema")
+	s.Close()
+
+	if _, err := Restore(ctx, cfg, backup, false); err == nil || !strings.Contains(err.Error(), "schema version mismatch") {
+		t.Fatalf("Restore = %v, want a schema version mismatch", err)
+	}
+	if got := notes(t, cfg.Path); len(got) != 2 || exists(cfg.Path+".pre-restore") {
+		t.Fatalf("database touched by the refused restore: %q", got)
+	}
+
+	if _, err := Restore(ctx, cfg, backup, true); err != nil {
+		t.Fatalf("Restore(force) = %v", err)
+	}
+	if got := notes(t, cfg.Path); !slices.Equal(got, []string{"old schema"}) {
+		t.Errorf("notes after the forced restore = %q", got)
+	}
+}
+
+func TestRestoreCorruptBackup(t *testing.T) {
+	ctx := context.Background()
+	s, cfg := testDB(t, 15)
+	addNote(t, s, "current")
+	s.Close()
+
+	garbage := filepath.Join(t.TempDir(), "garbage.sqlite3")
+	if err := os.WriteFile(garbage, []byte(strings.Repeat("no database ", 1000)), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Restore(ctx, cfg, garbage, true); err == nil {
+		t.Fatal("Restore(garbage) = nil, want an error (even with force)")
+	}
+	if got := notes(t, cfg.Path); !slices.Equal(got, []string{"current"}) || exists(cfg.Path+".pre-restore") {
+		t.Errorf("database touched by the refused restore: %q", got)
+	}
+}
+
+func TestBackupSchedulerRetention(t *testing.T) {
+	_, cfg := testDB(t, 15) // file test.sqlite3: prefix "test-"
+	dir := t.TempDir()
+
+	old := []string{
+		"test-20240101-000000.sqlite3",
+		"test-20240102-000000.sqlite3",
+		"test-20240103-000000.sqlite3",
+	}
+	others := []string{"other-20240101-000000.sqlite3", "test-notes.txt"}
+	for _, name := range append(slices.Clone(old), others...) {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	b := NewBackupScheduler(cfg, config.BackupConfig{Dir: dir, Keep: 2}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	dest, err := b.RunOnce(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, e := range entries {
+		got = append(got, e.Name())
+	}
+
+	// the new backup and the newest old one, other files untouched
+	want := []string{filepath.Base(dest), old[2], others[0], others[1]}
+	slices.Sort(got)
+	slices.Sort(want)
+	if !slices.Equal(got, want) {
+		t.Errorf("files = %q, want %q", got, want)
+	}
+}
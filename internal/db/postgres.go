@@ -0,0 +1,71 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/axelrhd/hagg/internal/config"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/pgx/v5/stdlib"
+	"github.com/jmoiron/sqlx"
+)
+
+// Postgres exposes one pgx connection pool in two flavours:
+// the native pool (needed by the SCS pgxstore) and a database/sql view
+// of the same pool for sqlx-based stores.
+type Postgres struct {
+	Pool *pgxpool.Pool
+	DB   *sqlx.DB
+}
+
+// OpenPostgres connects to the configured PostgreSQL database.
+func OpenPostgres(ctx context.Context, cfg config.PostgresConfig) (*Postgres, error) {
+	if cfg.DSN == "" {
+		return nil, fmt.Errorf("postgres dsn is empty")
+	}
+
+	poolCfg, err := pgxpool.ParseConfig(cfg.DSN)
+	if err != nil {
+		return nil, fmt.Errorf("parse postgres dsn: %w", err)
+	}
+	poolCfg.MaxConns = cfg.MaxConns
+
+	pool, err := pgxpool.NewWithConfig(ctx, poolCfg)
+	if err != nil {
+		return nil, err
+	}
+
+	// verify connection
+	if err := pool.Ping(ctx); err != nil {
+		pool.Close()
+		return nil, err
+	}
+
+	return &Postgres{
+		Pool: pool,
+		DB:   sqlx.NewDb(stdlib.OpenDBFromPool(pool), "pgx"),
+	}, nil
+}
+
+// Close closes the database/sql view and the underlying pool.
+func (p *Postgres) Close() error {
+	err := p.DB.Close()
+	p.Pool.Close()
+	return err
+}
+
+// WithTx runs fn inside a transaction.
+// The transaction is committed if fn returns nil and rolled back otherwise.
+func (p *Postgres) WithTx(ctx context.Context, fn func(tx *sqlx.Tx) error) error {
+	tx, err := p.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if err := fn(tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
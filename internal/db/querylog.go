@@ -0,0 +1,204 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Querier is implemented by *sqlx.DB, *sqlx.Tx and the logging wrapper.
+// Stores should depend on this instead of a concrete sqlx type.
+type Querier interface {
+	GetContext(ctx context.Context, dest any, query string, args ...any) error
+	SelectContext(ctx context.Context, dest any, query string, args ...any) error
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// Secret marks a query argument that must never show up in logs
+// (e.g. the login UID). It is passed to the driver as a plain string.
+type Secret string
+
+// QueryStat aggregates all executions of one SQL statement.
+type QueryStat struct {
+	SQL      string
+	Count    int64
+	Errors   int64
+	Slow     int64
+	Total    time.Duration
+	Max      time.Duration
+	LastSeen time.Time
+}
+
+// Avg returns the average duration per execution.
+func (s QueryStat) Avg() time.Duration {
+	if s.Count == 0 {
+		return 0
+	}
+	return s.Total / time.Duration(s.Count)
+}
+
+// QueryLogger logs every statement at debug level, warns about slow ones
+// and keeps per-statement statistics (e.g. for a dev toolbar or metrics).
+type QueryLogger struct {
+	logger *slog.Logger
+	slow   time.Duration // 0 = no slow query warnings
+
+	mu    sync.Mutex
+	stats map[string]*QueryStat
+}
+
+func NewQueryLogger(logger *slog.Logger, slow time.Duration) *QueryLogger {
+	return &QueryLogger{
+		logger: logger,
+		slow:   slow,
+		stats:  make(map[string]*QueryStat),
+	}
+}
+
+// Wrap returns a Querier that instruments all calls to q.
+func (l *QueryLogger) Wrap(q Querier) Querier {
+	return &loggedQuerier{q: q, log: l}
+}
+
+// Stats returns a snapshot of all statistics, most expensive statements first.
+func (l *QueryLogger) Stats() []QueryStat {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	list := make([]QueryStat, 0, len(l.stats))
+	for _, s := range l.stats {
+		list = append(list, *s)
+	}
+
+	sort.Slice(list, func(i, j int) bool { return list[i].Total > list[j].Total })
+	return list
+}
+
+// Reset clears all statistics.
+func (l *QueryLogger) Reset() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.stats = make(map[string]*QueryStat)
+}
+
+// ------------------------------------------------------------
+// Internals
+// ------------------------------------------------------------
+
+var whitespace = regexp.MustCompile(`\s+`)
+
+func (l *QueryLogger) record(ctx context.Context, query string, args []any, d time.Duration, rows int64, err error) {
+	query = strings.TrimSpace(whitespace.ReplaceAllString(query, " "))
+	slow := l.slow > 0 && d >= l.slow
+
+	l.mu.Lock()
+	s, ok := l.stats[query]
+	if !ok {
+		s = &QueryStat{SQL: query}
+		l.stats[query] = s
+	}
+	s.Count++
+	s.Total += d
+	s.Max = max(s.Max, d)
+	s.LastSeen = time.Now()
+	if err != nil {
+		s.Errors++
+	}
+	if slow {
+		s.Slow++
+	}
+	l.mu.Unlock()
+
+	attrs := []any{
+		"sql", query,
+		"args", redactArgs(args),
+		"duration", d,
+		"rows", rows,
+	}
+	if err != nil {
+		attrs = append(attrs, "error", err)
+	}
+
+	if slow {
+		l.logger.WarnContext(ctx, "slow query", append(attrs, "threshold", l.slow)...)
+		return
+	}
+	l.logger.DebugContext(ctx, "query", attrs...)
+}
+
+func redactArgs(args []any) []string {
+	out := make([]string, len(args))
+	for i, a := range args {
+		if _, ok := a.(Secret); ok {
+			out[i] = "[REDACTED]"
+			continue
+		}
+		out[i] = fmt.Sprint(a)
+	}
+	return out
+}
+
+// driverArgs replaces Secret values with plain strings for the driver.
+func driverArgs(args []any) []any {
+	out := make([]any, len(args))
+	for i, a := range args {
+		if s, ok := a.(Secret); ok {
+			out[i] = string(s)
+			continue
+		}
+		out[i] = a
+	}
+	return out
+}
+
+type loggedQuerier struct {
+	q   Querier
+	log *QueryLogger
+}
+
+func (lq *loggedQuerier) GetContext(ctx context.Context, dest any, query string, args ...any) error {
+	start := time.Now()
+	err := lq.q.GetContext(ctx, dest, query, driverArgs(args)...)
+
+	var rows int64
+	if err == nil {
+		rows = 1
+	}
+	lq.log.record(ctx, query, args, time.Since(start), rows, err)
+
+	return err
+}
+
+func (lq *loggedQuerier) SelectContext(ctx context.Context, dest any, query string, args ...any) error {
+	start := time.Now()
+	err := lq.q.SelectContext(ctx, dest, query, driverArgs(args)...)
+
+	var rows int64
+	if v := reflect.ValueOf(dest); v.Kind() == reflect.Pointer && v.Elem().Kind() == reflect.Slice {
+		rows = int64(v.Elem().Len())
+	}
+	lq.log.record(ctx, query, args, time.Since(start), rows, err)
+
+	return err
+}
+
+func (lq *loggedQuerier) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	start := time.Now()
+	res, err := lq.q.ExecContext(ctx, query, driverArgs(args)...)
+
+	var rows int64
+	if err == nil {
+		rows, _ = res.RowsAffected()
+	}
+	lq.log.record(ctx, query, args, time.Since(start), rows, err)
+
+	return res, err
+}
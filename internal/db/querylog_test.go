@@ -0,0 +1,88 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+// spyQuerier records the arguments the driver gets.
+type spyQuerier struct {
+	args [][]any
+}
+
+func (s *spyQuerier) GetContext(ctx context.Context, dest any, query string, args ...any) error {
+	s.args = append(s.args, args)
+	return nil
+}
+
+func (s *spyQuerier) SelectContext(ctx context.Context, dest any, query string, args ...any) error {
+	s.args = append(s.args, args)
+	return nil
+}
+
+func (s *spyQuerier) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	s.args = append(s.args, args)
+	return driverResult(0), nil
+}
+
+type driverResult int64
+
+func (r driverResult) LastInsertId() (int64, error) { return 0, nil }
+func (r driverResult) RowsAffected() (int64, error) { return int64(r), nil }
+
+func TestQueryLoggerRedactsSecrets(t *testing.T) {
+	const secret = "uid-hash-0123456789abcdef"
+
+	for _, slow := range []time.Duration{0, time.Nanosecond} { // debug and slow query warning
+		var buf bytes.Buffer
+		ql := NewQueryLogger(slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})), slow)
+		spy := &spyQuerier{}
+		q := ql.Wrap(spy)
+		ctx := context.Background()
+
+		var dest []string
+		_ = q.GetContext(ctx, &dest, "SELECT * FROM users WHERE uid_hash = ? AND id = ?", Secret(secret), 42)
+		_ = q.SelectContext(ctx, &dest, "SELECT * FROM users WHERE uid_hash = ?", Secret(secret))
+		_, _ = q.ExecContext(ctx, "UPDATE users SET uid_hash = ? WHERE display_name = ?", Secret(secret), "alice")
+
+		out := buf.String()
+		if strings.Contains(out, secret) {
+			t.Errorf("slow=%s: secret in the log:\n%s", slow, out)
+		}
+		if n := strings.Count(out, "[REDACTED]"); n != 3 {
+			t.Errorf("slow=%s: %d redaction markers, want 3:\n%s", slow, n, out)
+		}
+		// other arguments stay readable
+		if !strings.Contains(out, "42") || !strings.Contains(out, "alice") {
+			t.Errorf("slow=%s: plain arguments missing:\n%s", slow, out)
+		}
+
+		// the driver gets the value as a plain string
+		if len(spy.args) != 3 {
+			t.Fatalf("driver calls = %d, want 3", len(spy.args))
+		}
+		for i, args := range spy.args {
+			if s, ok := args[0].(string); !ok || s != secret {
+				t.Errorf("slow=%s: call #%d: driver got %#v, want the plain string", slow, i+1, args[0])
+			}
+		}
+		if args := spy.args[0]; args[1] != 42 {
+			t.Errorf("slow=%s: driver got %#v, want 42 unchanged", slow, args[1])
+		}
+	}
+}
+
+func TestRedactArgs(t *testing.T) {
+	got := redactArgs([]any{Secret("token"), "token", 7, nil})
+	want := []string{"[REDACTED]", "token", "7", "<nil>"}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("redactArgs[%d] = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
@@ -1,29 +1,121 @@
 package db
 
 import (
+	"context"
 	"fmt"
+	"net/url"
+	"strings"
 
+	"github.com/axelrhd/hagg/internal/config"
 	"github.com/jmoiron/sqlx"
 	_ "modernc.org/sqlite"
 )
 
-// OpenSQLite opens a SQLite database with sane defaults.
-func OpenSQLite(path string) (*sqlx.DB, error) {
-	if path == "" {
+// SQLite bundles the two connection pools we use for one database file.
+//
+// SQLite only allows a single writer at a time. Instead of letting several
+// connections race for the write lock (and fail with SQLITE_BUSY), all writes
+// go through Write, which holds exactly one connection. Reads go through Read,
+// a multi-connection pool that WAL mode lets run concurrently with the writer.
+type SQLite struct {
+	Write *sqlx.DB
+	Read  *sqlx.DB
+}
+
+// Pragmas holds the effective connection settings as reported by SQLite.
+type Pragmas struct {
+	JournalMode string
+	ForeignKeys bool
+	BusyTimeout int // milliseconds
+	Synchronous int // 0=OFF 1=NORMAL 2=FULL 3=EXTRA
+	QueryOnly   bool
+}
+
+// OpenSQLite opens the writer and reader pools for the configured database
+// and verifies that the pragmas actually took effect.
+//
+// Pragmas are passed via modernc.org/sqlite's `_pragma=name(value)` DSN
+// syntax, so they are applied to every new connection in the pool.
+func OpenSQLite(cfg config.SQLiteConfig) (*SQLite, error) {
+	if cfg.Path == "" {
 		return nil, fmt.Errorf("sqlite path is empty")
 	}
 
-	// DSN with recommended pragmas
-	dsn := fmt.Sprintf(
-		"%s?_foreign_keys=on&_journal_mode=WAL&_busy_timeout=5000",
-		path,
-	)
+	write, err := openPool(cfg, false)
+	if err != nil {
+		return nil, fmt.Errorf("open sqlite writer: %w", err)
+	}
 
-	db, err := sqlx.Open("sqlite", dsn)
+	read, err := openPool(cfg, true)
 	if err != nil {
+		write.Close()
+		return nil, fmt.Errorf("open sqlite reader: %w", err)
+	}
+
+	s := &SQLite{Write: write, Read: read}
+
+	if err := s.verify(context.Background(), cfg); err != nil {
+		s.Close()
 		return nil, err
 	}
 
+	return s, nil
+}
+
+// Close closes both pools.
+func (s *SQLite) Close() error {
+	rerr := s.Read.Close()
+	werr := s.Write.Close()
+
+	if werr != nil {
+		return werr
+	}
+	return rerr
+}
+
+// Pragmas reports the effective settings of a connection from the given pool.
+func (s *SQLite) Pragmas(ctx context.Context, pool *sqlx.DB) (Pragmas, error) {
+	var p Pragmas
+
+	if err := pool.GetContext(ctx, &p.JournalMode, "PRAGMA journal_mode"); err != nil {
+		return p, err
+	}
+	if err := pool.GetContext(ctx, &p.ForeignKeys, "PRAGMA foreign_keys"); err != nil {
+		return p, err
+	}
+	if err := pool.GetContext(ctx, &p.BusyTimeout, "PRAGMA busy_timeout"); err != nil {
+		return p, err
+	}
+	if err := pool.GetContext(ctx, &p.Synchronous, "PRAGMA synchronous"); err != nil {
+		return p, err
+	}
+	if err := pool.GetContext(ctx, &p.QueryOnly, "PRAGMA query_only"); err != nil {
+		return p, err
+	}
+
+	p.JournalMode = strings.ToLower(p.JournalMode)
+	return p, nil
+}
+
+// ------------------------------------------------------------
+// Internals
+// ------------------------------------------------------------
+
+func openPool(cfg config.SQLiteConfig, readOnly bool) (*sqlx.DB, error) {
+	db, err := sqlx.Open("sqlite", dsn(cfg, readOnly))
+	if err != nil {
+		return nil, err
+	}
+
+	if readOnly {
+		db.SetMaxOpenConns(cfg.ReadConns)
+		db.SetMaxIdleConns(cfg.ReadConns)
+	} else {
+		// exactly one writer – SQLite serializes writes anyway
+		db.SetMaxOpenConns(1)
+		db.SetMaxIdleConns(1)
+	}
+
 	// verify connection
 	if err := db.Ping(); err != nil {
 		db.Close()
@@ -32,3 +124,68 @@ func OpenSQLite(path string) (*sqlx.DB, error) {
 
 	return db, nil
 }
+
+// dsn builds a modernc.org/sqlite DSN.
+//
+// Note: the mattn/go-sqlite3 style parameters (_foreign_keys=on,
+// _journal_mode=WAL, ...) are silently ignored by modernc.org/sqlite.
+func dsn(cfg config.SQLiteConfig, readOnly bool) string {
+	q := url.Values{}
+	q.Add("_pragma", fmt.Sprintf("busy_timeout(%d)", cfg.BusyTimeout.Milliseconds()))
+	q.Add("_pragma", "foreign_keys(1)")
+	q.Add("_pragma", "synchronous("+cfg.Synchronous+")")
+	// bind time.Time in a format SQLite's date functions understand
+	// (the default is time.Time.String, e.g. for the session store)
+	q.Set("_time_format", "sqlite")
+
+	if readOnly {
+		// the writer sets journal_mode (persistent in the file for WAL)
+		q.Add("_pragma", "query_only(1)")
+	} else {
+		q.Add("_pragma", "journal_mode("+cfg.JournalMode+")")
+		// take the write lock on BEGIN instead of on the first write,
+		// so busy_timeout applies and transactions don't deadlock on upgrade
+		q.Set("_txlock", "immediate")
+	}
+
+	return "file:" + cfg.Path + "?" + q.Encode()
+}
+
+// verify compares the effective pragmas of both pools with the config.
+func (s *SQLite) verify(ctx context.Context, cfg config.SQLiteConfig) error {
+	pools := []struct {
+		name     string
+		db       *sqlx.DB
+		readOnly bool
+	}{
+		{"writer", s.Write, false},
+		{"reader", s.Read, true},
+	}
+
+	for _, pool := range pools {
+		p, err := s.Pragmas(ctx, pool.db)
+		if err != nil {
+			return fmt.Errorf("read sqlite pragmas (%s): %w", pool.name, err)
+		}
+
+		// journal_mode is a property of the file only in WAL mode; readers
+		// of the other modes report the default and never write a journal
+		if !pool.readOnly && p.JournalMode != strings.ToLower(cfg.JournalMode) {
+			return fmt.Errorf("sqlite %s: journal_mode is %q, want %q", pool.name, p.JournalMode, strings.ToLower(cfg.JournalMode))
+		}
+		if !p.ForeignKeys {
+			return fmt.Errorf("sqlite %s: foreign_keys is off", pool.name)
+		}
+		if int64(p.BusyTimeout) != cfg.BusyTimeout.Milliseconds() {
+			return fmt.Errorf("sqlite %s: busy_timeout is %dms, want %dms", pool.name, p.BusyTimeout, cfg.BusyTimeout.Milliseconds())
+		}
+		if p.Synchronous != config.SynchronousLevels[strings.ToUpper(cfg.Synchronous)] {
+			return fmt.Errorf("sqlite %s: synchronous is %d, want %s", pool.name, p.Synchronous, cfg.Synchronous)
+		}
+		if p.QueryOnly != pool.readOnly {
+			return fmt.Errorf("sqlite %s: query_only is %t, want %t", pool.name, p.QueryOnly, pool.readOnly)
+		}
+	}
+
+	return nil
+}
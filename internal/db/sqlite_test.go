@@ -0,0 +1,92 @@
+package db
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/axelrhd/hagg/internal/config"
+)
+
+// testSQLiteConfig returns the settings of a fresh database file.
+func testSQLiteConfig(t *testing.T) config.SQLiteConfig {
+	t.Helper()
+
+	return config.SQLiteConfig{
+		Path:        filepath.Join(t.TempDir(), "test.sqlite3"),
+		JournalMode: "WAL",
+		Synchronous: "NORMAL",
+		BusyTimeout: 5 * time.Second,
+		ReadConns:   2,
+	}
+}
+
+func TestOpenSQLiteJournalModes(t *testing.T) {
+	for _, mode := range config.JournalModes {
+		t.Run(mode, func(t *testing.T) {
+			cfg := testSQLiteConfig(t)
+			cfg.JournalMode = mode
+
+			s, err := OpenSQLite(cfg)
+			if err != nil {
+				t.Fatalf("OpenSQLite: %v", err)
+			}
+			defer s.Close()
+
+			ctx := context.Background()
+			p, err := s.Pragmas(ctx, s.Write)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if p.JournalMode != strings.ToLower(mode) || p.QueryOnly {
+				t.Errorf("writer: journal_mode %q, query_only %t", p.JournalMode, p.QueryOnly)
+			}
+
+			// the reader sees what the writer wrote, but cannot write
+			if _, err := s.Write.ExecContext(ctx, `CREATE TABLE t (v INTEGER); INSERT INTO t VALUES (42)`); err != nil {
+				t.Fatal(err)
+			}
+			var v int
+			if err := s.Read.GetContext(ctx, &v, `SELECT v FROM t`); err != nil || v != 42 {
+				t.Errorf("read = %d, %v, want 42", v, err)
+			}
+			if _, err := s.Read.ExecContext(ctx, `INSERT INTO t VALUES (1)`); err == nil {
+				t.Error("reader wrote a row")
+			}
+		})
+	}
+}
+
+func TestOpenSQLitePragmas(t *testing.T) {
+	cfg := testSQLiteConfig(t)
+	cfg.Synchronous = "FULL"
+	cfg.BusyTimeout = 1500 * time.Millisecond
+
+	s, err := OpenSQLite(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	for name, pool := range map[string]bool{"writer": false, "reader": true} {
+		db := s.Write
+		if pool {
+			db = s.Read
+		}
+		p, err := s.Pragmas(context.Background(), db)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !p.ForeignKeys || p.BusyTimeout != 1500 || p.Synchronous != 2 || p.QueryOnly != pool {
+			t.Errorf("%s: %+v", name, p)
+		}
+	}
+}
+
+func TestOpenSQLiteEmptyPath(t *testing.T) {
+	if _, err := OpenSQLite(config.SQLiteConfig{}); err == nil {
+		t.Error("OpenSQLite(empty path) = nil, want an error")
+	}
+}
@@ -0,0 +1,79 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// Retry policy for transactions that hit SQLITE_BUSY.
+//
+// Inside one process this should not happen (single writer connection),
+// but the CLI and the server may write to the same file concurrently.
+const (
+	txMaxAttempts  = 5
+	txInitialDelay = 50 * time.Millisecond
+)
+
+// WithTx runs fn inside a write transaction on the writer pool.
+//
+// The transaction is committed if fn returns nil and rolled back otherwise.
+// If SQLite reports SQLITE_BUSY / SQLITE_LOCKED, the whole transaction is
+// retried with exponential backoff – so fn must not have side effects
+// outside of the transaction.
+func (s *SQLite) WithTx(ctx context.Context, fn func(tx *sqlx.Tx) error) error {
+	delay := txInitialDelay
+
+	var err error
+	for attempt := 1; attempt <= txMaxAttempts; attempt++ {
+		err = s.runTx(ctx, fn)
+		if err == nil || !IsBusy(err) {
+			return err
+		}
+
+		if attempt == txMaxAttempts {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+
+	return fmt.Errorf("transaction failed after %d attempts: %w", txMaxAttempts, err)
+}
+
+func (s *SQLite) runTx(ctx context.Context, fn func(tx *sqlx.Tx) error) error {
+	tx, err := s.Write.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if err := fn(tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// IsBusy reports whether err is SQLITE_BUSY or SQLITE_LOCKED
+// (including their extended result codes).
+func IsBusy(err error) bool {
+	var sqliteErr *sqlite.Error
+	if !errors.As(err, &sqliteErr) {
+		return false
+	}
+
+	// the primary result code is stored in the lower 8 bits
+	code := sqliteErr.Code() & 0xff
+	return code == sqlite3.SQLITE_BUSY || code == sqlite3.SQLITE_LOCKED
+}
@@ -0,0 +1,212 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// lockedDB opens a database with a short busy_timeout and returns a
+// function that takes the write lock from another connection (like the
+// CLI next to the server) until the returned release is called.
+func lockedDB(t *testing.T) (*SQLite, func() (release func())) {
+	t.Helper()
+
+	cfg := testSQLiteConfig(t)
+	cfg.BusyTimeout = 10 * time.Millisecond
+	s, err := OpenSQLite(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+
+	if _, err := s.Write.Exec(`CREATE TABLE t (v INTEGER)`); err != nil {
+		t.Fatal(err)
+	}
+
+	other, err := openSingle(cfg.Path, cfg, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { other.Close() })
+
+	lock := func() func() {
+		conn, err := other.Conn(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := conn.ExecContext(context.Background(), "BEGIN IMMEDIATE"); err != nil {
+			t.Fatal(err)
+		}
+		return func() {
+			_, _ = conn.ExecContext(context.Background(), "COMMIT")
+			conn.Close()
+		}
+	}
+
+	return s, lock
+}
+
+// busyError returns a real SQLITE_BUSY error of s.
+func busyError(t *testing.T, s *SQLite, lock func() func()) error {
+	t.Helper()
+
+	release := lock()
+	defer release()
+
+	_, err := s.Write.Exec(`INSERT INTO t VALUES (0)`)
+	if !IsBusy(err) {
+		t.Fatalf("write while locked = %v, want SQLITE_BUSY", err)
+	}
+	return err
+}
+
+func values(t *testing.T, s *SQLite) []int {
+	t.Helper()
+
+	var vs []int
+	if err := s.Read.Select(&vs, `SELECT v FROM t ORDER BY rowid`); err != nil {
+		t.Fatal(err)
+	}
+	return vs
+}
+
+func TestIsBusy(t *testing.T) {
+	s, lock := lockedDB(t)
+	busy := busyError(t, s, lock)
+
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{errors.New("database is locked"), false}, // only the code counts
+		{busy, true},
+		{fmt.Errorf("insert: %w", busy), true},
+	}
+
+	for _, tt := range tests {
+		if got := IsBusy(tt.err); got != tt.want {
+			t.Errorf("IsBusy(%v) = %t, want %t", tt.err, got, tt.want)
+		}
+	}
+
+	// other SQLite errors are not retried
+	_, err := s.Write.Exec(`INSERT INTO missing VALUES (1)`)
+	if err == nil || IsBusy(err) {
+		t.Errorf("IsBusy(%v) = true", err)
+	}
+}
+
+func TestWithTxRetriesBusy(t *testing.T) {
+	s, lock := lockedDB(t)
+	busy := busyError(t, s, lock)
+
+	// the first attempt is rolled back, fn runs again from scratch
+	calls := 0
+	err := s.WithTx(context.Background(), func(tx *sqlx.Tx) error {
+		calls++
+		if _, err := tx.Exec(`INSERT INTO t VALUES (?)`, calls); err != nil {
+			return err
+		}
+		if calls == 1 {
+			return fmt.Errorf("step 2: %w", busy)
+		}
+		return nil
+	})
+	if err != nil || calls != 2 {
+		t.Fatalf("WithTx = %v after %d calls, want nil after 2", err, calls)
+	}
+	if got := values(t, s); !slices.Equal(got, []int{2}) {
+		t.Errorf("rows = %v, want only the second attempt", got)
+	}
+}
+
+func TestWithTxNoRetry(t *testing.T) {
+	s, _ := lockedDB(t)
+	ctx := context.Background()
+	errAbort := errors.New("abort")
+
+	// committed: fn runs once
+	calls := 0
+	err := s.WithTx(ctx, func(tx *sqlx.Tx) error {
+		calls++
+		_, err := tx.Exec(`INSERT INTO t VALUES (1)`)
+		return err
+	})
+	if err != nil || calls != 1 {
+		t.Fatalf("WithTx = %v after %d calls, want nil after 1", err, calls)
+	}
+
+	// other errors roll back without a retry
+	calls = 0
+	err = s.WithTx(ctx, func(tx *sqlx.Tx) error {
+		calls++
+		if _, err := tx.Exec(`INSERT INTO t VALUES (2)`); err != nil {
+			return err
+		}
+		return errAbort
+	})
+	if !errors.Is(err, errAbort) || calls != 1 {
+		t.Fatalf("WithTx = %v after %d calls, want errAbort after 1", err, calls)
+	}
+
+	if got := values(t, s); !slices.Equal(got, []int{1}) {
+		t.Errorf("rows = %v, want only the committed one", got)
+	}
+}
+
+func TestWithTxGivesUp(t *testing.T) {
+	s, lock := lockedDB(t)
+	busy := busyError(t, s, lock)
+
+	calls := 0
+	err := s.WithTx(context.Background(), func(tx *sqlx.Tx) error {
+		calls++
+		return busy
+	})
+	if !IsBusy(err) || calls != txMaxAttempts {
+		t.Errorf("WithTx = %v after %d calls, want SQLITE_BUSY after %d", err, calls, txMaxAttempts)
+	}
+}
+
+func TestWithTxCanceled(t *testing.T) {
+	s, lock := lockedDB(t)
+	busy := busyError(t, s, lock)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := 0
+	err := s.WithTx(ctx, func(tx *sqlx.Tx) error {
+		calls++
+		cancel()
+		return busy
+	})
+	if !errors.Is(err, context.Canceled) || calls != 1 {
+		t.Errorf("WithTx = %v after %d calls, want context.Canceled after 1", err, calls)
+	}
+}
+
+func TestWithTxWaitsForOtherWriter(t *testing.T) {
+	s, lock := lockedDB(t)
+
+	// BEGIN IMMEDIATE fails while the other connection writes; the retries
+	// outlast it
+	release := lock()
+	time.AfterFunc(120*time.Millisecond, release)
+
+	err := s.WithTx(context.Background(), func(tx *sqlx.Tx) error {
+		_, err := tx.Exec(`INSERT INTO t VALUES (1)`)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("WithTx = %v", err)
+	}
+	if got := values(t, s); !slices.Equal(got, []int{1}) {
+		t.Errorf("rows = %v", got)
+	}
+}
@@ -73,6 +73,54 @@ func Navbar(ctx *handler.Context, deps app.Deps, oob bool) g.Node {
 							),
 						),
 					),
+
+					// Show Password link if authenticated
+					g.If(isAuthenticated,
+						Li(
+							Class("nav-item"),
+							A(
+								Class("nav-link"),
+								Href(view.URLString(ctx.Req, "/account/password")),
+								g.Text("Password"),
+							),
+						),
+					),
+
+					// Show 2FA link if authenticated
+					g.If(isAuthenticated,
+						Li(
+							Class("nav-item"),
+							A(
+								Class("nav-link"),
+								Href(view.URLString(ctx.Req, "/account/2fa")),
+								g.Text("2FA"),
+							),
+						),
+					),
+
+					// Show Passkeys link if authenticated and enabled
+					g.If(isAuthenticated && deps.Auth.PasskeysEnabled(),
+						Li(
+							Class("nav-item"),
+							A(
+								Class("nav-link"),
+								Href(view.URLString(ctx.Req, "/account/passkeys")),
+								g.Text("Passkeys"),
+							),
+						),
+					),
+
+					// Show Devices link if authenticated
+					g.If(isAuthenticated,
+						Li(
+							Class("nav-item"),
+							A(
+								Class("nav-link"),
+								Href(view.URLString(ctx.Req, "/account/sessions")),
+								g.Text("Devices"),
+							),
+						),
+					),
 				),
 
 				// Right nav items
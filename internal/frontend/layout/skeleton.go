@@ -76,6 +76,9 @@ func Skeleton(req *http.Request, content ...g.Node) g.Node {
 				// --- TOAST JS ---
 				Script(Src("/static/js/toast.js")),
 
+				// --- PASSKEY JS (WebAuthn, needs htmx + toast) ---
+				Script(Src("/static/js/passkey.js")),
+
 				// --- APP CSS (custom overrides) ---
 				Link(Rel("stylesheet"), Href("/static/css/app.css")),
 			),
@@ -4,6 +4,7 @@ import (
 	"github.com/axelrhd/hagg-lib/handler"
 	"github.com/axelrhd/hagg/internal/app"
 	"github.com/axelrhd/hagg/internal/frontend/layout"
+	usr "github.com/axelrhd/hagg/internal/user"
 	g "maragu.dev/gomponents"
 	. "maragu.dev/gomponents/html"
 )
@@ -20,6 +21,16 @@ func Page(deps app.Deps) handler.HandlerFunc {
 			username = user.FullName()
 		}
 
+		// recent login attempts – failed ones may hint at a leaked UID
+		var events []*usr.LoginEvent
+		if user != nil {
+			var err error
+			events, err = deps.Users.LoginEvents(ctx.Req.Context(), user.ID, recentLogins)
+			if err != nil {
+				return err
+			}
+		}
+
 		content := Div(
 			Class("container py-4"),
 
@@ -53,18 +64,26 @@ func Page(deps app.Deps) handler.HandlerFunc {
 						),
 						g.If(user != nil,
 							P(
-								Strong(g.Text("UID: ")),
-								Code(g.Text(user.UID)),
+								Strong(g.Text("User ID: ")),
+								Code(g.Textf("%d", user.ID)),
 							),
 						),
 						P(
-							Class("mb-0"),
 							Strong(g.Text("Status: ")),
 							Span(
 								Class("text-success"),
 								g.Text("✓ Authenticated"),
 							),
 						),
+						g.If(user != nil,
+							P(
+								Strong(g.Text("Logins: ")),
+								g.Textf("%d", user.LoginCount),
+							),
+						),
+						g.If(len(events) > 0,
+							loginEvents(events),
+						),
 					),
 				),
 
@@ -187,3 +206,25 @@ func Page(deps app.Deps) handler.HandlerFunc {
 		return ctx.Render(layout.Page(ctx, deps, content))
 	}
 }
+
+// recentLogins is the number of login attempts shown on the user card.
+const recentLogins = 5
+
+// loginEvents renders the latest login attempts of the current user.
+func loginEvents(events []*usr.LoginEvent) g.Node {
+	return Div(
+		Strong(g.Text("Recent logins:")),
+		Ul(
+			Class("list-unstyled small mb-0 mt-1"),
+			g.Map(events, func(ev *usr.LoginEvent) g.Node {
+				return Li(
+					g.If(ev.Success, Span(Class("text-success"), g.Text("✓ "))),
+					g.If(!ev.Success, Span(Class("text-danger"), g.Text("✘ "))),
+					g.Text(ev.CreatedAt.String()),
+					Span(Class("text-body-secondary"), g.Text(" · "+ev.IP)),
+					g.If(!ev.Success, Span(Class("text-danger"), g.Text(" · "+ev.Reason))),
+				)
+			}),
+		),
+	)
+}
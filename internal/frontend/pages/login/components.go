@@ -1,20 +1,53 @@
 package login
 
 import (
+	"github.com/axelrhd/hagg/internal/config"
 	g "maragu.dev/gomponents"
 	hx "maragu.dev/gomponents-htmx"
 	. "maragu.dev/gomponents/html"
 )
 
-// LoginForm renders a simple UID-only login form.
+// LoginForm renders the login form for the login mode (config.LoginMode*):
+// UID, UID + password, or display name + password.
 // Framework-agnostic - accepts URL string instead of context.
 //
+// alternatives are shown below the form (nil: nothing), e.g. PasskeyLogin
+// and MagicLinkRequest.
+//
 // Usage:
 //
 //	loginURL := view.URLString(ctx, "/htmx/login")  // Gin
 //	loginURL := view.URLString(req, "/htmx/login")  // Chi
-//	LoginForm(loginURL)
-func LoginForm(loginURL string) g.Node {
+//	LoginForm(loginURL, deps.Auth.Mode())
+func LoginForm(loginURL, mode string, alternatives ...g.Node) g.Node {
+	withPassword := mode != config.LoginModeUID
+
+	// first field: who is logging in
+	var identity g.Node
+	if mode == config.LoginModeDisplayNamePassword {
+		identity = Input(
+			Type("text"),
+			Class("form-control"),
+			ID("display_name"),
+			Name("display_name"),
+			Placeholder("Benutzername"),
+			AutoComplete("username"),
+			Required(),
+			AutoFocus(),
+		)
+	} else {
+		identity = Input(
+			Type("password"),
+			Class("form-control"),
+			ID("uid"),
+			Name("uid"),
+			Placeholder("UID"),
+			AutoComplete("off"),
+			Required(),
+			AutoFocus(),
+		)
+	}
+
 	return Article(
 		Class("container-narrow card p-4"),
 
@@ -26,14 +59,218 @@ func LoginForm(loginURL string) g.Node {
 		Form(
 			hx.Post(loginURL),
 
+			Div(
+				Class("mb-3"),
+				identity,
+			),
+
+			g.If(withPassword,
+				Div(
+					Class("mb-3"),
+					Input(
+						Type("password"),
+						Class("form-control"),
+						ID("password"),
+						Name("password"),
+						Placeholder("Passwort"),
+						AutoComplete("current-password"),
+						Required(),
+					),
+				),
+			),
+
+			Button(
+				Type("submit"),
+				Class("btn btn-primary w-100"),
+				g.Text("Anmelden"),
+			),
+		),
+
+		g.Group(alternatives),
+	)
+}
+
+// PasskeyLogin renders the passkey login button (static/js/passkey.js).
+// The browser offers the passkeys of this site, no UID is needed.
+// Framework-agnostic - accepts URL strings instead of context.
+//
+// Usage:
+//
+//	beginURL := view.URLString(req, "/htmx/login/passkey/begin")
+//	finishURL := view.URLString(req, "/htmx/login/passkey")
+//	LoginForm(loginURL, mode, PasskeyLogin(beginURL, finishURL))
+func PasskeyLogin(beginURL, finishURL string) g.Node {
+	return Div(
+		g.Attr("data-passkey-only", ""),
+
+		Div(
+			Class("text-center text-body-secondary small my-3"),
+			g.Text("oder"),
+		),
+
+		Button(
+			Type("button"),
+			Class("btn btn-outline-primary w-100"),
+			g.Attr("data-passkey", "login"),
+			g.Attr("data-passkey-begin", beginURL),
+			g.Attr("data-passkey-finish", finishURL),
+			I(Class("bi bi-fingerprint me-2")),
+			g.Text("Mit Passkey anmelden"),
+		),
+	)
+}
+
+// SSOLogin renders the link to the external identity provider. It is a
+// normal link, not an HTMX request: the browser leaves the site.
+// Framework-agnostic - accepts URL string instead of context.
+//
+// Usage:
+//
+//	startURL := view.URLString(req, "/auth/oidc/login")
+//	LoginForm(loginURL, mode, SSOLogin(startURL, deps.OIDC.ButtonLabel()))
+func SSOLogin(startURL, label string) g.Node {
+	return Div(
+		Div(
+			Class("text-center text-body-secondary small my-3"),
+			g.Text("oder"),
+		),
+
+		A(
+			Class("btn btn-outline-primary w-100"),
+			Href(startURL),
+			I(Class("bi bi-box-arrow-in-right me-2")),
+			g.Text(label),
+		),
+	)
+}
+
+// MagicLinkRequest renders the form that requests a login link by mail.
+// It is folded away, the login form stays the main way in.
+// Framework-agnostic - accepts URL string instead of context.
+//
+// Usage:
+//
+//	requestURL := view.URLString(req, "/htmx/login/link")
+//	LoginForm(loginURL, mode, MagicLinkRequest(requestURL))
+func MagicLinkRequest(requestURL string) g.Node {
+	return Details(
+		Class("mt-3"),
+
+		Summary(
+			Class("text-center text-body-secondary small"),
+			g.Text("Login-Link per E-Mail anfordern"),
+		),
+
+		Form(
+			hx.Post(requestURL),
+			// the address stays in the field, the toast tells what happened
+			hx.Swap("none"),
+			Class("mt-3"),
+
 			Div(
 				Class("mb-3"),
 				Input(
-					Type("password"),
+					Type("email"),
 					Class("form-control"),
-					ID("uid"),
-					Name("uid"),
-					Placeholder("UID"),
+					ID("email"),
+					Name("email"),
+					Placeholder("E-Mail-Adresse"),
+					AutoComplete("email"),
+					Required(),
+				),
+			),
+
+			Button(
+				Type("submit"),
+				Class("btn btn-outline-primary w-100"),
+				I(Class("bi bi-envelope me-2")),
+				g.Text("Link senden"),
+			),
+		),
+	)
+}
+
+// MagicLinkConfirm asks to confirm the login from a link. The token is only
+// used up by the button, not by opening the link.
+// Framework-agnostic - accepts URL string instead of context.
+//
+// Usage:
+//
+//	confirmURL := view.URLString(req, "/htmx/login/link/confirm")
+//	MagicLinkConfirm(confirmURL, tok, u.FullName())
+func MagicLinkConfirm(confirmURL, tok, username string) g.Node {
+	return Article(
+		Class("container-narrow text-center card p-4"),
+		H3(g.Text("Anmelden")),
+		P(
+			g.Text("Mit diesem Link meldest du dich an als "),
+			Strong(g.Text(username)),
+			g.Text("."),
+		),
+		Form(
+			hx.Post(confirmURL),
+			Input(Type("hidden"), Name("token"), Value(tok)),
+			Button(
+				Type("submit"),
+				Class("btn btn-primary"),
+				AutoFocus(),
+				g.Text("Jetzt anmelden"),
+			),
+		),
+	)
+}
+
+// MagicLinkInvalid tells that a login link cannot be used (anymore).
+// Framework-agnostic - accepts URL string instead of context.
+func MagicLinkInvalid(message, loginPageURL string) g.Node {
+	return Article(
+		Class("container-narrow text-center card p-4"),
+		H3(g.Text("Login-Link")),
+		P(Class("text-danger"), g.Text(message+".")),
+		A(
+			Class("btn btn-outline-primary"),
+			Href(loginPageURL),
+			g.Text("Neuen Link anfordern"),
+		),
+	)
+}
+
+// TOTPForm renders the second login step: a code from the authenticator
+// app or a recovery code. Cancel ends the pending login.
+// Framework-agnostic - accepts URL strings instead of context.
+//
+// Usage:
+//
+//	verifyURL := view.URLString(req, "/htmx/login/2fa")
+//	logoutURL := view.URLString(req, "/htmx/logout")
+//	TOTPForm(verifyURL, logoutURL)
+func TOTPForm(verifyURL, logoutURL string) g.Node {
+	return Article(
+		Class("container-narrow card p-4"),
+
+		H1(
+			Class("text-center mb-4"),
+			g.Text("Bestätigung"),
+		),
+
+		P(
+			Class("text-body-secondary"),
+			g.Text("Gib den Code aus deiner Authenticator-App ein – oder einen deiner Recovery-Codes."),
+		),
+
+		Form(
+			hx.Post(verifyURL),
+
+			Div(
+				Class("mb-3"),
+				Input(
+					Type("text"),
+					Class("form-control text-center"),
+					ID("code"),
+					Name("code"),
+					Placeholder("123456"),
+					AutoComplete("one-time-code"),
+					g.Attr("inputmode", "numeric"),
 					Required(),
 					AutoFocus(),
 				),
@@ -42,9 +279,31 @@ func LoginForm(loginURL string) g.Node {
 			Button(
 				Type("submit"),
 				Class("btn btn-primary w-100"),
-				g.Text("Anmelden"),
+				g.Text("Bestätigen"),
 			),
 		),
+
+		Button(
+			Type("button"),
+			Class("btn btn-link w-100 mt-2"),
+			hx.Post(logoutURL),
+			g.Text("Abbrechen"),
+		),
+	)
+}
+
+// EnrollNotice tells a pending login that 2FA has to be set up first.
+// Framework-agnostic - accepts URL string instead of context.
+func EnrollNotice(enrollURL string) g.Node {
+	return Article(
+		Class("container-narrow text-center card p-4"),
+		H3(g.Text("Zwei-Faktor-Authentifizierung")),
+		P(g.Text("Deine Rolle verlangt einen zweiten Faktor. Richte ihn ein, um die Anmeldung abzuschließen.")),
+		A(
+			Class("btn btn-primary"),
+			Href(enrollURL),
+			g.Text("Jetzt einrichten"),
+		),
 	)
 }
 
@@ -1,13 +1,27 @@
 package login
 
 import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
 	"github.com/axelrhd/hagg-lib/handler"
+	"github.com/axelrhd/hagg-lib/view"
 	"github.com/axelrhd/hagg/internal/app"
+	"github.com/axelrhd/hagg/internal/auth"
+	"github.com/axelrhd/hagg/internal/config"
 	"github.com/axelrhd/hagg/internal/shared"
+	"github.com/axelrhd/hagg/internal/throttle"
+	"github.com/axelrhd/hagg/internal/token"
+	"github.com/axelrhd/hagg/internal/user"
 )
 
 // HxLogin handles HTMX login requests.
-// It validates the UID, attempts login, and returns appropriate toast notifications.
+// It validates the credentials of the login mode, attempts login, and
+// returns appropriate toast notifications.
 func HxLogin(deps app.Deps) handler.HandlerFunc {
 	return func(ctx *handler.Context) error {
 		// Parse form data
@@ -16,17 +30,145 @@ func HxLogin(deps app.Deps) handler.HandlerFunc {
 			return ctx.NoContent()
 		}
 
-		uid := ctx.Req.FormValue("uid")
-		if uid == "" {
+		cred := auth.Credentials{
+			UID:         ctx.Req.FormValue("uid"),
+			DisplayName: ctx.Req.FormValue("display_name"),
+			Password:    ctx.Req.FormValue("password"),
+		}
+
+		mode := deps.Auth.Mode()
+		switch {
+		case mode == config.LoginModeDisplayNamePassword && cred.DisplayName == "":
+			ctx.Toast("Display name is required").Error().Notify()
+			return ctx.NoContent()
+		case mode != config.LoginModeDisplayNamePassword && cred.UID == "":
 			ctx.Toast("UID is required").Error().Notify()
 			return ctx.NoContent()
+		case mode != config.LoginModeUID && cred.Password == "":
+			ctx.Toast("Password is required").Error().Notify()
+			return ctx.NoContent()
 		}
 
 		// Attempt login
-		_, err := deps.Auth.Login(ctx.Req, uid)
+		_, err := deps.Auth.Login(ctx.Req, cred)
+		var blocked *throttle.BlockedError
+		switch {
+		case errors.As(err, &blocked):
+			blockedToast(ctx, blocked)
+			return ctx.NoContent()
+		case errors.Is(err, auth.ErrTOTPRequired):
+			// the login page re-renders with the code form
+			ctx.Event("auth-changed", true)
+			return ctx.NoContent()
+		case errors.Is(err, auth.ErrTOTPEnrollRequired):
+			ctx.Res.Header().Set("HX-Redirect", view.URLString(ctx.Req, "/account/2fa"))
+			return ctx.NoContent()
+		case err != nil:
+			ctx.Toast(err.Error()).Error().Notify()
+			return ctx.NoContent()
+		}
+
+		// Success
+		ctx.Toast("Login erfolgreich.").Success().Notify()
+		ctx.Event("auth-changed", true)
+		return ctx.NoContent()
+	}
+}
+
+// blockedToast tells the user when the next login attempt is possible.
+func blockedToast(ctx *handler.Context, blocked *throttle.BlockedError) {
+	wait := max(int(math.Ceil(time.Until(blocked.RetryAt).Seconds())), 1)
+	ctx.Res.Header().Set("Retry-After", strconv.Itoa(wait))
+
+	msg := fmt.Sprintf("%s (um %s Uhr).", blocked.Error(), blocked.RetryAt.Format("15:04:05"))
+	if blocked.Global {
+		msg = "Zurzeit schlagen ungewöhnlich viele Anmeldungen fehl. " + msg
+	}
+	ctx.Toast(msg).Warning().Notify()
+}
+
+// HxVerifyTOTP handles the second login step (code or recovery code).
+func HxVerifyTOTP(deps app.Deps) handler.HandlerFunc {
+	return func(ctx *handler.Context) error {
+		// Parse form data
+		if err := ctx.Req.ParseForm(); err != nil {
+			ctx.Toast("Invalid form data").Error().Notify()
+			return ctx.NoContent()
+		}
+
+		code := ctx.Req.FormValue("code")
+		if code == "" {
+			ctx.Toast("Code is required").Error().Notify()
+			return ctx.NoContent()
+		}
+
+		_, err := deps.Auth.VerifyTOTP(ctx.Req, code)
+		var blocked *throttle.BlockedError
+		switch {
+		case errors.As(err, &blocked):
+			// re-render: the code form, or the login form if this was the
+			// last try of the pending login
+			blockedToast(ctx, blocked)
+			ctx.Event("auth-changed", true)
+			return ctx.NoContent()
+		case errors.Is(err, auth.ErrNoPendingLogin), errors.Is(err, auth.ErrTooManyCodes):
+			// back to the login form
+			ctx.Toast(err.Error()).Error().Notify()
+			ctx.Event("auth-changed", true)
+			return ctx.NoContent()
+		case errors.Is(err, user.ErrInvalidCode):
+			ctx.Toast(err.Error()).Error().Notify()
+			return ctx.NoContent()
+		case err != nil:
+			return err
+		}
+
+		// Success
+		ctx.Toast("Login erfolgreich.").Success().Notify()
+		ctx.Event("auth-changed", true)
+		return ctx.NoContent()
+	}
+}
+
+// HxPasskeyBegin returns the WebAuthn options of a passkey login (JSON for
+// static/js/passkey.js).
+func HxPasskeyBegin(deps app.Deps) handler.HandlerFunc {
+	return func(ctx *handler.Context) error {
+		assertion, err := deps.Auth.BeginPasskeyLogin(ctx.Req)
+		if errors.Is(err, auth.ErrPasskeysDisabled) {
+			return shared.WriteJSONError(ctx, http.StatusNotFound, err.Error())
+		}
 		if err != nil {
+			return err
+		}
+
+		return shared.WriteJSON(ctx, http.StatusOK, assertion)
+	}
+}
+
+// HxPasskeyLogin verifies the passkey chosen in the browser and logs its
+// owner in (no second factor step).
+func HxPasskeyLogin(deps app.Deps) handler.HandlerFunc {
+	return func(ctx *handler.Context) error {
+		credential := ctx.Req.FormValue("credential")
+		if credential == "" {
+			ctx.Toast("Invalid form data").Error().Notify()
+			return ctx.NoContent()
+		}
+
+		_, err := deps.Auth.FinishPasskeyLogin(ctx.Req, []byte(credential))
+		switch {
+		case errors.Is(err, auth.ErrPasskeysDisabled),
+			errors.Is(err, auth.ErrPasskeyFailed),
+			errors.Is(err, auth.ErrPasskeyExpired),
+			// the user may not log in
+			errors.Is(err, user.ErrDisabled),
+			errors.Is(err, user.ErrLocked),
+			errors.Is(err, user.ErrExpired):
 			ctx.Toast(err.Error()).Error().Notify()
 			return ctx.NoContent()
+		case err != nil:
+			return err
 		}
 
 		// Success
@@ -36,8 +178,133 @@ func HxLogin(deps app.Deps) handler.HandlerFunc {
 	}
 }
 
+// HxRequestMagicLink mails a login link. The answer is the same whether
+// the address belongs to a user or not.
+func HxRequestMagicLink(deps app.Deps) handler.HandlerFunc {
+	return func(ctx *handler.Context) error {
+		email := ctx.Req.FormValue("email")
+		if email == "" {
+			ctx.Toast("Email is required").Error().Notify()
+			return ctx.NoContent()
+		}
+
+		err := deps.Auth.SendMagicLink(ctx.Req.Context(), email)
+		switch {
+		case errors.Is(err, auth.ErrMagicLinkDisabled), errors.Is(err, user.ErrInvalidEmail):
+			ctx.Toast(err.Error()).Error().Notify()
+			return ctx.NoContent()
+		case err != nil:
+			return err
+		}
+
+		ctx.Toast("Falls ein Konto mit dieser Adresse existiert, ist ein Login-Link unterwegs.").Success().Notify()
+		return ctx.NoContent()
+	}
+}
+
+// HxMagicLinkLogin uses up the login link confirmed on LinkPage and
+// continues like HxLogin (second factor, enrolment).
+func HxMagicLinkLogin(deps app.Deps) handler.HandlerFunc {
+	return func(ctx *handler.Context) error {
+		tok := ctx.Req.FormValue("token")
+		if tok == "" {
+			ctx.Toast("Invalid form data").Error().Notify()
+			return ctx.NoContent()
+		}
+
+		_, err := deps.Auth.LoginWithMagicLink(ctx.Req, tok)
+		switch {
+		case errors.Is(err, auth.ErrTOTPRequired):
+			// the login page shows the code form
+			ctx.Res.Header().Set("HX-Redirect", view.URLString(ctx.Req, "/login"))
+			return ctx.NoContent()
+		case errors.Is(err, auth.ErrTOTPEnrollRequired):
+			ctx.Res.Header().Set("HX-Redirect", view.URLString(ctx.Req, "/account/2fa"))
+			return ctx.NoContent()
+		case errors.Is(err, auth.ErrMagicLinkDisabled),
+			errors.Is(err, token.ErrInvalid),
+			errors.Is(err, token.ErrExpired),
+			errors.Is(err, user.ErrTokenUsed),
+			// the user may not log in
+			errors.Is(err, user.ErrDisabled),
+			errors.Is(err, user.ErrLocked),
+			errors.Is(err, user.ErrExpired):
+			ctx.Toast(err.Error()).Error().Notify()
+			return ctx.NoContent()
+		case err != nil:
+			return err
+		}
+
+		// Success: the toast would not survive the redirect
+		shared.SetFlash(ctx, "success", "Login erfolgreich.")
+		ctx.Res.Header().Set("HX-Redirect", view.URLString(ctx.Req, "/"))
+		return ctx.NoContent()
+	}
+}
+
+// SSOStart redirects to the identity provider (auth.OIDCLoginPath).
+func SSOStart(deps app.Deps) handler.HandlerFunc {
+	return func(ctx *handler.Context) error {
+		if deps.Auth.IsAuthenticated(ctx.Req) {
+			http.Redirect(ctx.Res, ctx.Req, view.URLString(ctx.Req, "/"), http.StatusSeeOther)
+			return nil
+		}
+
+		target, err := deps.OIDC.Start(ctx.Req)
+		switch {
+		case errors.Is(err, auth.ErrOIDCDisabled), errors.Is(err, auth.ErrOIDCFailed):
+			// provider unreachable: back to the other ways in
+			shared.SetFlash(ctx, "error", err.Error()+".")
+			http.Redirect(ctx.Res, ctx.Req, view.URLString(ctx.Req, "/login"), http.StatusSeeOther)
+			return nil
+		case err != nil:
+			return err
+		}
+
+		http.Redirect(ctx.Res, ctx.Req, target, http.StatusFound)
+		return nil
+	}
+}
+
+// SSOCallback completes the login when the identity provider redirects
+// back (auth.OIDCCallbackPath) and continues like HxLogin (second factor,
+// enrolment). It answers with redirects, the messages are flashes.
+func SSOCallback(deps app.Deps) handler.HandlerFunc {
+	return func(ctx *handler.Context) error {
+		redirect := func(path string) error {
+			http.Redirect(ctx.Res, ctx.Req, view.URLString(ctx.Req, path), http.StatusSeeOther)
+			return nil
+		}
+
+		_, err := deps.OIDC.Callback(ctx.Req)
+		switch {
+		case errors.Is(err, auth.ErrTOTPRequired):
+			// the login page shows the code form
+			return redirect("/login")
+		case errors.Is(err, auth.ErrTOTPEnrollRequired):
+			return redirect("/account/2fa")
+		case errors.Is(err, auth.ErrOIDCDisabled),
+			errors.Is(err, auth.ErrOIDCExpired),
+			errors.Is(err, auth.ErrOIDCCancelled),
+			errors.Is(err, auth.ErrOIDCFailed),
+			errors.Is(err, auth.ErrOIDCNoAccount),
+			// the user may not log in
+			errors.Is(err, user.ErrDisabled),
+			errors.Is(err, user.ErrLocked),
+			errors.Is(err, user.ErrExpired):
+			shared.SetFlash(ctx, "error", err.Error()+".")
+			return redirect("/login")
+		case err != nil:
+			return err
+		}
+
+		shared.SetFlash(ctx, "success", "Login erfolgreich.")
+		return redirect("/")
+	}
+}
+
 // HxLogout handles HTMX logout requests.
-// It clears the session, sets a flash message, and redirects to home.
+// It destroys the session, sets a flash message, and redirects to home.
 func HxLogout(deps app.Deps) handler.HandlerFunc {
 	return func(ctx *handler.Context) error {
 		err := deps.Auth.Logout(ctx.Req)
@@ -1,17 +1,23 @@
 package login
 
 import (
+	"errors"
+	"net/http"
+
 	"github.com/axelrhd/hagg-lib/handler"
 	"github.com/axelrhd/hagg-lib/view"
 	"github.com/axelrhd/hagg/internal/app"
+	"github.com/axelrhd/hagg/internal/auth"
 	"github.com/axelrhd/hagg/internal/frontend/layout"
+	"github.com/axelrhd/hagg/internal/token"
 	g "maragu.dev/gomponents"
 	hx "maragu.dev/gomponents-htmx"
 	. "maragu.dev/gomponents/html"
 )
 
 // Page is the login page handler.
-// It renders the login form or logout button depending on authentication status.
+// It renders the login form, the second factor step of a pending login, or
+// the logout button depending on authentication status.
 func Page(deps app.Deps) handler.HandlerFunc {
 	return func(ctx *handler.Context) error {
 		user, _ := deps.Auth.CurrentUser(ctx.Req)
@@ -25,6 +31,10 @@ func Page(deps app.Deps) handler.HandlerFunc {
 			username = user.FullName()
 		}
 
+		// first factor done, second factor missing
+		pending, isPending := deps.Auth.PendingLogin(ctx.Req)
+		authenticated := deps.Auth.IsAuthenticated(ctx.Req)
+
 		content := Div(
 			// HTMX auto-refresh on auth-changed event
 			hx.Post(view.URLString(ctx.Req, "/login")),
@@ -37,11 +47,32 @@ func Page(deps app.Deps) handler.HandlerFunc {
 			Class("d-flex align-items-center justify-content-center p-3"),
 			Style("min-height: 80vh"),
 
-			g.If(!deps.Auth.IsAuthenticated(ctx.Req),
-				LoginForm(loginURL),
+			g.If(!authenticated && !isPending,
+				LoginForm(loginURL, deps.Auth.Mode(),
+					g.Iff(deps.OIDC.Enabled(), func() g.Node {
+						return SSOLogin(view.URLString(ctx.Req, auth.OIDCLoginPath), deps.OIDC.ButtonLabel())
+					}),
+					g.If(deps.Auth.PasskeysEnabled(),
+						PasskeyLogin(
+							view.URLString(ctx.Req, "/htmx/login/passkey/begin"),
+							view.URLString(ctx.Req, "/htmx/login/passkey"),
+						),
+					),
+					g.If(deps.Auth.MagicLinksEnabled(),
+						MagicLinkRequest(view.URLString(ctx.Req, "/htmx/login/link")),
+					),
+				),
+			),
+
+			g.If(!authenticated && isPending && !pending.Enroll,
+				TOTPForm(view.URLString(ctx.Req, "/htmx/login/2fa"), logoutURL),
+			),
+
+			g.If(!authenticated && isPending && pending.Enroll,
+				EnrollNotice(view.URLString(ctx.Req, "/account/2fa")),
 			),
 
-			g.If(deps.Auth.IsAuthenticated(ctx.Req) && username != "",
+			g.If(authenticated && username != "",
 				LogoutButton(logoutURL, username),
 			),
 		)
@@ -49,3 +80,37 @@ func Page(deps app.Deps) handler.HandlerFunc {
 		return ctx.Render(layout.Page(ctx, deps, content))
 	}
 }
+
+// LinkPage is opened from the login link mail (auth.MagicLinkPath). It
+// checks the link and asks to confirm the login; logged-in users go home.
+func LinkPage(deps app.Deps) handler.HandlerFunc {
+	return func(ctx *handler.Context) error {
+		if deps.Auth.IsAuthenticated(ctx.Req) {
+			http.Redirect(ctx.Res, ctx.Req, view.URLString(ctx.Req, "/"), http.StatusSeeOther)
+			return nil
+		}
+
+		tok := ctx.Req.URL.Query().Get("token")
+
+		var card g.Node
+		u, err := deps.Auth.MagicLinkUser(ctx.Req.Context(), tok)
+		switch {
+		case err == nil:
+			card = MagicLinkConfirm(view.URLString(ctx.Req, "/htmx/login/link/confirm"), tok, u.FullName())
+		case errors.Is(err, token.ErrInvalid),
+			errors.Is(err, token.ErrExpired),
+			errors.Is(err, auth.ErrMagicLinkDisabled):
+			card = MagicLinkInvalid(err.Error(), view.URLString(ctx.Req, "/login"))
+		default:
+			return err
+		}
+
+		content := Div(
+			Class("d-flex align-items-center justify-content-center p-3"),
+			Style("min-height: 80vh"),
+			card,
+		)
+
+		return ctx.Render(layout.Page(ctx, deps, content))
+	}
+}
@@ -0,0 +1,131 @@
+package passkeys
+
+import (
+	"strconv"
+
+	"github.com/axelrhd/hagg/internal/user"
+	g "maragu.dev/gomponents"
+	hx "maragu.dev/gomponents-htmx"
+	. "maragu.dev/gomponents/html"
+)
+
+// cardID is the swap target of all HTMX responses of this page.
+const cardID = "passkeys"
+
+// PasskeysCard lists the passkeys of the user and registers new ones
+// (static/js/passkey.js runs the WebAuthn ceremony).
+// Framework-agnostic - accepts URL strings instead of context.
+//
+// Usage:
+//
+//	PasskeysCard(passkeys,
+//	    view.URLString(req, "/htmx/account/passkeys/begin"),
+//	    view.URLString(req, "/htmx/account/passkeys"),
+//	    view.URLString(req, "/htmx/account/passkeys/delete"),
+//	)
+func PasskeysCard(passkeys []*user.Passkey, beginURL, registerURL, deleteURL string) g.Node {
+	items := make([]g.Node, len(passkeys))
+	for i, p := range passkeys {
+		items[i] = passkeyItem(p, deleteURL)
+	}
+
+	return Article(
+		ID(cardID),
+		Class("container-narrow card p-4"),
+
+		H1(
+			Class("text-center mb-4"),
+			g.Text("Passkeys"),
+		),
+
+		P(
+			Class("text-body-secondary"),
+			g.Text("Mit einem Passkey meldest du dich per Fingerabdruck, Gesicht oder PIN an – "+
+				"ohne UID und ohne zusätzlichen Code."),
+		),
+
+		g.If(len(passkeys) == 0,
+			P(Class("fst-italic"), g.Text("Noch keine Passkeys registriert.")),
+		),
+
+		g.If(len(passkeys) > 0,
+			Ul(
+				Class("list-group mb-4"),
+				g.Group(items),
+			),
+		),
+
+		Form(
+			H2(Class("h6"), g.Text("Neuen Passkey hinzufügen")),
+
+			Div(
+				Class("mb-3"),
+				Input(
+					Type("text"),
+					Class("form-control"),
+					Name("name"),
+					Placeholder("Name, z.B. Laptop"),
+					MaxLength(strconv.Itoa(user.MaxPasskeyNameLength)),
+					AutoComplete("off"),
+				),
+			),
+
+			Button(
+				Type("button"),
+				Class("btn btn-primary w-100"),
+				g.Attr("data-passkey", "register"),
+				g.Attr("data-passkey-begin", beginURL),
+				g.Attr("data-passkey-finish", registerURL),
+				g.Attr("data-passkey-target", "#"+cardID),
+				g.Text("Passkey hinzufügen"),
+			),
+
+			P(
+				Class("small text-body-secondary mt-2 mb-0"),
+				g.Attr("data-passkey-only", ""),
+				g.Text("Der Browser fragt nach dem Gerät oder Passwort-Manager, der den Passkey speichert."),
+			),
+		),
+	)
+}
+
+// passkeyItem renders one passkey with its delete button.
+func passkeyItem(p *user.Passkey, deleteURL string) g.Node {
+	lastUsed := "noch nie"
+	if p.LastUsedAt.Valid {
+		lastUsed = p.LastUsedAt.String()
+	}
+
+	return Li(
+		Class("list-group-item d-flex align-items-center justify-content-between gap-2"),
+
+		Div(
+			Strong(g.Text(p.Name)),
+			Div(
+				Class("small text-body-secondary"),
+				g.Textf("hinzugefügt %s · zuletzt benutzt: %s", p.CreatedAt, lastUsed),
+			),
+		),
+
+		Button(
+			Type("button"),
+			Class("btn btn-sm btn-outline-danger"),
+			hx.Post(deleteURL),
+			hx.Vals(`{"id": "`+strconv.FormatInt(p.ID, 10)+`"}`),
+			hx.Target("#"+cardID),
+			hx.Swap("outerHTML"),
+			hx.Confirm("Passkey „"+p.Name+"“ wirklich entfernen?"),
+			g.Text("Entfernen"),
+		),
+	)
+}
+
+// DisabledCard is shown if passkeys are not enabled (AUTH_PASSKEYS).
+func DisabledCard() g.Node {
+	return Article(
+		ID(cardID),
+		Class("container-narrow text-center card p-4"),
+		H3(g.Text("Passkeys")),
+		P(g.Text("Passkeys sind auf diesem Server nicht aktiviert.")),
+	)
+}
@@ -0,0 +1,105 @@
+package passkeys
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/axelrhd/hagg-lib/handler"
+	"github.com/axelrhd/hagg/internal/app"
+	"github.com/axelrhd/hagg/internal/auth"
+	"github.com/axelrhd/hagg/internal/shared"
+	"github.com/axelrhd/hagg/internal/user"
+)
+
+// HxBegin returns the WebAuthn options to create a passkey (JSON for
+// static/js/passkey.js).
+func HxBegin(deps app.Deps) handler.HandlerFunc {
+	return func(ctx *handler.Context) error {
+		u, ok := deps.Auth.CurrentUser(ctx.Req)
+		if !ok {
+			return shared.WriteJSONError(ctx, http.StatusUnauthorized, "Nicht angemeldet.")
+		}
+
+		creation, err := deps.Auth.BeginPasskeyRegistration(ctx.Req, u)
+		if errors.Is(err, auth.ErrPasskeysDisabled) {
+			return shared.WriteJSONError(ctx, http.StatusNotFound, err.Error())
+		}
+		if err != nil {
+			return err
+		}
+
+		return shared.WriteJSON(ctx, http.StatusOK, creation)
+	}
+}
+
+// HxRegister stores the passkey created by the browser and renders the
+// updated list.
+func HxRegister(deps app.Deps) handler.HandlerFunc {
+	return func(ctx *handler.Context) error {
+		u, ok := deps.Auth.CurrentUser(ctx.Req)
+		if !ok {
+			ctx.Toast("Nicht angemeldet.").Error().Notify()
+			return ctx.NoContent()
+		}
+
+		p, err := deps.Auth.FinishPasskeyRegistration(
+			ctx.Req, u,
+			ctx.Req.FormValue("name"),
+			[]byte(ctx.Req.FormValue("credential")),
+		)
+		switch {
+		case errors.Is(err, auth.ErrPasskeysDisabled),
+			errors.Is(err, auth.ErrPasskeyFailed),
+			errors.Is(err, auth.ErrPasskeyExpired),
+			errors.Is(err, auth.ErrPasskeyName),
+			errors.Is(err, user.ErrPasskeyExists):
+			ctx.Toast(err.Error()).Error().Notify()
+			return ctx.NoContent()
+		case err != nil:
+			return err
+		}
+
+		card, err := listCard(ctx, deps, u)
+		if err != nil {
+			return err
+		}
+
+		ctx.Toast("Passkey „" + p.Name + "“ hinzugefügt.").Success().Notify()
+		return ctx.Render(card)
+	}
+}
+
+// HxDelete removes a passkey of the current user.
+func HxDelete(deps app.Deps) handler.HandlerFunc {
+	return func(ctx *handler.Context) error {
+		u, ok := deps.Auth.CurrentUser(ctx.Req)
+		if !ok {
+			ctx.Toast("Nicht angemeldet.").Error().Notify()
+			return ctx.NoContent()
+		}
+
+		id, err := strconv.ParseInt(ctx.Req.FormValue("id"), 10, 64)
+		if err != nil {
+			ctx.Toast("Invalid form data").Error().Notify()
+			return ctx.NoContent()
+		}
+
+		err = deps.Users.DeletePasskey(ctx.Req.Context(), u.ID, id)
+		switch {
+		case errors.Is(err, user.ErrPasskeyNotFound):
+			ctx.Toast(err.Error()).Error().Notify()
+			return ctx.NoContent()
+		case err != nil:
+			return err
+		}
+
+		card, err := listCard(ctx, deps, u)
+		if err != nil {
+			return err
+		}
+
+		ctx.Toast("Passkey entfernt.").Success().Notify()
+		return ctx.Render(card)
+	}
+}
@@ -0,0 +1,57 @@
+package passkeys
+
+import (
+	"net/http"
+
+	"github.com/axelrhd/hagg-lib/handler"
+	"github.com/axelrhd/hagg-lib/view"
+	"github.com/axelrhd/hagg/internal/app"
+	"github.com/axelrhd/hagg/internal/frontend/layout"
+	"github.com/axelrhd/hagg/internal/user"
+	g "maragu.dev/gomponents"
+	. "maragu.dev/gomponents/html"
+)
+
+// Page renders the passkeys of the current user.
+// This page is only accessible to authenticated users.
+func Page(deps app.Deps) handler.HandlerFunc {
+	return func(ctx *handler.Context) error {
+		u, ok := deps.Auth.CurrentUser(ctx.Req)
+		if !ok {
+			// only reachable without RequireAuth
+			http.Redirect(ctx.Res, ctx.Req, view.URLString(ctx.Req, "/login"), http.StatusSeeOther)
+			return nil
+		}
+
+		card := DisabledCard()
+		if deps.Auth.PasskeysEnabled() {
+			var err error
+			if card, err = listCard(ctx, deps, u); err != nil {
+				return err
+			}
+		}
+
+		content := Div(
+			Class("d-flex align-items-center justify-content-center p-3"),
+			Style("min-height: 80vh"),
+			card,
+		)
+
+		return ctx.Render(layout.Page(ctx, deps, content))
+	}
+}
+
+// listCard returns the card with the current passkeys of u.
+func listCard(ctx *handler.Context, deps app.Deps, u *user.User) (g.Node, error) {
+	passkeys, err := deps.Users.Passkeys(ctx.Req.Context(), u.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return PasskeysCard(
+		passkeys,
+		view.URLString(ctx.Req, "/htmx/account/passkeys/begin"),
+		view.URLString(ctx.Req, "/htmx/account/passkeys"),
+		view.URLString(ctx.Req, "/htmx/account/passkeys/delete"),
+	), nil
+}
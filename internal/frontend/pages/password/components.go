@@ -0,0 +1,94 @@
+package password
+
+import (
+	g "maragu.dev/gomponents"
+	hx "maragu.dev/gomponents-htmx"
+	. "maragu.dev/gomponents/html"
+)
+
+// ChangePasswordForm renders the form for a new password. The field for the
+// current password is only shown if the user already has one (a user who
+// logged in with the UID may set a first password).
+// Framework-agnostic - accepts URL string instead of context.
+//
+// Usage:
+//
+//	changeURL := view.URLString(req, "/htmx/account/password")
+//	ChangePasswordForm(changeURL, hasPassword)
+func ChangePasswordForm(changeURL string, hasPassword bool) g.Node {
+	title := "Passwort festlegen"
+	if hasPassword {
+		title = "Passwort ändern"
+	}
+
+	return Article(
+		ID("change-password"),
+		Class("container-narrow card p-4"),
+
+		H1(
+			Class("text-center mb-4"),
+			g.Text(title),
+		),
+
+		Form(
+			hx.Post(changeURL),
+			// success re-renders the (empty) form, errors only send a toast
+			hx.Target("#change-password"),
+			hx.Swap("outerHTML"),
+
+			g.If(hasPassword,
+				Div(
+					Class("mb-3"),
+					Input(
+						Type("password"),
+						Class("form-control"),
+						ID("current_password"),
+						Name("current_password"),
+						Placeholder("Aktuelles Passwort"),
+						AutoComplete("current-password"),
+						Required(),
+						AutoFocus(),
+					),
+				),
+			),
+
+			Div(
+				Class("mb-3"),
+				Input(
+					Type("password"),
+					Class("form-control"),
+					ID("new_password"),
+					Name("new_password"),
+					Placeholder("Neues Passwort"),
+					AutoComplete("new-password"),
+					Required(),
+					g.If(!hasPassword, AutoFocus()),
+				),
+			),
+
+			Div(
+				Class("mb-3"),
+				Input(
+					Type("password"),
+					Class("form-control"),
+					ID("confirm_password"),
+					Name("confirm_password"),
+					Placeholder("Neues Passwort wiederholen"),
+					AutoComplete("new-password"),
+					Required(),
+				),
+			),
+
+			P(
+				Class("form-text"),
+				g.Text("Alle anderen Sitzungen werden danach abgemeldet."),
+			),
+
+			Button(
+				Type("submit"),
+				Class("btn btn-primary w-100"),
+				g.Text("Speichern"),
+			),
+		),
+	)
+}
@@ -0,0 +1,53 @@
+package password
+
+import (
+	"errors"
+
+	"github.com/axelrhd/hagg-lib/handler"
+	"github.com/axelrhd/hagg-lib/view"
+	"github.com/axelrhd/hagg/internal/app"
+	"github.com/axelrhd/hagg/internal/user"
+)
+
+// HxChangePassword handles HTMX change password requests.
+// It checks the current password and the password policy, stores the new
+// password and re-renders the empty form.
+func HxChangePassword(deps app.Deps) handler.HandlerFunc {
+	return func(ctx *handler.Context) error {
+		u, ok := deps.Auth.CurrentUser(ctx.Req)
+		if !ok {
+			ctx.Toast("Nicht angemeldet.").Error().Notify()
+			return ctx.NoContent()
+		}
+
+		// Parse form data
+		if err := ctx.Req.ParseForm(); err != nil {
+			ctx.Toast("Invalid form data").Error().Notify()
+			return ctx.NoContent()
+		}
+
+		current := ctx.Req.FormValue("current_password")
+		next := ctx.Req.FormValue("new_password")
+
+		if next != ctx.Req.FormValue("confirm_password") {
+			ctx.Toast("Die neuen Passwörter stimmen nicht überein.").Error().Notify()
+			return ctx.NoContent()
+		}
+
+		err := deps.Auth.ChangePassword(ctx.Req, u, current, next)
+		switch {
+		case errors.Is(err, user.ErrWrongPassword):
+			ctx.Toast("Das aktuelle Passwort ist falsch.").Error().Notify()
+			return ctx.NoContent()
+		case errors.Is(err, user.ErrWeakPassword):
+			ctx.Toast(err.Error()).Error().Notify()
+			return ctx.NoContent()
+		case err != nil:
+			return err
+		}
+
+		// Success
+		ctx.Toast("Passwort gespeichert. Andere Sitzungen wurden abgemeldet.").Success().Notify()
+		return ctx.Render(ChangePasswordForm(view.URLString(ctx.Req, "/htmx/account/password"), true))
+	}
+}
@@ -0,0 +1,38 @@
+package password
+
+import (
+	"net/http"
+
+	"github.com/axelrhd/hagg-lib/handler"
+	"github.com/axelrhd/hagg-lib/view"
+	"github.com/axelrhd/hagg/internal/app"
+	"github.com/axelrhd/hagg/internal/frontend/layout"
+	. "maragu.dev/gomponents/html"
+)
+
+// Page renders the change password page.
+// This page is only accessible to authenticated users.
+func Page(deps app.Deps) handler.HandlerFunc {
+	return func(ctx *handler.Context) error {
+		user, ok := deps.Auth.CurrentUser(ctx.Req)
+		if !ok {
+			// only reachable without RequireAuth
+			http.Redirect(ctx.Res, ctx.Req, view.URLString(ctx.Req, "/login"), http.StatusSeeOther)
+			return nil
+		}
+
+		hasPassword, err := deps.Auth.HasPassword(ctx.Req.Context(), user.ID)
+		if err != nil {
+			return err
+		}
+
+		content := Div(
+			Class("d-flex align-items-center justify-content-center p-3"),
+			Style("min-height: 80vh"),
+
+			ChangePasswordForm(view.URLString(ctx.Req, "/htmx/account/password"), hasPassword),
+		)
+
+		return ctx.Render(layout.Page(ctx, deps, content))
+	}
+}
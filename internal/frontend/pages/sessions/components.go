@@ -0,0 +1,80 @@
+package sessions
+
+import (
+	"github.com/axelrhd/hagg/internal/auth"
+	g "maragu.dev/gomponents"
+	hx "maragu.dev/gomponents-htmx"
+	. "maragu.dev/gomponents/html"
+)
+
+// SessionsCard lists the devices (sessions) the user is logged in on and
+// ends all of them at once.
+// Framework-agnostic - accepts URL strings instead of context.
+//
+// Usage:
+//
+//	SessionsCard(sessions, view.URLString(req, "/htmx/account/sessions/logout-all"))
+func SessionsCard(sessions []auth.DeviceSession, logoutAllURL string) g.Node {
+	items := make([]g.Node, len(sessions))
+	for i, s := range sessions {
+		items[i] = sessionItem(s)
+	}
+
+	return Article(
+		Class("container-narrow card p-4"),
+
+		H1(
+			Class("text-center mb-4"),
+			g.Text("Geräte"),
+		),
+
+		P(
+			Class("text-body-secondary"),
+			g.Text("Auf diesen Geräten bist du angemeldet. Kennst du eines nicht, "+
+				"melde dich überall ab und ändere dein Passwort."),
+		),
+
+		g.If(len(sessions) == 0,
+			P(Class("fst-italic"), g.Text("Keine Sitzungen gefunden.")),
+		),
+
+		g.If(len(sessions) > 0,
+			Ul(
+				Class("list-group mb-4"),
+				g.Group(items),
+			),
+		),
+
+		Button(
+			Type("button"),
+			Class("btn btn-outline-danger w-100"),
+			hx.Post(logoutAllURL),
+			hx.Confirm("Wirklich auf allen Geräten abmelden, auch auf diesem?"),
+			g.Text("Auf allen Geräten abmelden"),
+		),
+	)
+}
+
+// sessionItem renders one session.
+func sessionItem(s auth.DeviceSession) g.Node {
+	device := s.UserAgent
+	if device == "" {
+		device = "Unbekanntes Gerät"
+	}
+
+	return Li(
+		Class("list-group-item"),
+
+		Div(
+			Class("d-flex align-items-center justify-content-between gap-2"),
+			Strong(Class("text-break"), g.Text(device)),
+			g.If(s.Current,
+				Span(Class("badge text-bg-success"), g.Text("Dieses Gerät")),
+			),
+		),
+		Div(
+			Class("small text-body-secondary"),
+			g.Textf("angemeldet %s · IP %s", s.CreatedAt, s.IP),
+		),
+	)
+}
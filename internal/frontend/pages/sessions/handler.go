@@ -0,0 +1,33 @@
+package sessions
+
+import (
+	"fmt"
+
+	"github.com/axelrhd/hagg-lib/handler"
+	"github.com/axelrhd/hagg-lib/view"
+	"github.com/axelrhd/hagg/internal/app"
+	"github.com/axelrhd/hagg/internal/shared"
+)
+
+// HxLogoutAll ends all sessions of the current user, including this one,
+// and redirects to the login page.
+func HxLogoutAll(deps app.Deps) handler.HandlerFunc {
+	return func(ctx *handler.Context) error {
+		u, ok := deps.Auth.CurrentUser(ctx.Req)
+		if !ok {
+			ctx.Toast("Nicht angemeldet.").Error().Notify()
+			return ctx.NoContent()
+		}
+
+		n, err := deps.Auth.LogoutEverywhere(ctx.Req, u)
+		if err != nil {
+			return err
+		}
+
+		// the flash lands in a new, anonymous session
+		shared.SetFlash(ctx, "success", fmt.Sprintf("Auf allen Geräten abgemeldet (%d Sitzungen).", n))
+
+		ctx.Res.Header().Set("HX-Redirect", view.URLString(ctx.Req, "/login"))
+		return ctx.NoContent()
+	}
+}
@@ -0,0 +1,37 @@
+package sessions
+
+import (
+	"net/http"
+
+	"github.com/axelrhd/hagg-lib/handler"
+	"github.com/axelrhd/hagg-lib/view"
+	"github.com/axelrhd/hagg/internal/app"
+	"github.com/axelrhd/hagg/internal/frontend/layout"
+	. "maragu.dev/gomponents/html"
+)
+
+// Page renders the devices the current user is logged in on.
+// This page is only accessible to authenticated users.
+func Page(deps app.Deps) handler.HandlerFunc {
+	return func(ctx *handler.Context) error {
+		u, ok := deps.Auth.CurrentUser(ctx.Req)
+		if !ok {
+			// only reachable without RequireAuth
+			http.Redirect(ctx.Res, ctx.Req, view.URLString(ctx.Req, "/login"), http.StatusSeeOther)
+			return nil
+		}
+
+		sessions, err := deps.Auth.Sessions(ctx.Req, u)
+		if err != nil {
+			return err
+		}
+
+		content := Div(
+			Class("d-flex align-items-center justify-content-center p-3"),
+			Style("min-height: 80vh"),
+			SessionsCard(sessions, view.URLString(ctx.Req, "/htmx/account/sessions/logout-all")),
+		)
+
+		return ctx.Render(layout.Page(ctx, deps, content))
+	}
+}
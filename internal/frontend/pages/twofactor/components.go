@@ -0,0 +1,189 @@
+package twofactor
+
+import (
+	"fmt"
+
+	"github.com/axelrhd/hagg/internal/user"
+	g "maragu.dev/gomponents"
+	hx "maragu.dev/gomponents-htmx"
+	. "maragu.dev/gomponents/html"
+)
+
+// cardID is the swap target of all HTMX responses of this page.
+const cardID = "two-factor"
+
+// EnrollCard renders the QR code of a new enrolment and the form for the
+// first code. The secret is shown as text for apps without a camera.
+// Framework-agnostic - accepts URL string instead of context.
+//
+// Usage:
+//
+//	confirmURL := view.URLString(req, "/htmx/account/2fa/confirm")
+//	EnrollCard(qrSVG, t.Secret, confirmURL, required)
+func EnrollCard(qrSVG, secret, confirmURL string, required bool) g.Node {
+	return Article(
+		ID(cardID),
+		Class("container-narrow card p-4"),
+
+		H1(
+			Class("text-center mb-4"),
+			g.Text("Zwei-Faktor-Authentifizierung"),
+		),
+
+		g.If(required,
+			P(
+				Class("alert alert-warning"),
+				g.Text("Deine Rolle verlangt einen zweiten Faktor. Die Anmeldung wird nach der Einrichtung abgeschlossen."),
+			),
+		),
+
+		P(g.Text("1. Scanne den QR-Code mit einer Authenticator-App.")),
+
+		Div(
+			Class("mx-auto mb-3"),
+			Style("max-width: 220px"),
+			g.Raw(qrSVG),
+		),
+
+		P(
+			Class("small text-body-secondary text-center"),
+			g.Text("Kein Scan möglich? Schlüssel manuell eingeben:"),
+			Br(),
+			Code(Class("user-select-all"), g.Text(secret)),
+		),
+
+		P(g.Text("2. Gib den angezeigten Code ein.")),
+
+		Form(
+			hx.Post(confirmURL),
+			hx.Target("#"+cardID),
+			hx.Swap("outerHTML"),
+
+			codeInput(true),
+
+			Button(
+				Type("submit"),
+				Class("btn btn-primary w-100"),
+				g.Text("Aktivieren"),
+			),
+		),
+	)
+}
+
+// ManageCard renders an active enrolment: new recovery codes and (unless
+// a role requires 2FA) deactivation, each confirmed with a current code.
+func ManageCard(t *user.TOTP, recoveryURL, disableURL string, required bool) g.Node {
+	return Article(
+		ID(cardID),
+		Class("container-narrow card p-4"),
+
+		H1(
+			Class("text-center mb-4"),
+			g.Text("Zwei-Faktor-Authentifizierung"),
+		),
+
+		P(
+			Span(Class("text-success"), g.Text("✓ Aktiv")),
+			g.Textf(" seit %s", t.ConfirmedAt),
+		),
+		P(
+			g.Textf("Unbenutzte Recovery-Codes: %d", t.RecoveryCodes),
+		),
+
+		Form(
+			Class("mb-4"),
+			hx.Post(recoveryURL),
+			hx.Target("#"+cardID),
+			hx.Swap("outerHTML"),
+
+			H2(Class("h6"), g.Text("Neue Recovery-Codes")),
+			P(
+				Class("small text-body-secondary"),
+				g.Text("Alle bisherigen Recovery-Codes werden ungültig."),
+			),
+			codeInput(false),
+			Button(
+				Type("submit"),
+				Class("btn btn-outline-primary w-100"),
+				g.Text("Codes erzeugen"),
+			),
+		),
+
+		g.If(required,
+			P(
+				Class("small text-body-secondary"),
+				g.Text("Deine Rolle verlangt einen zweiten Faktor, er kann nicht deaktiviert werden."),
+			),
+		),
+
+		g.If(!required,
+			Form(
+				hx.Post(disableURL),
+				hx.Target("#"+cardID),
+				hx.Swap("outerHTML"),
+				hx.Confirm("Zwei-Faktor-Authentifizierung wirklich deaktivieren?"),
+
+				H2(Class("h6"), g.Text("Deaktivieren")),
+				codeInput(false),
+				Button(
+					Type("submit"),
+					Class("btn btn-outline-danger w-100"),
+					g.Text("Deaktivieren"),
+				),
+			),
+		),
+	)
+}
+
+// RecoveryCodesCard shows new recovery codes exactly once.
+func RecoveryCodesCard(codes []string, continueURL string) g.Node {
+	items := make([]g.Node, len(codes))
+	for i, code := range codes {
+		items[i] = Li(Code(g.Text(code)))
+	}
+
+	return Article(
+		ID(cardID),
+		Class("container-narrow card p-4"),
+
+		H1(
+			Class("text-center mb-4"),
+			g.Text("Recovery-Codes"),
+		),
+
+		P(g.Text(fmt.Sprintf(
+			"Bewahre diese %d Codes sicher auf. Jeder Code ersetzt einmal den Code der App, "+
+				"falls du keinen Zugriff mehr auf sie hast. Sie werden nur jetzt angezeigt.",
+			len(codes),
+		))),
+
+		Ul(
+			Class("list-unstyled font-monospace user-select-all mb-4"),
+			g.Group(items),
+		),
+
+		A(
+			Class("btn btn-primary w-100"),
+			Href(continueURL),
+			g.Text("Codes gespeichert – weiter"),
+		),
+	)
+}
+
+// codeInput is the input for a code of the authenticator app. Managing an
+// active enrolment also accepts recovery codes.
+func codeInput(autofocus bool) g.Node {
+	return Div(
+		Class("mb-3"),
+		Input(
+			Type("text"),
+			Class("form-control text-center"),
+			Name("code"),
+			Placeholder("123456"),
+			AutoComplete("one-time-code"),
+			g.Attr("inputmode", "numeric"),
+			Required(),
+			g.If(autofocus, AutoFocus()),
+		),
+	)
+}
@@ -0,0 +1,87 @@
+package twofactor
+
+import (
+	"errors"
+
+	"github.com/axelrhd/hagg-lib/handler"
+	"github.com/axelrhd/hagg-lib/view"
+	"github.com/axelrhd/hagg/internal/app"
+	"github.com/axelrhd/hagg/internal/auth"
+	"github.com/axelrhd/hagg/internal/user"
+)
+
+// HxConfirm activates a new enrolment with the first code and shows the
+// recovery codes. A pending login that had to set up 2FA is completed.
+func HxConfirm(deps app.Deps) handler.HandlerFunc {
+	return func(ctx *handler.Context) error {
+		u, ok := deps.Auth.EnrollingUser(ctx.Req)
+		if !ok {
+			ctx.Toast(auth.ErrNoPendingLogin.Error()).Error().Notify()
+			return ctx.NoContent()
+		}
+
+		codes, err := deps.Auth.ConfirmTOTP(ctx.Req, u, ctx.Req.FormValue("code"))
+		switch {
+		case errors.Is(err, user.ErrInvalidCode), errors.Is(err, auth.ErrTOTPActive):
+			ctx.Toast(err.Error()).Error().Notify()
+			return ctx.NoContent()
+		case err != nil:
+			return err
+		}
+
+		ctx.Toast("Zwei-Faktor-Authentifizierung ist aktiv.").Success().Notify()
+		return ctx.Render(RecoveryCodesCard(codes, view.URLString(ctx.Req, "/")))
+	}
+}
+
+// HxRecoveryCodes replaces the recovery codes of the current user.
+func HxRecoveryCodes(deps app.Deps) handler.HandlerFunc {
+	return func(ctx *handler.Context) error {
+		u, ok := deps.Auth.CurrentUser(ctx.Req)
+		if !ok {
+			ctx.Toast("Nicht angemeldet.").Error().Notify()
+			return ctx.NoContent()
+		}
+
+		codes, err := deps.Auth.RegenerateRecoveryCodes(ctx.Req, u, ctx.Req.FormValue("code"))
+		switch {
+		case errors.Is(err, user.ErrInvalidCode):
+			ctx.Toast(err.Error()).Error().Notify()
+			return ctx.NoContent()
+		case err != nil:
+			return err
+		}
+
+		ctx.Toast("Neue Recovery-Codes erzeugt.").Success().Notify()
+		return ctx.Render(RecoveryCodesCard(codes, view.URLString(ctx.Req, "/account/2fa")))
+	}
+}
+
+// HxDisable removes the second factor of the current user.
+func HxDisable(deps app.Deps) handler.HandlerFunc {
+	return func(ctx *handler.Context) error {
+		u, ok := deps.Auth.CurrentUser(ctx.Req)
+		if !ok {
+			ctx.Toast("Nicht angemeldet.").Error().Notify()
+			return ctx.NoContent()
+		}
+
+		err := deps.Auth.DisableTOTP(ctx.Req, u, ctx.Req.FormValue("code"))
+		switch {
+		case errors.Is(err, user.ErrInvalidCode), errors.Is(err, auth.ErrTOTPMandatory):
+			ctx.Toast(err.Error()).Error().Notify()
+			return ctx.NoContent()
+		case err != nil:
+			return err
+		}
+
+		// back to the enrolment (with a new secret)
+		node, err := card(ctx, deps, u)
+		if err != nil {
+			return err
+		}
+
+		ctx.Toast("Zwei-Faktor-Authentifizierung deaktiviert.").Success().Notify()
+		return ctx.Render(node)
+	}
+}
@@ -0,0 +1,70 @@
+package twofactor
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/axelrhd/hagg-lib/handler"
+	"github.com/axelrhd/hagg-lib/view"
+	"github.com/axelrhd/hagg/internal/app"
+	"github.com/axelrhd/hagg/internal/frontend/layout"
+	"github.com/axelrhd/hagg/internal/totp"
+	"github.com/axelrhd/hagg/internal/user"
+	g "maragu.dev/gomponents"
+	. "maragu.dev/gomponents/html"
+)
+
+// Page renders the 2FA page: enrolment, or management of an active
+// enrolment. Also reachable by a pending login that must set up 2FA.
+func Page(deps app.Deps) handler.HandlerFunc {
+	return func(ctx *handler.Context) error {
+		u, ok := deps.Auth.EnrollingUser(ctx.Req)
+		if !ok {
+			http.Redirect(ctx.Res, ctx.Req, view.URLString(ctx.Req, "/login"), http.StatusSeeOther)
+			return nil
+		}
+
+		card, err := card(ctx, deps, u)
+		if err != nil {
+			return err
+		}
+
+		content := Div(
+			Class("d-flex align-items-center justify-content-center p-3"),
+			Style("min-height: 80vh"),
+			card,
+		)
+
+		return ctx.Render(layout.Page(ctx, deps, content))
+	}
+}
+
+// card returns the card for the current state of u.
+func card(ctx *handler.Context, deps app.Deps, u *user.User) (g.Node, error) {
+	required := deps.Auth.TOTPRequired(u)
+
+	t, err := deps.Users.TOTP(ctx.Req.Context(), u.ID)
+	if err != nil && !errors.Is(err, user.ErrNoTOTP) {
+		return nil, err
+	}
+	if t.Active() {
+		return ManageCard(
+			t,
+			view.URLString(ctx.Req, "/htmx/account/2fa/recovery-codes"),
+			view.URLString(ctx.Req, "/htmx/account/2fa/disable"),
+			required,
+		), nil
+	}
+
+	t, err = deps.Auth.BeginTOTP(ctx.Req.Context(), u)
+	if err != nil {
+		return nil, err
+	}
+
+	qrSVG, err := totp.QRCodeSVG(deps.Auth.TOTPURI(u, t.Secret))
+	if err != nil {
+		return nil, err
+	}
+
+	return EnrollCard(qrSVG, t.Secret, view.URLString(ctx.Req, "/htmx/account/2fa/confirm"), required), nil
+}
@@ -0,0 +1,27 @@
+package verifyemail
+
+import (
+	"net/http"
+
+	"github.com/axelrhd/hagg-lib/handler"
+	"github.com/axelrhd/hagg-lib/view"
+	"github.com/axelrhd/hagg/internal/app"
+	"github.com/axelrhd/hagg/internal/shared"
+)
+
+// Page handles the confirmation link from the verification mail.
+// It verifies the token, sets a flash message and redirects to home.
+func Page(deps app.Deps) handler.HandlerFunc {
+	return func(ctx *handler.Context) error {
+		tok := ctx.Req.URL.Query().Get("token")
+
+		if _, err := deps.EmailVerifier.Verify(ctx.Req.Context(), tok); err != nil {
+			shared.SetFlash(ctx, "error", err.Error())
+		} else {
+			shared.SetFlash(ctx, "success", "E-Mail-Adresse bestätigt.")
+		}
+
+		http.Redirect(ctx.Res, ctx.Req, view.URLString(ctx.Req, "/"), http.StatusSeeOther)
+		return nil
+	}
+}
@@ -0,0 +1,57 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"mime"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// FileMailer writes every message as .eml file into a directory
+// instead of sending it. Meant for development: open the files with
+// any mail client or just read them.
+type FileMailer struct {
+	dir  string
+	from string
+}
+
+func NewFileMailer(dir, from string) *FileMailer {
+	return &FileMailer{dir: dir, from: from}
+}
+
+// Compile-time interface check
+var _ Mailer = (*FileMailer)(nil)
+
+var unsafeFileChars = regexp.MustCompile(`[^a-zA-Z0-9._-]+`)
+
+func (m *FileMailer) Send(ctx context.Context, msg Message) error {
+	if err := os.MkdirAll(m.dir, 0o755); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	name := now.Format("20060102-150405.000000000") + "-" + unsafeFileChars.ReplaceAllString(msg.To, "_") + ".eml"
+
+	return os.WriteFile(filepath.Join(m.dir, name), []byte(format(m.from, msg, now)), 0o644)
+}
+
+// format renders msg as RFC 5322 message with a plain text body.
+func format(from string, msg Message, date time.Time) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: 8bit\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Text, "\n", "\r\n"))
+
+	return b.String()
+}
@@ -0,0 +1,39 @@
+// Package mail sends plain text mails through a pluggable Mailer.
+package mail
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/axelrhd/hagg/internal/config"
+)
+
+// Message is a plain text mail.
+type Message struct {
+	To      string
+	Subject string
+	Text    string
+}
+
+// Mailer delivers messages.
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// New returns the Mailer selected via MAIL_DRIVER.
+func New(cfg config.MailConfig) (Mailer, error) {
+	switch cfg.Driver {
+	case config.MailDriverFile:
+		return NewFileMailer(cfg.FileDir, cfg.From), nil
+	case config.MailDriverStdout:
+		return NewStdoutMailer(cfg.From), nil
+	case config.MailDriverSMTP:
+		m, err := NewSMTPMailer(cfg)
+		if err != nil {
+			return nil, err
+		}
+		return m, nil
+	}
+
+	return nil, fmt.Errorf("unsupported mail driver %q", cfg.Driver)
+}
@@ -0,0 +1,119 @@
+package mail
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	netmail "net/mail"
+	"net/smtp"
+	"strconv"
+	"time"
+
+	"github.com/axelrhd/hagg/internal/config"
+)
+
+// SMTPMailer delivers messages through an SMTP server: submission with
+// STARTTLS, implicit TLS, or unencrypted for local test servers (Mailpit,
+// MailHog, ...). Every message uses its own connection.
+type SMTPMailer struct {
+	cfg    config.MailConfig
+	sender string // envelope sender, the address of cfg.From
+}
+
+func NewSMTPMailer(cfg config.MailConfig) (*SMTPMailer, error) {
+	from, err := netmail.ParseAddress(cfg.From)
+	if err != nil {
+		return nil, fmt.Errorf("invalid MAIL_FROM: %w", err)
+	}
+
+	return &SMTPMailer{cfg: cfg, sender: from.Address}, nil
+}
+
+// Compile-time interface check
+var _ Mailer = (*SMTPMailer)(nil)
+
+func (m *SMTPMailer) Send(ctx context.Context, msg Message) error {
+	ctx, cancel := context.WithTimeout(ctx, m.cfg.SMTPTimeout)
+	defer cancel()
+
+	c, err := m.dial(ctx)
+	if err != nil {
+		return fmt.Errorf("smtp %s: %w", m.cfg.SMTPHost, err)
+	}
+	defer c.Close()
+
+	if err := m.send(c, msg); err != nil {
+		return fmt.Errorf("smtp %s: %w", m.cfg.SMTPHost, err)
+	}
+
+	return nil
+}
+
+// dial connects and says hello. The context deadline applies to the whole
+// conversation.
+func (m *SMTPMailer) dial(ctx context.Context) (*smtp.Client, error) {
+	addr := net.JoinHostPort(m.cfg.SMTPHost, strconv.Itoa(m.cfg.SMTPPort))
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	if m.cfg.SMTPTLS == config.SMTPTLSImplicit {
+		conn = tls.Client(conn, m.tlsConfig())
+	}
+
+	c, err := smtp.NewClient(conn, m.cfg.SMTPHost)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func (m *SMTPMailer) send(c *smtp.Client, msg Message) error {
+	if m.cfg.SMTPTLS == config.SMTPTLSStartTLS {
+		if err := c.StartTLS(m.tlsConfig()); err != nil {
+			return fmt.Errorf("starttls: %w", err)
+		}
+	}
+
+	if m.cfg.SMTPUser != "" {
+		auth := smtp.PlainAuth("", m.cfg.SMTPUser, m.cfg.SMTPPassword, m.cfg.SMTPHost)
+		if err := c.Auth(auth); err != nil {
+			return fmt.Errorf("auth: %w", err)
+		}
+	}
+
+	if err := c.Mail(m.sender); err != nil {
+		return err
+	}
+	if err := c.Rcpt(msg.To); err != nil {
+		return err
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, format(m.cfg.From, msg, time.Now())); err != nil {
+		w.Close()
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	return c.Quit()
+}
+
+func (m *SMTPMailer) tlsConfig() *tls.Config {
+	return &tls.Config{ServerName: m.cfg.SMTPHost}
+}
@@ -0,0 +1,189 @@
+package mail
+
+import (
+	"bufio"
+	"context"
+	"mime"
+	"net"
+	netmail "net/mail"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/axelrhd/hagg/internal/config"
+)
+
+// received is one message delivered to the sink.
+type received struct {
+	from string
+	to   []string
+	data string
+}
+
+// smtpSink is an SMTP server that accepts every message, just enough
+// protocol for net/smtp. It returns host and port and the delivered
+// messages.
+func smtpSink(t *testing.T) (string, int, <-chan received) {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	out := make(chan received, 10)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go serveSMTP(conn, out)
+		}
+	}()
+
+	addr := l.Addr().(*net.TCPAddr)
+	return addr.IP.String(), addr.Port, out
+}
+
+func serveSMTP(conn net.Conn, out chan<- received) {
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	r := bufio.NewReader(conn)
+	reply := func(s string) { conn.Write([]byte(s + "\r\n")) }
+
+	var msg received
+	reply("220 sink ESMTP")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		cmd := strings.ToUpper(line)
+
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+			reply("250 sink")
+		case strings.HasPrefix(cmd, "MAIL FROM:"):
+			msg.from = strings.Trim(line[len("MAIL FROM:"):], "<> ")
+			reply("250 OK")
+		case strings.HasPrefix(cmd, "RCPT TO:"):
+			msg.to = append(msg.to, strings.Trim(line[len("RCPT TO:"):], "<> "))
+			reply("250 OK")
+		case cmd == "DATA":
+			reply("354 go ahead")
+			var data strings.Builder
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if l == ".\r\n" {
+					break
+				}
+				data.WriteString(strings.TrimPrefix(l, "."))
+			}
+			msg.data = data.String()
+			out <- msg
+			msg = received{}
+			reply("250 queued")
+		case cmd == "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("502 not implemented")
+		}
+	}
+}
+
+func TestSMTPMailer(t *testing.T) {
+	host, port, inbox := smtpSink(t)
+
+	m, err := NewSMTPMailer(config.MailConfig{
+		From:        "Hagg <noreply@example.com>",
+		SMTPHost:    host,
+		SMTPPort:    port,
+		SMTPTLS:     config.SMTPTLSNone,
+		SMTPTimeout: 5 * time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	link := "https://hagg.example.com/login/link?token=abc.def"
+	err = m.Send(context.Background(), Message{
+		To:      "alice@example.com",
+		Subject: "Dein Login-Link für hagg",
+		Text:    "Hallo Älice,\n\n" + link + "\n",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got received
+	select {
+	case got = <-inbox:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no message delivered")
+	}
+
+	// envelope: the bare address of MAIL_FROM
+	if got.from != "noreply@example.com" || len(got.to) != 1 || got.to[0] != "alice@example.com" {
+		t.Errorf("envelope = %s -> %v", got.from, got.to)
+	}
+
+	parsed, err := netmail.ReadMessage(strings.NewReader(got.data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for header, want := range map[string]string{
+		"From":         "Hagg <noreply@example.com>",
+		"To":           "alice@example.com",
+		"Content-Type": "text/plain; charset=utf-8",
+	} {
+		if v := parsed.Header.Get(header); v != want {
+			t.Errorf("%s = %q, want %q", header, v, want)
+		}
+	}
+	// non-ASCII subjects are encoded (RFC 2047)
+	raw := parsed.Header.Get("Subject")
+	subject, err := new(mime.WordDecoder).DecodeHeader(raw)
+	if err != nil || subject != "Dein Login-Link für hagg" || raw == subject {
+		t.Errorf("Subject = %q (decoded %q, %v)", raw, subject, err)
+	}
+	if _, err := parsed.Header.Date(); err != nil {
+		t.Errorf("Date: %v", err)
+	}
+
+	var body strings.Builder
+	if _, err := bufio.NewReader(parsed.Body).WriteTo(&body); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(body.String(), "Hallo Älice,\r\n") || !strings.Contains(body.String(), "\r\n"+link+"\r\n") {
+		t.Errorf("body = %q, want the greeting and the link on a line of its own", body.String())
+	}
+}
+
+func TestSMTPMailerUnreachable(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+
+	m, _ := NewSMTPMailer(config.MailConfig{
+		From:        "noreply@example.com",
+		SMTPHost:    "127.0.0.1",
+		SMTPPort:    port,
+		SMTPTLS:     config.SMTPTLSNone,
+		SMTPTimeout: time.Second,
+	})
+	err = m.Send(context.Background(), Message{To: "alice@example.com", Subject: "x", Text: "x"})
+	if err == nil || !strings.Contains(err.Error(), "smtp 127.0.0.1") {
+		t.Errorf("Send = %v, want an error naming the server", err)
+	}
+}
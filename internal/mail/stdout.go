@@ -0,0 +1,34 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// StdoutMailer prints every message instead of sending it. Meant for
+// development and containers: links show up next to the server log.
+type StdoutMailer struct {
+	mu   sync.Mutex // one message at a time, never interleaved
+	out  io.Writer
+	from string
+}
+
+func NewStdoutMailer(from string) *StdoutMailer {
+	return &StdoutMailer{out: os.Stdout, from: from}
+}
+
+// Compile-time interface check
+var _ Mailer = (*StdoutMailer)(nil)
+
+func (m *StdoutMailer) Send(ctx context.Context, msg Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, err := fmt.Fprintf(m.out, "----- mail to %s -----\n%s\n----- end of mail -----\n",
+		msg.To, format(m.from, msg, time.Now()))
+	return err
+}
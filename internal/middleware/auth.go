@@ -5,26 +5,22 @@ import (
 
 	"github.com/axelrhd/hagg-lib/handler"
 	"github.com/axelrhd/hagg/internal/auth"
-	"github.com/axelrhd/hagg/internal/session"
 )
 
 // RequireAuth is a Chi-compatible middleware that requires authentication.
-// If the user is not authenticated (user_id not in session), it redirects to the login page.
+// If the user is not authenticated (no valid session, see auth.Auth.CurrentUser),
+// it redirects to the login page.
 //
 // Example:
 //
 //	r.Group(func(r chi.Router) {
-//	    r.Use(middleware.RequireAuth(wrapper))
+//	    r.Use(middleware.RequireAuth(wrapper, deps.Auth))
 //	    r.Get("/dashboard", wrapper.Wrap(dashboardHandler.Index))
 //	})
-func RequireAuth(wrapper *handler.Wrapper) func(http.Handler) http.Handler {
+func RequireAuth(wrapper *handler.Wrapper, authService *auth.Auth) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			sessionCtx := r.Context()
-			rawUID := session.Manager.Get(sessionCtx, auth.SessionKeyUID)
-			uid, ok := rawUID.(string)
-
-			if !ok || uid == "" {
+			if _, ok := authService.CurrentUser(r); !ok {
 				// Not authenticated - redirect to login
 				http.Redirect(w, r, "/login", http.StatusSeeOther)
 				return
@@ -50,11 +46,7 @@ func RequireAuth(wrapper *handler.Wrapper) func(http.Handler) http.Handler {
 func RequireGuest(wrapper *handler.Wrapper) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			sessionCtx := r.Context()
-			rawUID := session.Manager.Get(sessionCtx, auth.SessionKeyUID)
-			uid, ok := rawUID.(string)
-
-			if ok && uid != "" {
+			if _, ok := auth.SessionUserID(r.Context()); ok {
 				// Already authenticated - redirect to home
 				http.Redirect(w, r, "/", http.StatusSeeOther)
 				return
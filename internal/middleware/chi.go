@@ -69,17 +69,3 @@ func CORS() func(http.Handler) http.Handler {
 		})
 	}
 }
-
-// RateLimit is a placeholder middleware for rate limiting.
-// TODO: Implement actual rate limiting logic
-//
-// Example:
-//
-//	r.Use(middleware.RateLimit)
-func RateLimit(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// TODO: Implement rate limiting
-		next.ServeHTTP(w, r)
-	})
-}
-
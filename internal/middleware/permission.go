@@ -6,14 +6,12 @@ import (
 	"github.com/axelrhd/hagg-lib/casbinx"
 	"github.com/axelrhd/hagg-lib/view"
 	"github.com/axelrhd/hagg/internal/auth"
-	"github.com/axelrhd/hagg/internal/session"
-	"github.com/axelrhd/hagg/internal/user"
 )
 
 // RequirePermission is a **reference implementation** for Casbin-based authorization.
 //
 // This middleware combines authentication and authorization in a single check:
-//  1. Authentication: Verifies user is logged in (UID in session)
+//  1. Authentication: Verifies user is logged in (user ID in session)
 //  2. Authorization: Verifies user has permission via Casbin (subject → action)
 //
 // # When to use this
@@ -32,8 +30,8 @@ import (
 //
 // # Customization
 //
-// This implementation uses DisplayName as the Casbin subject. Your app may need:
-//   - UID as subject (unique, stable)
+// This implementation uses user.User.Subject ("user:<id>") as the Casbin
+// subject – stable across renames. Your app may need:
 //   - Email as subject (readable)
 //   - Role name directly (if stored in session)
 //
@@ -42,19 +40,16 @@ import (
 // # Example
 //
 //	r.Group(func(r chi.Router) {
-//	    r.Use(middleware.RequirePermission(deps.Auth, deps.Users, deps.Perms, "dashboard:view"))
+//	    r.Use(middleware.RequirePermission(deps.Auth, deps.Perms, "dashboard:view"))
 //	    r.Get("/dashboard", wrapper.Wrap(dashboard.Page(deps)))
 //	})
-func RequirePermission(authService *auth.Auth, users user.Store, perms *casbinx.Perm, action string) func(http.Handler) http.Handler {
+func RequirePermission(authService *auth.Auth, perms *casbinx.Perm, action string) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			sessionCtx := r.Context()
-
-			// Step 1: Check authentication
-			rawUID := session.Manager.Get(sessionCtx, auth.SessionKeyUID)
-			uid, ok := rawUID.(string)
-
-			if !ok || uid == "" {
+			// Step 1: Check authentication and load the user
+			// (CurrentUser also ends revoked sessions)
+			u, ok := authService.CurrentUser(r)
+			if !ok {
 				// Not authenticated - redirect to login
 				loginURL := view.URLString(r, "/login")
 
@@ -68,16 +63,9 @@ func RequirePermission(authService *auth.Auth, users user.Store, perms *casbinx.
 				return
 			}
 
-			// Step 2: Load user for authorization check
-			u, err := users.FindByUID(sessionCtx, uid)
-			if err != nil {
-				http.Error(w, "User not found", http.StatusUnauthorized)
-				return
-			}
-
-			// Step 3: Check authorization via Casbin
-			// Subject is the user's display name (adapt this if your policy uses UID or email)
-			allowed := perms.Can(u.DisplayName, action)
+			// Step 2: Check authorization via Casbin
+			// Subject is "user:<id>" (adapt this if your policy uses email or roles)
+			allowed := perms.Can(u.Subject(), action)
 			if !allowed {
 				// Not authorized - return 403 with toast for HTMX requests
 				if r.Header.Get("HX-Request") == "true" {
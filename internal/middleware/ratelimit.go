@@ -0,0 +1,96 @@
+package middleware
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/axelrhd/hagg/internal/auth"
+	"github.com/axelrhd/hagg/internal/ratelimit"
+	"github.com/axelrhd/hagg/internal/throttle"
+	"github.com/axelrhd/hagg/internal/user"
+)
+
+// RateLimit is a Chi-compatible middleware that limits the requests of each
+// client in a route group (RATELIMIT_LIMITS). The client is the logged-in
+// user, otherwise the IP address (see RealIP). Groups add up: a request in
+// the "auth" group also counts for "default", and the headers describe the
+// innermost limit. A nil limiter or a group without a limit lets everything
+// pass.
+//
+// Every response carries RateLimit-Limit, RateLimit-Remaining,
+// RateLimit-Reset and RateLimit-Policy (draft-ietf-httpapi-ratelimit-headers).
+// A rejected request gets Retry-After and 429, or a warning toast (204) for
+// HTMX requests.
+//
+// Example:
+//
+//	r.Group(func(r chi.Router) {
+//	    r.Use(middleware.RateLimit(deps.RateLimit, ratelimit.GroupAuth))
+//	    r.Post("/htmx/login", wrapper.Wrap(login.HxLogin(deps)))
+//	})
+func RateLimit(limiter *ratelimit.Limiter, group string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			res, ok := limiter.Allow(r.Context(), group, rateLimitKey(r))
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			h := w.Header()
+			h.Set("RateLimit-Limit", strconv.Itoa(res.Limit.Requests))
+			h.Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+			h.Set("RateLimit-Reset", strconv.Itoa(seconds(res.Reset)))
+			h.Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", res.Limit.Requests, seconds(res.Limit.Per)))
+
+			if res.Allowed {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			wait := seconds(res.RetryAfter)
+			h.Set("Retry-After", strconv.Itoa(wait))
+
+			if r.Header.Get("HX-Request") == "true" {
+				h.Set("HX-Trigger", rateLimitToast(res.RetryAfter))
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+
+			http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
+		})
+	}
+}
+
+// rateLimitKey identifies the client: "user:<id>" or "ip:<address>".
+func rateLimitKey(r *http.Request) string {
+	if id, ok := auth.SessionUserID(r.Context()); ok {
+		return user.SubjectPrefix + strconv.FormatInt(id, 10)
+	}
+	return "ip:" + auth.ClientIP(r)
+}
+
+// rateLimitToast returns the HX-Trigger header of the warning toast.
+func rateLimitToast(wait time.Duration) string {
+	now := time.Now()
+	msg := fmt.Sprintf("Zu viele Anfragen, bitte in %s erneut versuchen.", throttle.RetryIn(now.Add(wait), now))
+
+	b, _ := json.Marshal(map[string]any{
+		"toast": map[string]any{
+			"message":  msg,
+			"level":    "warning",
+			"timeout":  5000,
+			"position": "bottom-right",
+		},
+	})
+	return string(b)
+}
+
+// seconds rounds d up to whole seconds, at least 1 if d > 0.
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
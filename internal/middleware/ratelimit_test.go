@@ -0,0 +1,104 @@
+package middleware
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/axelrhd/hagg/internal/config"
+	"github.com/axelrhd/hagg/internal/ratelimit"
+	storememory "github.com/axelrhd/hagg/internal/ratelimit/store_memory"
+	"github.com/axelrhd/hagg/internal/session"
+)
+
+// rateLimited returns a handler behind RealIP and RateLimit with a limit
+// of 2 requests per minute in the auth group.
+func rateLimited(t *testing.T) http.Handler {
+	t.Helper()
+
+	session.Init(session.NewMemoryStore())
+	limiter, err := ratelimit.NewLimiter(
+		config.RateLimitConfig{Enabled: true, Limits: map[string]string{ratelimit.GroupAuth: "2/1m"}},
+		storememory.New(),
+		slog.New(slog.NewTextHandler(io.Discard, nil)),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	return session.Manager.LoadAndSave(RealIP(trustedNets(t))(RateLimit(limiter, ratelimit.GroupAuth)(ok)))
+}
+
+func request(h http.Handler, remoteAddr string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/htmx/login", nil)
+	req.RemoteAddr = remoteAddr
+	for k, v := range header {
+		req.Header[k] = v
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestRateLimit(t *testing.T) {
+	h := rateLimited(t)
+
+	for i, remaining := range []string{"1", "0"} {
+		rec := request(h, "203.0.113.9:4711", nil)
+		if rec.Code != http.StatusOK || rec.Header().Get("RateLimit-Remaining") != remaining {
+			t.Fatalf("request #%d: %d, RateLimit-Remaining %q", i+1, rec.Code, rec.Header().Get("RateLimit-Remaining"))
+		}
+	}
+
+	rec := request(h, "203.0.113.9:4711", nil)
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("request #3: %d, want 429", rec.Code)
+	}
+	for header, want := range map[string]string{
+		"Retry-After":         "30",
+		"RateLimit-Limit":     "2",
+		"RateLimit-Remaining": "0",
+		"RateLimit-Reset":     "60",
+		"RateLimit-Policy":    "2;w=60",
+	} {
+		if v := rec.Header().Get(header); v != want {
+			t.Errorf("%s = %q, want %q", header, v, want)
+		}
+	}
+
+	// HTMX gets a toast instead of an error page
+	rec = request(h, "203.0.113.9:4711", http.Header{"Hx-Request": {"true"}})
+	if rec.Code != http.StatusNoContent || !strings.Contains(rec.Header().Get("HX-Trigger"), `"toast"`) {
+		t.Errorf("HTMX request: %d, HX-Trigger %q, want 204 and a toast", rec.Code, rec.Header().Get("HX-Trigger"))
+	}
+
+	// another client has a bucket of its own
+	if rec := request(h, "198.51.100.7:4711", nil); rec.Code != http.StatusOK {
+		t.Errorf("other client: %d, want 200", rec.Code)
+	}
+}
+
+func TestRateLimitSpoofedForwardedFor(t *testing.T) {
+	h := rateLimited(t)
+
+	// a direct client cannot escape its bucket with made-up addresses
+	for i, spoofed := range []string{"192.0.2.1", "192.0.2.2", "192.0.2.3"} {
+		rec := request(h, "203.0.113.9:4711", http.Header{"X-Forwarded-For": {spoofed}})
+		if want := i < 2; (rec.Code == http.StatusOK) != want {
+			t.Fatalf("request #%d (X-Forwarded-For %s): %d", i+1, spoofed, rec.Code)
+		}
+	}
+
+	// behind the proxy, the forwarded clients are told apart
+	for _, client := range []string{"192.0.2.1", "192.0.2.2"} {
+		rec := request(h, "10.0.0.1:4711", http.Header{"X-Forwarded-For": {client}})
+		if rec.Code != http.StatusOK {
+			t.Errorf("forwarded %s: %d, want 200", client, rec.Code)
+		}
+	}
+}
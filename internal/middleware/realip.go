@@ -0,0 +1,80 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// RealIP is a Chi-compatible middleware that sets r.RemoteAddr to the
+// client address reported by a trusted reverse proxy. Unlike chi's RealIP
+// it ignores X-Forwarded-For and X-Real-IP of everyone else, so clients
+// cannot choose their own address (rate limits, login throttle).
+//
+// X-Forwarded-For is read from the right: the first address that is not a
+// trusted proxy is the client; a hop before it that is no address keeps
+// the peer address. Requests over the unix socket have no peer
+// address and always count as from the proxy.
+//
+// Example:
+//
+//	r.Use(middleware.RealIP(trusted)) // config.ServerConfig.TrustedProxyNets
+func RealIP(trusted []*net.IPNet) func(http.Handler) http.Handler {
+	isTrusted := func(ip net.IP) bool {
+		for _, n := range trusted {
+			if n.Contains(ip) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			host, _, err := net.SplitHostPort(r.RemoteAddr)
+			if err != nil {
+				host = r.RemoteAddr
+			}
+
+			if peer := net.ParseIP(host); peer == nil || isTrusted(peer) {
+				if ip := forwardedFor(r.Header, isTrusted); ip != "" {
+					r.RemoteAddr = ip
+				}
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// forwardedFor returns the client address of the proxy headers, "" if
+// there is none or the chain of trusted proxies reaches a hop that is no
+// address (the peer address is kept).
+func forwardedFor(h http.Header, isTrusted func(net.IP) bool) string {
+	if values := h.Values("X-Forwarded-For"); len(values) > 0 {
+		hops := strings.Split(strings.Join(values, ","), ",")
+
+		client := ""
+		for i := len(hops) - 1; i >= 0; i-- {
+			ip := net.ParseIP(strings.TrimSpace(hops[i]))
+			if ip == nil {
+				// neither the client nor a proxy we know: whoever is
+				// left of it could have written anything
+				return ""
+			}
+			client = ip.String()
+			if !isTrusted(ip) {
+				return client
+			}
+		}
+
+		// only proxies: the leftmost is the closest to the client
+		return client
+	}
+
+	if ip := net.ParseIP(strings.TrimSpace(h.Get("X-Real-IP"))); ip != nil {
+		return ip.String()
+	}
+
+	return ""
+}
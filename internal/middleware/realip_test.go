@@ -0,0 +1,162 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// trustedNets is the proxy network of the tests.
+func trustedNets(t *testing.T) []*net.IPNet {
+	t.Helper()
+
+	var nets []*net.IPNet
+	for _, s := range []string{"10.0.0.0/8", "fd00::/8"} {
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		nets = append(nets, n)
+	}
+	return nets
+}
+
+// realIP returns r.RemoteAddr as RealIP hands it to the next handler.
+func realIP(t *testing.T, trusted []*net.IPNet, remoteAddr string, header http.Header) string {
+	t.Helper()
+
+	var got string
+	h := RealIP(trusted)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.RemoteAddr
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = remoteAddr
+	req.Header = header
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	return got
+}
+
+func TestRealIP(t *testing.T) {
+	trusted := trustedNets(t)
+
+	tests := []struct {
+		name   string
+		remote string
+		header http.Header
+		want   string
+	}{
+		{
+			name:   "direct client",
+			remote: "203.0.113.9:4711",
+			want:   "203.0.113.9:4711",
+		},
+		{
+			name:   "untrusted peer spoofs X-Forwarded-For",
+			remote: "203.0.113.9:4711",
+			header: http.Header{"X-Forwarded-For": {"192.0.2.1"}},
+			want:   "203.0.113.9:4711",
+		},
+		{
+			name:   "untrusted peer spoofs X-Real-IP",
+			remote: "203.0.113.9:4711",
+			header: http.Header{"X-Real-Ip": {"192.0.2.1"}},
+			want:   "203.0.113.9:4711",
+		},
+		{
+			name:   "trusted proxy",
+			remote: "10.0.0.1:4711",
+			header: http.Header{"X-Forwarded-For": {"203.0.113.9"}},
+			want:   "203.0.113.9",
+		},
+		{
+			// the client sent its own X-Forwarded-For; the proxies
+			// appended the real client and each other
+			name:   "multi-hop with a spoofed hop",
+			remote: "10.0.0.1:4711",
+			header: http.Header{"X-Forwarded-For": {"192.0.2.1, 203.0.113.9, 10.0.0.2"}},
+			want:   "203.0.113.9",
+		},
+		{
+			name:   "multi-hop over several headers",
+			remote: "10.0.0.1:4711",
+			header: http.Header{"X-Forwarded-For": {"192.0.2.1, 203.0.113.9", "10.0.0.3", "10.0.0.2"}},
+			want:   "203.0.113.9",
+		},
+		{
+			name:   "only proxies",
+			remote: "10.0.0.1:4711",
+			header: http.Header{"X-Forwarded-For": {"10.0.0.4, 10.0.0.3, 10.0.0.2"}},
+			want:   "10.0.0.4",
+		},
+		{
+			name:   "invalid hop keeps the peer",
+			remote: "10.0.0.1:4711",
+			header: http.Header{"X-Forwarded-For": {"203.0.113.9, unknown, 10.0.0.2"}},
+			want:   "10.0.0.1:4711",
+		},
+		{
+			name:   "invalid hop right of the proxy",
+			remote: "10.0.0.1:4711",
+			header: http.Header{"X-Forwarded-For": {"203.0.113.9, unknown"}, "X-Real-Ip": {"192.0.2.1"}},
+			want:   "10.0.0.1:4711",
+		},
+		{
+			name:   "invalid hop left of the client",
+			remote: "10.0.0.1:4711",
+			header: http.Header{"X-Forwarded-For": {"unknown, 203.0.113.9, 10.0.0.2"}},
+			want:   "203.0.113.9",
+		},
+		{
+			name:   "IPv6",
+			remote: "[fd00::1]:4711",
+			header: http.Header{"X-Forwarded-For": {"2001:db8::1, fd00::2"}},
+			want:   "2001:db8::1",
+		},
+		{
+			name:   "X-Real-IP of a trusted proxy",
+			remote: "10.0.0.1:4711",
+			header: http.Header{"X-Real-Ip": {"203.0.113.9"}},
+			want:   "203.0.113.9",
+		},
+		{
+			name:   "X-Forwarded-For before X-Real-IP",
+			remote: "10.0.0.1:4711",
+			header: http.Header{"X-Forwarded-For": {"203.0.113.9"}, "X-Real-Ip": {"192.0.2.1"}},
+			want:   "203.0.113.9",
+		},
+		{
+			name:   "trusted proxy without headers",
+			remote: "10.0.0.1:4711",
+			want:   "10.0.0.1:4711",
+		},
+		{
+			name:   "unix socket",
+			remote: "@",
+			header: http.Header{"X-Forwarded-For": {"203.0.113.9"}},
+			want:   "203.0.113.9",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := tt.header
+			if header == nil {
+				header = http.Header{}
+			}
+			if got := realIP(t, trusted, tt.remote, header); got != tt.want {
+				t.Errorf("RemoteAddr = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRealIPNoTrustedProxies(t *testing.T) {
+	// nothing trusted: every header is ignored
+	header := http.Header{"X-Forwarded-For": {"192.0.2.1"}, "X-Real-Ip": {"192.0.2.1"}}
+	if got := realIP(t, nil, "10.0.0.1:4711", header); got != "10.0.0.1:4711" {
+		t.Errorf("RemoteAddr = %q, want the peer", got)
+	}
+}
@@ -0,0 +1,107 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"sync/atomic"
+	"time"
+
+	"github.com/axelrhd/hagg/internal/config"
+)
+
+// pruneInterval is how often Allow removes unused buckets.
+const pruneInterval = time.Minute
+
+// Result describes the bucket after a request.
+type Result struct {
+	Limit      Limit
+	Allowed    bool
+	Remaining  int           // requests left right now
+	Reset      time.Duration // until the bucket is full again
+	RetryAfter time.Duration // until the next request is allowed, 0 if Allowed
+}
+
+// Limiter applies the limits of the route groups (RATELIMIT_LIMITS).
+//
+// A nil *Limiter is valid and limits nothing.
+type Limiter struct {
+	store  Store
+	limits map[string]Limit
+	maxPer time.Duration // buckets unused for this long are full
+	log    *slog.Logger
+
+	nextPrune atomic.Int64 // unix nanoseconds
+}
+
+// NewLimiter returns the limiter configured with RATELIMIT_*, nil if it is
+// disabled.
+func NewLimiter(cfg config.RateLimitConfig, store Store, log *slog.Logger) (*Limiter, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+
+	l := &Limiter{
+		store:  store,
+		limits: make(map[string]Limit, len(cfg.Limits)),
+		log:    log,
+	}
+	for group, s := range cfg.Limits {
+		requests, per, err := config.ParseRateLimit(s)
+		if err != nil {
+			return nil, fmt.Errorf("RATELIMIT_LIMITS %s: %w", group, err)
+		}
+		l.limits[group] = Limit{Requests: requests, Per: per}
+		l.maxPer = max(l.maxPer, per)
+	}
+
+	return l, nil
+}
+
+// Allow takes a token from the bucket of key (a client) in group. It
+// returns false if the group has no limit. A broken store is logged and
+// lets the request pass: the limiter must not take the app down with it.
+func (l *Limiter) Allow(ctx context.Context, group, key string) (Result, bool) {
+	if l == nil {
+		return Result{}, false
+	}
+	limit, ok := l.limits[group]
+	if !ok {
+		return Result{}, false
+	}
+
+	now := time.Now()
+	l.prune(ctx, now)
+
+	allowed, tokens, err := l.store.Take(ctx, group+":"+key, limit, now)
+	if err != nil {
+		l.log.WarnContext(ctx, "rate limit failed", "group", group, "key", key, "err", err)
+		return Result{}, false
+	}
+
+	res := Result{
+		Limit:     limit,
+		Allowed:   allowed,
+		Remaining: int(math.Floor(tokens)),
+		Reset:     limit.Until(tokens, float64(limit.Requests)),
+	}
+	if !allowed {
+		res.RetryAfter = limit.Until(tokens, 1)
+		l.log.WarnContext(ctx, "rate limited", "group", group, "key", key)
+	}
+
+	return res, true
+}
+
+// prune removes unused buckets, at most once per pruneInterval.
+func (l *Limiter) prune(ctx context.Context, now time.Time) {
+	next := l.nextPrune.Load()
+	if now.UnixNano() < next || !l.nextPrune.CompareAndSwap(next, now.Add(pruneInterval).UnixNano()) {
+		return
+	}
+
+	if _, err := l.store.Prune(ctx, now.Add(-l.maxPer)); err != nil {
+		l.log.WarnContext(ctx, "prune rate limits failed", "err", err)
+	}
+}
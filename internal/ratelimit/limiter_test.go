@@ -0,0 +1,157 @@
+package ratelimit_test
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/axelrhd/hagg/internal/config"
+	"github.com/axelrhd/hagg/internal/ratelimit"
+	storememory "github.com/axelrhd/hagg/internal/ratelimit/store_memory"
+)
+
+func TestLimitRefill(t *testing.T) {
+	l := ratelimit.Limit{Requests: 4, Per: 2 * time.Second} // 2 per second
+
+	tests := []struct {
+		tokens  float64
+		elapsed time.Duration
+		want    float64
+	}{
+		{0, 0, 0},
+		{1, -time.Second, 1}, // clock went back: nothing refilled
+		{0, 250 * time.Millisecond, 0.5},
+		{0, time.Second, 2},
+		{1.5, time.Second, 3.5},
+		{3, time.Hour, 4}, // at most Requests
+	}
+
+	for _, tt := range tests {
+		if got := l.Refill(tt.tokens, tt.elapsed); got != tt.want {
+			t.Errorf("Refill(%v, %s) = %v, want %v", tt.tokens, tt.elapsed, got, tt.want)
+		}
+	}
+}
+
+func TestLimitUntil(t *testing.T) {
+	l := ratelimit.Limit{Requests: 4, Per: 2 * time.Second}
+
+	tests := []struct {
+		tokens, want float64
+		wait         time.Duration
+	}{
+		{1, 1, 0},
+		{2, 1, 0},
+		{0, 1, 500 * time.Millisecond},
+		{0.5, 1, 250 * time.Millisecond},
+		{0, 4, 2 * time.Second}, // empty to full: Per
+	}
+
+	for _, tt := range tests {
+		if got := l.Until(tt.tokens, tt.want); got != tt.wait {
+			t.Errorf("Until(%v, %v) = %s, want %s", tt.tokens, tt.want, got, tt.wait)
+		}
+	}
+}
+
+func newLimiter(t *testing.T, limits map[string]string) *ratelimit.Limiter {
+	t.Helper()
+
+	l, err := ratelimit.NewLimiter(
+		config.RateLimitConfig{Enabled: true, Limits: limits},
+		storememory.New(),
+		slog.New(slog.NewTextHandler(io.Discard, nil)),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return l
+}
+
+func TestLimiterBurst(t *testing.T) {
+	l := newLimiter(t, map[string]string{ratelimit.GroupAuth: "3/1m"})
+	ctx := context.Background()
+
+	for i := range 3 {
+		res, ok := l.Allow(ctx, ratelimit.GroupAuth, "ip:192.0.2.1")
+		if !ok || !res.Allowed {
+			t.Fatalf("request #%d: Allow = %+v, %t, want allowed", i+1, res, ok)
+		}
+		if res.Remaining != 2-i || res.RetryAfter != 0 {
+			t.Errorf("request #%d: Remaining = %d, RetryAfter = %s", i+1, res.Remaining, res.RetryAfter)
+		}
+	}
+
+	res, ok := l.Allow(ctx, ratelimit.GroupAuth, "ip:192.0.2.1")
+	if !ok || res.Allowed {
+		t.Fatalf("request #4: Allow = %+v, %t, want rejected", res, ok)
+	}
+	// one token every 20s, a full bucket after a minute
+	if res.Remaining != 0 || res.RetryAfter <= 19*time.Second || res.RetryAfter > 20*time.Second {
+		t.Errorf("request #4: Remaining = %d, RetryAfter = %s, want 0, ~20s", res.Remaining, res.RetryAfter)
+	}
+	if res.Reset <= 59*time.Second || res.Reset > time.Minute {
+		t.Errorf("request #4: Reset = %s, want ~1m", res.Reset)
+	}
+	if res.Limit != (ratelimit.Limit{Requests: 3, Per: time.Minute}) {
+		t.Errorf("Limit = %+v", res.Limit)
+	}
+}
+
+func TestLimiterGroups(t *testing.T) {
+	l := newLimiter(t, map[string]string{
+		ratelimit.GroupDefault: "100/1m",
+		ratelimit.GroupAuth:    "1/1m",
+	})
+	ctx := context.Background()
+
+	if res, _ := l.Allow(ctx, ratelimit.GroupAuth, "ip:192.0.2.1"); !res.Allowed {
+		t.Fatal("first auth request rejected")
+	}
+	if res, _ := l.Allow(ctx, ratelimit.GroupAuth, "ip:192.0.2.1"); res.Allowed {
+		t.Fatal("second auth request allowed")
+	}
+
+	// the exhausted auth bucket touches neither the other groups nor the
+	// other clients
+	if res, ok := l.Allow(ctx, ratelimit.GroupDefault, "ip:192.0.2.1"); !ok || !res.Allowed || res.Remaining != 99 {
+		t.Errorf("default group: Allow = %+v, %t, want a full bucket of its own", res, ok)
+	}
+	if res, ok := l.Allow(ctx, ratelimit.GroupAuth, "ip:198.51.100.7"); !ok || !res.Allowed {
+		t.Errorf("other client: Allow = %+v, %t, want allowed", res, ok)
+	}
+
+	// a group without a limit is not limited
+	if _, ok := l.Allow(ctx, "admin", "ip:192.0.2.1"); ok {
+		t.Error("group without a limit: Allow = ok")
+	}
+}
+
+func TestLimiterDisabled(t *testing.T) {
+	l, err := ratelimit.NewLimiter(
+		config.RateLimitConfig{Enabled: false, Limits: map[string]string{ratelimit.GroupDefault: "1/1m"}},
+		storememory.New(), nil,
+	)
+	if err != nil || l != nil {
+		t.Fatalf("NewLimiter(disabled) = %v, %v, want nil", l, err)
+	}
+
+	// a nil limiter limits nothing
+	for range 3 {
+		if _, ok := l.Allow(context.Background(), ratelimit.GroupDefault, "ip:192.0.2.1"); ok {
+			t.Fatal("nil limiter: Allow = ok")
+		}
+	}
+}
+
+func TestNewLimiterInvalid(t *testing.T) {
+	_, err := ratelimit.NewLimiter(
+		config.RateLimitConfig{Enabled: true, Limits: map[string]string{ratelimit.GroupAuth: "30 per minute"}},
+		storememory.New(), nil,
+	)
+	if err == nil {
+		t.Error("NewLimiter(invalid limit) = nil, want an error")
+	}
+}
@@ -0,0 +1,57 @@
+// Package ratelimit limits requests with token buckets: every client (IP
+// or logged-in user) gets one bucket per route group, holding up to
+// Limit.Requests tokens that refill evenly over Limit.Per. Each request
+// takes a token; an empty bucket rejects it (see Limiter).
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"time"
+)
+
+// GroupDefault is the group of the global middleware (server.go). Route
+// groups with stricter limits use their own name, e.g. GroupAuth.
+const (
+	GroupDefault = "default"
+	GroupAuth    = "auth" // login endpoints
+)
+
+// Limit allows Requests per Per, refilled continuously (bursts up to
+// Requests).
+type Limit struct {
+	Requests int
+	Per      time.Duration
+}
+
+// Refill returns the tokens of a bucket that held tokens elapsed ago.
+func (l Limit) Refill(tokens float64, elapsed time.Duration) float64 {
+	if elapsed <= 0 {
+		return tokens
+	}
+	return min(float64(l.Requests), tokens+elapsed.Seconds()*l.rate())
+}
+
+// Until returns how long a bucket holding tokens needs to hold want.
+func (l Limit) Until(tokens, want float64) time.Duration {
+	if tokens >= want {
+		return 0
+	}
+	return time.Duration(math.Ceil((want - tokens) / l.rate() * float64(time.Second)))
+}
+
+// rate returns the refill in tokens per second.
+func (l Limit) rate() float64 {
+	return float64(l.Requests) / l.Per.Seconds()
+}
+
+type Store interface {
+	// Take removes one token from the bucket of key (a new bucket is full)
+	// and returns the tokens left. If the bucket holds less than one token,
+	// it is left as is and Take returns false with its current tokens.
+	Take(ctx context.Context, key string, l Limit, now time.Time) (bool, float64, error)
+
+	// Prune removes buckets last used before before and returns their
+	// number. Buckets unused for their Limit.Per are full, like new ones.
+	Prune(ctx context.Context, before time.Time) (int64, error)
+}
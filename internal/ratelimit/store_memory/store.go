@@ -0,0 +1,57 @@
+package storememory
+
+import (
+	"context"
+	"maps"
+	"sync"
+	"time"
+
+	"github.com/axelrhd/hagg/internal/ratelimit"
+)
+
+type bucket struct {
+	tokens    float64
+	updatedAt time.Time
+}
+
+// Store is a concurrency-safe, in-memory ratelimit.Store. Buckets belong
+// to one process and are lost when it exits.
+type Store struct {
+	mu      sync.Mutex
+	buckets map[string]bucket
+}
+
+func New() *Store {
+	return &Store{buckets: make(map[string]bucket)}
+}
+
+// Compile-time interface check
+var _ ratelimit.Store = (*Store)(nil)
+
+func (s *Store) Take(ctx context.Context, key string, l ratelimit.Limit, now time.Time) (bool, float64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tokens := float64(l.Requests)
+	if b, ok := s.buckets[key]; ok {
+		tokens = l.Refill(b.tokens, now.Sub(b.updatedAt))
+	}
+	if tokens < 1 {
+		return false, tokens, nil
+	}
+
+	s.buckets[key] = bucket{tokens: tokens - 1, updatedAt: now}
+	return true, tokens - 1, nil
+}
+
+func (s *Store) Prune(ctx context.Context, before time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := len(s.buckets)
+	maps.DeleteFunc(s.buckets, func(_ string, b bucket) bool {
+		return b.updatedAt.Before(before)
+	})
+
+	return int64(n - len(s.buckets)), nil
+}
@@ -0,0 +1,15 @@
+package storememory_test
+
+import (
+	"testing"
+
+	"github.com/axelrhd/hagg/internal/ratelimit"
+	storememory "github.com/axelrhd/hagg/internal/ratelimit/store_memory"
+	"github.com/axelrhd/hagg/internal/ratelimit/storetest"
+)
+
+func TestStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) ratelimit.Store {
+		return storememory.New()
+	})
+}
@@ -0,0 +1,38 @@
+package storesqlite
+
+import (
+	"github.com/nullism/bqb"
+)
+
+// qTake takes a token in one statement, so concurrent requests cannot
+// spend the same token. The refilled tokens are
+//
+//	MIN(capacity, tokens + elapsed milliseconds * rate)
+//
+// A bucket with less than one token is not updated and returns no row.
+func qTake(key string, capacity, ratePerMs float64, now int64) *bqb.Query {
+	const refilled = `MIN(?, rate_limits.tokens + MAX(0, excluded.updated_at - rate_limits.updated_at) * ?)`
+
+	return bqb.New(`
+		INSERT INTO rate_limits (key, tokens, updated_at)
+		VALUES (?, ?, ?)
+		ON CONFLICT (key) DO UPDATE SET
+			tokens = `+refilled+` - 1,
+			updated_at = excluded.updated_at
+		WHERE `+refilled+` >= 1
+		RETURNING tokens`,
+		key, capacity-1, now,
+		capacity, ratePerMs,
+		capacity, ratePerMs)
+}
+
+func qBucket(key string) *bqb.Query {
+	return bqb.New(`
+		SELECT tokens, updated_at
+		FROM rate_limits
+		WHERE key = ?`, key)
+}
+
+func qPrune(before int64) *bqb.Query {
+	return bqb.New("DELETE FROM rate_limits WHERE updated_at < ?", before)
+}
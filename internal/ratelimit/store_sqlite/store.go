@@ -0,0 +1,77 @@
+package storesqlite
+
+import (
+	"context"
+	"time"
+
+	"github.com/axelrhd/hagg/internal/db"
+	"github.com/axelrhd/hagg/internal/ratelimit"
+)
+
+type Store struct {
+	write db.Querier // single-connection writer pool
+	read  db.Querier // multi-connection reader pool
+}
+
+// New returns a Store using the given writer and reader.
+func New(write, read db.Querier) *Store {
+	return &Store{
+		write: write,
+		read:  read,
+	}
+}
+
+// Compile-time interface check
+var _ ratelimit.Store = (*Store)(nil)
+
+// bucket is a row of rate_limits.
+type bucket struct {
+	Tokens    float64 `db:"tokens"`
+	UpdatedAt int64   `db:"updated_at"` // unix milliseconds
+}
+
+func (s *Store) Take(ctx context.Context, key string, l ratelimit.Limit, now time.Time) (bool, float64, error) {
+	capacity := float64(l.Requests)
+	ratePerMs := capacity / float64(l.Per.Milliseconds())
+
+	sql, args, err := qTake(key, capacity, ratePerMs, now.UnixMilli()).ToSql()
+	if err != nil {
+		return false, 0, err // Programmierfehler
+	}
+
+	var tokens float64
+	err = s.write.GetContext(ctx, &tokens, sql, args...)
+	if err == nil {
+		return true, tokens, nil
+	}
+	if !isNoRows(err) {
+		return false, 0, err
+	}
+
+	// empty bucket: report what it holds now
+	sql, args, err = qBucket(key).ToSql()
+	if err != nil {
+		return false, 0, err // Programmierfehler
+	}
+
+	var b bucket
+	if err := s.read.GetContext(ctx, &b, sql, args...); err != nil {
+		return false, 0, err
+	}
+
+	return false, l.Refill(b.Tokens, now.Sub(time.UnixMilli(b.UpdatedAt))), nil
+}
+
+func (s *Store) Prune(ctx context.Context, before time.Time) (int64, error) {
+	sql, args, err := qPrune(before.UnixMilli()).ToSql()
+	if err != nil {
+		return 0, err // Programmierfehler
+	}
+
+	res, err := s.write.ExecContext(ctx, sql, args...)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
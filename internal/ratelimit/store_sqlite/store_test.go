@@ -0,0 +1,38 @@
+package storesqlite_test
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/axelrhd/hagg/internal/config"
+	"github.com/axelrhd/hagg/internal/db"
+	"github.com/axelrhd/hagg/internal/ratelimit"
+	storesqlite "github.com/axelrhd/hagg/internal/ratelimit/store_sqlite"
+	"github.com/axelrhd/hagg/internal/ratelimit/storetest"
+	userstoretest "github.com/axelrhd/hagg/internal/user/storetest"
+)
+
+func TestStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) ratelimit.Store {
+		sqlite, err := db.OpenSQLite(config.SQLiteConfig{
+			Path:        filepath.Join(t.TempDir(), "test.sqlite3"),
+			JournalMode: "WAL",
+			Synchronous: "NORMAL",
+			BusyTimeout: 5 * time.Second,
+			ReadConns:   2,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { sqlite.Close() })
+
+		for _, up := range userstoretest.MigrationsUp(t, "../../../migrations") {
+			if _, err := sqlite.Write.Exec(up); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		return storesqlite.New(sqlite.Write, sqlite.Read)
+	})
+}
@@ -0,0 +1,121 @@
+// Package storetest is the contract every ratelimit.Store implementation
+// must fulfil. The backends run it from their own tests:
+//
+//	func TestStore(t *testing.T) {
+//	    storetest.Run(t, func(t *testing.T) ratelimit.Store {
+//	        ... // fresh, migrated database
+//	        return store
+//	    })
+//	}
+package storetest
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/axelrhd/hagg/internal/ratelimit"
+)
+
+// limit allows 3 requests per 3 seconds: one token per second.
+var limit = ratelimit.Limit{Requests: 3, Per: 3 * time.Second}
+
+// Run runs the contract against fresh stores returned by open (one per
+// subtest).
+func Run(t *testing.T, open func(t *testing.T) ratelimit.Store) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, s ratelimit.Store)
+	}{
+		{"Burst", testBurst},
+		{"Refill", testRefill},
+		{"Keys", testKeys},
+		{"Prune", testPrune},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, open(t))
+		})
+	}
+}
+
+// start is a whole second, so the stores that keep milliseconds lose
+// nothing.
+var start = time.Unix(1_700_000_000, 0)
+
+// take calls Take and checks its result; tokens within a millisecond's
+// refill.
+func take(t *testing.T, s ratelimit.Store, key string, now time.Time, wantAllowed bool, wantTokens float64) {
+	t.Helper()
+
+	allowed, tokens, err := s.Take(context.Background(), key, limit, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if allowed != wantAllowed || math.Abs(tokens-wantTokens) > 0.001 {
+		t.Fatalf("Take(%s, +%s) = %t, %.3f, want %t, %.3f",
+			key, now.Sub(start), allowed, tokens, wantAllowed, wantTokens)
+	}
+}
+
+func testBurst(t *testing.T, s ratelimit.Store) {
+	// a new bucket is full: Requests at once, then nothing
+	take(t, s, "ip:a", start, true, 2)
+	take(t, s, "ip:a", start, true, 1)
+	take(t, s, "ip:a", start, true, 0)
+	take(t, s, "ip:a", start, false, 0)
+	take(t, s, "ip:a", start, false, 0)
+}
+
+func testRefill(t *testing.T, s ratelimit.Store) {
+	take(t, s, "ip:a", start, true, 2)
+	take(t, s, "ip:a", start, true, 1)
+	take(t, s, "ip:a", start, true, 0)
+
+	// half a token: rejected, and the rejection costs nothing
+	take(t, s, "ip:a", start.Add(500*time.Millisecond), false, 0.5)
+	take(t, s, "ip:a", start.Add(time.Second), true, 0)
+
+	// one token per second
+	take(t, s, "ip:a", start.Add(2*time.Second), true, 0)
+	take(t, s, "ip:a", start.Add(2*time.Second), false, 0)
+
+	// a long pause fills the bucket, but not beyond Requests
+	take(t, s, "ip:a", start.Add(time.Hour), true, 2)
+	take(t, s, "ip:a", start.Add(time.Hour), true, 1)
+}
+
+func testKeys(t *testing.T, s ratelimit.Store) {
+	for range limit.Requests {
+		if ok, _, err := s.Take(context.Background(), "auth:ip:a", limit, start); err != nil || !ok {
+			t.Fatalf("Take = %t, %v", ok, err)
+		}
+	}
+	take(t, s, "auth:ip:a", start, false, 0)
+
+	// other clients and groups have buckets of their own
+	take(t, s, "auth:ip:b", start, true, 2)
+	take(t, s, "default:ip:a", start, true, 2)
+}
+
+func testPrune(t *testing.T, s ratelimit.Store) {
+	ctx := context.Background()
+
+	take(t, s, "ip:old", start, true, 2)
+	take(t, s, "ip:old", start, true, 1)
+	take(t, s, "ip:new", start.Add(time.Minute), true, 2)
+
+	n, err := s.Prune(ctx, start.Add(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("Prune = %d, want 1", n)
+	}
+
+	// a pruned bucket starts full, the others are kept
+	take(t, s, "ip:old", start.Add(2*time.Second), true, 2)
+	take(t, s, "ip:new", start.Add(time.Minute), true, 1)
+}
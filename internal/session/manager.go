@@ -3,49 +3,37 @@ package session
 import (
 	"database/sql"
 	"net/http"
-	"os"
-	"path/filepath"
 	"time"
 
+	"github.com/alexedwards/scs/pgxstore"
 	"github.com/alexedwards/scs/sqlite3store"
 	"github.com/alexedwards/scs/v2"
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/alexedwards/scs/v2/memstore"
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 // Manager is the global session manager instance.
 // It's initialized once during application startup via Init().
 var Manager *scs.SessionManager
 
-// Init initializes the global session manager with SQLite persistent storage.
+// Init initializes the global session manager with the given storage backend.
 // This must be called before starting the server.
 //
 // The session manager is configured with:
 //   - 24 hour session lifetime
 //   - HttpOnly cookies (prevents XSS attacks)
 //   - SameSite=Lax (CSRF protection)
-//   - SQLite backend for persistence across restarts
-//   - Shared database with app (default: ./db.sqlite3)
+//   - Persistent storage (SQLite or Postgres, see NewSQLiteStore / NewPostgresStore)
+//     or in-memory storage for development (NewMemoryStore)
 //
 // Example:
 //
-//	if err := session.Init("./db.sqlite3"); err != nil {
-//	    log.Fatal("failed to init sessions", "error", err)
+//	dbx, err := db.OpenSQLite(cfg.Database.SQLite)
+//	if err != nil {
+//	    log.Fatal("failed to open database", "error", err)
 //	}
-func Init(dbPath string) error {
-	// Ensure directory exists (if DB is in subdirectory)
-	dir := filepath.Dir(dbPath)
-	if dir != "." && dir != "/" {
-		if err := os.MkdirAll(dir, 0755); err != nil {
-			return err
-		}
-	}
-
-	// Open SQLite database for session storage
-	db, err := sql.Open("sqlite3", dbPath)
-	if err != nil {
-		return err
-	}
-
+//	session.Init(session.NewSQLiteStore(dbx.Write.DB, dbx.Read.DB))
+func Init(store scs.Store) {
 	// Create session manager
 	Manager = scs.New()
 	Manager.Lifetime = 24 * time.Hour
@@ -54,8 +42,46 @@ func Init(dbPath string) error {
 	Manager.Cookie.SameSite = http.SameSiteLaxMode
 
 	// Persistent storage - sessions survive server restarts
-	store := sqlite3store.New(db)
 	Manager.Store = store
+}
+
+// NewSQLiteStore returns a session store in the `sessions` table of the app
+// database (see migrations). It uses the pools of db.OpenSQLite: writes go
+// through the single writer (same pragmas, no competing write lock), the
+// lookup on every request through the reader pool.
+func NewSQLiteStore(write, read *sql.DB) scs.Store {
+	return &sqliteStore{
+		read:  sqlite3store.NewWithCleanupInterval(read, 0), // query_only: no cleanup
+		write: sqlite3store.New(write),
+	}
+}
+
+// NewPostgresStore returns a session store backed by the `sessions` table
+// in PostgreSQL (see migrations/postgres).
+func NewPostgresStore(pool *pgxpool.Pool) scs.Store {
+	return pgxstore.New(pool)
+}
+
+// NewMemoryStore returns an in-memory session store.
+// Sessions are lost on restart – use it for development and tests only.
+func NewMemoryStore() scs.Store {
+	return memstore.New()
+}
+
+// sqliteStore splits sqlite3store between the writer and reader pools.
+type sqliteStore struct {
+	read  *sqlite3store.SQLite3Store
+	write *sqlite3store.SQLite3Store
+}
+
+func (s *sqliteStore) Find(token string) ([]byte, bool, error) {
+	return s.read.Find(token)
+}
+
+func (s *sqliteStore) Commit(token string, b []byte, expiry time.Time) error {
+	return s.write.Commit(token, b, expiry)
+}
 
-	return nil
+func (s *sqliteStore) Delete(token string) error {
+	return s.write.Delete(token)
 }
@@ -0,0 +1,33 @@
+package shared
+
+import (
+	"encoding/json"
+
+	"github.com/axelrhd/hagg-lib/handler"
+)
+
+// JSONError is the body of a failed JSON response. Scripts show Error as
+// a toast (see static/js/passkey.js).
+type JSONError struct {
+	Error string `json:"error"`
+}
+
+// WriteJSON writes v as JSON response. Only for endpoints called by
+// scripts (fetch) instead of HTMX, e.g. the WebAuthn options of passkeys.
+//
+// Example:
+//
+//	return shared.WriteJSON(ctx, http.StatusOK, options)
+//	return shared.WriteJSONError(ctx, http.StatusUnauthorized, "Nicht angemeldet.")
+func WriteJSON(ctx *handler.Context, status int, v any) error {
+	ctx.Res.Header().Set("Content-Type", "application/json")
+	ctx.Res.Header().Set("Cache-Control", "no-store")
+	ctx.Res.WriteHeader(status)
+
+	return json.NewEncoder(ctx.Res).Encode(v)
+}
+
+// WriteJSONError writes msg as JSONError with status.
+func WriteJSONError(ctx *handler.Context, status int, msg string) error {
+	return WriteJSON(ctx, status, JSONError{Error: msg})
+}
@@ -0,0 +1,43 @@
+package store
+
+import (
+	"context"
+
+	storeThrottleMemory "github.com/axelrhd/hagg/internal/throttle/store_memory"
+	storeUserMemory "github.com/axelrhd/hagg/internal/user/store_memory"
+)
+
+// Memory is the Manager for the in-memory backend (DB_DRIVER=memory).
+type Memory struct {
+	users    *storeUserMemory.Store
+	throttle *storeThrottleMemory.Store
+}
+
+func NewMemory(users *storeUserMemory.Store) *Memory {
+	return &Memory{
+		users:    users,
+		throttle: storeThrottleMemory.New(),
+	}
+}
+
+// Compile-time interface check
+var _ Manager = (*Memory)(nil)
+
+func (m *Memory) Stores() Stores {
+	return Stores{
+		Users:    m.users,
+		Throttle: m.throttle,
+	}
+}
+
+// WithTx runs fn against a copy of the stores that is published only
+// if fn succeeds (see storememory.Store.Tx). Throttle counters are not
+// part of the copy: every change applies immediately.
+func (m *Memory) WithTx(ctx context.Context, fn func(tx Stores) error) error {
+	return m.users.Tx(func(tx *storeUserMemory.Store) error {
+		return fn(Stores{
+			Users:    tx,
+			Throttle: m.throttle,
+		})
+	})
+}
@@ -0,0 +1,52 @@
+package store_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/axelrhd/hagg/internal/store"
+	"github.com/axelrhd/hagg/internal/store/storetest"
+	"github.com/axelrhd/hagg/internal/user"
+	storeUserMemory "github.com/axelrhd/hagg/internal/user/store_memory"
+	userstoretest "github.com/axelrhd/hagg/internal/user/storetest"
+)
+
+func newMemory() *store.Memory {
+	return store.NewMemory(storeUserMemory.New(user.NewUIDHasher(userstoretest.Pepper)))
+}
+
+func TestMemory(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) store.Manager {
+		return newMemory()
+	})
+}
+
+func TestMemoryRetryOnConflict(t *testing.T) {
+	ctx := context.Background()
+	m := newMemory()
+
+	// a write outside the transaction while fn runs: fn runs again on the
+	// new state, the first attempt leaves nothing behind
+	calls := 0
+	err := m.WithTx(ctx, func(tx store.Stores) error {
+		calls++
+		if calls == 1 {
+			if _, err := m.Stores().Users.CreateUser(ctx, user.CreateUserInput{UID: "uid-bob", DisplayName: "bob"}); err != nil {
+				return err
+			}
+		}
+		_, err := tx.Users.CreateUser(ctx, user.CreateUserInput{UID: "uid-alice", DisplayName: "alice"})
+		return err
+	})
+	if err != nil || calls != 2 {
+		t.Fatalf("WithTx = %v after %d calls, want nil after 2", err, calls)
+	}
+
+	users, err := m.Stores().Users.ListUsers(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 2 {
+		t.Errorf("users = %d, want alice once and bob", len(users))
+	}
+}
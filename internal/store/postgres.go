@@ -0,0 +1,51 @@
+package store
+
+import (
+	"context"
+
+	"github.com/axelrhd/hagg/internal/db"
+	storeThrottlePostgres "github.com/axelrhd/hagg/internal/throttle/store_postgres"
+	"github.com/axelrhd/hagg/internal/user"
+	storeUserPostgres "github.com/axelrhd/hagg/internal/user/store_postgres"
+	"github.com/jmoiron/sqlx"
+)
+
+// Postgres is the Manager for the PostgreSQL backend.
+type Postgres struct {
+	db     *db.Postgres
+	ql     *db.QueryLogger
+	uids   *user.UIDHasher
+	stores Stores
+}
+
+// NewPostgres wires all stores to the PostgreSQL pool. Every statement goes
+// through ql (query logging, slow query warnings, statistics).
+func NewPostgres(pg *db.Postgres, ql *db.QueryLogger, uids *user.UIDHasher) *Postgres {
+	return &Postgres{
+		db:   pg,
+		ql:   ql,
+		uids: uids,
+		stores: Stores{
+			Users:    storeUserPostgres.New(ql.Wrap(pg.DB), uids),
+			Throttle: storeThrottlePostgres.New(ql.Wrap(pg.DB)),
+		},
+	}
+}
+
+// Compile-time interface check
+var _ Manager = (*Postgres)(nil)
+
+func (p *Postgres) Stores() Stores {
+	return p.stores
+}
+
+func (p *Postgres) WithTx(ctx context.Context, fn func(tx Stores) error) error {
+	return p.db.WithTx(ctx, func(tx *sqlx.Tx) error {
+		q := p.ql.Wrap(tx)
+
+		return fn(Stores{
+			Users:    storeUserPostgres.New(q, p.uids),
+			Throttle: storeThrottlePostgres.New(q),
+		})
+	})
+}
@@ -0,0 +1,56 @@
+package store
+
+import (
+	"context"
+
+	"github.com/axelrhd/hagg/internal/db"
+	storeThrottleSqlite "github.com/axelrhd/hagg/internal/throttle/store_sqlite"
+	"github.com/axelrhd/hagg/internal/user"
+	storeUserSqlite "github.com/axelrhd/hagg/internal/user/store_sqlite"
+	"github.com/jmoiron/sqlx"
+)
+
+// SQLite is the Manager for the SQLite backend.
+type SQLite struct {
+	db     *db.SQLite
+	ql     *db.QueryLogger
+	uids   *user.UIDHasher
+	stores Stores
+}
+
+// NewSQLite wires all stores to the SQLite pools. Every statement goes
+// through ql (query logging, slow query warnings, statistics).
+func NewSQLite(dbs *db.SQLite, ql *db.QueryLogger, uids *user.UIDHasher) *SQLite {
+	write := ql.Wrap(dbs.Write)
+	read := ql.Wrap(dbs.Read)
+
+	return &SQLite{
+		db:   dbs,
+		ql:   ql,
+		uids: uids,
+		stores: Stores{
+			Users:    storeUserSqlite.New(write, read, uids),
+			Throttle: storeThrottleSqlite.New(write, read),
+		},
+	}
+}
+
+// Compile-time interface check
+var _ Manager = (*SQLite)(nil)
+
+func (s *SQLite) Stores() Stores {
+	return s.stores
+}
+
+// WithTx runs fn in a write transaction. On SQLITE_BUSY the whole
+// transaction is retried (see db.SQLite.WithTx).
+func (s *SQLite) WithTx(ctx context.Context, fn func(tx Stores) error) error {
+	return s.db.WithTx(ctx, func(tx *sqlx.Tx) error {
+		q := s.ql.Wrap(tx)
+
+		return fn(Stores{
+			Users:    storeUserSqlite.New(q, q, s.uids),
+			Throttle: storeThrottleSqlite.New(q, q),
+		})
+	})
+}
@@ -0,0 +1,41 @@
+package store_test
+
+import (
+	"io"
+	"log/slog"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/axelrhd/hagg/internal/config"
+	"github.com/axelrhd/hagg/internal/db"
+	"github.com/axelrhd/hagg/internal/store"
+	"github.com/axelrhd/hagg/internal/store/storetest"
+	"github.com/axelrhd/hagg/internal/user"
+	userstoretest "github.com/axelrhd/hagg/internal/user/storetest"
+)
+
+func TestSQLite(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) store.Manager {
+		sqlite, err := db.OpenSQLite(config.SQLiteConfig{
+			Path:        filepath.Join(t.TempDir(), "test.sqlite3"),
+			JournalMode: "WAL",
+			Synchronous: "NORMAL",
+			BusyTimeout: 5 * time.Second,
+			ReadConns:   2,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { sqlite.Close() })
+
+		for _, up := range userstoretest.MigrationsUp(t, "../../migrations") {
+			if _, err := sqlite.Write.Exec(up); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		ql := db.NewQueryLogger(slog.New(slog.NewTextHandler(io.Discard, nil)), time.Second)
+		return store.NewSQLite(sqlite, ql, user.NewUIDHasher(userstoretest.Pepper))
+	})
+}
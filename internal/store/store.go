@@ -0,0 +1,33 @@
+// Package store bundles the repositories of all domains into a unit of work.
+//
+// Each domain keeps its own Store interface (e.g. user.Store). This package
+// only knows how to hand out a consistent set of them – either bound to the
+// database directly or to a single transaction, so multi-step operations
+// ("create user, assign role, write audit entry") commit or fail together.
+//
+// New domain stores join by adding a field to Stores and wiring it up in
+// every backend.
+package store
+
+import (
+	"context"
+
+	"github.com/axelrhd/hagg/internal/throttle"
+	"github.com/axelrhd/hagg/internal/user"
+)
+
+// Stores is the set of repositories available to a unit of work.
+type Stores struct {
+	Users    user.Store
+	Throttle throttle.Store // failed login counters
+}
+
+// Manager hands out Stores and runs units of work.
+type Manager interface {
+	// Stores returns repositories that are not bound to a transaction.
+	Stores() Stores
+
+	// WithTx runs fn inside a single transaction.
+	// The transaction is committed if fn returns nil, rolled back otherwise.
+	WithTx(ctx context.Context, fn func(tx Stores) error) error
+}
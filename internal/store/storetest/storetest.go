@@ -0,0 +1,186 @@
+// Package storetest is the contract every store.Manager implementation
+// must fulfil. The backends run it from their own tests:
+//
+//	func TestManager(t *testing.T) {
+//	    storetest.Run(t, func(t *testing.T) store.Manager {
+//	        ... // fresh, migrated database
+//	        return manager
+//	    })
+//	}
+package storetest
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/axelrhd/hagg/internal/store"
+	"github.com/axelrhd/hagg/internal/user"
+)
+
+// Run runs the contract against fresh managers returned by open (one per
+// subtest).
+func Run(t *testing.T, open func(t *testing.T) store.Manager) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, m store.Manager)
+	}{
+		{"Commit", testCommit},
+		{"Rollback", testRollback},
+		{"RollbackOnStoreError", testRollbackOnStoreError},
+		{"Uncommitted", testUncommitted},
+		{"Rerun", testRerun},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, open(t))
+		})
+	}
+}
+
+var errAbort = errors.New("abort")
+
+// createWithPassword creates uid with a password, two writes of one unit.
+func createWithPassword(ctx context.Context, tx store.Stores, uid string) error {
+	u, err := tx.Users.CreateUser(ctx, user.CreateUserInput{UID: uid, DisplayName: uid})
+	if err != nil {
+		return err
+	}
+	return tx.Users.SetPassword(ctx, u.ID, "hash-of-"+uid)
+}
+
+func testCommit(t *testing.T, m store.Manager) {
+	ctx := context.Background()
+
+	calls := 0
+	err := m.WithTx(ctx, func(tx store.Stores) error {
+		calls++
+		return createWithPassword(ctx, tx, "uid-alice")
+	})
+	if err != nil || calls != 1 {
+		t.Fatalf("WithTx = %v after %d calls, want nil after 1", err, calls)
+	}
+
+	u, err := m.Stores().Users.FindByUID(ctx, "uid-alice")
+	if err != nil {
+		t.Fatalf("committed user: %v", err)
+	}
+	if hash, err := m.Stores().Users.PasswordHash(ctx, u.ID); err != nil || hash != "hash-of-uid-alice" {
+		t.Errorf("committed password = %q, %v", hash, err)
+	}
+}
+
+func testRollback(t *testing.T, m store.Manager) {
+	ctx := context.Background()
+
+	// fn is not retried for its own errors
+	calls := 0
+	err := m.WithTx(ctx, func(tx store.Stores) error {
+		calls++
+		if err := createWithPassword(ctx, tx, "uid-alice"); err != nil {
+			return err
+		}
+		return errAbort
+	})
+	if !errors.Is(err, errAbort) || calls != 1 {
+		t.Fatalf("WithTx = %v after %d calls, want errAbort after 1", err, calls)
+	}
+
+	if _, err := m.Stores().Users.FindByUID(ctx, "uid-alice"); !errors.Is(err, user.ErrNotFound) {
+		t.Errorf("user of the rolled back transaction: FindByUID = %v, want ErrNotFound", err)
+	}
+	if users, err := m.Stores().Users.ListUsers(ctx); err != nil || len(users) != 0 {
+		t.Errorf("ListUsers = %d users, %v, want none", len(users), err)
+	}
+}
+
+func testRollbackOnStoreError(t *testing.T, m store.Manager) {
+	ctx := context.Background()
+
+	if err := createWithPassword(ctx, m.Stores(), "uid-bob"); err != nil {
+		t.Fatal(err)
+	}
+
+	// the second step fails: the first one is undone too
+	err := m.WithTx(ctx, func(tx store.Stores) error {
+		if err := createWithPassword(ctx, tx, "uid-alice"); err != nil {
+			return err
+		}
+		return createWithPassword(ctx, tx, "uid-bob")
+	})
+	if !errors.Is(err, user.ErrAlreadyExists) {
+		t.Fatalf("WithTx = %v, want ErrAlreadyExists", err)
+	}
+
+	if _, err := m.Stores().Users.FindByUID(ctx, "uid-alice"); !errors.Is(err, user.ErrNotFound) {
+		t.Errorf("FindByUID(alice) = %v, want ErrNotFound", err)
+	}
+}
+
+func testUncommitted(t *testing.T, m store.Manager) {
+	ctx := context.Background()
+
+	err := m.WithTx(ctx, func(tx store.Stores) error {
+		if err := createWithPassword(ctx, tx, "uid-alice"); err != nil {
+			return err
+		}
+
+		// visible inside the transaction only
+		if _, err := tx.Users.FindByUID(ctx, "uid-alice"); err != nil {
+			t.Errorf("inside: FindByUID = %v", err)
+		}
+		if _, err := m.Stores().Users.FindByUID(ctx, "uid-alice"); !errors.Is(err, user.ErrNotFound) {
+			t.Errorf("outside before the commit: FindByUID = %v, want ErrNotFound", err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := m.Stores().Users.FindByUID(ctx, "uid-alice"); err != nil {
+		t.Errorf("outside after the commit: FindByUID = %v", err)
+	}
+}
+
+// testRerun runs a seed-like unit ("create unless it exists") again after
+// a rollback and after a commit: a retried fn must find a clean state.
+func testRerun(t *testing.T, m store.Manager) {
+	ctx := context.Background()
+
+	seed := func(fail bool) error {
+		return m.WithTx(ctx, func(tx store.Stores) error {
+			for _, uid := range []string{"uid-alice", "uid-bob"} {
+				_, err := tx.Users.FindByUID(ctx, uid)
+				if errors.Is(err, user.ErrNotFound) {
+					err = createWithPassword(ctx, tx, uid)
+				}
+				if err != nil {
+					return err
+				}
+			}
+			if fail {
+				return errAbort
+			}
+			return nil
+		})
+	}
+
+	if err := seed(true); !errors.Is(err, errAbort) {
+		t.Fatalf("seed = %v, want errAbort", err)
+	}
+	for range 2 {
+		if err := seed(false); err != nil {
+			t.Fatalf("seed = %v", err)
+		}
+	}
+
+	users, err := m.Stores().Users.ListUsers(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 2 {
+		t.Errorf("users after rerunning the seed = %d, want 2", len(users))
+	}
+}
@@ -0,0 +1,191 @@
+package throttle
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// Policy describes how failures of one counter turn into blocks.
+//
+// The first Free failures within Window cost nothing. Each further failure
+// blocks for BaseDelay, doubled per failure and capped at MaxDelay. From
+// LockoutAfter failures on (0: never) every failure blocks for Lockout.
+type Policy struct {
+	Free         int
+	BaseDelay    time.Duration
+	MaxDelay     time.Duration
+	LockoutAfter int
+	Lockout      time.Duration
+	Window       time.Duration // failures older than this are forgotten
+}
+
+// Delay returns how long failure number n blocks (0: not at all).
+func (p Policy) Delay(n int) time.Duration {
+	switch {
+	case n <= p.Free:
+		return 0
+	case p.LockoutAfter > 0 && n >= p.LockoutAfter:
+		return p.Lockout
+	}
+
+	d := p.BaseDelay
+	for i := p.Free + 1; i < n && d < p.MaxDelay; i++ {
+		d *= 2
+	}
+	return min(d, p.MaxDelay)
+}
+
+// Guard applies a per-IP and a global Policy to login attempts. Wrong
+// second factors also count against the account, with the IP policy: a
+// distributed attack on a stolen password is slowed down like one from a
+// single address.
+//
+// A nil *Guard is valid and allows everything.
+type Guard struct {
+	store  Store
+	ip     Policy
+	global Policy
+	log    *slog.Logger
+}
+
+func NewGuard(store Store, ip, global Policy, log *slog.Logger) *Guard {
+	return &Guard{
+		store:  store,
+		ip:     ip,
+		global: global,
+		log:    log,
+	}
+}
+
+// Check returns a *BlockedError if ip (or everyone) must wait.
+func (g *Guard) Check(ctx context.Context, ip string) error {
+	if g == nil {
+		return nil
+	}
+	return g.check(ctx, IPKey(ip))
+}
+
+// CheckUser is Check for a second factor of account userID: a block of
+// the account counts, too.
+func (g *Guard) CheckUser(ctx context.Context, ip string, userID int64) error {
+	if g == nil {
+		return nil
+	}
+	return g.check(ctx, IPKey(ip), UserKey(userID))
+}
+
+func (g *Guard) check(ctx context.Context, keys ...string) error {
+	now := time.Now()
+
+	for _, key := range append(keys, GlobalKey) {
+		c, err := g.store.Counter(ctx, key)
+		if err != nil {
+			return err
+		}
+		if c.Blocked(now) {
+			return &BlockedError{
+				RetryAt: time.Unix(c.BlockedUntil, 0),
+				Global:  key == GlobalKey,
+			}
+		}
+	}
+
+	return nil
+}
+
+// Fail counts a failed login from ip. If the failure starts a block, it
+// returns it as *BlockedError.
+//
+// Every failure is logged as
+//
+//	login failed ip=<address> failures=<n> blocked_for=<seconds>
+//
+// at level WARN, the line a fail2ban filter matches (see README).
+func (g *Guard) Fail(ctx context.Context, ip string) error {
+	if g == nil {
+		return nil
+	}
+	return g.fail(ctx, ip, 0)
+}
+
+// FailUser is Fail for a wrong second factor of account userID: it also
+// counts against the account. The log line carries user_id and
+// user_failures in addition.
+func (g *Guard) FailUser(ctx context.Context, ip string, userID int64) error {
+	if g == nil {
+		return nil
+	}
+	return g.fail(ctx, ip, userID)
+}
+
+// fail counts a failure of ip, globally and of userID (0: none).
+func (g *Guard) fail(ctx context.Context, ip string, userID int64) error {
+	now := time.Now()
+
+	if _, err := g.store.Prune(ctx, now.Add(-max(g.ip.Window, g.global.Window)), now); err != nil {
+		return err
+	}
+
+	n, err := g.add(ctx, IPKey(ip), g.ip, now)
+	if err != nil {
+		return err
+	}
+	global, err := g.add(ctx, GlobalKey, g.global, now)
+	if err != nil {
+		return err
+	}
+
+	delay := g.ip.Delay(n)
+	attrs := []any{"ip", ip, "failures", n}
+
+	if userID > 0 {
+		u, err := g.add(ctx, UserKey(userID), g.ip, now)
+		if err != nil {
+			return err
+		}
+		delay = max(delay, g.ip.Delay(u))
+		attrs = append(attrs, "user_id", userID, "user_failures", u)
+	}
+
+	g.log.WarnContext(ctx, "login failed", append(attrs, "blocked_for", int(delay.Seconds()))...)
+
+	if d := g.global.Delay(global); d > 0 {
+		g.log.WarnContext(ctx, "login throttled for all clients", "failures", global, "blocked_for", int(d.Seconds()))
+		if d > delay {
+			return &BlockedError{RetryAt: now.Add(d), Global: true}
+		}
+	}
+	if delay > 0 {
+		return &BlockedError{RetryAt: now.Add(delay)}
+	}
+
+	return nil
+}
+
+// add counts a failure of key and blocks it if p says so.
+func (g *Guard) add(ctx context.Context, key string, p Policy, now time.Time) (int, error) {
+	n, err := g.store.AddFailure(ctx, key, now, now.Add(-p.Window))
+	if err != nil {
+		return 0, err
+	}
+
+	if d := p.Delay(n); d > 0 {
+		if err := g.store.Block(ctx, key, now.Add(d)); err != nil {
+			return 0, err
+		}
+	}
+
+	return n, nil
+}
+
+// Succeed forgets the failures of account userID after a completed login.
+// The IP and global counters only decay with their windows: otherwise
+// anyone with an account of their own could clear the backoff of their
+// address between guesses.
+func (g *Guard) Succeed(ctx context.Context, userID int64) error {
+	if g == nil {
+		return nil
+	}
+	return g.store.Reset(ctx, UserKey(userID))
+}
@@ -0,0 +1,100 @@
+package storememory
+
+import (
+	"cmp"
+	"context"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/axelrhd/hagg/internal/throttle"
+)
+
+// Store is a concurrency-safe, in-memory throttle.Store for development and
+// tests. Counters are lost when the process exits.
+type Store struct {
+	mu       sync.Mutex
+	counters map[string]throttle.Counter
+}
+
+func New() *Store {
+	return &Store{counters: make(map[string]throttle.Counter)}
+}
+
+// Compile-time interface check
+var _ throttle.Store = (*Store)(nil)
+
+func (s *Store) Counter(ctx context.Context, key string) (*throttle.Counter, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.counters[key]
+	if !ok {
+		return &throttle.Counter{Key: key}, nil
+	}
+	return &c, nil
+}
+
+func (s *Store) Counters(ctx context.Context) ([]*throttle.Counter, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	counters := make([]*throttle.Counter, 0, len(s.counters))
+	for _, c := range s.counters {
+		counters = append(counters, &c)
+	}
+	slices.SortFunc(counters, func(a, b *throttle.Counter) int {
+		return cmp.Or(cmp.Compare(b.LastFailureAt, a.LastFailureAt), cmp.Compare(a.Key, b.Key))
+	})
+
+	return counters, nil
+}
+
+func (s *Store) AddFailure(ctx context.Context, key string, now, windowStart time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.counters[key]
+	if !ok || c.LastFailureAt < windowStart.Unix() {
+		c.Key = key
+		c.Failures = 0
+	}
+	c.Failures++
+	c.LastFailureAt = now.Unix()
+	s.counters[key] = c
+
+	return c.Failures, nil
+}
+
+func (s *Store) Block(ctx context.Context, key string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if c, ok := s.counters[key]; ok {
+		c.BlockedUntil = max(c.BlockedUntil, until.Unix())
+		s.counters[key] = c
+	}
+
+	return nil
+}
+
+func (s *Store) Reset(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.counters, key)
+	return nil
+}
+
+func (s *Store) Prune(ctx context.Context, before, now time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := len(s.counters)
+	maps.DeleteFunc(s.counters, func(_ string, c throttle.Counter) bool {
+		return c.LastFailureAt < before.Unix() && c.BlockedUntil <= now.Unix()
+	})
+
+	return int64(n - len(s.counters)), nil
+}
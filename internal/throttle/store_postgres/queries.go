@@ -0,0 +1,57 @@
+package storepostgres
+
+import (
+	"github.com/nullism/bqb"
+)
+
+const counterColumns = `
+	key,
+	failures,
+	last_failure_at,
+	blocked_until`
+
+func qCounter(key string) *bqb.Query {
+	return bqb.New(`
+		SELECT`+counterColumns+`
+		FROM login_throttle
+		WHERE key = ?`, key)
+}
+
+func qCounters() *bqb.Query {
+	return bqb.New(`
+		SELECT` + counterColumns + `
+		FROM login_throttle
+		ORDER BY last_failure_at DESC, key`)
+}
+
+// qAddFailure counts in one statement, so concurrent failures add up.
+func qAddFailure(key string, now, windowStart int64) *bqb.Query {
+	return bqb.New(`
+		INSERT INTO login_throttle (key, failures, last_failure_at)
+		VALUES (?, 1, ?)
+		ON CONFLICT (key) DO UPDATE SET
+			failures = CASE
+				WHEN login_throttle.last_failure_at < ? THEN 1
+				ELSE login_throttle.failures + 1
+			END,
+			last_failure_at = excluded.last_failure_at
+		RETURNING failures`,
+		key, now, windowStart)
+}
+
+func qBlock(key string, until int64) *bqb.Query {
+	return bqb.New(`
+		UPDATE login_throttle
+		SET blocked_until = GREATEST(blocked_until, ?)
+		WHERE key = ?`, until, key)
+}
+
+func qReset(key string) *bqb.Query {
+	return bqb.New("DELETE FROM login_throttle WHERE key = ?", key)
+}
+
+func qPrune(before, now int64) *bqb.Query {
+	return bqb.New(`
+		DELETE FROM login_throttle
+		WHERE last_failure_at < ? AND blocked_until <= ?`, before, now)
+}
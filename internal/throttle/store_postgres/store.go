@@ -0,0 +1,99 @@
+package storepostgres
+
+import (
+	"context"
+	"time"
+
+	"github.com/axelrhd/hagg/internal/db"
+	"github.com/axelrhd/hagg/internal/throttle"
+	"github.com/nullism/bqb"
+)
+
+type Store struct {
+	db db.Querier
+}
+
+// New returns a Store using q (the pool or a transaction).
+func New(q db.Querier) *Store {
+	return &Store{db: q}
+}
+
+// Compile-time interface check
+var _ throttle.Store = (*Store)(nil)
+
+func (s *Store) Counter(ctx context.Context, key string) (*throttle.Counter, error) {
+	sql, args, err := qCounter(key).ToPgsql()
+	if err != nil {
+		return nil, err // Programmierfehler
+	}
+
+	var c throttle.Counter
+	if err := s.db.GetContext(ctx, &c, sql, args...); err != nil {
+		if isNoRows(err) {
+			return &throttle.Counter{Key: key}, nil
+		}
+		return nil, err
+	}
+
+	return &c, nil
+}
+
+func (s *Store) Counters(ctx context.Context) ([]*throttle.Counter, error) {
+	sql, args, err := qCounters().ToPgsql()
+	if err != nil {
+		return nil, err // Programmierfehler
+	}
+
+	var counters []*throttle.Counter
+	if err := s.db.SelectContext(ctx, &counters, sql, args...); err != nil {
+		return nil, err
+	}
+
+	return counters, nil
+}
+
+func (s *Store) AddFailure(ctx context.Context, key string, now, windowStart time.Time) (int, error) {
+	sql, args, err := qAddFailure(key, now.Unix(), windowStart.Unix()).ToPgsql()
+	if err != nil {
+		return 0, err // Programmierfehler
+	}
+
+	var n int
+	if err := s.db.GetContext(ctx, &n, sql, args...); err != nil {
+		return 0, err
+	}
+
+	return n, nil
+}
+
+func (s *Store) Block(ctx context.Context, key string, until time.Time) error {
+	return s.exec(ctx, qBlock(key, until.Unix()))
+}
+
+func (s *Store) Reset(ctx context.Context, key string) error {
+	return s.exec(ctx, qReset(key))
+}
+
+func (s *Store) Prune(ctx context.Context, before, now time.Time) (int64, error) {
+	sql, args, err := qPrune(before.Unix(), now.Unix()).ToPgsql()
+	if err != nil {
+		return 0, err // Programmierfehler
+	}
+
+	res, err := s.db.ExecContext(ctx, sql, args...)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
+
+func (s *Store) exec(ctx context.Context, q *bqb.Query) error {
+	sql, args, err := q.ToPgsql()
+	if err != nil {
+		return err // Programmierfehler
+	}
+
+	_, err = s.db.ExecContext(ctx, sql, args...)
+	return err
+}
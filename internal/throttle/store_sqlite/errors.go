@@ -0,0 +1,11 @@
+package storesqlite
+
+import (
+	"database/sql"
+	"errors"
+)
+
+// isNoRows reports whether a query found no row.
+func isNoRows(err error) bool {
+	return errors.Is(err, sql.ErrNoRows)
+}
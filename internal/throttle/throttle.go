@@ -0,0 +1,106 @@
+// Package throttle slows down guessing of login secrets: it counts failed
+// logins per client IP, per account (second factor) and globally and
+// blocks further attempts with an exponentially growing delay (see Guard).
+// The counters live in the database, so a restart does not reset them.
+package throttle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+)
+
+// GlobalKey is the counter of all failed logins, regardless of the client.
+const GlobalKey = "global"
+
+// IPKey returns the counter key of a client address.
+func IPKey(ip string) string {
+	return "ip:" + ip
+}
+
+// UserKey returns the counter key of an account. Only wrong second factors
+// count here: a wrong password would let anyone lock out any account.
+func UserKey(userID int64) string {
+	return "user:" + strconv.FormatInt(userID, 10)
+}
+
+// Counter is the state of one key (IPKey, UserKey or GlobalKey). Times are unix
+// seconds: they are compared in SQL and carry no time zone.
+type Counter struct {
+	Key           string `db:"key"`
+	Failures      int    `db:"failures"`        // since the window started
+	LastFailureAt int64  `db:"last_failure_at"` // unix seconds
+	BlockedUntil  int64  `db:"blocked_until"`   // unix seconds, 0: not blocked
+}
+
+// Blocked reports whether the counter blocks attempts at now.
+func (c Counter) Blocked(now time.Time) bool {
+	return c.BlockedUntil > now.Unix()
+}
+
+type Store interface {
+	// Counter returns the counter of key, a zero Counter (with Key) if
+	// there is none.
+	Counter(ctx context.Context, key string) (*Counter, error)
+
+	// Counters returns all counters, most recent failure first.
+	Counters(ctx context.Context) ([]*Counter, error)
+
+	// AddFailure counts a failure at now and returns the new count. If the
+	// last failure was before windowStart, counting starts again at 1.
+	// Concurrent calls never lose a failure.
+	AddFailure(ctx context.Context, key string, now, windowStart time.Time) (int, error)
+
+	// Block blocks key until until. A longer running block is kept.
+	Block(ctx context.Context, key string, until time.Time) error
+
+	// Reset removes the counter of key (successful login, hagg throttle reset).
+	Reset(ctx context.Context, key string) error
+
+	// Prune removes counters whose last failure was before before and which
+	// no longer block, and returns their number.
+	Prune(ctx context.Context, before, now time.Time) (int64, error)
+}
+
+// ErrBlocked is matched by every *BlockedError.
+var ErrBlocked = errors.New("Zu viele fehlgeschlagene Anmeldungen")
+
+// BlockedError rejects a login attempt until RetryAt.
+type BlockedError struct {
+	RetryAt time.Time
+	Global  bool // all clients are blocked, not only this one
+}
+
+func (e *BlockedError) Error() string {
+	return fmt.Sprintf("%s, bitte in %s erneut versuchen", ErrBlocked, RetryIn(e.RetryAt, time.Now()))
+}
+
+func (e *BlockedError) Is(target error) bool {
+	return target == ErrBlocked
+}
+
+// RetryIn formats the wait until t for users ("45 Sekunden", "3 Minuten"),
+// rounded up.
+func RetryIn(t, now time.Time) string {
+	secs := max(int(math.Ceil(t.Sub(now).Seconds())), 1)
+	mins := (secs + 59) / 60
+	hours := (mins + 59) / 60
+
+	switch {
+	case secs == 1:
+		return "1 Sekunde"
+	case secs < 60:
+		return fmt.Sprintf("%d Sekunden", secs)
+	case mins == 1:
+		return "1 Minute"
+	case mins < 60:
+		return fmt.Sprintf("%d Minuten", mins)
+	case hours == 1:
+		return "1 Stunde"
+	default:
+		return fmt.Sprintf("%d Stunden", hours)
+	}
+}
@@ -0,0 +1,114 @@
+// Package token creates and verifies short-lived, signed tokens for links
+// sent by mail (e.g. email verification).
+//
+// A token is base64url(payload) + "." + base64url(HMAC-SHA256(payload)).
+// The payload is JSON and readable by anyone holding the token – never put
+// secrets into the claims.
+package token
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalid = errors.New("Link ist ungültig")
+	ErrExpired = errors.New("Link ist abgelaufen")
+)
+
+// Signer signs and verifies tokens with one secret.
+type Signer struct {
+	secret []byte
+}
+
+func NewSigner(secret string) *Signer {
+	return &Signer{secret: []byte(secret)}
+}
+
+type envelope struct {
+	Purpose string          `json:"p"`
+	Expires int64           `json:"e"`
+	Claims  json.RawMessage `json:"c"`
+}
+
+// Sign returns a token for claims that is valid for ttl.
+// purpose separates token kinds: a token signed for one purpose
+// never verifies for another.
+func (s *Signer) Sign(purpose string, claims any, ttl time.Duration) (string, error) {
+	raw, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	payload, err := json.Marshal(envelope{
+		Purpose: purpose,
+		Expires: time.Now().Add(ttl).Unix(),
+		Claims:  raw,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	enc := base64.RawURLEncoding
+	return enc.EncodeToString(payload) + "." + enc.EncodeToString(s.mac(payload)), nil
+}
+
+// Verify checks signature, purpose and expiry of token
+// and decodes its claims into dest.
+func (s *Signer) Verify(purpose, token string, dest any) error {
+	_, err := s.VerifyExpires(purpose, token, dest)
+	return err
+}
+
+// VerifyExpires is Verify that also returns when token expires – the
+// moment from which it no longer verifies.
+func (s *Signer) VerifyExpires(purpose, token string, dest any) (time.Time, error) {
+	enc := base64.RawURLEncoding
+
+	payloadPart, sigPart, ok := strings.Cut(token, ".")
+	if !ok {
+		return time.Time{}, ErrInvalid
+	}
+
+	payload, err := enc.DecodeString(payloadPart)
+	if err != nil {
+		return time.Time{}, ErrInvalid
+	}
+	sig, err := enc.DecodeString(sigPart)
+	if err != nil {
+		return time.Time{}, ErrInvalid
+	}
+
+	if !hmac.Equal(sig, s.mac(payload)) {
+		return time.Time{}, ErrInvalid
+	}
+
+	var env envelope
+	if err := json.Unmarshal(payload, &env); err != nil {
+		return time.Time{}, ErrInvalid
+	}
+
+	if env.Purpose != purpose {
+		return time.Time{}, ErrInvalid
+	}
+	if time.Now().Unix() >= env.Expires {
+		return time.Time{}, ErrExpired
+	}
+
+	if err := json.Unmarshal(env.Claims, dest); err != nil {
+		return time.Time{}, ErrInvalid
+	}
+
+	return time.Unix(env.Expires, 0), nil
+}
+
+func (s *Signer) mac(payload []byte) []byte {
+	m := hmac.New(sha256.New, s.secret)
+	m.Write(payload)
+	return m.Sum(nil)
+}
@@ -0,0 +1,116 @@
+package token
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+type claims struct {
+	UserID int64  `json:"uid"`
+	Email  string `json:"email"`
+}
+
+func TestSignVerify(t *testing.T) {
+	s := NewSigner("secret-0123456789")
+
+	tok, err := s.Sign("verify-email", claims{UserID: 7, Email: "a@example.com"}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got claims
+	if err := s.Verify("verify-email", tok, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got != (claims{UserID: 7, Email: "a@example.com"}) {
+		t.Errorf("claims = %+v", got)
+	}
+
+	expires, err := s.VerifyExpires("verify-email", tok, &got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Until(expires); d <= time.Hour-2*time.Second || d > time.Hour {
+		t.Errorf("expires in %s, want about an hour", d)
+	}
+}
+
+func TestVerifyRejects(t *testing.T) {
+	s := NewSigner("secret-0123456789")
+	enc := base64.RawURLEncoding
+
+	valid, err := s.Sign("verify-email", claims{UserID: 7}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, sig, _ := strings.Cut(valid, ".")
+
+	// same payload with another user ID, signature of the original
+	raw, _ := enc.DecodeString(payload)
+	forged := enc.EncodeToString([]byte(strings.Replace(string(raw), `"uid":7`, `"uid":1`, 1))) + "." + sig
+
+	// a flipped bit in the signature
+	sigRaw, _ := enc.DecodeString(sig)
+	sigRaw[0] ^= 1
+	flipped := payload + "." + enc.EncodeToString(sigRaw)
+
+	expired, err := s.Sign("verify-email", claims{UserID: 7}, -time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now, err := s.Sign("verify-email", claims{UserID: 7}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := NewSigner("other-secret-0123").Sign("verify-email", claims{UserID: 7}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		purpose string
+		token   string
+		want    error
+	}{
+		{"tampered payload", "verify-email", forged, ErrInvalid},
+		{"tampered signature", "verify-email", flipped, ErrInvalid},
+		{"signature missing", "verify-email", payload, ErrInvalid},
+		{"signature empty", "verify-email", payload + ".", ErrInvalid},
+		{"not base64", "verify-email", "!!!." + sig, ErrInvalid},
+		{"empty", "verify-email", "", ErrInvalid},
+		{"other secret", "verify-email", other, ErrInvalid},
+		{"other purpose", "magic-link", valid, ErrInvalid},
+		{"expired", "verify-email", expired, ErrExpired},
+		{"expires now", "verify-email", now, ErrExpired},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got claims
+			if err := s.Verify(tt.purpose, tt.token, &got); !errors.Is(err, tt.want) {
+				t.Errorf("Verify = %v, want %v", err, tt.want)
+			}
+			if got != (claims{}) {
+				t.Errorf("claims decoded from a rejected token: %+v", got)
+			}
+		})
+	}
+}
+
+func TestVerifyChecksSignatureBeforeExpiry(t *testing.T) {
+	s := NewSigner("secret-0123456789")
+
+	// an expired token with a broken signature must not reveal that it
+	// would have been expired
+	expired, err := s.Sign("verify-email", claims{}, -time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Verify("verify-email", expired+"AA", &claims{}); !errors.Is(err, ErrInvalid) {
+		t.Errorf("Verify = %v, want ErrInvalid", err)
+	}
+}
@@ -0,0 +1,40 @@
+package totp
+
+import (
+	"fmt"
+	"strings"
+
+	"rsc.io/qr"
+)
+
+// quietZone is the white border around the code required by the spec.
+const quietZone = 4
+
+// QRCodeSVG renders content (usually a URI) as QR code in SVG format.
+// The code scales with its container and is always black on white,
+// scanners need the contrast in dark mode, too.
+func QRCodeSVG(content string) (string, error) {
+	code, err := qr.Encode(content, qr.M)
+	if err != nil {
+		return "", err
+	}
+
+	size := code.Size + 2*quietZone
+
+	var path strings.Builder
+	for y := 0; y < code.Size; y++ {
+		for x := 0; x < code.Size; x++ {
+			if code.Black(x, y) {
+				fmt.Fprintf(&path, "M%d %dh1v1h-1z", x+quietZone, y+quietZone)
+			}
+		}
+	}
+
+	return fmt.Sprintf(
+		`<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %d %d" shape-rendering="crispEdges" role="img" aria-label="QR-Code">`+
+			`<rect width="100%%" height="100%%" fill="#fff"/>`+
+			`<path fill="#000" d="%s"/>`+
+			`</svg>`,
+		size, size, path.String(),
+	), nil
+}
@@ -0,0 +1,116 @@
+package totp
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA1 seed of RFC 6238 Appendix B ("12345678901234567890")
+// in base32.
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestCodeRFC6238(t *testing.T) {
+	// Appendix B lists 8 digits; the 6-digit code is the same value mod 10^6
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},          // 94287082
+		{1111111109, "081804"},  // 07081804
+		{1111111111, "050471"},  // 14050471
+		{1234567890, "005924"},  // 89005924
+		{2000000000, "279037"},  // 69279037
+		{20000000000, "353130"}, // 65353130
+	}
+
+	for _, tt := range tests {
+		step := Step(time.Unix(tt.unix, 0))
+		got, err := Code(rfcSecret, step)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("Code(T=%d) = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+
+	// the apps may show the secret in lower case
+	if got, _ := Code(strings.ToLower(rfcSecret), 1); got != "287082" {
+		t.Errorf("Code(lower case secret) = %s", got)
+	}
+	if _, err := Code("not base32!", 1); err == nil {
+		t.Error("Code accepted an invalid secret")
+	}
+}
+
+func TestValidateSkew(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	current := Step(now)
+
+	for offset := int64(-3); offset <= 3; offset++ {
+		code, err := Code(rfcSecret, current+offset)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		step, ok := Validate(rfcSecret, code, now)
+		want := offset >= -Skew && offset <= Skew
+		if ok != want {
+			t.Errorf("Validate(step %+d) = %t, want %t", offset, ok, want)
+		}
+		if ok && step != current+offset {
+			t.Errorf("Validate(step %+d) returned step %d, want %d", offset, step, current+offset)
+		}
+	}
+}
+
+func TestValidateInput(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+
+	tests := []struct {
+		name string
+		code string
+		ok   bool
+	}{
+		{"plain", "005924", true},
+		{"grouped with a space", "005 924", true},
+		{"too short", "05924", false},
+		{"too long", "0005924", false},
+		{"wrong", "005925", false},
+		{"empty", "", false},
+	}
+
+	for _, tt := range tests {
+		if _, ok := Validate(rfcSecret, tt.code, now); ok != tt.ok {
+			t.Errorf("%s: Validate(%q) = %t, want %t", tt.name, tt.code, ok, tt.ok)
+		}
+	}
+
+	if _, ok := Validate("not base32!", "005924", now); ok {
+		t.Error("Validate accepted a code for an invalid secret")
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+	a, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := GenerateSecret()
+
+	if a == b {
+		t.Error("two secrets are equal")
+	}
+	if key, err := encoding.DecodeString(a); err != nil || len(key) != secretBytes {
+		t.Errorf("secret %q decodes to %d bytes, %v", a, len(key), err)
+	}
+}
+
+func TestURI(t *testing.T) {
+	got := URI("ABC", "hagg", "alice smith")
+	want := "otpauth://totp/hagg:alice%20smith?algorithm=SHA1&digits=6&issuer=hagg&period=30&secret=ABC"
+	if got != want {
+		t.Errorf("URI = %s\nwant  %s", got, want)
+	}
+}
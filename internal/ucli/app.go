@@ -29,7 +29,12 @@ func New() *cli.Command {
 				},
 			},
 			configCmd(),
+			dbCmd(),
 			userCmd(),
+			policyCmd(),
+			mailCmd(),
+			throttleCmd(),
+			sessionCmd(),
 		},
 	}
 }
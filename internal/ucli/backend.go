@@ -0,0 +1,140 @@
+package ucli
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/alexedwards/scs/v2"
+	"github.com/axelrhd/hagg/internal/config"
+	"github.com/axelrhd/hagg/internal/db"
+	"github.com/axelrhd/hagg/internal/ratelimit"
+	storeRateLimitMemory "github.com/axelrhd/hagg/internal/ratelimit/store_memory"
+	storeRateLimitSqlite "github.com/axelrhd/hagg/internal/ratelimit/store_sqlite"
+	"github.com/axelrhd/hagg/internal/session"
+	"github.com/axelrhd/hagg/internal/store"
+	"github.com/axelrhd/hagg/internal/user"
+	storeUserMemory "github.com/axelrhd/hagg/internal/user/store_memory"
+)
+
+// backend is the opened database backend selected via DB_DRIVER.
+type backend struct {
+	stores  store.Manager
+	queries *db.QueryLogger // nil for DB_DRIVER=memory
+	uids    *user.UIDHasher
+
+	sqlite   *db.SQLite   // set for DB_DRIVER=sqlite
+	postgres *db.Postgres // set for DB_DRIVER=postgres
+	memory   bool         // set for DB_DRIVER=memory
+
+	// roles of the DB_MEMORY_FIXTURE users by subject, assigned by serve
+	// in memory only
+	fixtureRoles map[string][]string
+}
+
+func openBackend(ctx context.Context, cfg *config.Config) (*backend, error) {
+	ql := db.NewQueryLogger(slog.Default(), cfg.Database.SlowQuery)
+	uids := user.NewUIDHasher(cfg.Auth.UIDPepper)
+
+	switch cfg.Database.Driver {
+	case config.DriverSQLite:
+		dbx, err := db.OpenSQLite(cfg.Database.SQLite)
+		if err != nil {
+			return nil, err
+		}
+
+		return &backend{
+			stores:  store.NewSQLite(dbx, ql, uids),
+			queries: ql,
+			uids:    uids,
+			sqlite:  dbx,
+		}, nil
+
+	case config.DriverPostgres:
+		pg, err := db.OpenPostgres(ctx, cfg.Database.Postgres)
+		if err != nil {
+			return nil, err
+		}
+
+		return &backend{
+			stores:   store.NewPostgres(pg, ql, uids),
+			queries:  ql,
+			uids:     uids,
+			postgres: pg,
+		}, nil
+
+	case config.DriverMemory:
+		users := storeUserMemory.New(uids)
+
+		var roles map[string][]string
+		if cfg.Database.Memory.Fixture != "" {
+			var err error
+			if roles, err = users.LoadFixture(ctx, cfg.Database.Memory.Fixture); err != nil {
+				return nil, err
+			}
+		}
+
+		return &backend{
+			stores:       store.NewMemory(users),
+			uids:         uids,
+			memory:       true,
+			fixtureRoles: roles,
+		}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported database driver %q", cfg.Database.Driver)
+}
+
+// hashLegacyUIDs hashes plaintext UIDs from before migration 00004 and
+// returns their number. The write transaction only runs if there are any.
+func (b *backend) hashLegacyUIDs(ctx context.Context) (int64, error) {
+	n, err := b.stores.Stores().Users.CountLegacyUIDs(ctx)
+	if err != nil || n == 0 {
+		return 0, err
+	}
+
+	err = b.stores.WithTx(ctx, func(tx store.Stores) error {
+		var err error
+		n, err = tx.Users.HashLegacyUIDs(ctx)
+		return err
+	})
+	if err != nil {
+		return 0, fmt.Errorf("hash legacy uids: %w", err)
+	}
+
+	return n, nil
+}
+
+// sessionStore returns the SCS store matching the backend.
+func (b *backend) sessionStore() (scs.Store, error) {
+	if b.postgres != nil {
+		return session.NewPostgresStore(b.postgres.Pool), nil
+	}
+	if b.memory {
+		return session.NewMemoryStore(), nil
+	}
+
+	return session.NewSQLiteStore(b.sqlite.Write.DB, b.sqlite.Read.DB), nil
+}
+
+// rateLimitStore returns the token bucket store of RATELIMIT_BACKEND.
+func (b *backend) rateLimitStore(cfg *config.Config) (ratelimit.Store, error) {
+	if cfg.RateLimit.Backend != config.RateLimitBackendSQLite {
+		return storeRateLimitMemory.New(), nil
+	}
+	if b.sqlite == nil {
+		return nil, fmt.Errorf("RATELIMIT_BACKEND=sqlite requires DB_DRIVER=sqlite")
+	}
+
+	return storeRateLimitSqlite.New(b.queries.Wrap(b.sqlite.Write), b.queries.Wrap(b.sqlite.Read)), nil
+}
+
+func (b *backend) Close() error {
+	if b.sqlite != nil {
+		return b.sqlite.Close()
+	}
+	if b.postgres != nil {
+		return b.postgres.Close()
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package ucli
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/axelrhd/hagg/internal/config"
+	"github.com/axelrhd/hagg/internal/db"
+	userstoretest "github.com/axelrhd/hagg/internal/user/storetest"
+)
+
+// TestMain runs the test binary as hagg when runCLI starts it (like
+// cmd/main.go), so the tests see the real exit codes.
+func TestMain(m *testing.M) {
+	if os.Getenv("HAGG_TEST_RUN_CLI") == "1" {
+		if err := New().Run(context.Background(), os.Args); err != nil {
+			log.Fatal(err)
+		}
+		os.Exit(0)
+	}
+
+	os.Exit(m.Run())
+}
+
+// cliEnv is the environment of hagg commands run by runCLI: a migrated
+// SQLite database and the files of testConfig.
+type cliEnv struct {
+	cfg  *config.Config
+	vars []string
+}
+
+func newCLIEnv(t *testing.T) *cliEnv {
+	t.Helper()
+
+	cfg := testConfig(t)
+	path := filepath.Join(t.TempDir(), "hagg.sqlite3")
+
+	sqlite, err := db.OpenSQLite(config.SQLiteConfig{
+		Path:        path,
+		JournalMode: "WAL",
+		Synchronous: "NORMAL",
+		BusyTimeout: 5 * time.Second,
+		ReadConns:   1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sqlite.Close()
+
+	for _, up := range userstoretest.MigrationsUp(t, "../../migrations") {
+		if _, err := sqlite.Write.Exec(up); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return &cliEnv{
+		cfg: cfg,
+		vars: []string{
+			"HAGG_TEST_RUN_CLI=1",
+			"DB_DRIVER=sqlite",
+			"DB_SQLITE_PATH=" + path,
+			"SESSION_DB_PATH=" + path,
+			"SESSION_SECRET=" + strings.Repeat("s", 40),
+			"AUTH_UID_PEPPER=" + userstoretest.Pepper,
+			"AUTH_TOKEN_SECRET=" + strings.Repeat("t", 40),
+			"CASBIN_MODEL=" + cfg.Casbin.ModelPath,
+			"CASBIN_POLICY=" + cfg.Casbin.PolicyPath,
+		},
+	}
+}
+
+// cliResult is the outcome of one hagg command.
+type cliResult struct {
+	code   int
+	stdout string
+	stderr string
+}
+
+// runCLI runs "hagg args..." with stdin (never a terminal) and returns its
+// exit code and output.
+func (e *cliEnv) runCLI(t *testing.T, stdin string, args ...string) cliResult {
+	t.Helper()
+
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Args[0] = "hagg"
+	cmd.Env = append(os.Environ(), e.vars...)
+	cmd.Stdin = strings.NewReader(stdin)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	var exit *exec.ExitError
+	if err != nil && !errors.As(err, &exit) {
+		t.Fatal(err)
+	}
+
+	return cliResult{code: cmd.ProcessState.ExitCode(), stdout: stdout.String(), stderr: stderr.String()}
+}
+
+// policy returns the content of the policy file.
+func (e *cliEnv) policy(t *testing.T) string {
+	t.Helper()
+
+	data, err := os.ReadFile(e.cfg.Casbin.PolicyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
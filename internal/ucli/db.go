@@ -0,0 +1,133 @@
+package ucli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/axelrhd/hagg/internal/config"
+	"github.com/axelrhd/hagg/internal/db"
+	"github.com/urfave/cli/v3"
+)
+
+func dbCmd() *cli.Command {
+	return &cli.Command{
+		Name:  "db",
+		Usage: "Database utilities",
+		Commands: []*cli.Command{
+			dbBackupCmd(),
+			dbRestoreCmd(),
+			dbSeedCmd(),
+			dbMigrateUIDsCmd(),
+		},
+	}
+}
+
+func dbBackupCmd() *cli.Command {
+	return &cli.Command{
+		Name:      "backup",
+		Usage:     "Create a consistent backup of the live database",
+		ArgsUsage: "<dest>",
+		Action: func(ctx context.Context, c *cli.Command) error {
+			if c.Args().Len() != 1 {
+				return errors.New("usage: hagg db backup <dest>")
+			}
+			dest := c.Args().First()
+
+			cfg := config.MustLoad()
+			if err := requireSQLite(cfg, "backup"); err != nil {
+				return err
+			}
+
+			if err := db.Backup(ctx, cfg.Database.SQLite, dest); err != nil {
+				return err
+			}
+
+			info, err := db.VerifyBackup(ctx, dest)
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf(
+				"✔ backup created: %s (%d bytes, schema version %d)\n",
+				info.Path,
+				info.Size,
+				info.SchemaVersion,
+			)
+
+			return nil
+		},
+	}
+}
+
+func dbRestoreCmd() *cli.Command {
+	return &cli.Command{
+		Name:      "restore",
+		Usage:     "Restore the database from a backup (stop the server first!)",
+		ArgsUsage: "<backup>",
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:  "force",
+				Usage: "Restore even if the schema versions differ or the current database cannot be checkpointed",
+			},
+		},
+		Action: func(ctx context.Context, c *cli.Command) error {
+			if c.Args().Len() != 1 {
+				return errors.New("usage: hagg db restore <backup>")
+			}
+			src := c.Args().First()
+
+			cfg := config.MustLoad()
+			if err := requireSQLite(cfg, "restore"); err != nil {
+				return err
+			}
+
+			info, err := db.Restore(ctx, cfg.Database.SQLite, src, c.Bool("force"))
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf(
+				"✔ database restored from %s (schema version %d)\n",
+				info.Path,
+				info.SchemaVersion,
+			)
+			fmt.Printf("  previous database kept as %s.pre-restore\n", cfg.Database.SQLite.Path)
+
+			return nil
+		},
+	}
+}
+
+// requireSQLite refuses file commands for other drivers: they would work
+// on DB_SQLITE_PATH, not on the database the server uses.
+func requireSQLite(cfg *config.Config, cmd string) error {
+	if cfg.Database.Driver != config.DriverSQLite {
+		return fmt.Errorf("db %s needs DB_DRIVER=sqlite (DB_DRIVER is %q)", cmd, cfg.Database.Driver)
+	}
+	return nil
+}
+
+func dbMigrateUIDsCmd() *cli.Command {
+	return &cli.Command{
+		Name:  "migrate-uids",
+		Usage: "Hash plaintext UIDs from before migration 00004 (serve does this at startup)",
+		Action: func(ctx context.Context, c *cli.Command) error {
+			cfg := config.MustLoad()
+
+			be, err := openBackend(ctx, cfg)
+			if err != nil {
+				return err
+			}
+			defer be.Close()
+
+			n, err := be.hashLegacyUIDs(ctx)
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("✔ %d legacy uid(s) hashed\n", n)
+			return nil
+		},
+	}
+}
@@ -0,0 +1,241 @@
+package ucli
+
+import (
+	"context"
+	_ "embed"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/axelrhd/hagg/internal/config"
+	"github.com/axelrhd/hagg/internal/store"
+	"github.com/axelrhd/hagg/internal/user"
+	"github.com/rodaine/table"
+	"github.com/urfave/cli/v3"
+	"gopkg.in/yaml.v3"
+)
+
+//go:embed seeds/demo.yaml
+var demoSeed []byte
+
+type seedFile struct {
+	Users []seedUser `yaml:"users"`
+}
+
+type seedUser struct {
+	UID         string   `yaml:"uid"`
+	DisplayName string   `yaml:"display_name"`
+	FirstName   string   `yaml:"first_name"`
+	LastName    string   `yaml:"last_name"`
+	Roles       []string `yaml:"roles"`
+}
+
+type seedResult struct {
+	DisplayName string
+	Subject     string // Casbin subject of the created or existing user
+	Status      string
+	RolesAdded  []string
+}
+
+func dbSeedCmd() *cli.Command {
+	return &cli.Command{
+		Name:      "seed",
+		Usage:     "Create users and role assignments from a YAML seed file (idempotent)",
+		ArgsUsage: "<file.yaml>",
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:  "demo",
+				Usage: "Use the built-in demo seed (arudolf, alice, worker)",
+			},
+			&cli.BoolFlag{
+				Name:  "reset",
+				Usage: "Delete ALL users (and their role assignments) before seeding – dev databases only!",
+			},
+		},
+		Action: func(ctx context.Context, c *cli.Command) error {
+			data, err := readSeed(c)
+			if err != nil {
+				return err
+			}
+
+			var seed seedFile
+			if err := yaml.Unmarshal(data, &seed); err != nil {
+				return fmt.Errorf("parse seed: %w", err)
+			}
+
+			cfg := config.MustLoad()
+
+			if err := validateSeed(cfg, &seed); err != nil {
+				return err
+			}
+
+			be, err := openBackend(ctx, cfg)
+			if err != nil {
+				return err
+			}
+			defer be.Close()
+
+			return runSeed(ctx, cfg, be, &seed, c.Bool("reset"))
+		},
+	}
+}
+
+func readSeed(c *cli.Command) ([]byte, error) {
+	if c.Bool("demo") {
+		if c.Args().Len() > 0 {
+			return nil, errors.New("use either --demo or a seed file, not both")
+		}
+		return demoSeed, nil
+	}
+
+	if c.Args().Len() != 1 {
+		return nil, errors.New("usage: hagg db seed <file.yaml> | --demo")
+	}
+
+	return os.ReadFile(c.Args().First())
+}
+
+// validateSeed checks the seed before anything is written.
+func validateSeed(cfg *config.Config, seed *seedFile) error {
+	enf, err := loadEnforcer(cfg)
+	if err != nil {
+		return err
+	}
+
+	uids := make(map[string]struct{})
+	names := make(map[string]struct{})
+
+	for i, su := range seed.Users {
+		if strings.TrimSpace(su.UID) == "" || strings.TrimSpace(su.DisplayName) == "" {
+			return fmt.Errorf("seed user #%d: uid and display_name are required", i+1)
+		}
+
+		if _, dup := uids[su.UID]; dup {
+			return fmt.Errorf("seed user %q: duplicate uid", su.DisplayName)
+		}
+		if _, dup := names[su.DisplayName]; dup {
+			return fmt.Errorf("seed user %q: duplicate display_name", su.DisplayName)
+		}
+		uids[su.UID] = struct{}{}
+		names[su.DisplayName] = struct{}{}
+
+		for _, role := range su.Roles {
+			perms, err := enf.GetFilteredPolicy(0, role)
+			if err != nil {
+				return err
+			}
+			if len(perms) == 0 {
+				return fmt.Errorf("seed user %q: unknown role %q (no permissions in %s)", su.DisplayName, role, cfg.Casbin.PolicyPath)
+			}
+		}
+	}
+
+	return nil
+}
+
+func runSeed(ctx context.Context, cfg *config.Config, be *backend, seed *seedFile, reset bool) error {
+	var (
+		results []*seedResult
+		purged  []string // subjects of users removed by --reset
+	)
+
+	// Users: one transaction (all or nothing)
+	err := be.stores.WithTx(ctx, func(tx store.Stores) error {
+		// WithTx may retry – start from scratch every time
+		results = results[:0]
+		purged = purged[:0]
+
+		if reset {
+			// all rows, soft-deleted ones included: their IDs are reused
+			// and must not pass their roles on to the seeded users
+			ids, err := tx.Users.PurgeUsers(ctx)
+			if err != nil {
+				return err
+			}
+			for _, id := range ids {
+				purged = append(purged, user.User{ID: id}.Subject())
+			}
+		}
+
+		for _, su := range seed.Users {
+			res := &seedResult{DisplayName: su.DisplayName}
+			results = append(results, res)
+
+			u, err := tx.Users.FindByDisplayName(ctx, su.DisplayName)
+			switch {
+			case errors.Is(err, user.ErrNotFound):
+				u, err = tx.Users.CreateUser(ctx, user.CreateUserInput{
+					UID:         su.UID,
+					DisplayName: su.DisplayName,
+					FirstName:   su.FirstName,
+					LastName:    su.LastName,
+				})
+				if err != nil {
+					return fmt.Errorf("create %q: %w", su.DisplayName, err)
+				}
+				res.Status = "created"
+
+			case err != nil:
+				return err
+
+			case u.UIDHash != be.uids.Hash(su.UID):
+				res.Status = "exists (uid differs, unchanged)"
+
+			default:
+				res.Status = "exists"
+			}
+			res.Subject = u.Subject()
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// Roles: policy.csv is a file, not part of the transaction.
+	// Re-running the seed converges to the same state.
+	if reset {
+		if _, err := policyRemoveSubjects(cfg.Casbin.PolicyPath, purged); err != nil {
+			return fmt.Errorf("remove role assignments: %w", err)
+		}
+	}
+
+	enf, err := loadEnforcer(cfg)
+	if err != nil {
+		return err
+	}
+
+	var rules []roleRule
+	for i, su := range seed.Users {
+		for _, role := range su.Roles {
+			has, err := enf.HasRoleForUser(results[i].Subject, role)
+			if err != nil {
+				return err
+			}
+			if !has {
+				rules = append(rules, roleRule{Subject: results[i].Subject, Role: role})
+				results[i].RolesAdded = append(results[i].RolesAdded, role)
+			}
+		}
+	}
+
+	if err := policyAppendRoles(cfg.Casbin.PolicyPath, rules); err != nil {
+		return fmt.Errorf("add role assignments: %w", err)
+	}
+
+	if reset {
+		fmt.Printf("✔ reset: %d user(s) removed\n", len(purged))
+	}
+
+	t := table.New("DISPLAY NAME", "STATUS", "ROLES ADDED")
+	t.WithWriter(os.Stdout)
+
+	for _, r := range results {
+		t.AddRow(r.DisplayName, r.Status, strings.Join(r.RolesAdded, ", "))
+	}
+
+	t.Print()
+	return nil
+}
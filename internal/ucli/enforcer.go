@@ -12,3 +12,9 @@ func loadEnforcer(cfg *config.Config) (*casbin.Enforcer, error) {
 		cfg.Casbin.PolicyPath,
 	)
 }
+
+// roleExists reports whether role has at least one permission (p line).
+func roleExists(enf *casbin.Enforcer, role string) (bool, error) {
+	perms, err := enf.GetFilteredPolicy(0, role)
+	return len(perms) > 0, err
+}
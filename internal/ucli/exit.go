@@ -0,0 +1,16 @@
+package ucli
+
+import "github.com/urfave/cli/v3"
+
+// Exit codes for scripted use (values from sysexits.h). All other
+// errors exit with 1.
+const (
+	exitUsage    = 64 // invalid arguments, or input needed but no TTY attached
+	exitDataErr  = 65 // invalid input data (missing field, bad email, unknown role)
+	exitConflict = 73 // cannot create: the user already exists
+)
+
+// exitErr wraps err with an exit code; urfave/cli prints it and exits.
+func exitErr(err error, code int) error {
+	return cli.Exit(err.Error(), code)
+}
@@ -0,0 +1,62 @@
+package ucli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/axelrhd/hagg/internal/config"
+	"github.com/axelrhd/hagg/internal/mail"
+	"github.com/axelrhd/hagg/internal/user"
+	"github.com/urfave/cli/v3"
+)
+
+func mailCmd() *cli.Command {
+	return &cli.Command{
+		Name:  "mail",
+		Usage: "Mail utilities",
+		Commands: []*cli.Command{
+			mailSendTestCmd(),
+		},
+	}
+}
+
+// mailSendTestCmd checks MAIL_* with a real message, e.g. against a local
+// SMTP sink (MAIL_DRIVER=smtp MAIL_SMTP_HOST=localhost MAIL_SMTP_PORT=1025
+// MAIL_SMTP_TLS=none).
+func mailSendTestCmd() *cli.Command {
+	return &cli.Command{
+		Name:      "send-test",
+		Usage:     "Send a test mail with the configured driver",
+		ArgsUsage: "<address>",
+		Action: func(ctx context.Context, c *cli.Command) error {
+			if c.Args().Len() != 1 {
+				return errors.New("usage: hagg mail send-test <address>")
+			}
+
+			to, err := user.NormalizeEmail(c.Args().First())
+			if err != nil || to == "" {
+				return user.ErrInvalidEmail
+			}
+
+			cfg := config.MustLoad()
+
+			mailer, err := mail.New(cfg.Mail)
+			if err != nil {
+				return err
+			}
+
+			err = mailer.Send(ctx, mail.Message{
+				To:      to,
+				Subject: "Testmail",
+				Text:    "Diese Mail bestätigt, dass der Mailversand funktioniert.\n",
+			})
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("✔ test mail sent to %s (driver %s)\n", to, cfg.Mail.Driver)
+			return nil
+		},
+	}
+}
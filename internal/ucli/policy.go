@@ -0,0 +1,141 @@
+package ucli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/axelrhd/hagg/internal/config"
+	"github.com/axelrhd/hagg/internal/user"
+	"github.com/casbin/casbin/v2"
+	"github.com/rodaine/table"
+	"github.com/urfave/cli/v3"
+)
+
+func policyCmd() *cli.Command {
+	return &cli.Command{
+		Name:  "policy",
+		Usage: "Casbin policy utilities",
+		Commands: []*cli.Command{
+			policyMigrateSubjectsCmd(),
+		},
+	}
+}
+
+func policyMigrateSubjectsCmd() *cli.Command {
+	return &cli.Command{
+		Name:  "migrate-subjects",
+		Usage: "Rewrite role assignments by display name to stable user subjects (user:<id>)",
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:  "dry-run",
+				Usage: "Only show what would change",
+			},
+		},
+		Action: func(ctx context.Context, c *cli.Command) error {
+
+			cfg := config.MustLoad()
+
+			enf, err := loadEnforcer(cfg)
+			if err != nil {
+				return err
+			}
+
+			legacy, err := legacySubjects(enf)
+			if err != nil {
+				return err
+			}
+			if len(legacy) == 0 {
+				fmt.Println("✔ nothing to migrate: all role assignments use user subjects")
+				return nil
+			}
+
+			be, err := openBackend(ctx, cfg)
+			if err != nil {
+				return err
+			}
+			defer be.Close()
+
+			users := be.stores.Stores().Users
+
+			renames := make(map[string]string, len(legacy))
+			unknown := 0
+
+			t := table.New("SUBJECT", "NEW SUBJECT")
+			t.WithWriter(os.Stdout)
+
+			for _, sub := range legacy {
+				u, err := users.FindByDisplayName(ctx, sub)
+				switch {
+				case errors.Is(err, user.ErrNotFound):
+					// e.g. left over from a deleted user – must not be
+					// handed to whoever takes the name next
+					t.AddRow(sub, "✘ no such user, left unchanged")
+					unknown++
+				case err != nil:
+					return err
+				default:
+					renames[sub] = u.Subject()
+					t.AddRow(sub, u.Subject())
+				}
+			}
+
+			t.Print()
+
+			if c.Bool("dry-run") {
+				fmt.Printf("✔ dry run: %d subject(s) would be migrated\n", len(renames))
+				return nil
+			}
+
+			n, err := policyRenameSubjects(cfg.Casbin.PolicyPath, renames)
+			if err != nil {
+				return err
+			}
+
+			if n > 0 {
+				fmt.Printf("✔ %d role assignment(s) of %d user(s) migrated in %s\n", n, len(renames), cfg.Casbin.PolicyPath)
+			}
+			if unknown > 0 {
+				fmt.Printf("! %d subject(s) match no user – remove those lines from %s\n", unknown, cfg.Casbin.PolicyPath)
+			}
+
+			return nil
+		},
+	}
+}
+
+// legacySubjects returns the subjects of `g` lines that are neither user
+// subjects (user:<id>) nor roles – display names from before stable
+// subjects. They no longer grant anything.
+func legacySubjects(enf *casbin.Enforcer) ([]string, error) {
+	pSubjects, err := enf.GetAllSubjects()
+	if err != nil {
+		return nil, err
+	}
+	roles, err := enf.GetAllRoles()
+	if err != nil {
+		return nil, err
+	}
+	grouping, err := enf.GetGroupingPolicy()
+	if err != nil {
+		return nil, err
+	}
+
+	var legacy []string
+	for _, rule := range grouping {
+		// trimmed like parseGroupingLine: the file adapter keeps trailing
+		// spaces ("g,alice ,viewer"), the rewrite does not
+		sub := strings.TrimSpace(rule[0])
+		if strings.HasPrefix(sub, user.SubjectPrefix) ||
+			slices.Contains(pSubjects, sub) || slices.Contains(roles, sub) ||
+			slices.Contains(legacy, sub) {
+			continue
+		}
+		legacy = append(legacy, sub)
+	}
+
+	return legacy, nil
+}
@@ -0,0 +1,142 @@
+package ucli
+
+import (
+	"os"
+	"strings"
+)
+
+// The Casbin file adapter rewrites the whole policy on SavePolicy and drops
+// all comments and sections. policy.csv is meant to be edited by hand, so the
+// CLI edits `g` (user → role) lines textually instead.
+
+type roleRule struct {
+	Subject string
+	Role    string
+}
+
+// parseGroupingLine returns the rule of a `g, subject, role` line.
+func parseGroupingLine(line string) (roleRule, bool) {
+	fields := strings.Split(strings.TrimSpace(line), ",")
+	if len(fields) != 3 || strings.TrimSpace(fields[0]) != "g" {
+		return roleRule{}, false
+	}
+
+	return roleRule{
+		Subject: strings.TrimSpace(fields[1]),
+		Role:    strings.TrimSpace(fields[2]),
+	}, true
+}
+
+// policyAppendRoles appends `g` lines for rules to the policy file.
+func policyAppendRoles(path string, rules []roleRule) error {
+	if len(rules) == 0 {
+		return nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var b strings.Builder
+	b.Write(data)
+
+	if len(data) > 0 && !strings.HasSuffix(string(data), "\n") {
+		b.WriteString("\n")
+	}
+
+	for _, r := range rules {
+		b.WriteString("g, " + r.Subject + ", " + r.Role + "\n")
+	}
+
+	return writePolicyFile(path, b.String())
+}
+
+// policyRemoveSubjects removes all `g` lines of the given subjects
+// and returns the number of removed lines.
+func policyRemoveSubjects(path string, subjects []string) (int, error) {
+	if len(subjects) == 0 {
+		return 0, nil
+	}
+
+	remove := make(map[string]struct{}, len(subjects))
+	for _, s := range subjects {
+		remove[s] = struct{}{}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+
+	lines := strings.SplitAfter(string(data), "\n")
+	kept := make([]string, 0, len(lines))
+	removed := 0
+
+	for _, line := range lines {
+		if r, ok := parseGroupingLine(line); ok {
+			if _, drop := remove[r.Subject]; drop {
+				removed++
+				continue
+			}
+		}
+		kept = append(kept, line)
+	}
+
+	if removed == 0 {
+		return 0, nil
+	}
+
+	return removed, writePolicyFile(path, strings.Join(kept, ""))
+}
+
+// policyRenameSubjects rewrites the subject of all `g` lines found in
+// renames (old → new) and returns the number of changed lines.
+func policyRenameSubjects(path string, renames map[string]string) (int, error) {
+	if len(renames) == 0 {
+		return 0, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+
+	lines := strings.SplitAfter(string(data), "\n")
+	renamed := 0
+
+	for i, line := range lines {
+		r, ok := parseGroupingLine(line)
+		if !ok {
+			continue
+		}
+		to, rename := renames[r.Subject]
+		if !rename {
+			continue
+		}
+
+		lines[i] = "g, " + to + ", " + r.Role + "\n"
+		renamed++
+	}
+
+	if renamed == 0 {
+		return 0, nil
+	}
+
+	return renamed, writePolicyFile(path, strings.Join(lines, ""))
+}
+
+// writePolicyFile replaces the policy file atomically.
+func writePolicyFile(path, content string) error {
+	mode := os.FileMode(0644)
+	if st, err := os.Stat(path); err == nil {
+		mode = st.Mode().Perm()
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(content), mode); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,145 @@
+package ucli
+
+import (
+	"os"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/axelrhd/hagg/internal/config"
+)
+
+// legacyPolicy has role assignments by display name (alice, ghost) next to
+// user subjects, a role hierarchy, comments and unusual spacing.
+const legacyPolicy = `# Rollen
+p, admin, *
+p, editor, user:list
+p, viewer, dashboard:view
+
+# Hierarchie
+g, editor, viewer
+
+# Benutzer
+g, user:7, admin
+g, alice, viewer
+g,alice ,  editor
+g, ghost, admin
+`
+
+// migratedPolicy is legacyPolicy after renaming alice to user:1.
+const migratedPolicy = `# Rollen
+p, admin, *
+p, editor, user:list
+p, viewer, dashboard:view
+
+# Hierarchie
+g, editor, viewer
+
+# Benutzer
+g, user:7, admin
+g, user:1, viewer
+g, user:1, editor
+g, ghost, admin
+`
+
+// writeLegacyPolicy replaces the policy file of cfg with legacyPolicy.
+func writeLegacyPolicy(t *testing.T, cfg *config.Config) {
+	t.Helper()
+
+	if err := os.WriteFile(cfg.Casbin.PolicyPath, []byte(legacyPolicy), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLegacySubjects(t *testing.T) {
+	cfg := testConfig(t)
+	writeLegacyPolicy(t, cfg)
+
+	enf, err := loadEnforcer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacy, err := legacySubjects(enf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// not user:7 and not the role editor of the hierarchy; alice once, trimmed
+	if want := []string{"alice", "ghost"}; !slices.Equal(legacy, want) {
+		t.Errorf("legacySubjects = %q, want %q", legacy, want)
+	}
+}
+
+func TestPolicyRenameSubjects(t *testing.T) {
+	cfg := testConfig(t)
+	writeLegacyPolicy(t, cfg)
+	path := cfg.Casbin.PolicyPath
+	renames := map[string]string{"alice": "user:1", "nobody": "user:9"}
+
+	n, err := policyRenameSubjects(path, renames)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("renamed = %d, want 2", n)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != migratedPolicy {
+		t.Errorf("policy =\n%s\nwant\n%s", data, migratedPolicy)
+	}
+
+	// a second run finds nothing to rename and leaves the file alone
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := policyRenameSubjects(path, renames); err != nil || n != 0 {
+		t.Errorf("second run = %d, %v, want 0", n, err)
+	}
+	again, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !again.ModTime().Equal(info.ModTime()) || again.Size() != info.Size() {
+		t.Error("second run rewrote the policy file")
+	}
+}
+
+func TestPolicyMigrateSubjects(t *testing.T) {
+	env := newCLIEnv(t)
+	writeLegacyPolicy(t, env.cfg)
+
+	// alice gets id 1, ghost has no user
+	if res := env.runCLI(t, "", "user", "create", "--display-name", "alice", "--generate-uid"); res.code != 0 {
+		t.Fatalf("user create: exit %d: %s", res.code, res.stderr)
+	}
+
+	res := env.runCLI(t, "", "policy", "migrate-subjects", "--dry-run")
+	if res.code != 0 || env.policy(t) != legacyPolicy {
+		t.Fatalf("dry run: exit %d, %s, policy changed: %t", res.code, res.stderr, env.policy(t) != legacyPolicy)
+	}
+
+	res = env.runCLI(t, "", "policy", "migrate-subjects")
+	if res.code != 0 {
+		t.Fatalf("exit %d: %s", res.code, res.stderr)
+	}
+	if !strings.Contains(res.stdout, "2 role assignment(s) of 1 user(s) migrated") ||
+		!strings.Contains(res.stdout, "1 subject(s) match no user") {
+		t.Errorf("stdout = %q", res.stdout)
+	}
+	if got := env.policy(t); got != migratedPolicy {
+		t.Errorf("policy =\n%s\nwant\n%s", got, migratedPolicy)
+	}
+
+	// idempotent: ghost is reported again, nothing changes
+	res = env.runCLI(t, "", "policy", "migrate-subjects")
+	if res.code != 0 || strings.Contains(res.stdout, "migrated") {
+		t.Errorf("second run: exit %d, stdout %q", res.code, res.stdout)
+	}
+	if got := env.policy(t); got != migratedPolicy {
+		t.Errorf("policy after the second run =\n%s", got)
+	}
+}
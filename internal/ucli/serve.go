@@ -1,23 +1,113 @@
 package ucli
 
 import (
+	"context"
+	"log"
+	"log/slog"
+	"strings"
+	"time"
+
 	"github.com/axelrhd/hagg"
 	"github.com/axelrhd/hagg/internal/config"
 	"github.com/axelrhd/hagg/internal/db"
-	storeUserSqlite "github.com/axelrhd/hagg/internal/user/store_sqlite"
 )
 
 func serve() error {
 	cfg := config.MustLoad()
+	ctx := context.Background()
+
+	// Dev mode: show debug logs (e.g. every SQL query)
+	if cfg.Server.Dev {
+		slog.SetLogLoggerLevel(slog.LevelDebug)
+	}
+
+	be, err := openBackend(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer be.Close()
+
+	if be.memory {
+		log.Println("WARNING: DB_DRIVER=memory – all data is lost on shutdown")
+	}
 
-	dbx, err := db.OpenSQLite(cfg.Database.SQLite.Path)
+	// plaintext UIDs from before migration 00004
+	n, err := be.hashLegacyUIDs(ctx)
 	if err != nil {
 		return err
 	}
-	defer dbx.Close()
+	if n > 0 {
+		log.Printf("hashed %d legacy plaintext uid(s)", n)
+	}
+
+	// role assignments by display name (before user:<id> subjects) grant nothing
+	enf, err := loadEnforcer(cfg)
+	if err != nil {
+		return err
+	}
+	legacy, err := legacySubjects(enf)
+	if err != nil {
+		return err
+	}
+	if len(legacy) > 0 {
+		log.Printf("WARNING: %d subject(s) in %s are not user subjects (%s) – run: hagg policy migrate-subjects",
+			len(legacy), cfg.Casbin.PolicyPath, strings.Join(legacy, ", "))
+	}
 
-	userStore := storeUserSqlite.New(dbx)
+	if be.sqlite != nil {
+		// OpenSQLite already verified the pragmas – log them for the operator
+		p, err := be.sqlite.Pragmas(ctx, be.sqlite.Write)
+		if err != nil {
+			return err
+		}
+		log.Printf(
+			"sqlite: journal_mode=%s foreign_keys=%t busy_timeout=%dms synchronous=%d read_conns=%d",
+			p.JournalMode, p.ForeignKeys, p.BusyTimeout, p.Synchronous, cfg.Database.SQLite.ReadConns,
+		)
 
-	hagg.StartServer(cfg, userStore)
+		// Scheduled backups (optional)
+		if cfg.Database.Backup.Interval > 0 {
+			scheduler := db.NewBackupScheduler(cfg.Database.SQLite, cfg.Database.Backup, slog.Default())
+			go scheduler.Run(ctx)
+		}
+	}
+
+	if days := cfg.Auth.LoginEventRetentionDays; days > 0 {
+		go pruneLoginEvents(ctx, be, time.Duration(days)*24*time.Hour)
+	}
+
+	sessions, err := be.sessionStore()
+	if err != nil {
+		return err
+	}
+
+	limits, err := be.rateLimitStore(cfg)
+	if err != nil {
+		return err
+	}
+
+	hagg.StartServer(cfg, be.stores, sessions, limits, be.queries, be.fixtureRoles)
 	return nil
 }
+
+// pruneLoginEvents deletes login attempts older than retention now and
+// then once a day, until ctx is cancelled.
+func pruneLoginEvents(ctx context.Context, be *backend, retention time.Duration) {
+	ticker := time.NewTicker(24 * time.Hour)
+	defer ticker.Stop()
+
+	for {
+		n, err := be.stores.Stores().Users.PruneLoginEvents(ctx, time.Now().Add(-retention))
+		if err != nil {
+			slog.Error("prune login events failed", "error", err)
+		} else if n > 0 {
+			slog.Info("pruned login events", "deleted", n, "retention", retention)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package ucli
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/axelrhd/hagg/internal/auth"
+	"github.com/axelrhd/hagg/internal/config"
+	"github.com/axelrhd/hagg/internal/user"
+	"github.com/rodaine/table"
+	"github.com/urfave/cli/v3"
+)
+
+func sessionCmd() *cli.Command {
+	return &cli.Command{
+		Name:  "session",
+		Usage: "Logged-in sessions of users",
+		Commands: []*cli.Command{
+			sessionListCmd(),
+			sessionRevokeCmd(),
+		},
+	}
+}
+
+func sessionListCmd() *cli.Command {
+	return &cli.Command{
+		Name:  "list",
+		Usage: "List the sessions of a user, newest first",
+		Flags: sessionUserFlags(),
+		Action: func(ctx context.Context, c *cli.Command) error {
+			cfg := config.MustLoad()
+
+			be, err := openBackend(ctx, cfg)
+			if err != nil {
+				return err
+			}
+			defer be.Close()
+
+			users := be.stores.Stores().Users
+			u, err := sessionUser(ctx, users, c)
+			if err != nil {
+				return err
+			}
+
+			sessions, err := users.Sessions(ctx, u.ID)
+			if err != nil {
+				return err
+			}
+
+			t := table.New(
+				"ID",
+				"LOGIN",
+				"IP",
+				"USER AGENT",
+			)
+			t.WithWriter(os.Stdout)
+
+			for _, s := range sessions {
+				t.AddRow(
+					s.ID,
+					s.CreatedAt,
+					s.IP,
+					s.UserAgent,
+				)
+			}
+
+			t.Print()
+			fmt.Printf("\n%d session(s) of %s\n", len(sessions), u.DisplayName)
+
+			return nil
+		},
+	}
+}
+
+func sessionRevokeCmd() *cli.Command {
+	return &cli.Command{
+		Name:  "revoke",
+		Usage: "Log a user out of all devices",
+		Description: "Deletes the sessions of the user from the session store. Sessions that\n" +
+			"are not indexed (logged in before user_sessions existed) end through the\n" +
+			"session version.",
+		Flags: sessionUserFlags(),
+		Action: func(ctx context.Context, c *cli.Command) error {
+			cfg := config.MustLoad()
+
+			be, err := openBackend(ctx, cfg)
+			if err != nil {
+				return err
+			}
+			defer be.Close()
+
+			users := be.stores.Stores().Users
+			u, err := sessionUser(ctx, users, c)
+			if err != nil {
+				return err
+			}
+
+			sessions, err := be.sessionStore()
+			if err != nil {
+				return err
+			}
+
+			n, err := auth.EndSessions(ctx, users, sessions, u.ID)
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("✔ %d session(s) ended: id=%d display_name=%s\n", n, u.ID, u.DisplayName)
+			if be.memory {
+				fmt.Println("  note: DB_DRIVER=memory – sessions of a running server are not affected")
+			}
+
+			return nil
+		},
+	}
+}
+
+// sessionUserFlags select the user of a session command.
+func sessionUserFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:  "user",
+			Usage: "Display name of the user",
+		},
+		&cli.Int64Flag{
+			Name:  "id",
+			Usage: "Numeric ID of the user instead of --user",
+		},
+	}
+}
+
+// sessionUser looks up the user given by --user or --id.
+func sessionUser(ctx context.Context, users user.Store, c *cli.Command) (*user.User, error) {
+	name, id := c.String("user"), c.Int64("id")
+	switch {
+	case name != "" && id == 0:
+		return users.FindByDisplayName(ctx, name)
+	case name == "" && id > 0:
+		return users.FindByID(ctx, id)
+	}
+
+	return nil, fmt.Errorf("usage: hagg session %s --user <display-name> | --id <id>", c.Name)
+}
@@ -7,11 +7,14 @@ import (
 	"github.com/axelrhd/hagg/internal/user"
 )
 
+// resolveSubjects returns the users whose Casbin subjects (user.User.Subject)
+// are inspected: the one with displayName, or all users. Output shows
+// the display name, the policy uses the subject.
 func resolveSubjects(
 	ctx context.Context,
 	userStore user.Store,
 	displayName string,
-) ([]string, error) {
+) ([]*user.User, error) {
 
 	// expliziter Name angegeben
 	if displayName != "" {
@@ -24,19 +27,14 @@ func resolveSubjects(
 			return nil, err
 		}
 
-		return []string{u.DisplayName}, nil
+		return []*user.User{u}, nil
 	}
 
 	// kein Name → alle User
-	users, err := userStore.ListUsers(ctx)
-	if err != nil {
-		return nil, err
-	}
-
-	subs := make([]string, 0, len(users))
-	for _, u := range users {
-		subs = append(subs, u.DisplayName)
-	}
+	return userStore.ListUsers(ctx)
+}
 
-	return subs, nil
+// subjectHeading labels a user in listings: "alice (user:2)".
+func subjectHeading(u *user.User) string {
+	return fmt.Sprintf("%s (%s)", u.DisplayName, u.Subject())
 }
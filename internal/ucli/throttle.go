@@ -0,0 +1,163 @@
+package ucli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	"github.com/axelrhd/hagg/internal/config"
+	"github.com/axelrhd/hagg/internal/throttle"
+	"github.com/rodaine/table"
+	"github.com/urfave/cli/v3"
+)
+
+func throttleCmd() *cli.Command {
+	return &cli.Command{
+		Name:  "throttle",
+		Usage: "Failed login counters (AUTH_THROTTLE_*)",
+		Commands: []*cli.Command{
+			throttleListCmd(),
+			throttleResetCmd(),
+		},
+	}
+}
+
+func throttleListCmd() *cli.Command {
+	return &cli.Command{
+		Name:  "list",
+		Usage: "List failed login counters, most recent first",
+		Action: func(ctx context.Context, c *cli.Command) error {
+			cfg := config.MustLoad()
+
+			be, err := openBackend(ctx, cfg)
+			if err != nil {
+				return err
+			}
+			defer be.Close()
+
+			counters, err := be.stores.Stores().Throttle.Counters(ctx)
+			if err != nil {
+				return err
+			}
+
+			t := table.New(
+				"KEY",
+				"FAILURES",
+				"LAST FAILURE",
+				"BLOCKED",
+			)
+			t.WithWriter(os.Stdout)
+
+			now := time.Now()
+			for _, tc := range counters {
+				t.AddRow(
+					tc.Key,
+					tc.Failures,
+					time.Unix(tc.LastFailureAt, 0).Format(time.DateTime),
+					blockedLabel(tc, now),
+				)
+			}
+
+			t.Print()
+			fmt.Printf("\n%d counter(s)\n", len(counters))
+
+			return nil
+		},
+	}
+}
+
+func throttleResetCmd() *cli.Command {
+	return &cli.Command{
+		Name:      "reset",
+		Usage:     "Forget the failed logins of a client and lift its block",
+		ArgsUsage: "<ip>",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "user",
+				Usage: "Reset the second factor counter of the user with this display name instead",
+			},
+			&cli.BoolFlag{
+				Name:  "global",
+				Usage: "Reset the counter of all clients instead",
+			},
+			&cli.BoolFlag{
+				Name:  "all",
+				Usage: "Reset every counter",
+			},
+		},
+		Action: func(ctx context.Context, c *cli.Command) error {
+			// exactly one of <ip>, --user, --global, --all
+			given := 0
+			for _, set := range []bool{c.Args().Len() > 0, c.IsSet("user"), c.Bool("global"), c.Bool("all")} {
+				if set {
+					given++
+				}
+			}
+			if given != 1 || c.Args().Len() > 1 {
+				return errors.New("usage: hagg throttle reset <ip> | --user <display-name> | --global | --all")
+			}
+
+			var key string
+			switch {
+			case c.Bool("global"):
+				key = throttle.GlobalKey
+			case c.Args().Len() == 1:
+				ip := net.ParseIP(c.Args().First())
+				if ip == nil {
+					return fmt.Errorf("invalid ip address: %q", c.Args().First())
+				}
+				key = throttle.IPKey(ip.String())
+			}
+
+			cfg := config.MustLoad()
+
+			be, err := openBackend(ctx, cfg)
+			if err != nil {
+				return err
+			}
+			defer be.Close()
+
+			if c.IsSet("user") {
+				u, err := be.stores.Stores().Users.FindByDisplayName(ctx, c.String("user"))
+				if err != nil {
+					return fmt.Errorf("user %q: %w", c.String("user"), err)
+				}
+				key = throttle.UserKey(u.ID)
+			}
+
+			store := be.stores.Stores().Throttle
+
+			if key != "" {
+				if err := store.Reset(ctx, key); err != nil {
+					return err
+				}
+				fmt.Printf("✔ %s reset\n", key)
+				return nil
+			}
+
+			counters, err := store.Counters(ctx)
+			if err != nil {
+				return err
+			}
+			for _, tc := range counters {
+				if err := store.Reset(ctx, tc.Key); err != nil {
+					return err
+				}
+			}
+
+			fmt.Printf("✔ %d counter(s) reset\n", len(counters))
+			return nil
+		},
+	}
+}
+
+func blockedLabel(tc *throttle.Counter, now time.Time) string {
+	if !tc.Blocked(now) {
+		return "-"
+	}
+	until := time.Unix(tc.BlockedUntil, 0)
+	return fmt.Sprintf("until %s (%s)", until.Format(time.DateTime), throttle.RetryIn(until, now))
+}
@@ -2,11 +2,11 @@ package ucli
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strconv"
 
-	"github.com/axelrhd/hagg/internal/config"
-	"github.com/axelrhd/hagg/internal/db"
-	storeUserSqlite "github.com/axelrhd/hagg/internal/user/store_sqlite"
+	"github.com/axelrhd/hagg/internal/user"
 	"github.com/urfave/cli/v3"
 )
 
@@ -16,46 +16,49 @@ func userCmd() *cli.Command {
 		Usage: "User management",
 		Commands: []*cli.Command{
 			userCreateCmd(),
+			userUpdateCmd(),
+			userVerifyEmailCmd(),
+			userDeleteCmd(),
+			userRotateUIDCmd(),
+			userSetPasswordCmd(),
+			userReset2FACmd(),
+			userDisableCmd(),
+			userEnableCmd(),
+			userExpireCmd(),
+			userShowCmd(),
 			userListCmd(),
+			userImportCmd(),
+			userExportCmd(),
 			userRolesCmd(),
 			userPermissionsCmd(),
 		},
 	}
 }
 
-func userCreateCmd() *cli.Command {
-	return &cli.Command{
-		Name:  "create",
-		Usage: "Create a new user",
-		Action: func(ctx context.Context, _ *cli.Command) error {
-
-			cfg := config.MustLoad()
-
-			dbx, err := db.OpenSQLite(cfg.Database.SQLite.Path)
-			if err != nil {
-				return err
-			}
-			defer dbx.Close()
-
-			input, err := promptCreateUser()
-			if err != nil {
-				return err
-			}
+// findUser resolves the user given as argument: a display name,
+// or a numeric ID with --id.
+func findUser(ctx context.Context, users user.Store, c *cli.Command) (*user.User, error) {
+	if c.Args().Len() != 1 {
+		return nil, fmt.Errorf("usage: hagg user %s %s", c.Name, c.ArgsUsage)
+	}
+	arg := c.Args().First()
 
-			store := storeUserSqlite.New(dbx)
+	if !c.Bool("id") {
+		return users.FindByDisplayName(ctx, arg)
+	}
 
-			u, err := store.CreateUser(ctx, input.UID, input.DisplayName)
-			if err != nil {
-				return err
-			}
+	id, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil {
+		return nil, errors.New("--id expects a numeric user ID")
+	}
 
-			fmt.Printf(
-				"✔ user created: id=%d display_name=%s\n",
-				u.ID,
-				u.DisplayName,
-			)
+	return users.FindByID(ctx, id)
+}
 
-			return nil
-		},
+// idFlag switches findUser from display name to numeric ID lookup.
+func idFlag() cli.Flag {
+	return &cli.BoolFlag{
+		Name:  "id",
+		Usage: "Look the user up by numeric ID instead of display name",
 	}
 }
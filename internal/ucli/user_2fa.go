@@ -0,0 +1,73 @@
+package ucli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/axelrhd/hagg/internal/config"
+	"github.com/axelrhd/hagg/internal/store"
+	"github.com/axelrhd/hagg/internal/user"
+	"github.com/urfave/cli/v3"
+)
+
+func userReset2FACmd() *cli.Command {
+	return &cli.Command{
+		Name:      "reset-2fa",
+		Usage:     "Remove a user's two-factor authentication (lost phone and recovery codes)",
+		ArgsUsage: "<display-name>",
+		Description: "Deletes the authenticator enrolment and all recovery codes. If a role of\n" +
+			"the user requires 2FA (auth:require-2fa in the policy), the next login asks\n" +
+			"to set it up again.",
+		Flags: []cli.Flag{idFlag()},
+		Action: func(ctx context.Context, c *cli.Command) error {
+
+			cfg := config.MustLoad()
+
+			be, err := openBackend(ctx, cfg)
+			if err != nil {
+				return err
+			}
+			defer be.Close()
+
+			var u *user.User
+			err = be.stores.WithTx(ctx, func(tx store.Stores) error {
+				var err error
+				u, err = findUser(ctx, tx.Users, c)
+				if err != nil {
+					return err
+				}
+
+				if _, err := tx.Users.TOTP(ctx, u.ID); err != nil {
+					return err
+				}
+				return tx.Users.DeleteTOTP(ctx, u.ID)
+			})
+			if errors.Is(err, user.ErrNoTOTP) {
+				return fmt.Errorf("%s: %w", u.DisplayName, err)
+			}
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf(
+				"✔ 2fa reset: id=%d display_name=%s (authenticator and recovery codes removed)\n",
+				u.ID,
+				u.DisplayName,
+			)
+			return nil
+		},
+	}
+}
+
+// twoFactorLabel describes the 2FA state of a user for hagg user show.
+func twoFactorLabel(t *user.TOTP) string {
+	switch {
+	case t == nil:
+		return "off"
+	case !t.Active():
+		return "setup started"
+	default:
+		return fmt.Sprintf("active since %s (%d recovery codes left)", t.ConfirmedAt, t.RecoveryCodes)
+	}
+}
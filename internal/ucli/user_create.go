@@ -0,0 +1,240 @@
+package ucli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/axelrhd/hagg/internal/config"
+	"github.com/axelrhd/hagg/internal/store"
+	"github.com/axelrhd/hagg/internal/user"
+	"github.com/mattn/go-isatty"
+	"github.com/urfave/cli/v3"
+)
+
+// createFieldFlags select the non-interactive mode.
+var createFieldFlags = []string{"uid", "display-name", "first-name", "last-name", "email"}
+
+func userCreateCmd() *cli.Command {
+	return &cli.Command{
+		Name:      "create",
+		Usage:     "Create a new user (interactive form, flags, or JSON on stdin with -)",
+		ArgsUsage: "[-]",
+		Description: "Without flags a form asks for the data (needs a terminal). For scripts pass\n" +
+			"the fields as flags or a JSON object on stdin:\n\n" +
+			"  hagg user create --display-name alice --generate-uid --role viewer\n" +
+			"  echo '{\"uid\":\"…\",\"display_name\":\"alice\",\"roles\":[\"viewer\"]}' | hagg user create -\n\n" +
+			"Exit codes: 64 usage / no terminal, 65 invalid data, 73 user exists.",
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:  "generate-uid",
+				Usage: "Generate a random UID (shown exactly once) instead of entering one",
+			},
+			&cli.StringFlag{
+				Name:  "uid",
+				Usage: "Login UID (secret; prefer --generate-uid or stdin, flags show up in the process list)",
+			},
+			&cli.StringFlag{
+				Name:  "display-name",
+				Usage: "Display name (required)",
+			},
+			&cli.StringFlag{
+				Name:  "first-name",
+				Usage: "First name",
+			},
+			&cli.StringFlag{
+				Name:  "last-name",
+				Usage: "Last name",
+			},
+			&cli.StringFlag{
+				Name:  "email",
+				Usage: "Email address",
+			},
+			&cli.StringSliceFlag{
+				Name:  "role",
+				Usage: "Assign a role (repeatable or comma-separated)",
+			},
+		},
+		Action: func(ctx context.Context, c *cli.Command) error {
+
+			fromStdin := c.Args().First() == "-"
+			if c.Args().Len() > 1 || (c.Args().Len() == 1 && !fromStdin) {
+				return exitErr(errors.New("usage: hagg user create [flags] [-]"), exitUsage)
+			}
+
+			withFlags := false
+			for _, name := range createFieldFlags {
+				withFlags = withFlags || c.IsSet(name)
+			}
+
+			generateUID := c.Bool("generate-uid")
+
+			switch {
+			case fromStdin && withFlags:
+				return exitErr(errors.New("use either JSON on stdin (-) or field flags, not both"), exitUsage)
+			case generateUID && c.IsSet("uid"):
+				return exitErr(errors.New("use either --uid or --generate-uid, not both"), exitUsage)
+			}
+
+			var (
+				input *user.CreateUserInput
+				roles []string
+				err   error
+			)
+
+			switch {
+			case fromStdin:
+				input, roles, err = readCreateJSON(os.Stdin)
+				if err != nil {
+					return exitErr(fmt.Errorf("stdin: %w", err), exitDataErr)
+				}
+
+			case withFlags:
+				input = &user.CreateUserInput{
+					UID:         c.String("uid"),
+					DisplayName: c.String("display-name"),
+					FirstName:   c.String("first-name"),
+					LastName:    c.String("last-name"),
+					Email:       c.String("email"),
+				}
+
+			case !isTerminal(os.Stdin):
+				// never block a script on a form nobody can fill in
+				return exitErr(errors.New(
+					"no terminal attached: pass --display-name and --uid/--generate-uid, or JSON via 'hagg user create -'",
+				), exitUsage)
+
+			default:
+				input, err = promptCreateUser(generateUID)
+				if err != nil {
+					return err
+				}
+			}
+
+			roles = append(roles, c.StringSlice("role")...)
+
+			if generateUID && input.UID == "" {
+				input.UID, err = user.GenerateUID()
+				if err != nil {
+					return err
+				}
+			}
+
+			if err := normalizeCreateInput(input); err != nil {
+				return exitErr(err, exitDataErr)
+			}
+
+			cfg := config.MustLoad()
+
+			enf, err := loadEnforcer(cfg)
+			if err != nil {
+				return err
+			}
+			for _, role := range roles {
+				ok, err := roleExists(enf, role)
+				if err != nil {
+					return err
+				}
+				if !ok {
+					return exitErr(fmt.Errorf("unknown role %q (no permissions in %s)", role, cfg.Casbin.PolicyPath), exitDataErr)
+				}
+			}
+
+			be, err := openBackend(ctx, cfg)
+			if err != nil {
+				return err
+			}
+			defer be.Close()
+
+			// one transaction – further steps (roles, audit, ...) join here
+			var u *user.User
+			err = be.stores.WithTx(ctx, func(tx store.Stores) error {
+				var err error
+				u, err = tx.Users.CreateUser(ctx, *input)
+				return err
+			})
+			if errors.Is(err, user.ErrAlreadyExists) {
+				return exitErr(fmt.Errorf("create %q: %w", input.DisplayName, err), exitConflict)
+			}
+			if err != nil {
+				return err
+			}
+
+			// Roles: policy.csv is a file, not part of the transaction
+			var rules []roleRule
+			for _, role := range roles {
+				rules = append(rules, roleRule{Subject: u.Subject(), Role: role})
+			}
+			if err := policyAppendRoles(cfg.Casbin.PolicyPath, rules); err != nil {
+				return fmt.Errorf("user created, but adding role assignments failed: %w", err)
+			}
+
+			fmt.Printf(
+				"✔ user created: id=%d display_name=%s\n",
+				u.ID,
+				u.DisplayName,
+			)
+			if len(roles) > 0 {
+				fmt.Printf("✔ roles assigned: %s\n", strings.Join(roles, ", "))
+			}
+
+			if generateUID {
+				printUIDOnce(input.UID)
+			}
+
+			return nil
+		},
+	}
+}
+
+// readCreateJSON reads one user object (same keys as hagg user import).
+func readCreateJSON(r io.Reader) (*user.CreateUserInput, []string, error) {
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+
+	var row importRow
+	if err := dec.Decode(&row); err != nil {
+		return nil, nil, err
+	}
+
+	return &user.CreateUserInput{
+		UID:         row.UID,
+		DisplayName: row.DisplayName,
+		FirstName:   row.FirstName,
+		LastName:    row.LastName,
+		Email:       row.Email,
+	}, row.Roles, nil
+}
+
+// normalizeCreateInput trims the input and checks the required fields.
+func normalizeCreateInput(in *user.CreateUserInput) error {
+	in.UID = strings.TrimSpace(in.UID)
+	in.DisplayName = strings.TrimSpace(in.DisplayName)
+	in.FirstName = strings.TrimSpace(in.FirstName)
+	in.LastName = strings.TrimSpace(in.LastName)
+
+	if err := nonEmpty("display name")(in.DisplayName); err != nil {
+		return err
+	}
+	if err := nonEmpty("uid")(in.UID); err != nil {
+		return errors.New("uid is required (or use --generate-uid)")
+	}
+
+	email, err := user.NormalizeEmail(in.Email)
+	if err != nil {
+		return fmt.Errorf("email %q: %w", in.Email, err)
+	}
+	in.Email = email
+
+	return nil
+}
+
+// isTerminal reports whether f is an interactive terminal
+// (not a pipe, file or /dev/null).
+func isTerminal(f *os.File) bool {
+	return isatty.IsTerminal(f.Fd()) || isatty.IsCygwinTerminal(f.Fd())
+}
@@ -0,0 +1,91 @@
+package ucli
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestUserCreateExitCodes(t *testing.T) {
+	env := newCLIEnv(t)
+
+	tests := []struct {
+		name   string
+		stdin  string
+		args   []string
+		code   int
+		stderr string
+	}{
+		{"extra argument", "", []string{"user", "create", "alice"}, exitUsage, "usage: hagg user create"},
+		{"stdin and flags", `{}`, []string{"user", "create", "--display-name", "alice", "-"}, exitUsage, "not both"},
+		{"uid and generated uid", "", []string{"user", "create", "--uid", "uid-alice", "--generate-uid"}, exitUsage, "not both"},
+		{"no terminal for the form", "", []string{"user", "create"}, exitUsage, "no terminal attached"},
+		{"no terminal, --role only", "", []string{"user", "create", "--role", "viewer"}, exitUsage, "no terminal attached"},
+
+		{"broken JSON", `{"display_name":`, []string{"user", "create", "-"}, exitDataErr, "stdin:"},
+		{"unknown JSON key", `{"display_name":"alice","phone":"123"}`, []string{"user", "create", "-"}, exitDataErr, "unknown field"},
+		{"no display name", "", []string{"user", "create", "--uid", "uid-alice"}, exitDataErr, "display name"},
+		{"no uid", "", []string{"user", "create", "--display-name", "alice"}, exitDataErr, "uid is required"},
+		{"invalid email", "", []string{"user", "create", "--display-name", "alice", "--generate-uid", "--email", "alice"}, exitDataErr, "email"},
+		{"unknown role", "", []string{"user", "create", "--display-name", "alice", "--generate-uid", "--role", "owner"}, exitDataErr, `unknown role "owner"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := env.runCLI(t, tt.stdin, tt.args...)
+			if res.code != tt.code || !strings.Contains(res.stderr, tt.stderr) {
+				t.Errorf("exit %d, stderr %q, want exit %d and %q", res.code, res.stderr, tt.code, tt.stderr)
+			}
+		})
+	}
+
+	// nothing was created along the way
+	if res := env.runCLI(t, "", "user", "show", "alice"); res.code == 0 {
+		t.Errorf("user show alice: exit 0 after the failed creates:\n%s", res.stdout)
+	}
+	if policy := env.policy(t); policy != testPolicy {
+		t.Errorf("policy changed:\n%s", policy)
+	}
+}
+
+func TestUserCreateFlags(t *testing.T) {
+	env := newCLIEnv(t)
+
+	res := env.runCLI(t, "", "user", "create", "--display-name", "alice", "--generate-uid", "--role", "viewer,editor")
+	if res.code != 0 {
+		t.Fatalf("exit %d: %s", res.code, res.stderr)
+	}
+	if !strings.Contains(res.stdout, "display_name=alice") || !strings.Contains(res.stdout, "viewer, editor") {
+		t.Errorf("stdout = %q", res.stdout)
+	}
+	if policy := env.policy(t); !strings.Contains(policy, ", viewer\n") || !strings.Contains(policy, ", editor\n") {
+		t.Errorf("role assignments missing:\n%s", policy)
+	}
+
+	// the same display name again
+	res = env.runCLI(t, "", "user", "create", "--display-name", "alice", "--generate-uid")
+	if res.code != exitConflict {
+		t.Errorf("second create: exit %d, stderr %q, want %d", res.code, res.stderr, exitConflict)
+	}
+}
+
+func TestUserCreateStdin(t *testing.T) {
+	env := newCLIEnv(t)
+
+	const input = `{"uid":"uid-bob","display_name":" bob ","email":"Bob@Example.com","roles":["admin"]}`
+	res := env.runCLI(t, input, "user", "create", "-")
+	if res.code != 0 {
+		t.Fatalf("exit %d: %s", res.code, res.stderr)
+	}
+	if !strings.Contains(res.stdout, "display_name=bob") {
+		t.Errorf("stdout = %q", res.stdout)
+	}
+	if policy := env.policy(t); !strings.Contains(policy, ", admin\n") {
+		t.Errorf("role assignment missing:\n%s", policy)
+	}
+
+	// the same UID again
+	res = env.runCLI(t, `{"uid":"uid-bob","display_name":"bobby"}`, "user", "create", "-")
+	if res.code != exitConflict {
+		t.Errorf("second create: exit %d, stderr %q, want %d", res.code, res.stderr, exitConflict)
+	}
+}
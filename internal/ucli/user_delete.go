@@ -0,0 +1,83 @@
+package ucli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/axelrhd/hagg/internal/config"
+	"github.com/axelrhd/hagg/internal/store"
+	"github.com/axelrhd/hagg/internal/user"
+	"github.com/charmbracelet/huh"
+	"github.com/urfave/cli/v3"
+)
+
+func userDeleteCmd() *cli.Command {
+	return &cli.Command{
+		Name:      "delete",
+		Usage:     "Delete a user (soft delete) and remove its role assignments",
+		ArgsUsage: "<display-name>",
+		Flags: []cli.Flag{
+			idFlag(),
+			&cli.BoolFlag{
+				Name:    "yes",
+				Aliases: []string{"y"},
+				Usage:   "Do not ask for confirmation",
+			},
+		},
+		Action: func(ctx context.Context, c *cli.Command) error {
+
+			cfg := config.MustLoad()
+
+			be, err := openBackend(ctx, cfg)
+			if err != nil {
+				return err
+			}
+			defer be.Close()
+
+			u, err := findUser(ctx, be.stores.Stores().Users, c)
+			if err != nil {
+				return err
+			}
+
+			if !c.Bool("yes") {
+				confirmed := false
+				err := huh.NewConfirm().
+					Title(fmt.Sprintf("Delete user %q (id=%d)?", u.DisplayName, u.ID)).
+					Value(&confirmed).
+					Run()
+				if err != nil {
+					return err
+				}
+				if !confirmed {
+					return errors.New("aborted")
+				}
+			}
+
+			err = be.stores.WithTx(ctx, func(tx store.Stores) error {
+				return tx.Users.DeleteUser(ctx, u.ID)
+			})
+			if err != nil {
+				if errors.Is(err, user.ErrNotFound) {
+					return fmt.Errorf("user %q was deleted concurrently", u.DisplayName)
+				}
+				return err
+			}
+
+			// role assignments of a deleted account are dead weight in the policy
+			n, err := policyRemoveSubjects(cfg.Casbin.PolicyPath, []string{u.Subject()})
+			if err != nil {
+				return fmt.Errorf("user deleted, but policy update failed: %w", err)
+			}
+
+			fmt.Printf(
+				"✔ user deleted: id=%d display_name=%s (%d role assignment(s) removed)\n",
+				u.ID,
+				u.DisplayName,
+				n,
+			)
+
+			return nil
+		},
+	}
+}
@@ -0,0 +1,84 @@
+package ucli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/axelrhd/hagg/internal/auth"
+	"github.com/axelrhd/hagg/internal/config"
+	"github.com/axelrhd/hagg/internal/mail"
+	"github.com/axelrhd/hagg/internal/store"
+	"github.com/axelrhd/hagg/internal/token"
+	"github.com/axelrhd/hagg/internal/user"
+	"github.com/urfave/cli/v3"
+)
+
+func userVerifyEmailCmd() *cli.Command {
+	return &cli.Command{
+		Name:      "verify-email",
+		Usage:     "Send an email verification link (or mark the email as verified)",
+		ArgsUsage: "<display-name>",
+		Flags: []cli.Flag{
+			idFlag(),
+			&cli.BoolFlag{
+				Name:  "mark-verified",
+				Usage: "Mark the current email as verified without sending a link",
+			},
+		},
+		Action: func(ctx context.Context, c *cli.Command) error {
+
+			cfg := config.MustLoad()
+
+			be, err := openBackend(ctx, cfg)
+			if err != nil {
+				return err
+			}
+			defer be.Close()
+
+			users := be.stores.Stores().Users
+
+			u, err := findUser(ctx, users, c)
+			if err != nil {
+				return err
+			}
+			if u.Email == "" {
+				return errors.New("user has no email: set one with hagg user update --email")
+			}
+
+			if c.Bool("mark-verified") {
+				verified := user.At(time.Now())
+				err = be.stores.WithTx(ctx, func(tx store.Stores) error {
+					_, err := tx.Users.UpdateUser(ctx, u.ID, user.UpdateUserInput{EmailVerified: &verified})
+					return err
+				})
+				if err != nil {
+					return err
+				}
+
+				fmt.Printf("✔ email marked as verified: %s\n", u.Email)
+				return nil
+			}
+
+			mailer, err := mail.New(cfg.Mail)
+			if err != nil {
+				return err
+			}
+
+			verifier := auth.NewEmailVerifier(
+				users,
+				token.NewSigner(cfg.Auth.TokenSecret),
+				mailer,
+				cfg.BaseURL(),
+				cfg.Auth.EmailVerifyTTL,
+			)
+			if err := verifier.Send(ctx, u); err != nil {
+				return err
+			}
+
+			fmt.Printf("✔ verification link sent to %s (valid for %s)\n", u.Email, cfg.Auth.EmailVerifyTTL)
+			return nil
+		},
+	}
+}
@@ -0,0 +1,186 @@
+package ucli
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/axelrhd/hagg/internal/config"
+	"github.com/axelrhd/hagg/internal/user"
+	"github.com/urfave/cli/v3"
+)
+
+// exportRow is one exported user. The UID hash is only included with
+// --include-secrets; the UID itself is never stored and cannot be exported.
+type exportRow struct {
+	ID              int64           `json:"id"`
+	DisplayName     string          `json:"display_name"`
+	FirstName       string          `json:"first_name"`
+	LastName        string          `json:"last_name"`
+	Email           string          `json:"email"`
+	EmailVerifiedAt string          `json:"email_verified_at"`
+	Status          string          `json:"status"`
+	Roles           []string        `json:"roles"`
+	Attributes      user.Attributes `json:"attributes"`
+	CreatedAt       string          `json:"created_at"`
+	UIDHash         string          `json:"uid_hash,omitempty"`
+}
+
+func userExportCmd() *cli.Command {
+	return &cli.Command{
+		Name:  "export",
+		Usage: "Export all users with their roles as CSV or JSON",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "format",
+				Value: "csv",
+				Usage: "Output format: csv or json",
+			},
+			&cli.StringFlag{
+				Name:    "output",
+				Aliases: []string{"o"},
+				Usage:   "Write to this file instead of stdout",
+			},
+			&cli.BoolFlag{
+				Name:  "include-secrets",
+				Usage: "Include the UID hashes (only useful with the same AUTH_UID_PEPPER)",
+			},
+		},
+		Action: func(ctx context.Context, c *cli.Command) error {
+
+			format := c.String("format")
+			if format != "csv" && format != "json" {
+				return fmt.Errorf("unknown format %q: use csv or json", format)
+			}
+
+			cfg := config.MustLoad()
+
+			be, err := openBackend(ctx, cfg)
+			if err != nil {
+				return err
+			}
+			defer be.Close()
+
+			users, err := be.stores.Stores().Users.ListUsers(ctx)
+			if err != nil {
+				return err
+			}
+
+			enf, err := loadEnforcer(cfg)
+			if err != nil {
+				return err
+			}
+
+			now := time.Now()
+			rows := make([]exportRow, 0, len(users))
+			for _, u := range users {
+				roles, err := enf.GetRolesForUser(u.Subject())
+				if err != nil {
+					return err
+				}
+
+				row := exportRow{
+					ID:              u.ID,
+					DisplayName:     u.DisplayName,
+					FirstName:       u.FirstName,
+					LastName:        u.LastName,
+					Email:           u.Email,
+					EmailVerifiedAt: u.EmailVerified.String(),
+					Status:          u.StatusLabel(now),
+					Roles:           roles,
+					Attributes:      u.Attributes,
+					CreatedAt:       u.CreatedAt.String(),
+				}
+				if row.Roles == nil {
+					row.Roles = []string{}
+				}
+				if row.Attributes == nil {
+					row.Attributes = user.Attributes{}
+				}
+				if c.Bool("include-secrets") {
+					row.UIDHash = u.UIDHash
+				}
+				rows = append(rows, row)
+			}
+
+			var w io.Writer = os.Stdout
+			if path := c.String("output"); path != "" {
+				// may contain personal data → not world-readable
+				f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+				if err != nil {
+					return err
+				}
+				defer f.Close()
+				w = f
+			}
+
+			if format == "json" {
+				enc := json.NewEncoder(w)
+				enc.SetIndent("", "  ")
+				err = enc.Encode(rows)
+			} else {
+				err = writeExportCSV(w, rows, c.Bool("include-secrets"))
+			}
+			if err != nil {
+				return err
+			}
+
+			if path := c.String("output"); path != "" {
+				fmt.Fprintf(os.Stderr, "✔ %d user(s) exported to %s\n", len(rows), path)
+			}
+			return nil
+		},
+	}
+}
+
+// writeExportCSV writes rows with a header line. Roles are separated by
+// spaces (as accepted by hagg user import), attributes are a JSON object.
+func writeExportCSV(w io.Writer, rows []exportRow, withSecrets bool) error {
+	cw := csv.NewWriter(w)
+
+	header := []string{
+		"id", "display_name", "first_name", "last_name", "email",
+		"email_verified_at", "status", "roles", "attributes", "created_at",
+	}
+	if withSecrets {
+		header = append(header, "uid_hash")
+	}
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+
+	for _, r := range rows {
+		attrs, err := json.Marshal(r.Attributes)
+		if err != nil {
+			return err
+		}
+
+		rec := []string{
+			strconv.FormatInt(r.ID, 10),
+			r.DisplayName,
+			r.FirstName,
+			r.LastName,
+			r.Email,
+			r.EmailVerifiedAt,
+			r.Status,
+			strings.Join(r.Roles, " "),
+			string(attrs),
+			r.CreatedAt,
+		}
+		if withSecrets {
+			rec = append(rec, r.UIDHash)
+		}
+		if err := cw.Write(rec); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
@@ -4,47 +4,72 @@ import (
 	"errors"
 	"strings"
 
+	"github.com/axelrhd/hagg/internal/user"
 	"github.com/charmbracelet/huh"
 )
 
-type CreateUserInput struct {
-	UID         string
-	DisplayName string
-	FirstName   string
-	LastName    string
-}
+// promptCreateUser asks for the new user's data. With generateUID, the UID
+// field is skipped and a random UID is filled in instead.
+func promptCreateUser(generateUID bool) (*user.CreateUserInput, error) {
+	var in user.CreateUserInput
+
+	fields := []huh.Field{
+		huh.NewInput().
+			Title("Display name").
+			Value(&in.DisplayName).
+			Validate(nonEmpty("display name")),
+
+		// optional by default
+		huh.NewInput().
+			Title("First name").
+			Value(&in.FirstName),
+
+		// optional by default
+		huh.NewInput().
+			Title("Last name").
+			Value(&in.LastName),
+
+		// optional, normalized below
+		huh.NewInput().
+			Title("Email").
+			Value(&in.Email).
+			Validate(func(v string) error {
+				_, err := user.NormalizeEmail(v)
+				return err
+			}),
+	}
+
+	if !generateUID {
+		uidField := huh.NewInput().
+			Title("UID (login secret)").
+			Value(&in.UID).
+			Validate(nonEmpty("uid"))
 
-func promptCreateUser() (*CreateUserInput, error) {
-	var in CreateUserInput
+		fields = append([]huh.Field{uidField}, fields...)
+	}
 
 	form := huh.NewForm(
-		huh.NewGroup(
-			huh.NewInput().
-				Title("UID (login secret)").
-				Value(&in.UID).
-				Validate(nonEmpty("uid")),
-
-			huh.NewInput().
-				Title("Display name").
-				Value(&in.DisplayName).
-				Validate(nonEmpty("display name")),
-
-			// optional by default
-			huh.NewInput().
-				Title("First name").
-				Value(&in.FirstName),
-
-			// optional by default
-			huh.NewInput().
-				Title("Last name").
-				Value(&in.LastName),
-		),
+		huh.NewGroup(fields...),
 	)
 
 	if err := form.Run(); err != nil {
 		return nil, err
 	}
 
+	email, err := user.NormalizeEmail(in.Email)
+	if err != nil {
+		return nil, err
+	}
+	in.Email = email
+
+	if generateUID {
+		uid, err := user.GenerateUID()
+		if err != nil {
+			return nil, err
+		}
+		in.UID = uid
+	}
+
 	return &in, nil
 }
 
@@ -0,0 +1,373 @@
+package ucli
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/axelrhd/hagg/internal/config"
+	"github.com/axelrhd/hagg/internal/store"
+	"github.com/axelrhd/hagg/internal/user"
+	"github.com/rodaine/table"
+	"github.com/urfave/cli/v3"
+)
+
+// importRow is one user of an import file (CSV or JSON).
+type importRow struct {
+	UID         string   `json:"uid"`
+	DisplayName string   `json:"display_name"`
+	FirstName   string   `json:"first_name"`
+	LastName    string   `json:"last_name"`
+	Email       string   `json:"email"`
+	Roles       []string `json:"roles"`
+
+	line    int      // CSV line or JSON array index (1-based), for the report
+	errors  []string // validation errors
+	subject string   // Casbin subject of the created user
+}
+
+// importColumns are the CSV columns, uid and display_name are required.
+var importColumns = []string{"uid", "display_name", "first_name", "last_name", "email", "roles"}
+
+// errDryRun rolls back the import transaction after all rows were created.
+var errDryRun = errors.New("dry run")
+
+func userImportCmd() *cli.Command {
+	return &cli.Command{
+		Name:      "import",
+		Usage:     "Create users and role assignments from a CSV or JSON file (all or nothing)",
+		ArgsUsage: "<file.csv|file.json>",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "format",
+				Usage: "File format: csv or json (default: from the file extension)",
+			},
+			&cli.BoolFlag{
+				Name:  "dry-run",
+				Usage: "Validate and create everything in a transaction that is rolled back",
+			},
+		},
+		Action: func(ctx context.Context, c *cli.Command) error {
+			if c.Args().Len() != 1 {
+				return errors.New("usage: hagg user import <file.csv|file.json>")
+			}
+			path := c.Args().First()
+
+			format := c.String("format")
+			if format == "" {
+				format = strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+			}
+
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+
+			var rows []*importRow
+			switch format {
+			case "csv":
+				rows, err = parseImportCSV(data)
+			case "json":
+				rows, err = parseImportJSON(data)
+			default:
+				return fmt.Errorf("unknown format %q: use --format csv or --format json", format)
+			}
+			if err != nil {
+				return fmt.Errorf("parse %s: %w", path, err)
+			}
+			if len(rows) == 0 {
+				return fmt.Errorf("%s contains no users", path)
+			}
+
+			cfg := config.MustLoad()
+
+			be, err := openBackend(ctx, cfg)
+			if err != nil {
+				return err
+			}
+			defer be.Close()
+
+			if err := validateImport(ctx, cfg, be, rows); err != nil {
+				return err
+			}
+
+			invalid := 0
+			for _, r := range rows {
+				if len(r.errors) > 0 {
+					invalid++
+				}
+			}
+			if invalid > 0 {
+				printImportReport(rows)
+				return fmt.Errorf("import aborted: %d of %d row(s) invalid, nothing was written", invalid, len(rows))
+			}
+
+			dryRun := c.Bool("dry-run")
+
+			if err := importUsers(ctx, be, rows, dryRun); err != nil {
+				return err
+			}
+
+			printImportReport(rows)
+
+			if dryRun {
+				fmt.Printf("✔ dry run: %d user(s) valid, nothing was written\n", len(rows))
+				return nil
+			}
+
+			// Roles: policy.csv is a file, not part of the transaction
+			var rules []roleRule
+			for _, r := range rows {
+				for _, role := range r.Roles {
+					rules = append(rules, roleRule{Subject: r.subject, Role: role})
+				}
+			}
+			if err := policyAppendRoles(cfg.Casbin.PolicyPath, rules); err != nil {
+				return fmt.Errorf("users imported, but adding role assignments failed: %w", err)
+			}
+
+			fmt.Printf("✔ %d user(s) imported, %d role assignment(s) added\n", len(rows), len(rules))
+			return nil
+		},
+	}
+}
+
+// importUsers creates the users of rows in one transaction (all or
+// nothing) and sets their subjects. The dry run creates them as well
+// (unique constraints, ...) and rolls back.
+func importUsers(ctx context.Context, be *backend, rows []*importRow, dryRun bool) error {
+	err := be.stores.WithTx(ctx, func(tx store.Stores) error {
+		for _, r := range rows {
+			u, err := tx.Users.CreateUser(ctx, user.CreateUserInput{
+				UID:         r.UID,
+				DisplayName: r.DisplayName,
+				FirstName:   r.FirstName,
+				LastName:    r.LastName,
+				Email:       r.Email,
+			})
+			if err != nil {
+				return fmt.Errorf("row %d (%q): %w", r.line, r.DisplayName, err)
+			}
+			r.subject = u.Subject()
+		}
+
+		if dryRun {
+			return errDryRun
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errDryRun) {
+		return fmt.Errorf("import aborted, nothing was written: %w", err)
+	}
+
+	return nil
+}
+
+// parseImportCSV reads a CSV file with a header line. The delimiter is
+// ',' or ';' (spreadsheet exports), roles are separated by spaces or '|'.
+func parseImportCSV(data []byte) ([]*importRow, error) {
+	data = bytes.TrimPrefix(data, []byte("\ufeff")) // BOM (Excel)
+
+	r := csv.NewReader(bytes.NewReader(data))
+	header, _, _ := bytes.Cut(data, []byte("\n"))
+	if bytes.Count(header, []byte(";")) > bytes.Count(header, []byte(",")) {
+		r.Comma = ';'
+	}
+	r.TrimLeadingSpace = true
+
+	cols, err := r.Read()
+	if err != nil {
+		return nil, err
+	}
+
+	idx := make(map[string]int, len(cols))
+	for i, col := range cols {
+		col = strings.ToLower(strings.TrimSpace(col))
+		if !slices.Contains(importColumns, col) {
+			return nil, fmt.Errorf("unknown column %q (allowed: %s)", col, strings.Join(importColumns, ", "))
+		}
+		idx[col] = i
+	}
+	for _, col := range importColumns[:2] {
+		if _, ok := idx[col]; !ok {
+			return nil, fmt.Errorf("missing column %q", col)
+		}
+	}
+
+	field := func(rec []string, col string) string {
+		i, ok := idx[col]
+		if !ok {
+			return ""
+		}
+		return strings.TrimSpace(rec[i])
+	}
+
+	var rows []*importRow
+	for {
+		rec, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		line, _ := r.FieldPos(0)
+		rows = append(rows, &importRow{
+			UID:         field(rec, "uid"),
+			DisplayName: field(rec, "display_name"),
+			FirstName:   field(rec, "first_name"),
+			LastName:    field(rec, "last_name"),
+			Email:       field(rec, "email"),
+			Roles: strings.FieldsFunc(field(rec, "roles"), func(r rune) bool {
+				return r == ' ' || r == '|'
+			}),
+			line: line,
+		})
+	}
+
+	return rows, nil
+}
+
+// parseImportJSON reads an array of user objects.
+func parseImportJSON(data []byte) ([]*importRow, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+
+	var rows []*importRow
+	if err := dec.Decode(&rows); err != nil {
+		return nil, err
+	}
+
+	for i, r := range rows {
+		if r == nil {
+			return nil, fmt.Errorf("entry %d is null", i+1)
+		}
+		r.line = i + 1
+		r.UID = strings.TrimSpace(r.UID)
+		r.DisplayName = strings.TrimSpace(r.DisplayName)
+		r.FirstName = strings.TrimSpace(r.FirstName)
+		r.LastName = strings.TrimSpace(r.LastName)
+		r.Email = strings.TrimSpace(r.Email)
+	}
+
+	return rows, nil
+}
+
+// validateImport checks every row (against the file and the database) and
+// records the problems on the row, so the report lists all of them at once.
+// Only infrastructure errors are returned.
+func validateImport(ctx context.Context, cfg *config.Config, be *backend, rows []*importRow) error {
+	enf, err := loadEnforcer(cfg)
+	if err != nil {
+		return err
+	}
+
+	users := be.stores.Stores().Users
+
+	uids := make(map[string]int)
+	names := make(map[string]int)
+	emails := make(map[string]int)
+
+	// exists reports whether a lookup found a user
+	exists := func(_ *user.User, err error) (bool, error) {
+		switch {
+		case err == nil:
+			return true, nil
+		case errors.Is(err, user.ErrNotFound):
+			return false, nil
+		default:
+			return false, err
+		}
+	}
+
+	for _, r := range rows {
+		fail := func(format string, args ...any) {
+			r.errors = append(r.errors, fmt.Sprintf(format, args...))
+		}
+
+		if r.UID == "" {
+			fail("uid is required")
+		} else if prev, dup := uids[r.UID]; dup {
+			fail("uid also used in row %d", prev)
+		} else {
+			uids[r.UID] = r.line
+			found, err := exists(users.FindByUID(ctx, r.UID))
+			if err != nil {
+				return err
+			}
+			if found {
+				fail("uid already in use")
+			}
+		}
+
+		if r.DisplayName == "" {
+			fail("display_name is required")
+		} else if prev, dup := names[r.DisplayName]; dup {
+			fail("display_name also used in row %d", prev)
+		} else {
+			names[r.DisplayName] = r.line
+			found, err := exists(users.FindByDisplayName(ctx, r.DisplayName))
+			if err != nil {
+				return err
+			}
+			if found {
+				fail("display_name %q already exists", r.DisplayName)
+			}
+		}
+
+		if email, err := user.NormalizeEmail(r.Email); err != nil {
+			fail("email %q is invalid", r.Email)
+		} else if email != "" {
+			r.Email = email
+			if prev, dup := emails[email]; dup {
+				fail("email also used in row %d", prev)
+			} else {
+				emails[email] = r.line
+				found, err := exists(users.FindByEmail(ctx, email))
+				if err != nil {
+					return err
+				}
+				if found {
+					fail("email %q already in use", email)
+				}
+			}
+		}
+
+		for _, role := range r.Roles {
+			ok, err := roleExists(enf, role)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				fail("unknown role %q", role)
+			}
+		}
+	}
+
+	return nil
+}
+
+func printImportReport(rows []*importRow) {
+	t := table.New("ROW", "DISPLAY NAME", "ROLES", "RESULT")
+	t.WithWriter(os.Stdout)
+
+	for _, r := range rows {
+		result := "ok"
+		if len(r.errors) > 0 {
+			result = "✘ " + strings.Join(r.errors, "; ")
+		}
+		t.AddRow(strconv.Itoa(r.line), r.DisplayName, strings.Join(r.Roles, ", "), result)
+	}
+
+	t.Print()
+}
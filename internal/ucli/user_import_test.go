@@ -0,0 +1,277 @@
+package ucli
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/axelrhd/hagg/internal/config"
+	"github.com/axelrhd/hagg/internal/store"
+	"github.com/axelrhd/hagg/internal/user"
+	storeUserMemory "github.com/axelrhd/hagg/internal/user/store_memory"
+)
+
+const testPolicy = `p, admin, *
+p, editor, user:list
+p, viewer, dashboard:view
+`
+
+// testConfig returns a configuration with the repository's model.conf and
+// a fresh policy.csv (roles admin, editor and viewer).
+func testConfig(t *testing.T) *config.Config {
+	t.Helper()
+
+	dir := t.TempDir()
+	model, err := os.ReadFile(filepath.Join("..", "..", "model.conf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &config.Config{}
+	cfg.Casbin.ModelPath = filepath.Join(dir, "model.conf")
+	cfg.Casbin.PolicyPath = filepath.Join(dir, "policy.csv")
+	if err := os.WriteFile(cfg.Casbin.ModelPath, model, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(cfg.Casbin.PolicyPath, []byte(testPolicy), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return cfg
+}
+
+func testBackend() *backend {
+	uids := user.NewUIDHasher("test-pepper-0123456789abcdef0123")
+	return &backend{stores: store.NewMemory(storeUserMemory.New(uids)), uids: uids, memory: true}
+}
+
+// failingManager lets CreateUser fail for one display name, after the
+// rows before it were created in the same transaction.
+type failingManager struct {
+	store.Manager
+	failOn string
+}
+
+type failingUsers struct {
+	user.Store
+	failOn string
+}
+
+var errCreate = errors.New("create failed")
+
+func (m failingManager) WithTx(ctx context.Context, fn func(tx store.Stores) error) error {
+	return m.Manager.WithTx(ctx, func(tx store.Stores) error {
+		tx.Users = failingUsers{tx.Users, m.failOn}
+		return fn(tx)
+	})
+}
+
+func (u failingUsers) CreateUser(ctx context.Context, in user.CreateUserInput) (*user.User, error) {
+	if in.DisplayName == u.failOn {
+		return nil, errCreate
+	}
+	return u.Store.CreateUser(ctx, in)
+}
+
+func userCount(t *testing.T, be *backend) int {
+	t.Helper()
+
+	users, err := be.stores.Stores().Users.ListUsers(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(users)
+}
+
+func TestParseImportCSV(t *testing.T) {
+	// columns in any order and case, with spaces, optional ones left out
+	data := "Roles, DISPLAY_NAME ,uid\n" +
+		"admin|viewer, Alice , uid-alice\n" +
+		"\"editor viewer\",\"Bob\nBuilder\",uid-bob\n" +
+		",carol,uid-carol\n"
+
+	rows, err := parseImportCSV([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("rows = %d, want 3", len(rows))
+	}
+
+	want := []struct {
+		uid, name string
+		roles     []string
+		line      int
+	}{
+		{"uid-alice", "Alice", []string{"admin", "viewer"}, 2},
+		{"uid-bob", "Bob\nBuilder", []string{"editor", "viewer"}, 3},
+		{"uid-carol", "carol", nil, 5}, // the quoted line break counts
+	}
+	for i, w := range want {
+		r := rows[i]
+		if r.UID != w.uid || r.DisplayName != w.name || !slices.Equal(r.Roles, w.roles) || r.line != w.line {
+			t.Errorf("row %d = %q %q %q line %d, want %q %q %q line %d",
+				i+1, r.UID, r.DisplayName, r.Roles, r.line, w.uid, w.name, w.roles, w.line)
+		}
+		if r.FirstName != "" || r.LastName != "" || r.Email != "" {
+			t.Errorf("row %d: columns missing in the file are not empty: %+v", i+1, r)
+		}
+	}
+}
+
+func TestParseImportCSVSemicolon(t *testing.T) {
+	// Excel export: BOM, ';' as delimiter, commas inside the fields
+	data := "\ufeffuid;display_name;first_name;last_name;email\r\n" +
+		"uid-alice;Liddell, Alice;Alice;Liddell;alice@example.com\r\n"
+
+	rows, err := parseImportCSV([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 {
+		t.Fatalf("rows = %d, want 1", len(rows))
+	}
+	r := rows[0]
+	if r.UID != "uid-alice" || r.DisplayName != "Liddell, Alice" || r.FirstName != "Alice" ||
+		r.LastName != "Liddell" || r.Email != "alice@example.com" {
+		t.Errorf("row = %+v", r)
+	}
+}
+
+func TestParseImportCSVErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{"unknown column", "uid,display_name,phone\nuid-alice,alice,123\n", `unknown column "phone"`},
+		{"missing uid", "display_name,email\nalice,a@example.com\n", `missing column "uid"`},
+		{"missing display_name", "uid,email\nuid-alice,a@example.com\n", `missing column "display_name"`},
+		{"empty file", "", "EOF"},
+		{"too few fields", "uid,display_name\nuid-alice\n", "wrong number of fields"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseImportCSV([]byte(tt.data))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("parseImportCSV = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateImport(t *testing.T) {
+	ctx := context.Background()
+	cfg := testConfig(t)
+	be := testBackend()
+
+	_, err := be.stores.Stores().Users.CreateUser(ctx, user.CreateUserInput{
+		UID:         "uid-existing",
+		DisplayName: "existing",
+		Email:       "existing@example.com",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := parseImportCSV([]byte("uid,display_name,email,roles\n" +
+		"uid-alice,alice,Alice@Example.com,admin viewer\n" + // line 2: ok
+		"uid-alice,bob,,\n" + // line 3: uid of line 2
+		"uid-carol,alice,,\n" + // line 4: display name of line 2
+		"uid-dave,dave,alice@example.COM,\n" + // line 5: email of line 2 (normalized)
+		"uid-existing,existing,existing@example.com,\n" + // line 6: all three in the database
+		"uid-erin,erin,no-email,\n" + // line 7
+		"uid-frank,frank,,viewer owner|guest\n" + // line 8
+		",,,\n")) // line 9
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := validateImport(ctx, cfg, be, rows); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[int][]string{
+		2: nil,
+		3: {"uid also used in row 2"},
+		4: {"display_name also used in row 2"},
+		5: {"email also used in row 2"},
+		6: {"uid already in use", `display_name "existing" already exists`, `email "existing@example.com" already in use`},
+		7: {`email "no-email" is invalid`},
+		8: {`unknown role "owner"`, `unknown role "guest"`},
+		9: {"uid is required", "display_name is required"},
+	}
+	for _, r := range rows {
+		if !slices.Equal(r.errors, want[r.line]) {
+			t.Errorf("line %d: errors = %q, want %q", r.line, r.errors, want[r.line])
+		}
+	}
+	if rows[0].Email != "alice@example.com" {
+		t.Errorf("email = %q, want it normalized", rows[0].Email)
+	}
+
+	// validation writes nothing
+	if n := userCount(t, be); n != 1 {
+		t.Errorf("users after validating = %d, want 1", n)
+	}
+}
+
+func TestImportUsers(t *testing.T) {
+	ctx := context.Background()
+	be := testBackend()
+
+	rows, err := parseImportCSV([]byte("uid,display_name,roles\nuid-alice,alice,admin\nuid-bob,bob,\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the dry run creates the users in a transaction that is rolled back
+	if err := importUsers(ctx, be, rows, true); err != nil {
+		t.Fatalf("dry run: %v", err)
+	}
+	if n := userCount(t, be); n != 0 {
+		t.Fatalf("users after the dry run = %d, want 0", n)
+	}
+
+	if err := importUsers(ctx, be, rows, false); err != nil {
+		t.Fatal(err)
+	}
+	if n := userCount(t, be); n != 2 {
+		t.Fatalf("users after the import = %d, want 2", n)
+	}
+	for _, r := range rows {
+		u, err := be.stores.Stores().Users.FindByUID(ctx, r.UID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.subject != u.Subject() {
+			t.Errorf("%s: subject = %q, want %q", r.DisplayName, r.subject, u.Subject())
+		}
+	}
+}
+
+func TestImportUsersAllOrNothing(t *testing.T) {
+	ctx := context.Background()
+	be := testBackend()
+	be.stores = failingManager{Manager: be.stores, failOn: "carol"}
+
+	rows, err := parseImportCSV([]byte("uid,display_name\nuid-alice,alice\nuid-bob,bob\nuid-carol,carol\nuid-dave,dave\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = importUsers(ctx, be, rows, false)
+	if !errors.Is(err, errCreate) || !strings.Contains(err.Error(), `row 4 ("carol")`) {
+		t.Fatalf("importUsers = %v, want the failed row", err)
+	}
+
+	// alice and bob were created before carol failed: rolled back
+	if n := userCount(t, be); n != 0 {
+		t.Errorf("users after the failed import = %d, want 0", n)
+	}
+}
@@ -2,11 +2,15 @@ package ucli
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/axelrhd/hagg/internal/config"
-	"github.com/axelrhd/hagg/internal/db"
-	storeUserSqlite "github.com/axelrhd/hagg/internal/user/store_sqlite"
+	"github.com/axelrhd/hagg/internal/user"
 	"github.com/rodaine/table"
 	"github.com/urfave/cli/v3"
 )
@@ -15,42 +19,126 @@ func userListCmd() *cli.Command {
 	return &cli.Command{
 		Name:  "list",
 		Usage: "List users",
-		Action: func(ctx context.Context, _ *cli.Command) error {
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "search",
+				Usage: "Filter by display, first or last name (substring, case-insensitive)",
+			},
+			&cli.StringFlag{
+				Name:  "sort",
+				Value: string(user.SortID),
+				Usage: "Sort field (id, display_name, first_name, last_name, created_at, updated_at); prefix with - for descending",
+			},
+			&cli.IntFlag{
+				Name:  "limit",
+				Value: user.DefaultListLimit,
+				Usage: fmt.Sprintf("Users per page (max %d)", user.MaxListLimit),
+			},
+			&cli.StringFlag{
+				Name:  "inactive-since",
+				Usage: "Only users without a login since then: age (90d, 36h) or date (2006-01-02)",
+			},
+			&cli.IntFlag{
+				Name:  "page",
+				Value: 1,
+				Usage: "Page number, starting at 1",
+			},
+		},
+		Action: func(ctx context.Context, c *cli.Command) error {
+
+			sortField, desc, err := user.ParseSort(c.String("sort"))
+			if err != nil {
+				return err
+			}
+
+			page := c.Int("page")
+			if page < 1 {
+				return errors.New("--page must be >= 1")
+			}
+
+			lq, err := user.ListQuery{
+				Search: c.String("search"),
+				Sort:   sortField,
+				Desc:   desc,
+				Limit:  c.Int("limit"),
+			}.Normalize()
+			if err != nil {
+				return err
+			}
+			lq.Offset = (page - 1) * lq.Limit
+
+			if c.IsSet("inactive-since") {
+				lq.InactiveSince, err = parseSince(c.String("inactive-since"), time.Now())
+				if err != nil {
+					return err
+				}
+			}
 
 			cfg := config.MustLoad()
 
-			dbx, err := db.OpenSQLite(cfg.Database.SQLite.Path)
+			be, err := openBackend(ctx, cfg)
 			if err != nil {
 				return err
 			}
-			defer dbx.Close()
+			defer be.Close()
 
-			store := storeUserSqlite.New(dbx)
+			store := be.stores.Stores().Users
 
-			users, err := store.ListUsers(ctx)
+			res, err := store.QueryUsers(ctx, lq)
 			if err != nil {
 				return err
 			}
 
 			t := table.New(
 				"ID",
-				"UID",
 				"DISPLAY NAME",
 				"FULL NAME",
+				"STATUS",
+				"LAST LOGIN",
 			)
 			t.WithWriter(os.Stdout)
 
-			for _, u := range users {
+			now := time.Now()
+			for _, u := range res.Users {
 				t.AddRow(
 					u.ID,
-					u.UID,
 					u.DisplayName,
 					u.FullName(),
+					u.StatusLabel(now),
+					lastLoginLabel(u),
 				)
 			}
 
 			t.Print()
+
+			pages := max(1, (res.Total+int64(lq.Limit)-1)/int64(lq.Limit))
+			fmt.Printf("\npage %d/%d · %d user(s) total\n", page, pages, res.Total)
+
 			return nil
 		},
 	}
 }
+
+// parseSince parses an age relative to now ("90d", "36h") or a local date/time.
+func parseSince(s string, now time.Time) (time.Time, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		if n, err := strconv.Atoi(days); err == nil && n >= 0 {
+			return now.AddDate(0, 0, -n), nil
+		}
+	}
+	if d, err := time.ParseDuration(s); err == nil && d >= 0 {
+		return now.Add(-d), nil
+	}
+	if t, err := parseLocalTime(s); err == nil {
+		return t, nil
+	}
+
+	return time.Time{}, fmt.Errorf("invalid value %q: use an age like 90d or 36h, or a date like 2006-01-02", s)
+}
+
+func lastLoginLabel(u *user.User) string {
+	if !u.LastLoginAt.Valid {
+		return "never"
+	}
+	return u.LastLoginAt.String()
+}
@@ -0,0 +1,169 @@
+package ucli
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/axelrhd/hagg/internal/auth"
+	"github.com/axelrhd/hagg/internal/config"
+	"github.com/axelrhd/hagg/internal/store"
+	"github.com/axelrhd/hagg/internal/user"
+	"github.com/charmbracelet/huh"
+	"github.com/urfave/cli/v3"
+)
+
+func userSetPasswordCmd() *cli.Command {
+	return &cli.Command{
+		Name:      "set-password",
+		Usage:     "Set (or remove) a user's password and end all of its sessions",
+		ArgsUsage: "<display-name>",
+		Description: "Asks for the password twice (needs a terminal). Scripts pass it on the\n" +
+			"first line of stdin:\n\n" +
+			"  printf '%s\\n' \"$PW\" | hagg user set-password --stdin alice\n\n" +
+			"The password must satisfy AUTH_PASSWORD_MIN_LENGTH and AUTH_PASSWORD_MIN_CLASSES.\n" +
+			"It is only used for logins with AUTH_LOGIN_MODE=password or display-name+password.\n\n" +
+			"Exit codes: 64 usage / no terminal, 65 password rejected by the policy.",
+		Flags: []cli.Flag{
+			idFlag(),
+			&cli.BoolFlag{
+				Name:  "stdin",
+				Usage: "Read the password from the first line of stdin",
+			},
+			&cli.BoolFlag{
+				Name:  "clear",
+				Usage: "Remove the password (password logins fail until a new one is set)",
+			},
+		},
+		Action: func(ctx context.Context, c *cli.Command) error {
+
+			if c.Bool("stdin") && c.Bool("clear") {
+				return exitErr(errors.New("use either --stdin or --clear, not both"), exitUsage)
+			}
+			if !c.Bool("stdin") && !c.Bool("clear") && !isTerminal(os.Stdin) {
+				return exitErr(errors.New("no terminal attached: pass the password with --stdin"), exitUsage)
+			}
+
+			cfg := config.MustLoad()
+
+			be, err := openBackend(ctx, cfg)
+			if err != nil {
+				return err
+			}
+			defer be.Close()
+
+			u, err := findUser(ctx, be.stores.Stores().Users, c)
+			if err != nil {
+				return err
+			}
+
+			policy := auth.PasswordPolicy(cfg.Auth)
+
+			var hash string // "" removes the password
+			if !c.Bool("clear") {
+				var password string
+				if c.Bool("stdin") {
+					password, err = readPasswordLine(os.Stdin)
+				} else {
+					password, err = promptPassword(policy, u)
+				}
+				if err != nil {
+					return err
+				}
+
+				if err := policy.Check(password, u); err != nil {
+					return exitErr(err, exitDataErr)
+				}
+
+				hash, err = user.HashPassword(password)
+				if err != nil {
+					return err
+				}
+			}
+
+			err = be.stores.WithTx(ctx, func(tx store.Stores) error {
+				if err := tx.Users.SetPassword(ctx, u.ID, hash); err != nil {
+					return err
+				}
+				_, err := tx.Users.RevokeSessions(ctx, u.ID)
+				return err
+			})
+			if err != nil {
+				return err
+			}
+
+			action := "set"
+			if hash == "" {
+				action = "removed"
+			}
+			fmt.Printf(
+				"✔ password %s: id=%d display_name=%s (all sessions ended)\n",
+				action,
+				u.ID,
+				u.DisplayName,
+			)
+			if cfg.Auth.LoginMode == config.LoginModeUID {
+				fmt.Println("  note: AUTH_LOGIN_MODE=uid – passwords are not used for login")
+			}
+
+			return nil
+		},
+	}
+}
+
+// readPasswordLine reads the first line of r (without the line break).
+func readPasswordLine(r io.Reader) (string, error) {
+	line, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+
+	line = strings.TrimRight(line, "\r\n")
+	if line == "" {
+		return "", exitErr(errors.New("stdin: no password given"), exitUsage)
+	}
+
+	return line, nil
+}
+
+// promptPassword asks for the new password twice, hidden.
+func promptPassword(policy user.PasswordPolicy, u *user.User) (string, error) {
+	var password, confirm string
+
+	form := huh.NewForm(
+		huh.NewGroup(
+			huh.NewInput().
+				Title("New password").
+				Description(fmt.Sprintf(
+					"At least %d characters, %d character class(es)",
+					policy.MinLength, policy.MinClasses,
+				)).
+				EchoMode(huh.EchoModePassword).
+				Value(&password).
+				Validate(func(v string) error {
+					return policy.Check(v, u)
+				}),
+
+			huh.NewInput().
+				Title("Repeat password").
+				EchoMode(huh.EchoModePassword).
+				Value(&confirm).
+				Validate(func(v string) error {
+					if v != password {
+						return errors.New("passwords do not match")
+					}
+					return nil
+				}),
+		),
+	)
+
+	if err := form.Run(); err != nil {
+		return "", err
+	}
+
+	return password, nil
+}
@@ -0,0 +1,47 @@
+package ucli
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestUserSetPasswordExitCodes(t *testing.T) {
+	env := newCLIEnv(t)
+
+	if res := env.runCLI(t, "", "user", "create", "--display-name", "alice", "--generate-uid"); res.code != 0 {
+		t.Fatalf("user create: exit %d: %s", res.code, res.stderr)
+	}
+
+	tests := []struct {
+		name   string
+		stdin  string
+		args   []string
+		code   int
+		stderr string
+	}{
+		{"no terminal for the prompt", "Secret-Passw0rd\n", []string{"user", "set-password", "alice"}, exitUsage, "no terminal attached"},
+		{"stdin and clear", "", []string{"user", "set-password", "--stdin", "--clear", "alice"}, exitUsage, "not both"},
+		{"empty stdin", "", []string{"user", "set-password", "--stdin", "alice"}, exitUsage, "no password given"},
+		{"too short", "short\n", []string{"user", "set-password", "--stdin", "alice"}, exitDataErr, ""},
+		{"unknown user", "Secret-Passw0rd\n", []string{"user", "set-password", "--stdin", "bob"}, 1, "nicht gefunden"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := env.runCLI(t, tt.stdin, tt.args...)
+			if res.code != tt.code || !strings.Contains(res.stderr, tt.stderr) {
+				t.Errorf("exit %d, stderr %q, want exit %d and %q", res.code, res.stderr, tt.code, tt.stderr)
+			}
+		})
+	}
+
+	res := env.runCLI(t, "Secret-Passw0rd\n", "user", "set-password", "--stdin", "alice")
+	if res.code != 0 || !strings.Contains(res.stdout, "password set") {
+		t.Errorf("exit %d, stdout %q, stderr %q", res.code, res.stdout, res.stderr)
+	}
+
+	res = env.runCLI(t, "", "user", "set-password", "--clear", "alice")
+	if res.code != 0 || !strings.Contains(res.stdout, "password removed") {
+		t.Errorf("--clear: exit %d, stdout %q, stderr %q", res.code, res.stdout, res.stderr)
+	}
+}
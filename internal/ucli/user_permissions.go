@@ -6,9 +6,7 @@ import (
 	"sort"
 
 	"github.com/axelrhd/hagg/internal/config"
-	"github.com/axelrhd/hagg/internal/db"
 	"github.com/axelrhd/hagg/internal/user"
-	storeUserSqlite "github.com/axelrhd/hagg/internal/user/store_sqlite"
 	"github.com/urfave/cli/v3"
 )
 
@@ -32,13 +30,13 @@ func userPermissionsCmd() *cli.Command {
 
 			cfg := config.MustLoad()
 
-			dbx, err := db.OpenSQLite(cfg.Database.SQLite.Path)
+			be, err := openBackend(ctx, cfg)
 			if err != nil {
 				return err
 			}
-			defer dbx.Close()
+			defer be.Close()
 
-			userStore := storeUserSqlite.New(dbx)
+			userStore := be.stores.Stores().Users
 
 			if c.Bool("tree") {
 				return runPermissionsTree(ctx, cfg, userStore, displayName)
@@ -61,15 +59,15 @@ func runPermissionsFlat(
 		return err
 	}
 
-	subjects, err := resolveSubjects(ctx, userStore, displayName)
+	users, err := resolveSubjects(ctx, userStore, displayName)
 	if err != nil {
 		return err
 	}
 
-	for _, sub := range subjects {
-		fmt.Printf("%s:\n", sub)
+	for _, u := range users {
+		fmt.Printf("%s:\n", subjectHeading(u))
 
-		raw, err := enf.GetImplicitPermissionsForUser(sub)
+		raw, err := enf.GetImplicitPermissionsForUser(u.Subject())
 		if err != nil {
 			return err
 		}
@@ -94,15 +92,15 @@ func runPermissionsTree(
 		return err
 	}
 
-	subjects, err := resolveSubjects(ctx, userStore, displayName)
+	users, err := resolveSubjects(ctx, userStore, displayName)
 	if err != nil {
 		return err
 	}
 
-	for _, sub := range subjects {
-		fmt.Printf("%s:\n", sub)
+	for _, u := range users {
+		fmt.Printf("%s:\n", subjectHeading(u))
 
-		roles, err := enf.GetRolesForUser(sub)
+		roles, err := enf.GetRolesForUser(u.Subject())
 		if err != nil {
 			return err
 		}
@@ -124,7 +122,7 @@ func runPermissionsTree(
 			}
 		}
 
-		rawEff, err := enf.GetImplicitPermissionsForUser(sub)
+		rawEff, err := enf.GetImplicitPermissionsForUser(u.Subject())
 		if err != nil {
 			return err
 		}
@@ -5,8 +5,6 @@ import (
 	"fmt"
 
 	"github.com/axelrhd/hagg/internal/config"
-	"github.com/axelrhd/hagg/internal/db"
-	storeUserSqlite "github.com/axelrhd/hagg/internal/user/store_sqlite"
 	"github.com/urfave/cli/v3"
 )
 
@@ -24,28 +22,28 @@ func userRolesCmd() *cli.Command {
 
 			cfg := config.MustLoad()
 
-			dbx, err := db.OpenSQLite(cfg.Database.SQLite.Path)
+			be, err := openBackend(ctx, cfg)
 			if err != nil {
 				return err
 			}
-			defer dbx.Close()
+			defer be.Close()
 
-			userStore := storeUserSqlite.New(dbx)
+			userStore := be.stores.Stores().Users
 
 			enf, err := loadEnforcer(cfg)
 			if err != nil {
 				return err
 			}
 
-			subjects, err := resolveSubjects(ctx, userStore, displayName)
+			users, err := resolveSubjects(ctx, userStore, displayName)
 			if err != nil {
 				return err
 			}
 
-			for _, sub := range subjects {
-				fmt.Printf("%s:\n", sub)
+			for _, u := range users {
+				fmt.Printf("%s:\n", subjectHeading(u))
 
-				roles, err := enf.GetRolesForUser(sub)
+				roles, err := enf.GetRolesForUser(u.Subject())
 				if err != nil {
 					return err
 				}
@@ -0,0 +1,159 @@
+package ucli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/axelrhd/hagg/internal/config"
+	"github.com/axelrhd/hagg/internal/user"
+	"github.com/urfave/cli/v3"
+)
+
+func userShowCmd() *cli.Command {
+	return &cli.Command{
+		Name:      "show",
+		Usage:     "Show a single user",
+		ArgsUsage: "<display-name>",
+		Flags: []cli.Flag{
+			idFlag(),
+			&cli.IntFlag{
+				Name:  "events",
+				Value: user.DefaultLoginEvents,
+				Usage: "Number of recent login attempts to show (0 = none)",
+			},
+		},
+		Action: func(ctx context.Context, c *cli.Command) error {
+
+			cfg := config.MustLoad()
+
+			be, err := openBackend(ctx, cfg)
+			if err != nil {
+				return err
+			}
+			defer be.Close()
+
+			u, err := findUser(ctx, be.stores.Stores().Users, c)
+			if err != nil {
+				return err
+			}
+
+			enf, err := loadEnforcer(cfg)
+			if err != nil {
+				return err
+			}
+
+			roles, err := enf.GetRolesForUser(u.Subject())
+			if err != nil {
+				return err
+			}
+
+			_, err = be.stores.Stores().Users.PasswordHash(ctx, u.ID)
+			hasPassword := err == nil
+			if err != nil && !errors.Is(err, user.ErrNoPassword) {
+				return err
+			}
+
+			totp, err := be.stores.Stores().Users.TOTP(ctx, u.ID)
+			if err != nil && !errors.Is(err, user.ErrNoTOTP) {
+				return err
+			}
+
+			passkeys, err := be.stores.Stores().Users.Passkeys(ctx, u.ID)
+			if err != nil {
+				return err
+			}
+
+			identities, err := be.stores.Stores().Users.Identities(ctx, u.ID)
+			if err != nil {
+				return err
+			}
+
+			// the UID is a login secret and never printed
+			fmt.Printf("id: %d\n", u.ID)
+			fmt.Printf("display_name: %s\n", u.DisplayName)
+			fmt.Printf("first_name: %s\n", u.FirstName)
+			fmt.Printf("last_name: %s\n", u.LastName)
+			fmt.Printf("email: %s\n", u.Email)
+			if u.Email != "" {
+				fmt.Printf("email_verified_at: %s\n", u.EmailVerified)
+			}
+			fmt.Printf("status: %s\n", u.StatusLabel(time.Now()))
+			fmt.Printf("password: %t\n", hasPassword)
+			fmt.Printf("two_factor: %s\n", twoFactorLabel(totp))
+			fmt.Printf("passkeys: %d\n", len(passkeys))
+			fmt.Printf("last_login_at: %s\n", lastLoginLabel(u))
+			fmt.Printf("login_count: %d\n", u.LoginCount)
+			fmt.Printf("created_at: %s\n", u.CreatedAt)
+			fmt.Printf("updated_at: %s\n", u.UpdatedAt)
+			printYAMLList("roles", roles, "")
+			printIdentities(identities)
+			printAttributes(u.Attributes)
+
+			if n := c.Int("events"); n > 0 {
+				events, err := be.stores.Stores().Users.LoginEvents(ctx, u.ID, n)
+				if err != nil {
+					return err
+				}
+				printLoginEvents(events)
+			}
+
+			return nil
+		},
+	}
+}
+
+// printAttributes prints custom attributes sorted by key, values as JSON.
+func printAttributes(attrs user.Attributes) {
+	if len(attrs) == 0 {
+		fmt.Println("attributes: {}")
+		return
+	}
+
+	fmt.Println("attributes:")
+	for _, k := range slices.Sorted(maps.Keys(attrs)) {
+		v, err := json.Marshal(attrs[k])
+		if err != nil {
+			v = []byte(fmt.Sprint(attrs[k]))
+		}
+		fmt.Printf("  %s: %s\n", k, v)
+	}
+}
+
+// printIdentities prints the linked SSO accounts with the roles mapped at
+// their last login (assigned by the server, not in policy.csv).
+func printIdentities(identities []*user.Identity) {
+	if len(identities) == 0 {
+		fmt.Println("sso_accounts: []")
+		return
+	}
+
+	fmt.Println("sso_accounts:")
+	for _, id := range identities {
+		fmt.Printf("  - issuer: %s\n", id.Issuer)
+		fmt.Printf("    subject: %s\n", id.Subject)
+		fmt.Printf("    last_login_at: %s\n", id.LastLoginAt)
+		printYAMLList("sso_roles", id.Roles, "    ")
+	}
+}
+
+// printLoginEvents prints login attempts, newest first.
+func printLoginEvents(events []*user.LoginEvent) {
+	if len(events) == 0 {
+		fmt.Println("login_events: []")
+		return
+	}
+
+	fmt.Println("login_events:")
+	for _, ev := range events {
+		result := "ok"
+		if !ev.Success {
+			result = "failed: " + ev.Reason
+		}
+		fmt.Printf("  - %s %s %s (%s)\n", ev.CreatedAt, ev.IP, result, ev.UserAgent)
+	}
+}
@@ -0,0 +1,129 @@
+package ucli
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/axelrhd/hagg/internal/config"
+	"github.com/axelrhd/hagg/internal/store"
+	"github.com/axelrhd/hagg/internal/user"
+	"github.com/urfave/cli/v3"
+)
+
+func userDisableCmd() *cli.Command {
+	return &cli.Command{
+		Name:      "disable",
+		Usage:     "Disable a user (login refused, running sessions end immediately)",
+		ArgsUsage: "<display-name>",
+		Flags:     []cli.Flag{idFlag()},
+		Action: func(ctx context.Context, c *cli.Command) error {
+			status := user.StatusDisabled
+
+			return updateUserStatus(ctx, c, user.UpdateUserInput{
+				Status: &status,
+			})
+		},
+	}
+}
+
+func userEnableCmd() *cli.Command {
+	return &cli.Command{
+		Name:      "enable",
+		Usage:     "Re-enable a user (clears disabled status, lock and expiry)",
+		ArgsUsage: "<display-name>",
+		Flags:     []cli.Flag{idFlag()},
+		Action: func(ctx context.Context, c *cli.Command) error {
+			status := user.StatusActive
+			none := user.NullTime{}
+
+			return updateUserStatus(ctx, c, user.UpdateUserInput{
+				Status:      &status,
+				LockedUntil: &none,
+				ValidUntil:  &none,
+			})
+		},
+	}
+}
+
+func userExpireCmd() *cli.Command {
+	return &cli.Command{
+		Name:      "expire",
+		Usage:     "Let a user's access expire now or at a given time",
+		ArgsUsage: "<display-name>",
+		Flags: []cli.Flag{
+			idFlag(),
+			&cli.StringFlag{
+				Name:  "at",
+				Usage: `Expiry time in local time ("2006-01-02", "2006-01-02 15:04"); default: now`,
+			},
+			&cli.BoolFlag{
+				Name:  "clear",
+				Usage: "Remove the expiry date",
+			},
+		},
+		Action: func(ctx context.Context, c *cli.Command) error {
+			validUntil := user.At(time.Now())
+
+			switch {
+			case c.Bool("clear"):
+				validUntil = user.NullTime{}
+
+			case c.String("at") != "":
+				t, err := parseLocalTime(c.String("at"))
+				if err != nil {
+					return err
+				}
+				validUntil = user.At(t)
+			}
+
+			return updateUserStatus(ctx, c, user.UpdateUserInput{
+				ValidUntil: &validUntil,
+			})
+		},
+	}
+}
+
+// updateUserStatus applies in to the user given as argument
+// and prints the resulting status.
+func updateUserStatus(ctx context.Context, c *cli.Command, in user.UpdateUserInput) error {
+	cfg := config.MustLoad()
+
+	be, err := openBackend(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer be.Close()
+
+	var u *user.User
+	err = be.stores.WithTx(ctx, func(tx store.Stores) error {
+		current, err := findUser(ctx, tx.Users, c)
+		if err != nil {
+			return err
+		}
+
+		u, err = tx.Users.UpdateUser(ctx, current.ID, in)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf(
+		"✔ %s: status=%s\n",
+		u.DisplayName,
+		u.StatusLabel(time.Now()),
+	)
+
+	return nil
+}
+
+func parseLocalTime(s string) (time.Time, error) {
+	for _, layout := range []string{time.DateTime, "2006-01-02 15:04", time.DateOnly} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("invalid time %q (use 2006-01-02 or 2006-01-02 15:04)", s)
+}
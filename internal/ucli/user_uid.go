@@ -0,0 +1,67 @@
+package ucli
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/axelrhd/hagg/internal/config"
+	"github.com/axelrhd/hagg/internal/store"
+	"github.com/axelrhd/hagg/internal/user"
+	"github.com/urfave/cli/v3"
+)
+
+func userRotateUIDCmd() *cli.Command {
+	return &cli.Command{
+		Name:      "rotate-uid",
+		Usage:     "Replace a user's UID with a generated one and end all of its sessions",
+		ArgsUsage: "<display-name>",
+		Flags:     []cli.Flag{idFlag()},
+		Action: func(ctx context.Context, c *cli.Command) error {
+
+			cfg := config.MustLoad()
+
+			be, err := openBackend(ctx, cfg)
+			if err != nil {
+				return err
+			}
+			defer be.Close()
+
+			uid, err := user.GenerateUID()
+			if err != nil {
+				return err
+			}
+
+			var u *user.User
+			err = be.stores.WithTx(ctx, func(tx store.Stores) error {
+				current, err := findUser(ctx, tx.Users, c)
+				if err != nil {
+					return err
+				}
+
+				u, err = tx.Users.RotateUID(ctx, current.ID, uid)
+				return err
+			})
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf(
+				"✔ uid rotated: id=%d display_name=%s (all sessions ended)\n",
+				u.ID,
+				u.DisplayName,
+			)
+			printUIDOnce(uid)
+
+			return nil
+		},
+	}
+}
+
+// printUIDOnce shows a generated UID. Only its hash is stored,
+// so it cannot be displayed again.
+func printUIDOnce(uid string) {
+	fmt.Println()
+	fmt.Printf("  UID: %s\n", uid)
+	fmt.Println()
+	fmt.Println("  Hand it to the user now – it is shown only this once.")
+}
@@ -0,0 +1,156 @@
+package ucli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/axelrhd/hagg/internal/config"
+	"github.com/axelrhd/hagg/internal/store"
+	"github.com/axelrhd/hagg/internal/user"
+	"github.com/urfave/cli/v3"
+)
+
+func userUpdateCmd() *cli.Command {
+	return &cli.Command{
+		Name:      "update",
+		Usage:     "Change names, email or attributes of a user",
+		ArgsUsage: "<display-name>",
+
+		// --attr 'tags=["a","b"]' – values must not be split at commas
+		DisableSliceFlagSeparator: true,
+
+		Flags: []cli.Flag{
+			idFlag(),
+			&cli.StringFlag{
+				Name:  "display-name",
+				Usage: "New display name (roles stay assigned, see user.User.Subject)",
+			},
+			&cli.StringFlag{
+				Name:  "first-name",
+				Usage: "New first name (empty string clears it)",
+			},
+			&cli.StringFlag{
+				Name:  "last-name",
+				Usage: "New last name (empty string clears it)",
+			},
+			&cli.StringFlag{
+				Name:  "email",
+				Usage: "New email (empty string clears it, a change resets the verification)",
+			},
+			&cli.StringSliceFlag{
+				Name:  "attr",
+				Usage: "Set a custom attribute as key=value (value is JSON if valid, else a string; repeatable)",
+			},
+			&cli.StringSliceFlag{
+				Name:  "unset-attr",
+				Usage: "Remove a custom attribute (repeatable)",
+			},
+		},
+		Action: func(ctx context.Context, c *cli.Command) error {
+
+			var in user.UpdateUserInput
+			if c.IsSet("display-name") {
+				v := c.String("display-name")
+				if err := nonEmpty("display name")(v); err != nil {
+					return err
+				}
+				in.DisplayName = &v
+			}
+			if c.IsSet("first-name") {
+				v := c.String("first-name")
+				in.FirstName = &v
+			}
+			if c.IsSet("last-name") {
+				v := c.String("last-name")
+				in.LastName = &v
+			}
+
+			if c.IsSet("email") {
+				v, err := user.NormalizeEmail(c.String("email"))
+				if err != nil {
+					return err
+				}
+				in.Email = &v
+			}
+
+			set, err := parseAttrs(c.StringSlice("attr"))
+			if err != nil {
+				return err
+			}
+			unset := c.StringSlice("unset-attr")
+			changeAttrs := len(set) > 0 || len(unset) > 0
+
+			if in.Empty() && !changeAttrs {
+				return errors.New("nothing to update: use --display-name, --first-name, --last-name, --email, --attr or --unset-attr")
+			}
+
+			cfg := config.MustLoad()
+
+			be, err := openBackend(ctx, cfg)
+			if err != nil {
+				return err
+			}
+			defer be.Close()
+
+			var before, after *user.User
+			err = be.stores.WithTx(ctx, func(tx store.Stores) error {
+				var err error
+				before, err = findUser(ctx, tx.Users, c)
+				if err != nil {
+					return err
+				}
+
+				// merged inside the tx, so concurrent changes are not lost
+				if changeAttrs {
+					attrs := before.Attributes.Clone()
+					for k, v := range set {
+						attrs.Set(k, v)
+					}
+					for _, k := range unset {
+						delete(attrs, k)
+					}
+					in.Attributes = &attrs
+				}
+
+				after, err = tx.Users.UpdateUser(ctx, before.ID, in)
+				return err
+			})
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf(
+				"✔ user updated: id=%d display_name=%s\n",
+				after.ID,
+				after.DisplayName,
+			)
+
+			return nil
+		},
+	}
+}
+
+// parseAttrs parses key=value pairs. Values that are valid JSON keep their
+// type (42, true, {"a":1}), everything else is stored as a string.
+func parseAttrs(pairs []string) (map[string]any, error) {
+	attrs := make(map[string]any, len(pairs))
+	for _, p := range pairs {
+		k, v, ok := strings.Cut(p, "=")
+		k = strings.TrimSpace(k)
+		if !ok || k == "" {
+			return nil, fmt.Errorf("invalid attribute %q: expected key=value", p)
+		}
+
+		var val any
+		dec := json.NewDecoder(strings.NewReader(v))
+		dec.UseNumber()
+		if err := dec.Decode(&val); err != nil || dec.More() {
+			val = v
+		}
+		attrs[k] = val
+	}
+	return attrs, nil
+}
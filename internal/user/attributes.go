@@ -0,0 +1,128 @@
+package user
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Attributes holds app-specific profile data (users.attributes, JSON object).
+// Numbers are kept as json.Number, so integers survive unchanged.
+type Attributes map[string]any
+
+func (a *Attributes) Scan(v any) error {
+	var data []byte
+
+	switch v := v.(type) {
+	case nil:
+		*a = Attributes{}
+		return nil
+	case string:
+		data = []byte(v)
+	case []byte:
+		data = v
+	default:
+		return fmt.Errorf("cannot scan %T into user.Attributes", v)
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	m := Attributes{}
+	if err := dec.Decode(&m); err != nil {
+		return fmt.Errorf("decode attributes: %w", err)
+	}
+
+	*a = m
+	return nil
+}
+
+func (a Attributes) Value() (driver.Value, error) {
+	if a == nil {
+		return "{}", nil
+	}
+
+	data, err := json.Marshal(map[string]any(a))
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// -----------------------------------------------------------------------------
+// Typed accessors
+// -----------------------------------------------------------------------------
+
+// String returns the attribute as string (false if missing or not a string).
+func (a Attributes) String(key string) (string, bool) {
+	s, ok := a[key].(string)
+	return s, ok
+}
+
+// Int returns the attribute as integer.
+func (a Attributes) Int(key string) (int64, bool) {
+	switch v := a[key].(type) {
+	case json.Number:
+		i, err := v.Int64()
+		return i, err == nil
+	case int:
+		return int64(v), true
+	case int64:
+		return v, true
+	case float64:
+		return int64(v), v == float64(int64(v))
+	}
+	return 0, false
+}
+
+// Float returns the attribute as float.
+func (a Attributes) Float(key string) (float64, bool) {
+	switch v := a[key].(type) {
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
+
+// Bool returns the attribute as bool.
+func (a Attributes) Bool(key string) (bool, bool) {
+	b, ok := a[key].(bool)
+	return b, ok
+}
+
+// Time returns an RFC 3339 string attribute as time.
+func (a Attributes) Time(key string) (time.Time, bool) {
+	s, ok := a.String(key)
+	if !ok {
+		return time.Time{}, false
+	}
+
+	t, err := time.Parse(time.RFC3339, s)
+	return t, err == nil
+}
+
+// Set stores v under key (time.Time is stored as RFC 3339 string).
+func (a Attributes) Set(key string, v any) {
+	if t, ok := v.(time.Time); ok {
+		v = t.Format(time.RFC3339)
+	}
+	a[key] = v
+}
+
+// Clone returns a copy that can be modified independently (shallow per value).
+func (a Attributes) Clone() Attributes {
+	c := make(Attributes, len(a))
+	for k, v := range a {
+		c[k] = v
+	}
+	return c
+}
@@ -0,0 +1,26 @@
+package user
+
+import (
+	"errors"
+	"net/mail"
+	"strings"
+)
+
+var ErrInvalidEmail = errors.New("ungültige E-Mail-Adresse")
+
+// NormalizeEmail validates a bare address ("alice@example.com", no display
+// name) and returns it in lower case, the form stored in users.email.
+// The empty string (no email) is returned unchanged.
+func NormalizeEmail(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return "", nil
+	}
+
+	addr, err := mail.ParseAddress(s)
+	if err != nil || addr.Address != s || addr.Name != "" {
+		return "", ErrInvalidEmail
+	}
+
+	return strings.ToLower(addr.Address), nil
+}
@@ -5,4 +5,29 @@ import "errors"
 var (
 	ErrNotFound      = errors.New("Benutzer nicht gefunden")
 	ErrAlreadyExists = errors.New("Benutzer existiert bereits")
+
+	// Zugang verweigert (siehe User.CheckAccess)
+	ErrDisabled = errors.New("Benutzer ist deaktiviert")
+	ErrLocked   = errors.New("Benutzer ist vorübergehend gesperrt")
+	ErrExpired  = errors.New("Zugang ist abgelaufen")
+
+	// Passwörter (siehe PasswordPolicy, Store.PasswordHash)
+	ErrNoPassword    = errors.New("Kein Passwort gesetzt")
+	ErrWrongPassword = errors.New("Passwort ist falsch")
+	ErrWeakPassword  = errors.New("Passwort ist zu schwach")
+
+	// Zwei-Faktor-Authentifizierung (siehe TOTP)
+	ErrNoTOTP      = errors.New("Zwei-Faktor-Authentifizierung ist nicht eingerichtet")
+	ErrInvalidCode = errors.New("Code ist ungültig")
+
+	// Passkeys (siehe Passkey)
+	ErrPasskeyNotFound = errors.New("Passkey nicht gefunden")
+	ErrPasskeyExists   = errors.New("Passkey ist bereits registriert")
+
+	// Externe Konten (siehe Identity)
+	ErrIdentityNotFound = errors.New("Verknüpftes Konto nicht gefunden")
+	ErrIdentityExists   = errors.New("Konto ist bereits verknüpft")
+
+	// Login-Links (siehe Store.UseLoginToken)
+	ErrTokenUsed = errors.New("Link wurde bereits verwendet")
 )
@@ -0,0 +1,74 @@
+package user
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	"github.com/axelrhd/litetime"
+)
+
+// Identity links a user to an account at an external identity provider
+// (OpenID Connect, see package auth). Issuer and Subject identify the
+// account; the pair is unique.
+type Identity struct {
+	ID      int64  `db:"id"`
+	UserID  int64  `db:"user_id"`
+	Issuer  string `db:"issuer"`
+	Subject string `db:"subject"`
+
+	// Roles are the Casbin roles mapped from the provider's groups at the
+	// last login (see config OIDC_ROLE_MAP).
+	Roles RoleList `db:"roles"`
+
+	CreatedAt   litetime.Time `db:"created_at"`
+	LastLoginAt NullTime      `db:"last_login_at"`
+}
+
+// RoleList is a sorted set of role names (user_identities.roles, JSON array).
+type RoleList []string
+
+// NewRoleList returns the roles sorted and without duplicates or empty names.
+func NewRoleList(roles ...string) RoleList {
+	list := RoleList{}
+	for _, r := range roles {
+		if r != "" {
+			list = append(list, r)
+		}
+	}
+	slices.Sort(list)
+	return slices.Compact(list)
+}
+
+func (r *RoleList) Scan(v any) error {
+	var data []byte
+
+	switch v := v.(type) {
+	case nil:
+		*r = RoleList{}
+		return nil
+	case string:
+		data = []byte(v)
+	case []byte:
+		data = v
+	default:
+		return fmt.Errorf("cannot scan %T into user.RoleList", v)
+	}
+
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return fmt.Errorf("decode roles: %w", err)
+	}
+
+	*r = NewRoleList(list...)
+	return nil
+}
+
+func (r RoleList) Value() (driver.Value, error) {
+	data, err := json.Marshal(NewRoleList(r...))
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
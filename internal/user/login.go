@@ -0,0 +1,19 @@
+package user
+
+import "github.com/axelrhd/litetime"
+
+// DefaultLoginEvents is the number of login events shown per user.
+const DefaultLoginEvents = 10
+
+// LoginEvent is one login attempt (see Store.RecordLogin).
+// Failed attempts with an unknown UID have UserID 0; the UID itself is
+// never recorded.
+type LoginEvent struct {
+	ID        int64         `db:"id"`
+	UserID    int64         `db:"user_id"`
+	Success   bool          `db:"success"`
+	Reason    string        `db:"reason"` // error message of a failed attempt
+	IP        string        `db:"ip"`
+	UserAgent string        `db:"user_agent"`
+	CreatedAt litetime.Time `db:"created_at"`
+}
@@ -2,18 +2,29 @@ package user
 
 import (
 	"fmt"
+	"strconv"
+	"strings"
 
 	"github.com/axelrhd/litetime"
 )
 
 type User struct {
-	ID          int64         `db:"id"`
-	UID         string        `db:"uid"`          // login secret (never shown, never used for authz)
-	DisplayName string        `db:"display_name"` // stable, human-readable identifier (Casbin subject)
-	FirstName   string        `db:"first_name"`
-	LastName    string        `db:"last_name"`
-	CreatedAt   litetime.Time `db:"created_at"`
-	UpdatedAt   litetime.Time `db:"updated_at"`
+	ID             int64         `db:"id"`
+	UIDHash        string        `db:"uid_hash"`     // HMAC of the login secret (see UIDHasher)
+	DisplayName    string        `db:"display_name"` // unique, human-readable name (may change, see Subject)
+	FirstName      string        `db:"first_name"`
+	LastName       string        `db:"last_name"`
+	Email          string        `db:"email"` // optional, unique, lower case ("" = none)
+	EmailVerified  NullTime      `db:"email_verified_at"`
+	Attributes     Attributes    `db:"attributes"`      // app-specific profile data
+	SessionVersion int64         `db:"session_version"` // stored in the session at login; incremented to end all sessions
+	Status         Status        `db:"status"`
+	LockedUntil    NullTime      `db:"locked_until"`  // temporary lock (e.g. too many failed logins)
+	ValidUntil     NullTime      `db:"valid_until"`   // access expires at this time
+	LastLoginAt    NullTime      `db:"last_login_at"` // last successful login
+	LoginCount     int64         `db:"login_count"`
+	CreatedAt      litetime.Time `db:"created_at"`
+	UpdatedAt      litetime.Time `db:"updated_at"`
 }
 
 // -----------------------------------------------------------------------------
@@ -37,13 +48,33 @@ func (u User) FullName() string {
 	return u.LastName + ", " + u.FirstName
 }
 
+// HasVerifiedEmail reports whether the user confirmed its current email.
+func (u User) HasVerifiedEmail() bool {
+	return u.Email != "" && u.EmailVerified.Valid
+}
+
 // -----------------------------------------------------------------------------
 // Authorization helpers
 // -----------------------------------------------------------------------------
 
-// Subject returns the Casbin subject identifier for this user.
+// SubjectPrefix marks user subjects in the Casbin policy ("user:42").
+const SubjectPrefix = "user:"
+
+// Subject returns the Casbin subject identifier for this user ("user:<id>").
+// Unlike the display name it never changes: renamed users keep their roles,
+// and a new user taking an old name does not inherit them.
 func (u User) Subject() string {
-	return u.DisplayName
+	return SubjectPrefix + strconv.FormatInt(u.ID, 10)
+}
+
+// SubjectID returns the user ID of a subject built by User.Subject.
+func SubjectID(subject string) (int64, bool) {
+	s, ok := strings.CutPrefix(subject, SubjectPrefix)
+	if !ok {
+		return 0, false
+	}
+	id, err := strconv.ParseInt(s, 10, 64)
+	return id, err == nil && id > 0
 }
 
 // -----------------------------------------------------------------------------
@@ -52,9 +83,8 @@ func (u User) Subject() string {
 
 func (u User) String() string {
 	return fmt.Sprintf(
-		"User(id=%d uid='%s' display_name='%s' first_name='%s' last_name='%s' created_at='%s' updated_at='%s')",
+		"User(id=%d display_name='%s' first_name='%s' last_name='%s' created_at='%s' updated_at='%s')",
 		u.ID,
-		u.UID,
 		u.DisplayName,
 		u.FirstName,
 		u.LastName,
@@ -65,9 +95,8 @@ func (u User) String() string {
 
 func (u User) GoString() string {
 	return fmt.Sprintf(
-		"User{id=%d uid=%q display_name=%q first_name=%q last_name=%q created_at=%q updated_at=%q}",
+		"User{id=%d display_name=%q first_name=%q last_name=%q created_at=%q updated_at=%q}",
 		u.ID,
-		u.UID,
 		u.DisplayName,
 		u.FirstName,
 		u.LastName,
@@ -0,0 +1,60 @@
+package user
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"time"
+)
+
+// NullTime is an optional point in time, stored like all timestamps of this
+// app: as local time text "2006-01-02 15:04:05" (datetime('now', 'localtime')).
+type NullTime struct {
+	Time  time.Time
+	Valid bool
+}
+
+// At returns a valid NullTime for t (truncated to seconds).
+func At(t time.Time) NullTime {
+	return NullTime{Time: t.Truncate(time.Second), Valid: true}
+}
+
+func (t *NullTime) Scan(v any) error {
+	switch v := v.(type) {
+	case nil:
+		*t = NullTime{}
+		return nil
+	case time.Time:
+		*t = NullTime{Time: v, Valid: true}
+		return nil
+	case []byte:
+		return t.parse(string(v))
+	case string:
+		return t.parse(v)
+	}
+
+	return fmt.Errorf("cannot scan %T into user.NullTime", v)
+}
+
+func (t *NullTime) parse(s string) error {
+	parsed, err := time.ParseInLocation(time.DateTime, s, time.Local)
+	if err != nil {
+		return err
+	}
+
+	*t = NullTime{Time: parsed, Valid: true}
+	return nil
+}
+
+func (t NullTime) Value() (driver.Value, error) {
+	if !t.Valid {
+		return nil, nil
+	}
+	return t.Time.In(time.Local).Format(time.DateTime), nil
+}
+
+func (t NullTime) String() string {
+	if !t.Valid {
+		return ""
+	}
+	return t.Time.Format(time.DateTime)
+}
@@ -0,0 +1,22 @@
+package user
+
+import "github.com/axelrhd/litetime"
+
+// Passkey is a WebAuthn credential of a user (see package auth). The
+// credential record is stored as opaque JSON, only package auth reads it.
+type Passkey struct {
+	ID           int64  `db:"id"`
+	UserID       int64  `db:"user_id"`
+	CredentialID string `db:"credential_id"` // base64url without padding, unique
+	Name         string `db:"name"`          // chosen by the user, e.g. "Laptop"
+
+	// Credential is the webauthn.Credential as JSON: public key, sign
+	// counter, flags. Updated after every login.
+	Credential string `db:"credential"`
+
+	CreatedAt  litetime.Time `db:"created_at"`
+	LastUsedAt NullTime      `db:"last_used_at"`
+}
+
+// MaxPasskeyNameLength limits Passkey.Name (characters).
+const MaxPasskeyNameLength = 64
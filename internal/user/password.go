@@ -0,0 +1,215 @@
+package user
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// -----------------------------------------------------------------------------
+// Hashing
+// -----------------------------------------------------------------------------
+
+// argon2idParams are the cost parameters of new hashes (RFC 9106, second
+// recommended option with 2 lanes). Existing hashes keep their own
+// parameters, they are part of the encoded string.
+var argon2idParams = struct {
+	memory  uint32 // KiB
+	time    uint32
+	threads uint8
+	keyLen  uint32
+	saltLen int
+}{
+	memory:  64 * 1024,
+	time:    3,
+	threads: 2,
+	keyLen:  32,
+	saltLen: 16,
+}
+
+var b64 = base64.RawStdEncoding
+
+// HashPassword returns an argon2id hash of password in PHC string format:
+//
+//	$argon2id$v=19$m=65536,t=3,p=2$<salt>$<hash>
+func HashPassword(password string) (string, error) {
+	p := argon2idParams
+
+	salt := make([]byte, p.saltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, p.time, p.memory, p.threads, p.keyLen)
+
+	return fmt.Sprintf(
+		"$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, p.memory, p.time, p.threads,
+		b64.EncodeToString(salt), b64.EncodeToString(key),
+	), nil
+}
+
+// CheckPassword reports whether password matches a hash created by
+// HashPassword. An error means the stored hash is malformed.
+func CheckPassword(encoded, password string) (bool, error) {
+	h, err := parseHash(encoded)
+	if err != nil {
+		return false, err
+	}
+
+	got := argon2.IDKey([]byte(password), h.salt, h.time, h.memory, h.threads, uint32(len(h.key)))
+
+	return subtle.ConstantTimeCompare(got, h.key) == 1, nil
+}
+
+// PasswordNeedsRehash reports whether encoded was created with other cost
+// parameters than new hashes get. After a successful login the password
+// is hashed again, so raised parameters reach existing users.
+func PasswordNeedsRehash(encoded string) bool {
+	h, err := parseHash(encoded)
+	if err != nil {
+		return true
+	}
+
+	p := argon2idParams
+	return h.memory != p.memory || h.time != p.time || h.threads != p.threads ||
+		len(h.key) != int(p.keyLen) || len(h.salt) != p.saltLen
+}
+
+// argon2idHash is a decoded hash of HashPassword.
+type argon2idHash struct {
+	memory, time uint32
+	threads      uint8
+	salt, key    []byte
+}
+
+func parseHash(encoded string) (*argon2idHash, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[0] != "" || parts[1] != "argon2id" {
+		return nil, errors.New("password hash: unsupported format")
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return nil, fmt.Errorf("password hash: unsupported version %q", parts[2])
+	}
+
+	var h argon2idHash
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &h.memory, &h.time, &h.threads); err != nil {
+		return nil, fmt.Errorf("password hash: parameters: %w", err)
+	}
+
+	var err error
+	if h.salt, err = b64.DecodeString(parts[4]); err != nil {
+		return nil, fmt.Errorf("password hash: salt: %w", err)
+	}
+	if h.key, err = b64.DecodeString(parts[5]); err != nil {
+		return nil, fmt.Errorf("password hash: key: %w", err)
+	}
+
+	return &h, nil
+}
+
+// dummyHash is checked when there is no user or no password, so a failed
+// login takes as long as a wrong password (no user enumeration by timing).
+// Created on first use: hashing costs 64 MiB and every CLI start would pay.
+var dummyHash = sync.OnceValue(func() string {
+	h, _ := HashPassword("hagg-dummy-password")
+	return h
+})
+
+// CheckDummyPassword spends the time of one CheckPassword call.
+func CheckDummyPassword(password string) {
+	_, _ = CheckPassword(dummyHash(), password)
+}
+
+// -----------------------------------------------------------------------------
+// Policy
+// -----------------------------------------------------------------------------
+
+// MaxPasswordLength limits the input of the (deliberately slow) hash.
+const MaxPasswordLength = 256
+
+// commonPasswords are rejected regardless of length (lower case).
+var commonPasswords = []string{
+	"123456789012", "1234567890123", "12345678901234",
+	"password1234", "passwort1234", "password123!", "passwort123!",
+	"qwertyuiop12", "qwertzuiop12", "qwertyuiopas", "qwertzuiopas",
+	"iloveyou1234", "letmein12345", "welcome12345", "willkommen12",
+	"hallohallo12", "sommer2024!!", "sommer2025!!", "changeme1234",
+	"administrator", "adminadmin12",
+}
+
+// PasswordPolicy describes which passwords are accepted.
+type PasswordPolicy struct {
+	MinLength  int // characters, not bytes
+	MinClasses int // of lower case, upper case, digits, other
+}
+
+// Check validates password for u (u may be nil for a new user). All
+// errors wrap ErrWeakPassword and are meant to be shown to the user.
+func (p PasswordPolicy) Check(password string, u *User) error {
+	n := utf8.RuneCountInString(password)
+
+	switch {
+	case n < p.MinLength:
+		return fmt.Errorf("%w: mindestens %d Zeichen", ErrWeakPassword, p.MinLength)
+	case n > MaxPasswordLength:
+		return fmt.Errorf("%w: höchstens %d Zeichen", ErrWeakPassword, MaxPasswordLength)
+	}
+
+	if c := charClasses(password); c < p.MinClasses {
+		return fmt.Errorf(
+			"%w: mindestens %d Zeichenarten (Klein-, Großbuchstaben, Ziffern, Sonderzeichen)",
+			ErrWeakPassword, p.MinClasses,
+		)
+	}
+
+	lower := strings.ToLower(password)
+
+	for _, common := range commonPasswords {
+		if lower == common {
+			return fmt.Errorf("%w: zu häufig verwendet", ErrWeakPassword)
+		}
+	}
+	if first, _ := utf8.DecodeRuneInString(lower); lower != "" && strings.Count(lower, string(first)) == utf8.RuneCountInString(lower) {
+		return fmt.Errorf("%w: nur ein Zeichen wiederholt", ErrWeakPassword)
+	}
+
+	if u != nil {
+		local, _, _ := strings.Cut(u.Email, "@")
+		for _, name := range []string{u.DisplayName, u.FirstName, u.LastName, local} {
+			if utf8.RuneCountInString(name) >= 3 && strings.Contains(lower, strings.ToLower(name)) {
+				return fmt.Errorf("%w: darf den Namen nicht enthalten", ErrWeakPassword)
+			}
+		}
+	}
+
+	return nil
+}
+
+// charClasses counts the character classes used in s.
+func charClasses(s string) int {
+	var lower, upper, digit, other int
+	for _, r := range s {
+		switch {
+		case unicode.IsLower(r):
+			lower = 1
+		case unicode.IsUpper(r):
+			upper = 1
+		case unicode.IsDigit(r):
+			digit = 1
+		default:
+			other = 1
+		}
+	}
+	return lower + upper + digit + other
+}
@@ -0,0 +1,162 @@
+package user
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestPasswordPolicy(t *testing.T) {
+	policy := PasswordPolicy{MinLength: 12, MinClasses: 3}
+	alice := &User{DisplayName: "alice", FirstName: "Alice", LastName: "Wunderland", Email: "a.w@example.com"}
+
+	tests := []struct {
+		name     string
+		password string
+		u        *User
+		ok       bool
+	}{
+		{"valid", "Correct-Horse-7", nil, true},
+		{"too short", "Sh0rt-Pass", nil, false},
+		{"length counts characters, not bytes", "Ää1-Ää1-Ää1-", nil, true},
+		{"too long", strings.Repeat("Aa1-", MaxPasswordLength/4+1), nil, false},
+		{"at max length", strings.Repeat("Aa1-", MaxPasswordLength/4), nil, true},
+		{"too few classes", "correcthorse7", nil, false},
+		{"common password, any case", "PASSWORD123!", &User{}, false},
+		{"one character repeated", "AAAAAAAAAAAAAAA", nil, false},
+		{"contains display name", "xx-Alice-2024!", alice, false},
+		{"contains last name", "wunderland-Go1", alice, false},
+		{"contains email local part", "Secret-a.w-2024", alice, false},
+		{"short names are ignored", "Correct-Horse-7", &User{DisplayName: "or"}, true},
+		{"names only checked with a user", "xx-Alice-2024!", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := policy.Check(tt.password, tt.u)
+			if tt.ok && err != nil {
+				t.Errorf("Check(%q) = %v, want ok", tt.password, err)
+			}
+			if !tt.ok && !errors.Is(err, ErrWeakPassword) {
+				t.Errorf("Check(%q) = %v, want ErrWeakPassword", tt.password, err)
+			}
+		})
+	}
+}
+
+func TestCharClasses(t *testing.T) {
+	tests := []struct {
+		s    string
+		want int
+	}{
+		{"", 0},
+		{"abc", 1},
+		{"abcDEF", 2},
+		{"abcDEF123", 3},
+		{"abcDEF123-", 4},
+		{"äÖ", 2},
+		{"   ", 1},
+	}
+
+	for _, tt := range tests {
+		if got := charClasses(tt.s); got != tt.want {
+			t.Errorf("charClasses(%q) = %d, want %d", tt.s, got, tt.want)
+		}
+	}
+}
+
+// cheapParams makes hashing fast for the test and restores the real
+// parameters afterwards.
+func cheapParams(t *testing.T, memory, time uint32) {
+	t.Helper()
+
+	saved := argon2idParams
+	t.Cleanup(func() { argon2idParams = saved })
+
+	argon2idParams.memory = memory
+	argon2idParams.time = time
+	argon2idParams.threads = 1
+}
+
+func TestHashPassword(t *testing.T) {
+	cheapParams(t, 1024, 1)
+
+	hash, err := HashPassword("Correct-Horse-7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=1024,t=1,p=1$") {
+		t.Errorf("hash = %q, want PHC format with the current parameters", hash)
+	}
+
+	for password, want := range map[string]bool{
+		"Correct-Horse-7":  true,
+		"correct-horse-7":  false,
+		"Correct-Horse-7 ": false,
+		"":                 false,
+	} {
+		ok, err := CheckPassword(hash, password)
+		if err != nil || ok != want {
+			t.Errorf("CheckPassword(%q) = %t, %v; want %t", password, ok, err, want)
+		}
+	}
+
+	again, _ := HashPassword("Correct-Horse-7")
+	if again == hash {
+		t.Error("two hashes of the same password are equal (salt missing)")
+	}
+}
+
+func TestCheckPasswordMalformed(t *testing.T) {
+	for _, hash := range []string{
+		"",
+		"plaintext",
+		"$2a$10$abcdefghijklmnopqrstuv", // bcrypt
+		"$argon2i$v=19$m=1024,t=1,p=1$c2FsdA$a2V5",        // not argon2id
+		"$argon2id$v=16$m=1024,t=1,p=1$c2FsdA$a2V5",       // old version
+		"$argon2id$v=19$m=1024,p=1$c2FsdA$a2V5",           // parameter missing
+		"$argon2id$v=19$m=1024,t=1,p=1$!!!$a2V5",          // salt not base64
+		"$argon2id$v=19$m=1024,t=1,p=1$c2FsdA$a2V5$extra", // too many parts
+	} {
+		if ok, err := CheckPassword(hash, "x"); ok || err == nil {
+			t.Errorf("CheckPassword(%q) = %t, %v; want an error", hash, ok, err)
+		}
+		if !PasswordNeedsRehash(hash) {
+			t.Errorf("PasswordNeedsRehash(%q) = false, want true", hash)
+		}
+	}
+}
+
+func TestPasswordParameterUpgrade(t *testing.T) {
+	cheapParams(t, 1024, 1)
+
+	old, err := HashPassword("Correct-Horse-7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if PasswordNeedsRehash(old) {
+		t.Fatal("fresh hash needs a rehash")
+	}
+
+	// raised parameters: old hashes keep working but are upgraded
+	argon2idParams.memory = 2048
+	argon2idParams.time = 2
+
+	if ok, err := CheckPassword(old, "Correct-Horse-7"); !ok || err != nil {
+		t.Fatalf("old hash after raising the parameters = %t, %v", ok, err)
+	}
+	if !PasswordNeedsRehash(old) {
+		t.Fatal("old hash does not need a rehash")
+	}
+
+	upgraded, err := HashPassword("Correct-Horse-7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(upgraded, "$m=2048,t=2,p=1$") || PasswordNeedsRehash(upgraded) {
+		t.Errorf("upgraded hash = %q", upgraded)
+	}
+	if ok, _ := CheckPassword(upgraded, "Correct-Horse-7"); !ok {
+		t.Error("upgraded hash does not verify")
+	}
+}
@@ -0,0 +1,95 @@
+package user
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// SortField is a column users can be sorted by.
+type SortField string
+
+const (
+	SortID          SortField = "id"
+	SortDisplayName SortField = "display_name"
+	SortFirstName   SortField = "first_name"
+	SortLastName    SortField = "last_name"
+	SortCreatedAt   SortField = "created_at"
+	SortUpdatedAt   SortField = "updated_at"
+)
+
+// SortFields lists all valid sort fields (whitelist for SQL ORDER BY).
+var SortFields = []SortField{
+	SortID,
+	SortDisplayName,
+	SortFirstName,
+	SortLastName,
+	SortCreatedAt,
+	SortUpdatedAt,
+}
+
+const (
+	DefaultListLimit = 50
+	MaxListLimit     = 1000
+)
+
+// ListQuery describes one page of a filtered, sorted user listing.
+type ListQuery struct {
+	Search string    // substring of display, first or last name (case-insensitive)
+	Sort   SortField // default: SortID
+	Desc   bool
+	Limit  int // default: DefaultListLimit, capped at MaxListLimit
+	Offset int
+
+	// InactiveSince keeps users without a successful login since then.
+	// Users who never logged in count from their creation. Zero: no filter.
+	InactiveSince time.Time
+}
+
+// ListResult is one page of users plus the number of all matching users.
+type ListResult struct {
+	Users []*User
+	Total int64
+}
+
+// ParseSort parses "field" or "-field" (descending).
+func ParseSort(s string) (SortField, bool, error) {
+	desc := strings.HasPrefix(s, "-")
+	field := SortField(strings.TrimPrefix(s, "-"))
+
+	for _, f := range SortFields {
+		if f == field {
+			return field, desc, nil
+		}
+	}
+
+	return "", false, fmt.Errorf("unknown sort field %q", field)
+}
+
+// Normalize applies defaults and limits. Stores call it before building
+// their query, so callers may pass a zero ListQuery.
+func (q ListQuery) Normalize() (ListQuery, error) {
+	q.Search = strings.TrimSpace(q.Search)
+
+	if q.Sort == "" {
+		q.Sort = SortID
+	}
+	if _, _, err := ParseSort(string(q.Sort)); err != nil {
+		return q, err
+	}
+
+	if q.Limit <= 0 {
+		q.Limit = DefaultListLimit
+	}
+	q.Limit = min(q.Limit, MaxListLimit)
+	q.Offset = max(q.Offset, 0)
+
+	return q, nil
+}
+
+// LikePattern returns the search term as a LIKE pattern with
+// the wildcards % and _ escaped (ESCAPE '\').
+func (q ListQuery) LikePattern() string {
+	r := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return "%" + r.Replace(q.Search) + "%"
+}
@@ -0,0 +1,15 @@
+package user
+
+import "github.com/axelrhd/litetime"
+
+// Session is a logged-in session of a user (see Store.AddSession). It
+// indexes the session store, so all sessions of a user can be listed and
+// ended. Token is the session store key and as secret as the cookie.
+type Session struct {
+	ID        int64         `db:"id"`
+	UserID    int64         `db:"user_id"`
+	Token     string        `db:"token"`
+	IP        string        `db:"ip"`
+	UserAgent string        `db:"user_agent"`
+	CreatedAt litetime.Time `db:"created_at"` // login time
+}
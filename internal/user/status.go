@@ -0,0 +1,42 @@
+package user
+
+import "time"
+
+type Status string
+
+const (
+	StatusActive   Status = "active"
+	StatusDisabled Status = "disabled"
+)
+
+// CheckAccess reports why u may not log in or use a session at now
+// (nil = access granted).
+func (u User) CheckAccess(now time.Time) error {
+	switch {
+	case u.Status == StatusDisabled:
+		return ErrDisabled
+	case u.ValidUntil.Valid && !now.Before(u.ValidUntil.Time):
+		return ErrExpired
+	case u.LockedUntil.Valid && now.Before(u.LockedUntil.Time):
+		return ErrLocked
+	}
+
+	return nil
+}
+
+// StatusLabel describes the effective status at now, e.g. for listings.
+func (u User) StatusLabel(now time.Time) string {
+	switch u.CheckAccess(now) {
+	case ErrDisabled:
+		return "disabled"
+	case ErrExpired:
+		return "expired"
+	case ErrLocked:
+		return "locked until " + u.LockedUntil.String()
+	}
+
+	if u.ValidUntil.Valid {
+		return "active until " + u.ValidUntil.String()
+	}
+	return "active"
+}
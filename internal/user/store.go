@@ -1,10 +1,185 @@
 package user
 
-import "context"
+import (
+	"context"
+	"time"
+)
 
 type Store interface {
+	FindByID(ctx context.Context, id int64) (*User, error)
 	FindByUID(ctx context.Context, uid string) (*User, error)
 	FindByDisplayName(ctx context.Context, displayName string) (*User, error)
-	CreateUser(ctx context.Context, uid, displayName string) (*User, error)
+	FindByEmail(ctx context.Context, email string) (*User, error) // email as returned by NormalizeEmail
+	CreateUser(ctx context.Context, in CreateUserInput) (*User, error)
+	UpdateUser(ctx context.Context, id int64, in UpdateUserInput) (*User, error)
 	ListUsers(ctx context.Context) ([]*User, error)
+
+	// QueryUsers returns one page of users matching q (see ListQuery).
+	QueryUsers(ctx context.Context, q ListQuery) (*ListResult, error)
+
+	// RotateUID replaces the login UID and ends all sessions of the user
+	// (increments SessionVersion).
+	RotateUID(ctx context.Context, id int64, uid string) (*User, error)
+
+	// RevokeSessions ends all sessions of the user (increments SessionVersion).
+	RevokeSessions(ctx context.Context, id int64) (*User, error)
+
+	// SetPassword stores the password hash of a user (see HashPassword),
+	// "" removes the password. Sessions are not touched.
+	SetPassword(ctx context.Context, id int64, hash string) error
+
+	// PasswordHash returns the password hash of a user, ErrNoPassword if
+	// none is set (or the user does not exist).
+	PasswordHash(ctx context.Context, id int64) (string, error)
+
+	// TOTP returns the authenticator app enrolment of a user, ErrNoTOTP if
+	// there is none.
+	TOTP(ctx context.Context, id int64) (*TOTP, error)
+
+	// SetTOTP starts a new, unconfirmed enrolment with secret. A previous
+	// enrolment and its recovery codes are replaced.
+	SetTOTP(ctx context.Context, id int64, secret string) error
+
+	// UseTOTPStep accepts a code of time step: it confirms the enrolment
+	// and remembers step. ErrInvalidCode if step is not newer than the last
+	// accepted one (replay) or there is no enrolment.
+	UseTOTPStep(ctx context.Context, id int64, step int64) error
+
+	// DeleteTOTP removes the enrolment and all recovery codes of a user.
+	DeleteTOTP(ctx context.Context, id int64) error
+
+	// SetRecoveryCodes replaces the recovery codes of a user (as returned by
+	// GenerateRecoveryCodes). Only keyed hashes are stored, like UIDs.
+	SetRecoveryCodes(ctx context.Context, id int64, codes []string) error
+
+	// UseRecoveryCode marks an unused code (see NormalizeRecoveryCode) as
+	// used, ErrInvalidCode if there is none.
+	UseRecoveryCode(ctx context.Context, id int64, code string) error
+
+	// Passkeys returns the passkeys of a user, oldest first.
+	Passkeys(ctx context.Context, userID int64) ([]*Passkey, error)
+
+	// PasskeyByCredentialID returns the passkey with the WebAuthn credential
+	// ID (base64url) of a live user, ErrPasskeyNotFound if there is none.
+	PasskeyByCredentialID(ctx context.Context, credentialID string) (*Passkey, error)
+
+	// AddPasskey stores a new passkey of p.UserID and returns it with ID and
+	// CreatedAt. ErrPasskeyExists if the credential is already registered.
+	AddPasskey(ctx context.Context, p Passkey) (*Passkey, error)
+
+	// UsePasskey stores the credential record after a login (sign counter,
+	// flags) and sets LastUsedAt.
+	UsePasskey(ctx context.Context, id int64, credential string) error
+
+	// DeletePasskey removes passkey id of user userID, ErrPasskeyNotFound
+	// if the user has no such passkey.
+	DeletePasskey(ctx context.Context, userID, id int64) error
+
+	// Identity returns the external account issuer/subject of a live user,
+	// ErrIdentityNotFound if there is none.
+	Identity(ctx context.Context, issuer, subject string) (*Identity, error)
+
+	// Identities returns the external accounts of a user, oldest first.
+	Identities(ctx context.Context, userID int64) ([]*Identity, error)
+
+	// ListIdentities returns the external accounts of all live users.
+	ListIdentities(ctx context.Context) ([]*Identity, error)
+
+	// LinkIdentity links an external account to id.UserID and returns it
+	// with ID and CreatedAt. ErrIdentityExists if the account is linked to
+	// another live user; a link of a deleted user is replaced.
+	LinkIdentity(ctx context.Context, id Identity) (*Identity, error)
+
+	// UseIdentity stores the mapped roles after a login and sets
+	// LastLoginAt.
+	UseIdentity(ctx context.Context, id int64, roles RoleList) error
+
+	// UseLoginToken marks the nonce of a single-use login link of a live
+	// user as used, ErrTokenUsed if it was used before. It is remembered
+	// until expires (the end of the link's validity); expired
+	// nonces are removed on the way.
+	UseLoginToken(ctx context.Context, userID int64, nonce string, expires time.Time) error
+
+	// AddSession records a logged-in session of s.UserID until expires
+	// (the lifetime of the session store entry). Expired records are
+	// removed on the way. ErrNotFound if the user does not exist.
+	AddSession(ctx context.Context, s Session, expires time.Time) error
+
+	// Sessions returns the unexpired sessions of a user, newest first.
+	Sessions(ctx context.Context, userID int64) ([]*Session, error)
+
+	// RenewSession replaces the token and expiry of a recorded session
+	// after the session store issued a new token.
+	RenewSession(ctx context.Context, token, newToken string, expires time.Time) error
+
+	// RemoveSession forgets the session with token (logout).
+	RemoveSession(ctx context.Context, token string) error
+
+	// RemoveSessions forgets all sessions of a user and returns their
+	// tokens, so the caller can delete them from the session store.
+	RemoveSessions(ctx context.Context, userID int64) ([]string, error)
+
+	// RecordLogin stores a login attempt. A successful one also updates
+	// LastLoginAt and LoginCount of the user.
+	RecordLogin(ctx context.Context, ev LoginEvent) error
+
+	// LoginEvents returns the latest login attempts of a user, newest first.
+	LoginEvents(ctx context.Context, userID int64, limit int) ([]*LoginEvent, error)
+
+	// PruneLoginEvents deletes login attempts recorded before before and
+	// returns their number (AUTH_LOGIN_EVENT_RETENTION_DAYS).
+	PruneLoginEvents(ctx context.Context, before time.Time) (int64, error)
+
+	// DeleteUser soft-deletes a user (sets deleted_at). Deleted users are
+	// invisible to all other methods; their UID and display name become
+	// available again.
+	DeleteUser(ctx context.Context, id int64) error
+
+	// CountLegacyUIDs returns the number of rows (soft-deleted ones
+	// included) that still hold a plaintext UID (see HashLegacyUIDs).
+	CountLegacyUIDs(ctx context.Context) (int64, error)
+
+	// HashLegacyUIDs replaces plaintext UIDs left over from before UID
+	// hashing (migration 00004) with their hash and returns the number of
+	// converted rows. It is idempotent; serve runs it at startup when
+	// CountLegacyUIDs finds any (or: hagg db migrate-uids).
+	HashLegacyUIDs(ctx context.Context) (int64, error)
+
+	// PurgeUsers hard-deletes all users, soft-deleted ones included, and
+	// returns their IDs (to remove their policy subjects – the IDs may be
+	// reused). Only meant for development databases (hagg db seed --reset).
+	PurgeUsers(ctx context.Context) ([]int64, error)
+}
+
+// CreateUserInput holds all fields of a new user.
+type CreateUserInput struct {
+	UID         string
+	DisplayName string
+	FirstName   string
+	LastName    string
+	Email       string     // optional, normalized (see NormalizeEmail)
+	Attributes  Attributes // optional
+}
+
+// UpdateUserInput holds the fields to change. nil fields stay untouched;
+// a NullTime with Valid=false clears the timestamp.
+//
+// Changing Email resets the verification unless EmailVerified is set too.
+type UpdateUserInput struct {
+	DisplayName   *string
+	FirstName     *string
+	LastName      *string
+	Email         *string // normalized (see NormalizeEmail), "" removes the email
+	EmailVerified *NullTime
+	Attributes    *Attributes // replaces all attributes
+	Status        *Status
+	LockedUntil   *NullTime
+	ValidUntil    *NullTime
+}
+
+// Empty reports whether the update would not change anything.
+func (in UpdateUserInput) Empty() bool {
+	return in.DisplayName == nil && in.FirstName == nil && in.LastName == nil &&
+		in.Email == nil && in.EmailVerified == nil && in.Attributes == nil &&
+		in.Status == nil && in.LockedUntil == nil && in.ValidUntil == nil
 }
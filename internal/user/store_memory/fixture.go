@@ -0,0 +1,75 @@
+package storememory
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/axelrhd/hagg/internal/user"
+)
+
+// Fixture is the JSON format used to seed the in-memory store.
+//
+// Example:
+//
+//	{
+//	  "users": [
+//	    {"uid": "demo-alice", "display_name": "alice", "first_name": "Alice", "roles": ["admin"]}
+//	  ]
+//	}
+type Fixture struct {
+	Users []FixtureUser `json:"users"`
+}
+
+type FixtureUser struct {
+	UID         string   `json:"uid"`
+	DisplayName string   `json:"display_name"`
+	FirstName   string   `json:"first_name"`
+	LastName    string   `json:"last_name"`
+	Roles       []string `json:"roles"` // Casbin roles, assigned in memory only
+}
+
+// LoadFixture reads a JSON fixture file and inserts its users. It returns
+// their roles by Casbin subject (user:<id>): like the users, they live
+// only as long as the process, so they never go into policy.csv.
+func (s *Store) LoadFixture(ctx context.Context, path string) (map[string][]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var f Fixture
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("parse fixture %s: %w", path, err)
+	}
+
+	roles := make(map[string][]string)
+	err = s.Tx(func(tx *Store) error {
+		for i, fu := range f.Users {
+			if fu.UID == "" || fu.DisplayName == "" {
+				return fmt.Errorf("fixture %s: user #%d: uid and display_name are required", path, i+1)
+			}
+
+			u, err := tx.insert(user.User{
+				UIDHash:     tx.uids.Hash(fu.UID),
+				DisplayName: fu.DisplayName,
+				FirstName:   fu.FirstName,
+				LastName:    fu.LastName,
+			})
+			if err != nil {
+				return fmt.Errorf("fixture %s: user %q: %w", path, fu.DisplayName, err)
+			}
+			if len(fu.Roles) > 0 {
+				roles[u.Subject()] = fu.Roles
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return roles, nil
+}
@@ -0,0 +1,1014 @@
+package storememory
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/axelrhd/hagg/internal/user"
+	"github.com/axelrhd/litetime"
+)
+
+// Store is a concurrency-safe, in-memory user.Store for development and tests.
+// All data is lost when the process exits.
+type Store struct {
+	mu      sync.RWMutex
+	users   map[int64]*user.User
+	deleted map[int64]*user.User // soft-deleted users, kept like the SQL rows
+	events  []*user.LoginEvent   // oldest first
+	hashes  map[int64]string     // password hashes by user ID
+	totp    map[int64]*user.TOTP // authenticator enrolments by user ID
+	codes   []*recoveryCode
+	keys    []*user.Passkey      // passkeys, oldest first
+	idents  []*user.Identity     // external accounts, oldest first
+	tokens  map[string]time.Time // used login link nonces → expiry
+	logins  []*session           // logged-in sessions, oldest first
+	nextID  int64
+	nextKey int64  // next passkey ID
+	nextIdt int64  // next identity ID
+	nextSes int64  // next session ID
+	version uint64 // incremented on every write (optimistic tx check)
+	uids    *user.UIDHasher
+}
+
+func New(uids *user.UIDHasher) *Store {
+	return &Store{
+		users:   make(map[int64]*user.User),
+		deleted: make(map[int64]*user.User),
+		hashes:  make(map[int64]string),
+		totp:    make(map[int64]*user.TOTP),
+		tokens:  make(map[string]time.Time),
+		nextID:  1,
+		nextKey: 1,
+		nextIdt: 1,
+		nextSes: 1,
+		uids:    uids,
+	}
+}
+
+// Compile-time interface check
+var _ user.Store = (*Store)(nil)
+
+func (s *Store) CreateUser(ctx context.Context, in user.CreateUserInput) (*user.User, error) {
+	return s.insert(user.User{
+		UIDHash:     s.uids.Hash(in.UID),
+		DisplayName: in.DisplayName,
+		FirstName:   in.FirstName,
+		LastName:    in.LastName,
+		Email:       in.Email,
+		Attributes:  in.Attributes.Clone(),
+	})
+}
+
+func (s *Store) UpdateUser(ctx context.Context, id int64, in user.UpdateUserInput) (*user.User, error) {
+	if in.Empty() {
+		return s.FindByID(ctx, id)
+	}
+
+	return s.modify(id, func(u *user.User) error {
+		if in.DisplayName != nil {
+			for _, existing := range s.users {
+				if existing.ID != id && existing.DisplayName == *in.DisplayName {
+					return user.ErrAlreadyExists
+				}
+			}
+			u.DisplayName = *in.DisplayName
+		}
+		if in.FirstName != nil {
+			u.FirstName = *in.FirstName
+		}
+		if in.LastName != nil {
+			u.LastName = *in.LastName
+		}
+		if in.Email != nil {
+			if *in.Email != "" {
+				for _, existing := range s.users {
+					if existing.ID != id && existing.Email == *in.Email {
+						return user.ErrAlreadyExists
+					}
+				}
+			}
+			// a changed address has to be verified again
+			if *in.Email != u.Email && in.EmailVerified == nil {
+				u.EmailVerified = user.NullTime{}
+			}
+			u.Email = *in.Email
+		}
+		if in.EmailVerified != nil {
+			u.EmailVerified = *in.EmailVerified
+		}
+		if in.Attributes != nil {
+			u.Attributes = in.Attributes.Clone()
+		}
+		if in.Status != nil {
+			u.Status = *in.Status
+		}
+		if in.LockedUntil != nil {
+			u.LockedUntil = *in.LockedUntil
+		}
+		if in.ValidUntil != nil {
+			u.ValidUntil = *in.ValidUntil
+		}
+		return nil
+	})
+}
+
+func (s *Store) RotateUID(ctx context.Context, id int64, uid string) (*user.User, error) {
+	uidHash := s.uids.Hash(uid)
+
+	return s.modify(id, func(u *user.User) error {
+		for _, existing := range s.users {
+			if existing.ID != id && existing.UIDHash == uidHash {
+				return user.ErrAlreadyExists
+			}
+		}
+
+		u.UIDHash = uidHash
+		u.SessionVersion++
+		return nil
+	})
+}
+
+func (s *Store) RevokeSessions(ctx context.Context, id int64) (*user.User, error) {
+	return s.modify(id, func(u *user.User) error {
+		u.SessionVersion++
+		return nil
+	})
+}
+
+func (s *Store) SetPassword(ctx context.Context, id int64, hash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if hash == "" {
+		delete(s.hashes, id)
+		s.version++
+		return nil
+	}
+
+	if _, ok := s.users[id]; !ok {
+		return user.ErrNotFound
+	}
+
+	s.hashes[id] = hash
+	s.version++
+
+	return nil
+}
+
+func (s *Store) PasswordHash(ctx context.Context, id int64) (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	hash, ok := s.hashes[id]
+	if _, live := s.users[id]; !ok || !live {
+		return "", user.ErrNoPassword
+	}
+
+	return hash, nil
+}
+
+func (s *Store) TOTP(ctx context.Context, id int64) (*user.TOTP, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	t, ok := s.totp[id]
+	if _, live := s.users[id]; !ok || !live {
+		return nil, user.ErrNoTOTP
+	}
+
+	c := *t
+	for _, rc := range s.codes {
+		if rc.userID == id && !rc.used {
+			c.RecoveryCodes++
+		}
+	}
+
+	return &c, nil
+}
+
+func (s *Store) SetTOTP(ctx context.Context, id int64, secret string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[id]; !ok {
+		return user.ErrNotFound
+	}
+
+	ts, err := now()
+	if err != nil {
+		return err
+	}
+
+	s.totp[id] = &user.TOTP{UserID: id, Secret: secret, CreatedAt: ts}
+	s.deleteCodes(id)
+	s.version++
+
+	return nil
+}
+
+func (s *Store) UseTOTPStep(ctx context.Context, id int64, step int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.totp[id]
+	if !ok || step <= t.LastStep {
+		return user.ErrInvalidCode
+	}
+
+	updated := *t
+	updated.LastStep = step
+	if !updated.ConfirmedAt.Valid {
+		updated.ConfirmedAt = user.At(time.Now())
+	}
+	s.totp[id] = &updated
+	s.version++
+
+	return nil
+}
+
+func (s *Store) DeleteTOTP(ctx context.Context, id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.totp, id)
+	s.deleteCodes(id)
+	s.version++
+
+	return nil
+}
+
+func (s *Store) SetRecoveryCodes(ctx context.Context, id int64, codes []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.deleteCodes(id)
+	for _, code := range codes {
+		s.codes = append(s.codes, &recoveryCode{userID: id, hash: s.uids.Hash(code)})
+	}
+	s.version++
+
+	return nil
+}
+
+func (s *Store) UseRecoveryCode(ctx context.Context, id int64, code string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	hash := s.uids.Hash(code)
+	for i, rc := range s.codes {
+		if rc.userID == id && rc.hash == hash && !rc.used {
+			used := *rc
+			used.used = true
+			s.codes[i] = &used
+			s.version++
+			return nil
+		}
+	}
+
+	return user.ErrInvalidCode
+}
+
+func (s *Store) Passkeys(ctx context.Context, userID int64) ([]*user.Passkey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if _, ok := s.users[userID]; !ok {
+		return nil, nil
+	}
+
+	var passkeys []*user.Passkey
+	for _, p := range s.keys {
+		if p.UserID == userID {
+			c := *p
+			passkeys = append(passkeys, &c)
+		}
+	}
+
+	return passkeys, nil
+}
+
+func (s *Store) PasskeyByCredentialID(ctx context.Context, credentialID string) (*user.Passkey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, p := range s.keys {
+		if _, live := s.users[p.UserID]; live && p.CredentialID == credentialID {
+			c := *p
+			return &c, nil
+		}
+	}
+
+	return nil, user.ErrPasskeyNotFound
+}
+
+func (s *Store) AddPasskey(ctx context.Context, p user.Passkey) (*user.Passkey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[p.UserID]; !ok {
+		return nil, user.ErrNotFound
+	}
+	for _, existing := range s.keys {
+		if existing.CredentialID == p.CredentialID {
+			return nil, user.ErrPasskeyExists
+		}
+	}
+
+	ts, err := now()
+	if err != nil {
+		return nil, err
+	}
+
+	p.ID = s.nextKey
+	p.CreatedAt = ts
+	p.LastUsedAt = user.NullTime{}
+
+	s.nextKey++
+	s.keys = append(s.keys, &p)
+	s.version++
+
+	c := p
+	return &c, nil
+}
+
+func (s *Store) UsePasskey(ctx context.Context, id int64, credential string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, p := range s.keys {
+		if p.ID == id {
+			used := *p
+			used.Credential = credential
+			used.LastUsedAt = user.At(time.Now())
+			s.keys[i] = &used
+			s.version++
+			return nil
+		}
+	}
+
+	return nil
+}
+
+func (s *Store) DeletePasskey(ctx context.Context, userID, id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := slices.IndexFunc(s.keys, func(p *user.Passkey) bool {
+		return p.ID == id && p.UserID == userID
+	})
+	if i < 0 {
+		return user.ErrPasskeyNotFound
+	}
+
+	s.keys = slices.Delete(slices.Clone(s.keys), i, i+1)
+	s.version++
+
+	return nil
+}
+
+func (s *Store) Identity(ctx context.Context, issuer, subject string) (*user.Identity, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, i := range s.idents {
+		if _, live := s.users[i.UserID]; live && i.Issuer == issuer && i.Subject == subject {
+			return cloneIdentity(i), nil
+		}
+	}
+
+	return nil, user.ErrIdentityNotFound
+}
+
+func (s *Store) Identities(ctx context.Context, userID int64) ([]*user.Identity, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var identities []*user.Identity
+	for _, i := range s.idents {
+		if _, live := s.users[i.UserID]; live && i.UserID == userID {
+			identities = append(identities, cloneIdentity(i))
+		}
+	}
+
+	return identities, nil
+}
+
+func (s *Store) ListIdentities(ctx context.Context) ([]*user.Identity, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var identities []*user.Identity
+	for _, i := range s.idents {
+		if _, live := s.users[i.UserID]; live {
+			identities = append(identities, cloneIdentity(i))
+		}
+	}
+
+	return identities, nil
+}
+
+func (s *Store) LinkIdentity(ctx context.Context, id user.Identity) (*user.Identity, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[id.UserID]; !ok {
+		return nil, user.ErrNotFound
+	}
+
+	idents := s.idents
+	for n, existing := range s.idents {
+		if existing.Issuer != id.Issuer || existing.Subject != id.Subject {
+			continue
+		}
+		if _, live := s.users[existing.UserID]; live {
+			return nil, user.ErrIdentityExists
+		}
+		// the user was deleted: free the account
+		idents = slices.Delete(slices.Clone(s.idents), n, n+1)
+		break
+	}
+
+	ts, err := now()
+	if err != nil {
+		return nil, err
+	}
+
+	id.ID = s.nextIdt
+	id.Roles = user.NewRoleList(id.Roles...)
+	id.CreatedAt = ts
+	id.LastLoginAt = user.NullTime{}
+
+	s.nextIdt++
+	s.idents = append(idents, &id)
+	s.version++
+
+	return cloneIdentity(&id), nil
+}
+
+func (s *Store) UseIdentity(ctx context.Context, id int64, roles user.RoleList) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for n, i := range s.idents {
+		if i.ID == id {
+			used := *i
+			used.Roles = user.NewRoleList(roles...)
+			used.LastLoginAt = user.At(time.Now())
+			s.idents[n] = &used
+			s.version++
+			return nil
+		}
+	}
+
+	return nil
+}
+
+func (s *Store) UseLoginToken(ctx context.Context, userID int64, nonce string, expires time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[userID]; !ok {
+		return user.ErrNotFound
+	}
+
+	now := time.Now()
+	maps.DeleteFunc(s.tokens, func(_ string, exp time.Time) bool {
+		return exp.Before(now)
+	})
+
+	if _, used := s.tokens[nonce]; used {
+		return user.ErrTokenUsed
+	}
+	s.tokens[nonce] = expires
+	s.version++
+
+	return nil
+}
+
+func (s *Store) AddSession(ctx context.Context, sess user.Session, expires time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[sess.UserID]; !ok {
+		return user.ErrNotFound
+	}
+
+	ts, err := now()
+	if err != nil {
+		return err
+	}
+
+	current := time.Now()
+	s.logins = slices.DeleteFunc(slices.Clone(s.logins), func(l *session) bool {
+		return l.expires.Before(current) || l.Token == sess.Token
+	})
+
+	sess.ID = s.nextSes
+	sess.CreatedAt = ts
+	s.nextSes++
+	s.logins = append(s.logins, &session{Session: sess, expires: expires})
+	s.version++
+
+	return nil
+}
+
+func (s *Store) Sessions(ctx context.Context, userID int64) ([]*user.Session, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	current := time.Now()
+	var sessions []*user.Session
+	for i := len(s.logins) - 1; i >= 0; i-- {
+		if l := s.logins[i]; l.UserID == userID && !l.expires.Before(current) {
+			sess := l.Session
+			sessions = append(sessions, &sess)
+		}
+	}
+
+	return sessions, nil
+}
+
+func (s *Store) RenewSession(ctx context.Context, token, newToken string, expires time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for n, l := range s.logins {
+		if l.Token == token {
+			renewed := *l
+			renewed.Token = newToken
+			renewed.expires = expires
+			s.logins = slices.Clone(s.logins)
+			s.logins[n] = &renewed
+			s.version++
+			return nil
+		}
+	}
+
+	return nil
+}
+
+func (s *Store) RemoveSession(ctx context.Context, token string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.logins = slices.DeleteFunc(slices.Clone(s.logins), func(l *session) bool {
+		return l.Token == token
+	})
+	s.version++
+
+	return nil
+}
+
+func (s *Store) RemoveSessions(ctx context.Context, userID int64) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var tokens []string
+	s.logins = slices.DeleteFunc(slices.Clone(s.logins), func(l *session) bool {
+		if l.UserID == userID {
+			tokens = append(tokens, l.Token)
+			return true
+		}
+		return false
+	})
+	s.version++
+
+	return tokens, nil
+}
+
+func (s *Store) RecordLogin(ctx context.Context, ev user.LoginEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ts, err := now()
+	if err != nil {
+		return err
+	}
+
+	ev.ID = int64(len(s.events)) + 1
+	ev.CreatedAt = ts
+
+	if ev.UserID != 0 {
+		u, ok := s.users[ev.UserID]
+		if !ok {
+			return user.ErrNotFound
+		}
+		if ev.Success {
+			updated := *u
+			updated.LastLoginAt = user.At(time.Now())
+			updated.LoginCount++
+			updated.UpdatedAt = ts
+			s.users[u.ID] = &updated
+		}
+	}
+
+	s.events = append(s.events, &ev)
+	s.version++
+
+	return nil
+}
+
+func (s *Store) LoginEvents(ctx context.Context, userID int64, limit int) ([]*user.LoginEvent, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var events []*user.LoginEvent
+	for i := len(s.events) - 1; i >= 0 && len(events) < limit; i-- {
+		if s.events[i].UserID == userID {
+			ev := *s.events[i]
+			events = append(events, &ev)
+		}
+	}
+
+	return events, nil
+}
+
+func (s *Store) PruneLoginEvents(ctx context.Context, before time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := len(s.events)
+	cutoff := before.Format(time.DateTime) // sortable like lastActive
+	s.events = slices.DeleteFunc(slices.Clone(s.events), func(ev *user.LoginEvent) bool {
+		return ev.CreatedAt.String() < cutoff
+	})
+	s.version++
+
+	return int64(n - len(s.events)), nil
+}
+
+func (s *Store) DeleteUser(ctx context.Context, id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[id]
+	if !ok {
+		return user.ErrNotFound
+	}
+
+	delete(s.users, id)
+	s.deleted[id] = u
+	s.version++
+
+	return nil
+}
+
+func (s *Store) FindByID(ctx context.Context, id int64) (*user.User, error) {
+	return s.find(func(u *user.User) bool { return u.ID == id })
+}
+
+func (s *Store) FindByUID(ctx context.Context, uid string) (*user.User, error) {
+	uidHash := s.uids.Hash(uid)
+	return s.find(func(u *user.User) bool { return u.UIDHash == uidHash })
+}
+
+func (s *Store) FindByDisplayName(ctx context.Context, displayName string) (*user.User, error) {
+	return s.find(func(u *user.User) bool { return u.DisplayName == displayName })
+}
+
+func (s *Store) FindByEmail(ctx context.Context, email string) (*user.User, error) {
+	if email == "" {
+		return nil, user.ErrNotFound
+	}
+	return s.find(func(u *user.User) bool { return u.Email == email })
+}
+
+func (s *Store) ListUsers(ctx context.Context) ([]*user.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	users := make([]*user.User, 0, len(s.users))
+	for _, u := range s.users {
+		users = append(users, cloneUser(u))
+	}
+
+	// insertion order, like the SQL stores
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+
+	return users, nil
+}
+
+func (s *Store) QueryUsers(ctx context.Context, lq user.ListQuery) (*user.ListResult, error) {
+	lq, err := lq.Normalize()
+	if err != nil {
+		return nil, err
+	}
+
+	all, err := s.ListUsers(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	search := strings.ToLower(lq.Search)
+	matches := all[:0]
+	for _, u := range all {
+		if search != "" &&
+			!strings.Contains(strings.ToLower(u.DisplayName), search) &&
+			!strings.Contains(strings.ToLower(u.FirstName), search) &&
+			!strings.Contains(strings.ToLower(u.LastName), search) {
+			continue
+		}
+		if !lq.InactiveSince.IsZero() && lastActive(u) >= lq.InactiveSince.Format(time.DateTime) {
+			continue
+		}
+		matches = append(matches, u)
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		a, b := sortKey(matches[i], lq.Sort), sortKey(matches[j], lq.Sort)
+		if a == b {
+			a, b = fmt.Sprintf("%020d", matches[i].ID), fmt.Sprintf("%020d", matches[j].ID)
+		}
+		if lq.Desc {
+			return a > b
+		}
+		return a < b
+	})
+
+	res := &user.ListResult{Total: int64(len(matches))}
+
+	start := min(lq.Offset, len(matches))
+	end := min(start+lq.Limit, len(matches))
+	res.Users = matches[start:end]
+
+	return res, nil
+}
+
+// CountLegacyUIDs is always 0: the memory store never held plaintext UIDs.
+func (s *Store) CountLegacyUIDs(ctx context.Context) (int64, error) {
+	return 0, nil
+}
+
+// HashLegacyUIDs is a no-op: the memory store never held plaintext UIDs.
+func (s *Store) HashLegacyUIDs(ctx context.Context) (int64, error) {
+	return 0, nil
+}
+
+func (s *Store) PurgeUsers(ctx context.Context) ([]int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ids := make([]int64, 0, len(s.users)+len(s.deleted))
+	for id := range s.users {
+		ids = append(ids, id)
+	}
+	for id := range s.deleted {
+		ids = append(ids, id)
+	}
+
+	s.users = make(map[int64]*user.User)
+	s.deleted = make(map[int64]*user.User)
+	s.events = nil
+	s.hashes = make(map[int64]string)
+	s.totp = make(map[int64]*user.TOTP)
+	s.codes = nil
+	s.keys = nil
+	s.idents = nil
+	s.tokens = make(map[string]time.Time)
+	s.logins = nil
+	s.nextID = 1
+	s.nextKey = 1
+	s.nextIdt = 1
+	s.nextSes = 1
+	s.version++
+
+	return ids, nil
+}
+
+// -----------------------------------------------------------------------------
+// Transactions
+// -----------------------------------------------------------------------------
+
+// txMaxAttempts limits retries when concurrent writes keep invalidating a tx.
+const txMaxAttempts = 5
+
+// Tx runs fn against a private copy of the store and publishes the copy
+// only if fn succeeds – so either all writes of fn become visible or none.
+//
+// If another writer changed the store in the meantime, the copy is discarded
+// and fn runs again (optimistic concurrency). Like the SQL retry on
+// SQLITE_BUSY, fn must not have side effects outside of the store.
+func (s *Store) Tx(fn func(tx *Store) error) error {
+	for attempt := 1; attempt <= txMaxAttempts; attempt++ {
+		s.mu.RLock()
+		tx := s.clone()
+		base := s.version
+		s.mu.RUnlock()
+
+		if err := fn(tx); err != nil {
+			return err
+		}
+
+		s.mu.Lock()
+		if s.version != base {
+			s.mu.Unlock()
+			continue
+		}
+
+		s.users = tx.users
+		s.deleted = tx.deleted
+		s.events = tx.events
+		s.hashes = tx.hashes
+		s.totp = tx.totp
+		s.codes = tx.codes
+		s.keys = tx.keys
+		s.idents = tx.idents
+		s.tokens = tx.tokens
+		s.logins = tx.logins
+		s.nextID = tx.nextID
+		s.nextKey = tx.nextKey
+		s.nextIdt = tx.nextIdt
+		s.nextSes = tx.nextSes
+		s.version++
+		s.mu.Unlock()
+
+		return nil
+	}
+
+	return fmt.Errorf("memory store: transaction conflicted %d times", txMaxAttempts)
+}
+
+// clone copies the data of s. The caller must hold s.mu.
+func (s *Store) clone() *Store {
+	c := &Store{
+		users:   make(map[int64]*user.User, len(s.users)),
+		deleted: make(map[int64]*user.User, len(s.deleted)),
+		events:  slices.Clone(s.events), // events are never modified
+		hashes:  maps.Clone(s.hashes),
+		totp:    maps.Clone(s.totp),    // entries are replaced, never modified
+		codes:   slices.Clone(s.codes), // same
+		keys:    slices.Clone(s.keys),  // same
+		idents:  slices.Clone(s.idents),
+		tokens:  maps.Clone(s.tokens),
+		logins:  slices.Clone(s.logins), // entries are replaced, never modified
+		nextID:  s.nextID,
+		nextKey: s.nextKey,
+		nextIdt: s.nextIdt,
+		nextSes: s.nextSes,
+		uids:    s.uids,
+	}
+
+	for id, u := range s.users {
+		c.users[id] = cloneUser(u)
+	}
+	for id, u := range s.deleted {
+		c.deleted[id] = cloneUser(u)
+	}
+
+	return c
+}
+
+// -----------------------------------------------------------------------------
+// Internals
+// -----------------------------------------------------------------------------
+
+// cloneIdentity copies i including its roles.
+func cloneIdentity(i *user.Identity) *user.Identity {
+	c := *i
+	c.Roles = slices.Clone(i.Roles)
+	return &c
+}
+
+// session is one row of user_sessions.
+type session struct {
+	user.Session
+	expires time.Time
+}
+
+// recoveryCode is one row of user_recovery_codes.
+type recoveryCode struct {
+	userID int64
+	hash   string
+	used   bool
+}
+
+// deleteCodes removes all recovery codes of a user. The caller must hold
+// the write lock.
+func (s *Store) deleteCodes(id int64) {
+	s.codes = slices.DeleteFunc(slices.Clone(s.codes), func(rc *recoveryCode) bool {
+		return rc.userID == id
+	})
+}
+
+// insert adds u with a new ID. Uniqueness of uid and display_name among
+// live users is enforced like the unique indexes of the SQL schema.
+func (s *Store) insert(u user.User) (*user.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, existing := range s.users {
+		if existing.UIDHash == u.UIDHash || existing.DisplayName == u.DisplayName ||
+			(u.Email != "" && existing.Email == u.Email) {
+			return nil, user.ErrAlreadyExists
+		}
+	}
+
+	ts, err := now()
+	if err != nil {
+		return nil, err
+	}
+
+	u.ID = s.nextID
+	u.SessionVersion = 1
+	u.Status = user.StatusActive
+	u.CreatedAt = ts
+	u.UpdatedAt = ts
+
+	s.nextID++
+	s.version++
+
+	s.users[u.ID] = cloneUser(&u)
+
+	return &u, nil
+}
+
+// modify applies fn to a copy of the live user id and stores the copy
+// if fn succeeds. fn runs under the write lock.
+func (s *Store) modify(id int64, fn func(u *user.User) error) (*user.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[id]
+	if !ok {
+		return nil, user.ErrNotFound
+	}
+
+	ts, err := now()
+	if err != nil {
+		return nil, err
+	}
+
+	updated := *u
+	if err := fn(&updated); err != nil {
+		return nil, err
+	}
+	updated.UpdatedAt = ts
+
+	s.users[id] = &updated
+	s.version++
+
+	return cloneUser(&updated), nil
+}
+
+// cloneUser copies u including its attributes map, so callers
+// cannot modify stored data.
+func cloneUser(u *user.User) *user.User {
+	c := *u
+	c.Attributes = u.Attributes.Clone()
+	return &c
+}
+
+// now returns the current local time in the format the SQL stores use
+// (datetime('now', 'localtime')).
+func now() (litetime.Time, error) {
+	var t litetime.Time
+	err := t.Scan(time.Now().Format(time.DateTime))
+	return t, err
+}
+
+// sortKey returns the value of field as comparable string
+// (IDs zero-padded, timestamps are already sortable).
+func sortKey(u *user.User, field user.SortField) string {
+	switch field {
+	case user.SortDisplayName:
+		return u.DisplayName
+	case user.SortFirstName:
+		return u.FirstName
+	case user.SortLastName:
+		return u.LastName
+	case user.SortCreatedAt:
+		return u.CreatedAt.String()
+	case user.SortUpdatedAt:
+		return u.UpdatedAt.String()
+	default:
+		return fmt.Sprintf("%020d", u.ID)
+	}
+}
+
+// lastActive returns the last login (or the creation, if the user never
+// logged in) as sortable local time string, like sortKey.
+func lastActive(u *user.User) string {
+	if u.LastLoginAt.Valid {
+		return u.LastLoginAt.String()
+	}
+	return u.CreatedAt.String()
+}
+
+func (s *Store) find(match func(u *user.User) bool) (*user.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, u := range s.users {
+		if match(u) {
+			return cloneUser(u), nil
+		}
+	}
+
+	return nil, user.ErrNotFound
+}
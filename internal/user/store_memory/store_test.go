@@ -0,0 +1,16 @@
+package storememory_test
+
+import (
+	"testing"
+
+	"github.com/axelrhd/hagg/internal/user"
+	storememory "github.com/axelrhd/hagg/internal/user/store_memory"
+	"github.com/axelrhd/hagg/internal/user/storetest"
+)
+
+func TestStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) storetest.Harness {
+		uids := user.NewUIDHasher(storetest.Pepper)
+		return storetest.Harness{Store: storememory.New(uids), UIDs: uids}
+	})
+}
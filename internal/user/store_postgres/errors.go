@@ -0,0 +1,25 @@
+package storepostgres
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/axelrhd/hagg/internal/user"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// unique_violation, see https://www.postgresql.org/docs/current/errcodes-appendix.html
+const pgUniqueViolation = "23505"
+
+func mapSQLError(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return user.ErrNotFound
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == pgUniqueViolation {
+		return user.ErrAlreadyExists
+	}
+
+	return err
+}
@@ -0,0 +1,518 @@
+package storepostgres
+
+import (
+	"github.com/axelrhd/hagg/internal/db"
+	"github.com/axelrhd/hagg/internal/user"
+	"github.com/nullism/bqb"
+)
+
+// Timestamps are rendered in the same text format SQLite uses
+// (datetime('now', 'localtime')), so user.User scans identically
+// on both backends.
+const userColumns = `
+	id,
+	uid_hash,
+	display_name,
+	last_name,
+	first_name,
+	COALESCE(email, '') AS email,
+	to_char(email_verified_at, 'YYYY-MM-DD HH24:MI:SS') AS email_verified_at,
+	attributes::text AS attributes,
+	session_version,
+	status,
+	to_char(locked_until, 'YYYY-MM-DD HH24:MI:SS') AS locked_until,
+	to_char(valid_until, 'YYYY-MM-DD HH24:MI:SS') AS valid_until,
+	to_char(last_login_at, 'YYYY-MM-DD HH24:MI:SS') AS last_login_at,
+	login_count,
+	to_char(created_at, 'YYYY-MM-DD HH24:MI:SS') AS created_at,
+	to_char(updated_at, 'YYYY-MM-DD HH24:MI:SS') AS updated_at`
+
+func qCreateUser(uidHash string, in user.CreateUserInput) *bqb.Query {
+	return bqb.New(`
+		INSERT INTO users (uid_hash, display_name, first_name, last_name, email, attributes)
+		VALUES (?, ?, ?, ?, ?, ?::jsonb)
+		RETURNING`+userColumns,
+		db.Secret(uidHash), in.DisplayName, in.FirstName, in.LastName, nullIfEmpty(in.Email), in.Attributes)
+}
+
+func qUpdateUser(id int64, in user.UpdateUserInput) *bqb.Query {
+	set := bqb.Optional("SET")
+	if in.DisplayName != nil {
+		set.Comma("display_name = ?", *in.DisplayName)
+	}
+	if in.FirstName != nil {
+		set.Comma("first_name = ?", *in.FirstName)
+	}
+	if in.LastName != nil {
+		set.Comma("last_name = ?", *in.LastName)
+	}
+	if in.Email != nil {
+		// a changed address has to be verified again
+		if in.EmailVerified == nil {
+			set.Comma("email_verified_at = CASE WHEN email IS NOT DISTINCT FROM ?::text THEN email_verified_at ELSE NULL END", nullIfEmpty(*in.Email))
+		}
+		set.Comma("email = ?", nullIfEmpty(*in.Email))
+	}
+	if in.EmailVerified != nil {
+		set.Comma("email_verified_at = ?::timestamp", *in.EmailVerified)
+	}
+	if in.Attributes != nil {
+		set.Comma("attributes = ?::jsonb", *in.Attributes)
+	}
+	if in.Status != nil {
+		set.Comma("status = ?", string(*in.Status))
+	}
+	if in.LockedUntil != nil {
+		set.Comma("locked_until = ?::timestamp", *in.LockedUntil)
+	}
+	if in.ValidUntil != nil {
+		set.Comma("valid_until = ?::timestamp", *in.ValidUntil)
+	}
+
+	return bqb.New(`
+		UPDATE users ?
+		WHERE id = ? AND deleted_at IS NULL
+		RETURNING`+userColumns, set, id)
+}
+
+func qRotateUID(id int64, uidHash string) *bqb.Query {
+	return bqb.New(`
+		UPDATE users
+		SET uid_hash = ?, session_version = session_version + 1
+		WHERE id = ? AND deleted_at IS NULL
+		RETURNING`+userColumns, db.Secret(uidHash), id)
+}
+
+func qRevokeSessions(id int64) *bqb.Query {
+	return bqb.New(`
+		UPDATE users
+		SET session_version = session_version + 1
+		WHERE id = ? AND deleted_at IS NULL
+		RETURNING`+userColumns, id)
+}
+
+func qDeleteUser(id int64) *bqb.Query {
+	return bqb.New(`
+		UPDATE users
+		SET deleted_at = LOCALTIMESTAMP(0)
+		WHERE id = ? AND deleted_at IS NULL`, id)
+}
+
+// qUserSelector selects live (not soft-deleted) users.
+func qUserSelector() *bqb.Query {
+	return bqb.New("SELECT" + userColumns + "\nFROM users\nWHERE deleted_at IS NULL")
+}
+
+func qUserByID(id int64) *bqb.Query {
+	sel := qUserSelector()
+	sel.Concat("\nAND id = ?", id)
+
+	return sel
+}
+
+func qUserByUIDHash(uidHash string) *bqb.Query {
+	sel := qUserSelector()
+	sel.Concat("\nAND uid_hash = ?", db.Secret(uidHash))
+
+	return sel
+}
+
+func qUserByDisplayName(displayName string) *bqb.Query {
+	sel := qUserSelector()
+	sel.Concat("\nAND display_name = ?", displayName)
+
+	return sel
+}
+
+func qUserByEmail(email string) *bqb.Query {
+	sel := qUserSelector()
+	sel.Concat("\nAND email = ?", email)
+
+	return sel
+}
+
+func qAllUsers() *bqb.Query {
+	sel := qUserSelector()
+	sel.Concat("\nORDER BY id")
+
+	return sel
+}
+
+// qUserFilter returns the WHERE conditions of a listing query.
+func qUserFilter(q user.ListQuery) *bqb.Query {
+	where := bqb.New("deleted_at IS NULL")
+
+	if q.Search != "" {
+		p := q.LikePattern()
+		where.And(`(
+			display_name ILIKE ? ESCAPE '\'
+			OR first_name ILIKE ? ESCAPE '\'
+			OR last_name ILIKE ? ESCAPE '\'
+		)`, p, p, p)
+	}
+
+	if !q.InactiveSince.IsZero() {
+		// never logged in: counts from the creation
+		where.And("COALESCE(last_login_at, created_at) < ?::timestamp", user.At(q.InactiveSince))
+	}
+
+	return where
+}
+
+func qQueryUsers(q user.ListQuery) *bqb.Query {
+	dir := "ASC"
+	if q.Desc {
+		dir = "DESC"
+	}
+
+	// q.Sort is whitelisted (user.ListQuery.Normalize); id makes the order stable
+	return bqb.New(
+		"SELECT"+userColumns+"\nFROM users\nWHERE ?\nORDER BY "+orderColumn(q.Sort)+" "+dir+", id "+dir+"\nLIMIT ? OFFSET ?",
+		qUserFilter(q), q.Limit, q.Offset,
+	)
+}
+
+// orderColumn returns the ORDER BY expression of a sort field. Text sorts
+// bytewise like in SQLite and the memory store, not by the locale of the
+// database.
+func orderColumn(f user.SortField) string {
+	switch f {
+	case user.SortDisplayName, user.SortFirstName, user.SortLastName:
+		return string(f) + ` COLLATE "C"`
+	default:
+		return string(f)
+	}
+}
+
+func qCountUsers(q user.ListQuery) *bqb.Query {
+	return bqb.New("SELECT COUNT(*) FROM users\nWHERE ?", qUserFilter(q))
+}
+
+// qSetPassword inserts or replaces the password hash of a live user.
+func qSetPassword(id int64, hash string) *bqb.Query {
+	return bqb.New(`
+		INSERT INTO user_passwords (user_id, hash)
+		SELECT id, ? FROM users
+		WHERE id = ? AND deleted_at IS NULL
+		ON CONFLICT (user_id) DO UPDATE
+		SET hash = excluded.hash, updated_at = LOCALTIMESTAMP(0)`, db.Secret(hash), id)
+}
+
+func qDeletePassword(id int64) *bqb.Query {
+	return bqb.New("DELETE FROM user_passwords WHERE user_id = ?", id)
+}
+
+func qPasswordHash(id int64) *bqb.Query {
+	return bqb.New(`
+		SELECT p.hash
+		FROM user_passwords p
+		JOIN users u ON u.id = p.user_id
+		WHERE p.user_id = ? AND u.deleted_at IS NULL`, id)
+}
+
+func qTOTP(id int64) *bqb.Query {
+	return bqb.New(`
+		SELECT
+			t.user_id,
+			t.secret,
+			to_char(t.confirmed_at, 'YYYY-MM-DD HH24:MI:SS') AS confirmed_at,
+			t.last_step,
+			(
+				SELECT COUNT(*) FROM user_recovery_codes c
+				WHERE c.user_id = t.user_id AND c.used_at IS NULL
+			) AS recovery_codes,
+			to_char(t.created_at, 'YYYY-MM-DD HH24:MI:SS') AS created_at
+		FROM user_totp t
+		JOIN users u ON u.id = t.user_id
+		WHERE t.user_id = ? AND u.deleted_at IS NULL`, id)
+}
+
+// qSetTOTP starts a new enrolment of a live user (replaces an old one).
+func qSetTOTP(id int64, secret string) *bqb.Query {
+	return bqb.New(`
+		INSERT INTO user_totp (user_id, secret)
+		SELECT id, ? FROM users
+		WHERE id = ? AND deleted_at IS NULL
+		ON CONFLICT (user_id) DO UPDATE
+		SET secret = excluded.secret, confirmed_at = NULL, last_step = 0, created_at = LOCALTIMESTAMP(0)`,
+		db.Secret(secret), id)
+}
+
+// qUseTOTPStep accepts a step only once and confirms the enrolment.
+func qUseTOTPStep(id int64, step int64) *bqb.Query {
+	return bqb.New(`
+		UPDATE user_totp
+		SET last_step = ?, confirmed_at = COALESCE(confirmed_at, LOCALTIMESTAMP(0))
+		WHERE user_id = ? AND last_step < ?`, step, id, step)
+}
+
+func qDeleteTOTP(id int64) *bqb.Query {
+	return bqb.New("DELETE FROM user_totp WHERE user_id = ?", id)
+}
+
+func qDeleteRecoveryCodes(id int64) *bqb.Query {
+	return bqb.New("DELETE FROM user_recovery_codes WHERE user_id = ?", id)
+}
+
+func qInsertRecoveryCodes(id int64, hashes []string) *bqb.Query {
+	values := bqb.Q()
+	for _, h := range hashes {
+		values.Comma("(?, ?)", id, db.Secret(h))
+	}
+	return bqb.New("INSERT INTO user_recovery_codes (user_id, code_hash) VALUES ?", values)
+}
+
+func qUseRecoveryCode(id int64, hash string) *bqb.Query {
+	return bqb.New(`
+		UPDATE user_recovery_codes
+		SET used_at = LOCALTIMESTAMP(0)
+		WHERE id = (
+			SELECT id FROM user_recovery_codes
+			WHERE user_id = ? AND code_hash = ? AND used_at IS NULL
+			LIMIT 1
+		)`, id, db.Secret(hash))
+}
+
+const passkeyColumns = `
+	p.id,
+	p.user_id,
+	p.credential_id,
+	p.name,
+	p.credential,
+	to_char(p.last_used_at, 'YYYY-MM-DD HH24:MI:SS') AS last_used_at,
+	to_char(p.created_at, 'YYYY-MM-DD HH24:MI:SS') AS created_at`
+
+// passkeyReturning are the passkeyColumns of an INSERT (no table alias).
+const passkeyReturning = `
+	id,
+	user_id,
+	credential_id,
+	name,
+	credential,
+	to_char(last_used_at, 'YYYY-MM-DD HH24:MI:SS') AS last_used_at,
+	to_char(created_at, 'YYYY-MM-DD HH24:MI:SS') AS created_at`
+
+func qPasskeys(userID int64) *bqb.Query {
+	return bqb.New(`
+		SELECT`+passkeyColumns+`
+		FROM user_passkeys p
+		JOIN users u ON u.id = p.user_id
+		WHERE p.user_id = ? AND u.deleted_at IS NULL
+		ORDER BY p.id`, userID)
+}
+
+func qPasskeyByCredentialID(credentialID string) *bqb.Query {
+	return bqb.New(`
+		SELECT`+passkeyColumns+`
+		FROM user_passkeys p
+		JOIN users u ON u.id = p.user_id
+		WHERE p.credential_id = ? AND u.deleted_at IS NULL`, credentialID)
+}
+
+// qAddPasskey stores a passkey of a live user.
+func qAddPasskey(p user.Passkey) *bqb.Query {
+	return bqb.New(`
+		INSERT INTO user_passkeys (user_id, credential_id, name, credential)
+		SELECT id, ?, ?, ? FROM users
+		WHERE id = ? AND deleted_at IS NULL
+		RETURNING`+passkeyReturning,
+		p.CredentialID, p.Name, p.Credential, p.UserID)
+}
+
+func qUsePasskey(id int64, credential string) *bqb.Query {
+	return bqb.New(`
+		UPDATE user_passkeys
+		SET credential = ?, last_used_at = LOCALTIMESTAMP(0)
+		WHERE id = ?`, credential, id)
+}
+
+func qDeletePasskey(userID, id int64) *bqb.Query {
+	return bqb.New("DELETE FROM user_passkeys WHERE id = ? AND user_id = ?", id, userID)
+}
+
+const identityColumns = `
+	i.id,
+	i.user_id,
+	i.issuer,
+	i.subject,
+	i.roles::text AS roles,
+	to_char(i.last_login_at, 'YYYY-MM-DD HH24:MI:SS') AS last_login_at,
+	to_char(i.created_at, 'YYYY-MM-DD HH24:MI:SS') AS created_at`
+
+// identityReturning are the identityColumns of an INSERT (no table alias).
+const identityReturning = `
+	id,
+	user_id,
+	issuer,
+	subject,
+	roles::text AS roles,
+	to_char(last_login_at, 'YYYY-MM-DD HH24:MI:SS') AS last_login_at,
+	to_char(created_at, 'YYYY-MM-DD HH24:MI:SS') AS created_at`
+
+func qIdentity(issuer, subject string) *bqb.Query {
+	return bqb.New(`
+		SELECT`+identityColumns+`
+		FROM user_identities i
+		JOIN users u ON u.id = i.user_id
+		WHERE i.issuer = ? AND i.subject = ? AND u.deleted_at IS NULL`, issuer, subject)
+}
+
+func qIdentities(userID int64) *bqb.Query {
+	return bqb.New(`
+		SELECT`+identityColumns+`
+		FROM user_identities i
+		JOIN users u ON u.id = i.user_id
+		WHERE i.user_id = ? AND u.deleted_at IS NULL
+		ORDER BY i.id`, userID)
+}
+
+func qListIdentities() *bqb.Query {
+	return bqb.New(`
+		SELECT` + identityColumns + `
+		FROM user_identities i
+		JOIN users u ON u.id = i.user_id
+		WHERE u.deleted_at IS NULL
+		ORDER BY i.id`)
+}
+
+// qUnlinkDeletedIdentity frees an external account whose user was deleted,
+// so it can be linked again.
+func qUnlinkDeletedIdentity(issuer, subject string) *bqb.Query {
+	return bqb.New(`
+		DELETE FROM user_identities
+		WHERE issuer = ? AND subject = ?
+		AND user_id IN (SELECT id FROM users WHERE deleted_at IS NOT NULL)`, issuer, subject)
+}
+
+// qLinkIdentity links an external account to a live user.
+func qLinkIdentity(id user.Identity) *bqb.Query {
+	return bqb.New(`
+		INSERT INTO user_identities (user_id, issuer, subject, roles)
+		SELECT id, ?, ?, ?::jsonb FROM users
+		WHERE id = ? AND deleted_at IS NULL
+		RETURNING`+identityReturning,
+		id.Issuer, id.Subject, id.Roles, id.UserID)
+}
+
+func qUseIdentity(id int64, roles user.RoleList) *bqb.Query {
+	return bqb.New(`
+		UPDATE user_identities
+		SET roles = ?::jsonb, last_login_at = LOCALTIMESTAMP(0)
+		WHERE id = ?`, roles, id)
+}
+
+func qDeleteExpiredLoginTokens() *bqb.Query {
+	return bqb.New("DELETE FROM used_login_tokens WHERE expires_at < LOCALTIMESTAMP")
+}
+
+// qUseLoginToken remembers a nonce of a live user; a second use violates
+// the primary key.
+func qUseLoginToken(userID int64, nonce string, expires user.NullTime) *bqb.Query {
+	return bqb.New(`
+		INSERT INTO used_login_tokens (nonce, user_id, expires_at)
+		SELECT ?, id, ?::timestamp FROM users
+		WHERE id = ? AND deleted_at IS NULL`,
+		nonce, expires, userID)
+}
+
+func qDeleteExpiredSessions() *bqb.Query {
+	return bqb.New("DELETE FROM user_sessions WHERE expires_at < LOCALTIMESTAMP")
+}
+
+// qAddSession records a session of a live user; re-adding a token (a
+// second login in the same session) replaces the record.
+func qAddSession(sess user.Session, expires user.NullTime) *bqb.Query {
+	return bqb.New(`
+		INSERT INTO user_sessions (token, user_id, ip, user_agent, expires_at)
+		SELECT ?, id, ?, ?, ?::timestamp FROM users
+		WHERE id = ? AND deleted_at IS NULL
+		ON CONFLICT (token) DO UPDATE SET
+			user_id = excluded.user_id,
+			ip = excluded.ip,
+			user_agent = excluded.user_agent,
+			expires_at = excluded.expires_at`,
+		db.Secret(sess.Token), sess.IP, sess.UserAgent, expires, sess.UserID)
+}
+
+func qSessions(userID int64) *bqb.Query {
+	return bqb.New(`
+		SELECT id, user_id, token, ip, user_agent, to_char(created_at, 'YYYY-MM-DD HH24:MI:SS') AS created_at
+		FROM user_sessions
+		WHERE user_id = ? AND expires_at >= LOCALTIMESTAMP
+		ORDER BY id DESC`, userID)
+}
+
+func qRenewSession(token, newToken string, expires user.NullTime) *bqb.Query {
+	return bqb.New("UPDATE user_sessions SET token = ?, expires_at = ? WHERE token = ?",
+		db.Secret(newToken), expires, db.Secret(token))
+}
+
+func qRemoveSession(token string) *bqb.Query {
+	return bqb.New("DELETE FROM user_sessions WHERE token = ?", db.Secret(token))
+}
+
+func qRemoveSessions(userID int64) *bqb.Query {
+	return bqb.New("DELETE FROM user_sessions WHERE user_id = ? RETURNING token", userID)
+}
+
+func qRecordLoginEvent(ev user.LoginEvent) *bqb.Query {
+	return bqb.New(`
+		INSERT INTO login_events (user_id, success, reason, ip, user_agent)
+		VALUES (?, ?, ?, ?, ?)`,
+		nullIfZero(ev.UserID), ev.Success, ev.Reason, ev.IP, ev.UserAgent)
+}
+
+func qPruneLoginEvents(before user.NullTime) *bqb.Query {
+	return bqb.New("DELETE FROM login_events WHERE created_at < ?", before)
+}
+
+func qTouchLastLogin(id int64) *bqb.Query {
+	return bqb.New(`
+		UPDATE users
+		SET last_login_at = LOCALTIMESTAMP(0), login_count = login_count + 1
+		WHERE id = ? AND deleted_at IS NULL`, id)
+}
+
+func qLoginEvents(userID int64, limit int) *bqb.Query {
+	return bqb.New(`
+		SELECT id, user_id, success, reason, ip, user_agent, to_char(created_at, 'YYYY-MM-DD HH24:MI:SS') AS created_at
+		FROM login_events
+		WHERE user_id = ?
+		ORDER BY id DESC
+		LIMIT ?`, userID, limit)
+}
+
+// qLegacyUIDs selects all rows (including soft-deleted ones)
+// whose uid_hash still holds a plaintext UID.
+func qLegacyUIDs() *bqb.Query {
+	return bqb.New("SELECT id, uid_hash FROM users\nWHERE uid_hash NOT LIKE 'hmac-sha256:%'")
+}
+
+func qCountLegacyUIDs() *bqb.Query {
+	return bqb.New("SELECT COUNT(*) FROM users\nWHERE uid_hash NOT LIKE 'hmac-sha256:%'")
+}
+
+func qSetUIDHash(id int64, uidHash string) *bqb.Query {
+	return bqb.New("UPDATE users SET uid_hash = ? WHERE id = ?", db.Secret(uidHash), id)
+}
+
+func qPurgeUsers() *bqb.Query {
+	return bqb.New("DELETE FROM users RETURNING id")
+}
+
+// nullIfEmpty stores optional text columns as NULL (unique indexes
+// must not treat "" as a value).
+func nullIfEmpty(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// nullIfZero stores a missing reference as NULL.
+func nullIfZero(id int64) any {
+	if id == 0 {
+		return nil
+	}
+	return id
+}
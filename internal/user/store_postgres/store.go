@@ -0,0 +1,717 @@
+package storepostgres
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/axelrhd/hagg/internal/db"
+	"github.com/axelrhd/hagg/internal/user"
+	"github.com/nullism/bqb"
+)
+
+type Store struct {
+	db   db.Querier
+	uids *user.UIDHasher
+}
+
+// New returns a Store using q (the pool or a transaction).
+func New(q db.Querier, uids *user.UIDHasher) *Store {
+	return &Store{db: q, uids: uids}
+}
+
+// Compile-time interface check
+var _ user.Store = (*Store)(nil)
+
+func (s *Store) CreateUser(ctx context.Context, in user.CreateUserInput) (*user.User, error) {
+	q := qCreateUser(s.uids.Hash(in.UID), in)
+
+	sql, args, err := q.ToPgsql()
+	if err != nil {
+		return nil, err // Programmierfehler
+	}
+
+	var u user.User
+	if err := s.db.GetContext(ctx, &u, sql, args...); err != nil {
+		return nil, mapSQLError(err)
+	}
+
+	return &u, nil
+}
+
+func (s *Store) UpdateUser(ctx context.Context, id int64, in user.UpdateUserInput) (*user.User, error) {
+	if in.Empty() {
+		return s.FindByID(ctx, id)
+	}
+
+	q := qUpdateUser(id, in)
+
+	sql, args, err := q.ToPgsql()
+	if err != nil {
+		return nil, err // Programmierfehler
+	}
+
+	var u user.User
+	if err := s.db.GetContext(ctx, &u, sql, args...); err != nil {
+		return nil, mapSQLError(err)
+	}
+
+	return &u, nil
+}
+
+func (s *Store) RotateUID(ctx context.Context, id int64, uid string) (*user.User, error) {
+	q := qRotateUID(id, s.uids.Hash(uid))
+
+	sql, args, err := q.ToPgsql()
+	if err != nil {
+		return nil, err // Programmierfehler
+	}
+
+	var u user.User
+	if err := s.db.GetContext(ctx, &u, sql, args...); err != nil {
+		return nil, mapSQLError(err)
+	}
+
+	return &u, nil
+}
+
+func (s *Store) RevokeSessions(ctx context.Context, id int64) (*user.User, error) {
+	q := qRevokeSessions(id)
+
+	sql, args, err := q.ToPgsql()
+	if err != nil {
+		return nil, err // Programmierfehler
+	}
+
+	var u user.User
+	if err := s.db.GetContext(ctx, &u, sql, args...); err != nil {
+		return nil, mapSQLError(err)
+	}
+
+	return &u, nil
+}
+
+func (s *Store) SetPassword(ctx context.Context, id int64, hash string) error {
+	q := qSetPassword(id, hash)
+	if hash == "" {
+		q = qDeletePassword(id)
+	}
+
+	sql, args, err := q.ToPgsql()
+	if err != nil {
+		return err // Programmierfehler
+	}
+
+	res, err := s.db.ExecContext(ctx, sql, args...)
+	if err != nil {
+		return mapSQLError(err)
+	}
+
+	// removing a password that was never set is fine
+	if n, _ := res.RowsAffected(); n == 0 && hash != "" {
+		return user.ErrNotFound
+	}
+
+	return nil
+}
+
+func (s *Store) PasswordHash(ctx context.Context, id int64) (string, error) {
+	sql, args, err := qPasswordHash(id).ToPgsql()
+	if err != nil {
+		return "", err // Programmierfehler
+	}
+
+	var hash string
+	if err := s.db.GetContext(ctx, &hash, sql, args...); err != nil {
+		if err = mapSQLError(err); errors.Is(err, user.ErrNotFound) {
+			return "", user.ErrNoPassword
+		}
+		return "", err
+	}
+
+	return hash, nil
+}
+
+func (s *Store) TOTP(ctx context.Context, id int64) (*user.TOTP, error) {
+	sql, args, err := qTOTP(id).ToPgsql()
+	if err != nil {
+		return nil, err // Programmierfehler
+	}
+
+	var t user.TOTP
+	if err := s.db.GetContext(ctx, &t, sql, args...); err != nil {
+		if err = mapSQLError(err); errors.Is(err, user.ErrNotFound) {
+			return nil, user.ErrNoTOTP
+		}
+		return nil, err
+	}
+
+	return &t, nil
+}
+
+func (s *Store) SetTOTP(ctx context.Context, id int64, secret string) error {
+	// the recovery codes belong to the old enrolment
+	if err := s.exec(ctx, qDeleteRecoveryCodes(id)); err != nil {
+		return err
+	}
+
+	sql, args, err := qSetTOTP(id, secret).ToPgsql()
+	if err != nil {
+		return err // Programmierfehler
+	}
+
+	res, err := s.db.ExecContext(ctx, sql, args...)
+	if err != nil {
+		return mapSQLError(err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return user.ErrNotFound
+	}
+
+	return nil
+}
+
+func (s *Store) UseTOTPStep(ctx context.Context, id int64, step int64) error {
+	sql, args, err := qUseTOTPStep(id, step).ToPgsql()
+	if err != nil {
+		return err // Programmierfehler
+	}
+
+	res, err := s.db.ExecContext(ctx, sql, args...)
+	if err != nil {
+		return mapSQLError(err)
+	}
+
+	// no enrolment, or the code was already used
+	if n, _ := res.RowsAffected(); n == 0 {
+		return user.ErrInvalidCode
+	}
+
+	return nil
+}
+
+func (s *Store) DeleteTOTP(ctx context.Context, id int64) error {
+	if err := s.exec(ctx, qDeleteRecoveryCodes(id)); err != nil {
+		return err
+	}
+	return s.exec(ctx, qDeleteTOTP(id))
+}
+
+func (s *Store) SetRecoveryCodes(ctx context.Context, id int64, codes []string) error {
+	if err := s.exec(ctx, qDeleteRecoveryCodes(id)); err != nil {
+		return err
+	}
+	if len(codes) == 0 {
+		return nil
+	}
+
+	// keyed hashes like the UIDs: a leaked table does not help
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = s.uids.Hash(code)
+	}
+
+	return s.exec(ctx, qInsertRecoveryCodes(id, hashes))
+}
+
+func (s *Store) UseRecoveryCode(ctx context.Context, id int64, code string) error {
+	sql, args, err := qUseRecoveryCode(id, s.uids.Hash(code)).ToPgsql()
+	if err != nil {
+		return err // Programmierfehler
+	}
+
+	res, err := s.db.ExecContext(ctx, sql, args...)
+	if err != nil {
+		return mapSQLError(err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return user.ErrInvalidCode
+	}
+
+	return nil
+}
+
+func (s *Store) Passkeys(ctx context.Context, userID int64) ([]*user.Passkey, error) {
+	sql, args, err := qPasskeys(userID).ToPgsql()
+	if err != nil {
+		return nil, err // Programmierfehler
+	}
+
+	var passkeys []*user.Passkey
+	if err := s.db.SelectContext(ctx, &passkeys, sql, args...); err != nil {
+		return nil, mapSQLError(err)
+	}
+
+	return passkeys, nil
+}
+
+func (s *Store) PasskeyByCredentialID(ctx context.Context, credentialID string) (*user.Passkey, error) {
+	sql, args, err := qPasskeyByCredentialID(credentialID).ToPgsql()
+	if err != nil {
+		return nil, err // Programmierfehler
+	}
+
+	var p user.Passkey
+	if err := s.db.GetContext(ctx, &p, sql, args...); err != nil {
+		if err = mapSQLError(err); errors.Is(err, user.ErrNotFound) {
+			return nil, user.ErrPasskeyNotFound
+		}
+		return nil, err
+	}
+
+	return &p, nil
+}
+
+func (s *Store) AddPasskey(ctx context.Context, p user.Passkey) (*user.Passkey, error) {
+	sql, args, err := qAddPasskey(p).ToPgsql()
+	if err != nil {
+		return nil, err // Programmierfehler
+	}
+
+	var created user.Passkey
+	if err := s.db.GetContext(ctx, &created, sql, args...); err != nil {
+		// no row: the user does not exist (ErrNotFound)
+		if err = mapSQLError(err); errors.Is(err, user.ErrAlreadyExists) {
+			return nil, user.ErrPasskeyExists
+		}
+		return nil, err
+	}
+
+	return &created, nil
+}
+
+func (s *Store) UsePasskey(ctx context.Context, id int64, credential string) error {
+	return s.exec(ctx, qUsePasskey(id, credential))
+}
+
+func (s *Store) DeletePasskey(ctx context.Context, userID, id int64) error {
+	sql, args, err := qDeletePasskey(userID, id).ToPgsql()
+	if err != nil {
+		return err // Programmierfehler
+	}
+
+	res, err := s.db.ExecContext(ctx, sql, args...)
+	if err != nil {
+		return mapSQLError(err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return user.ErrPasskeyNotFound
+	}
+
+	return nil
+}
+
+func (s *Store) Identity(ctx context.Context, issuer, subject string) (*user.Identity, error) {
+	sql, args, err := qIdentity(issuer, subject).ToPgsql()
+	if err != nil {
+		return nil, err // Programmierfehler
+	}
+
+	var i user.Identity
+	if err := s.db.GetContext(ctx, &i, sql, args...); err != nil {
+		if err = mapSQLError(err); errors.Is(err, user.ErrNotFound) {
+			return nil, user.ErrIdentityNotFound
+		}
+		return nil, err
+	}
+
+	return &i, nil
+}
+
+func (s *Store) Identities(ctx context.Context, userID int64) ([]*user.Identity, error) {
+	return s.selectIdentities(ctx, qIdentities(userID))
+}
+
+func (s *Store) ListIdentities(ctx context.Context) ([]*user.Identity, error) {
+	return s.selectIdentities(ctx, qListIdentities())
+}
+
+func (s *Store) selectIdentities(ctx context.Context, q *bqb.Query) ([]*user.Identity, error) {
+	sql, args, err := q.ToPgsql()
+	if err != nil {
+		return nil, err // Programmierfehler
+	}
+
+	var identities []*user.Identity
+	if err := s.db.SelectContext(ctx, &identities, sql, args...); err != nil {
+		return nil, mapSQLError(err)
+	}
+
+	return identities, nil
+}
+
+func (s *Store) LinkIdentity(ctx context.Context, id user.Identity) (*user.Identity, error) {
+	if err := s.exec(ctx, qUnlinkDeletedIdentity(id.Issuer, id.Subject)); err != nil {
+		return nil, err
+	}
+
+	sql, args, err := qLinkIdentity(id).ToPgsql()
+	if err != nil {
+		return nil, err // Programmierfehler
+	}
+
+	var created user.Identity
+	if err := s.db.GetContext(ctx, &created, sql, args...); err != nil {
+		// no row: the user does not exist (ErrNotFound)
+		if err = mapSQLError(err); errors.Is(err, user.ErrAlreadyExists) {
+			return nil, user.ErrIdentityExists
+		}
+		return nil, err
+	}
+
+	return &created, nil
+}
+
+func (s *Store) UseIdentity(ctx context.Context, id int64, roles user.RoleList) error {
+	return s.exec(ctx, qUseIdentity(id, roles))
+}
+
+func (s *Store) UseLoginToken(ctx context.Context, userID int64, nonce string, expires time.Time) error {
+	if err := s.exec(ctx, qDeleteExpiredLoginTokens()); err != nil {
+		return err
+	}
+
+	sql, args, err := qUseLoginToken(userID, nonce, user.At(expires)).ToPgsql()
+	if err != nil {
+		return err // Programmierfehler
+	}
+
+	res, err := s.db.ExecContext(ctx, sql, args...)
+	if err != nil {
+		if err = mapSQLError(err); errors.Is(err, user.ErrAlreadyExists) {
+			return user.ErrTokenUsed
+		}
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return user.ErrNotFound
+	}
+
+	return nil
+}
+
+func (s *Store) AddSession(ctx context.Context, sess user.Session, expires time.Time) error {
+	if err := s.exec(ctx, qDeleteExpiredSessions()); err != nil {
+		return err
+	}
+
+	sql, args, err := qAddSession(sess, user.At(expires)).ToPgsql()
+	if err != nil {
+		return err // Programmierfehler
+	}
+
+	res, err := s.db.ExecContext(ctx, sql, args...)
+	if err != nil {
+		return mapSQLError(err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return user.ErrNotFound
+	}
+
+	return nil
+}
+
+func (s *Store) Sessions(ctx context.Context, userID int64) ([]*user.Session, error) {
+	sql, args, err := qSessions(userID).ToPgsql()
+	if err != nil {
+		return nil, err // Programmierfehler
+	}
+
+	var sessions []*user.Session
+	if err := s.db.SelectContext(ctx, &sessions, sql, args...); err != nil {
+		return nil, mapSQLError(err)
+	}
+
+	return sessions, nil
+}
+
+func (s *Store) RenewSession(ctx context.Context, token, newToken string, expires time.Time) error {
+	return s.exec(ctx, qRenewSession(token, newToken, user.At(expires)))
+}
+
+func (s *Store) RemoveSession(ctx context.Context, token string) error {
+	return s.exec(ctx, qRemoveSession(token))
+}
+
+func (s *Store) RemoveSessions(ctx context.Context, userID int64) ([]string, error) {
+	sql, args, err := qRemoveSessions(userID).ToPgsql()
+	if err != nil {
+		return nil, err // Programmierfehler
+	}
+
+	var tokens []string
+	if err := s.db.SelectContext(ctx, &tokens, sql, args...); err != nil {
+		return nil, mapSQLError(err)
+	}
+
+	return tokens, nil
+}
+
+func (s *Store) RecordLogin(ctx context.Context, ev user.LoginEvent) error {
+	if ev.Success && ev.UserID != 0 {
+		sql, args, err := qTouchLastLogin(ev.UserID).ToPgsql()
+		if err != nil {
+			return err // Programmierfehler
+		}
+
+		res, err := s.db.ExecContext(ctx, sql, args...)
+		if err != nil {
+			return mapSQLError(err)
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return user.ErrNotFound
+		}
+	}
+
+	sql, args, err := qRecordLoginEvent(ev).ToPgsql()
+	if err != nil {
+		return err // Programmierfehler
+	}
+
+	if _, err := s.db.ExecContext(ctx, sql, args...); err != nil {
+		return mapSQLError(err)
+	}
+
+	return nil
+}
+
+func (s *Store) LoginEvents(ctx context.Context, userID int64, limit int) ([]*user.LoginEvent, error) {
+	sql, args, err := qLoginEvents(userID, limit).ToPgsql()
+	if err != nil {
+		// SQL konnte nicht gebaut werden → Programmierfehler
+		return nil, err
+	}
+
+	var events []*user.LoginEvent
+	if err := s.db.SelectContext(ctx, &events, sql, args...); err != nil {
+		return nil, mapSQLError(err)
+	}
+
+	return events, nil
+}
+
+func (s *Store) PruneLoginEvents(ctx context.Context, before time.Time) (int64, error) {
+	sql, args, err := qPruneLoginEvents(user.At(before)).ToPgsql()
+	if err != nil {
+		return 0, err // Programmierfehler
+	}
+
+	res, err := s.db.ExecContext(ctx, sql, args...)
+	if err != nil {
+		return 0, mapSQLError(err)
+	}
+
+	return res.RowsAffected()
+}
+
+func (s *Store) DeleteUser(ctx context.Context, id int64) error {
+	q := qDeleteUser(id)
+
+	sql, args, err := q.ToPgsql()
+	if err != nil {
+		return err // Programmierfehler
+	}
+
+	res, err := s.db.ExecContext(ctx, sql, args...)
+	if err != nil {
+		return mapSQLError(err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return user.ErrNotFound
+	}
+
+	return nil
+}
+
+func (s *Store) FindByID(ctx context.Context, id int64) (*user.User, error) {
+	q := qUserByID(id)
+
+	sql, args, err := q.ToPgsql()
+	if err != nil {
+		// SQL konnte nicht gebaut werden → Programmierfehler
+		return nil, err
+	}
+
+	var u user.User
+	if err := s.db.GetContext(ctx, &u, sql, args...); err != nil {
+		return nil, mapSQLError(err)
+	}
+
+	return &u, nil
+}
+
+func (s *Store) FindByUID(ctx context.Context, uid string) (*user.User, error) {
+	q := qUserByUIDHash(s.uids.Hash(uid))
+
+	sql, args, err := q.ToPgsql()
+	if err != nil {
+		// SQL konnte nicht gebaut werden → Programmierfehler
+		return nil, err
+	}
+
+	var u user.User
+	if err := s.db.GetContext(ctx, &u, sql, args...); err != nil {
+		return nil, mapSQLError(err)
+	}
+
+	return &u, nil
+}
+
+func (s *Store) FindByDisplayName(ctx context.Context, displayName string) (*user.User, error) {
+	q := qUserByDisplayName(displayName)
+
+	sql, args, err := q.ToPgsql()
+	if err != nil {
+		// SQL konnte nicht gebaut werden → Programmierfehler
+		return nil, err
+	}
+
+	var u user.User
+	if err := s.db.GetContext(ctx, &u, sql, args...); err != nil {
+		return nil, mapSQLError(err)
+	}
+
+	return &u, nil
+}
+
+func (s *Store) FindByEmail(ctx context.Context, email string) (*user.User, error) {
+	q := qUserByEmail(email)
+
+	sql, args, err := q.ToPgsql()
+	if err != nil {
+		// SQL konnte nicht gebaut werden → Programmierfehler
+		return nil, err
+	}
+
+	var u user.User
+	if err := s.db.GetContext(ctx, &u, sql, args...); err != nil {
+		return nil, mapSQLError(err)
+	}
+
+	return &u, nil
+}
+
+func (s *Store) ListUsers(ctx context.Context) ([]*user.User, error) {
+	q := qAllUsers()
+
+	sql, args, err := q.ToPgsql()
+	if err != nil {
+		// SQL konnte nicht gebaut werden → Programmierfehler
+		return nil, err
+	}
+
+	var users []*user.User
+	if err := s.db.SelectContext(ctx, &users, sql, args...); err != nil {
+		return nil, mapSQLError(err)
+	}
+
+	return users, nil
+}
+
+func (s *Store) QueryUsers(ctx context.Context, lq user.ListQuery) (*user.ListResult, error) {
+	lq, err := lq.Normalize()
+	if err != nil {
+		return nil, err
+	}
+
+	sql, args, err := qQueryUsers(lq).ToPgsql()
+	if err != nil {
+		// SQL konnte nicht gebaut werden → Programmierfehler
+		return nil, err
+	}
+
+	res := &user.ListResult{}
+	if err := s.db.SelectContext(ctx, &res.Users, sql, args...); err != nil {
+		return nil, mapSQLError(err)
+	}
+
+	sql, args, err = qCountUsers(lq).ToPgsql()
+	if err != nil {
+		return nil, err // Programmierfehler
+	}
+
+	if err := s.db.GetContext(ctx, &res.Total, sql, args...); err != nil {
+		return nil, mapSQLError(err)
+	}
+
+	return res, nil
+}
+
+func (s *Store) CountLegacyUIDs(ctx context.Context) (int64, error) {
+	sql, args, err := qCountLegacyUIDs().ToPgsql()
+	if err != nil {
+		return 0, err // Programmierfehler
+	}
+
+	var n int64
+	if err := s.db.GetContext(ctx, &n, sql, args...); err != nil {
+		return 0, mapSQLError(err)
+	}
+
+	return n, nil
+}
+
+func (s *Store) HashLegacyUIDs(ctx context.Context) (int64, error) {
+	sql, args, err := qLegacyUIDs().ToPgsql()
+	if err != nil {
+		// SQL konnte nicht gebaut werden → Programmierfehler
+		return 0, err
+	}
+
+	var rows []struct {
+		ID  int64  `db:"id"`
+		UID string `db:"uid_hash"`
+	}
+	if err := s.db.SelectContext(ctx, &rows, sql, args...); err != nil {
+		return 0, mapSQLError(err)
+	}
+
+	for _, row := range rows {
+		sql, args, err := qSetUIDHash(row.ID, s.uids.Hash(row.UID)).ToPgsql()
+		if err != nil {
+			return 0, err // Programmierfehler
+		}
+
+		if _, err := s.db.ExecContext(ctx, sql, args...); err != nil {
+			return 0, mapSQLError(err)
+		}
+	}
+
+	return int64(len(rows)), nil
+}
+
+func (s *Store) PurgeUsers(ctx context.Context) ([]int64, error) {
+	q := qPurgeUsers()
+
+	sql, args, err := q.ToPgsql()
+	if err != nil {
+		// SQL konnte nicht gebaut werden → Programmierfehler
+		return nil, err
+	}
+
+	var ids []int64
+	if err := s.db.SelectContext(ctx, &ids, sql, args...); err != nil {
+		return nil, mapSQLError(err)
+	}
+
+	return ids, nil
+}
+
+// exec runs a write query without result.
+func (s *Store) exec(ctx context.Context, q *bqb.Query) error {
+	sql, args, err := q.ToPgsql()
+	if err != nil {
+		return err // Programmierfehler
+	}
+
+	if _, err := s.db.ExecContext(ctx, sql, args...); err != nil {
+		return mapSQLError(err)
+	}
+
+	return nil
+}
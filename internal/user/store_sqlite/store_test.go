@@ -0,0 +1,122 @@
+package storesqlite_test
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/axelrhd/hagg/internal/config"
+	"github.com/axelrhd/hagg/internal/db"
+	"github.com/axelrhd/hagg/internal/user"
+	storesqlite "github.com/axelrhd/hagg/internal/user/store_sqlite"
+	"github.com/axelrhd/hagg/internal/user/storetest"
+)
+
+func TestStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) storetest.Harness {
+		sqlite, err := db.OpenSQLite(config.SQLiteConfig{
+			Path:        filepath.Join(t.TempDir(), "test.sqlite3"),
+			JournalMode: "WAL",
+			Synchronous: "NORMAL",
+			BusyTimeout: 5 * time.Second,
+			ReadConns:   2,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { sqlite.Close() })
+
+		for _, up := range storetest.MigrationsUp(t, "../../../migrations") {
+			if _, err := sqlite.Write.Exec(up); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		uids := user.NewUIDHasher(storetest.Pepper)
+		return storetest.Harness{
+			Store: storesqlite.New(sqlite.Write, sqlite.Read, uids),
+			UIDs:  uids,
+			InsertLegacyUID: func(t *testing.T, uid, displayName string) {
+				_, err := sqlite.Write.Exec(`INSERT INTO users (uid_hash, display_name) VALUES (?, ?)`, uid, displayName)
+				if err != nil {
+					t.Fatal(err)
+				}
+			},
+		}
+	})
+}
+
+// TestQueryLogRedactsSecrets runs the statements that carry credentials
+// through the query logger: none of them may reach the log.
+func TestQueryLogRedactsSecrets(t *testing.T) {
+	sqlite, err := db.OpenSQLite(config.SQLiteConfig{
+		Path:        filepath.Join(t.TempDir(), "test.sqlite3"),
+		JournalMode: "WAL",
+		Synchronous: "NORMAL",
+		BusyTimeout: 5 * time.Second,
+		ReadConns:   2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sqlite.Close() })
+
+	for _, up := range storetest.MigrationsUp(t, "../../../migrations") {
+		if _, err := sqlite.Write.Exec(up); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var buf bytes.Buffer
+	ql := db.NewQueryLogger(slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})), 0)
+	uids := user.NewUIDHasher(storetest.Pepper)
+	s := storesqlite.New(ql.Wrap(sqlite.Write), ql.Wrap(sqlite.Read), uids)
+	ctx := context.Background()
+
+	const (
+		uid      = "UID-SECRET-4711"
+		newUID   = "UID-SECRET-4712"
+		password = "$argon2id$v=19$m=65536,t=3,p=2$secret-hash"
+		totp     = "JBSWY3DPEHPK3PXPSECRET"
+		code     = "rcode-secret"
+		token    = "session-token-secret"
+		newToken = "session-token-secret-2"
+	)
+
+	steps := []func() error{
+		func() error {
+			_, err := s.CreateUser(ctx, user.CreateUserInput{UID: uid, DisplayName: "alice"})
+			return err
+		},
+		func() error { _, err := s.FindByUID(ctx, uid); return err },
+		func() error { _, err := s.RotateUID(ctx, 1, newUID); return err },
+		func() error { return s.SetPassword(ctx, 1, password) },
+		func() error { return s.SetTOTP(ctx, 1, totp) },
+		func() error { return s.SetRecoveryCodes(ctx, 1, []string{code}) },
+		func() error { return s.UseRecoveryCode(ctx, 1, code) },
+		func() error {
+			return s.AddSession(ctx, user.Session{UserID: 1, Token: token}, time.Now().Add(time.Hour))
+		},
+		func() error { return s.RenewSession(ctx, token, newToken, time.Now().Add(time.Hour)) },
+		func() error { return s.RemoveSession(ctx, newToken) },
+	}
+	for i, step := range steps {
+		if err := step(); err != nil {
+			t.Fatalf("step %d: %v", i+1, err)
+		}
+	}
+
+	out := buf.String()
+	if !strings.Contains(out, "[REDACTED]") {
+		t.Fatalf("no redaction marker in the log:\n%s", out)
+	}
+	for _, secret := range []string{uid, newUID, uids.Hash(uid), uids.Hash(newUID), password, totp, code, token, newToken} {
+		if strings.Contains(out, secret) {
+			t.Errorf("%q in the query log", secret)
+		}
+	}
+}
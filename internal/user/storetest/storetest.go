@@ -0,0 +1,824 @@
+// Package storetest is the contract every user.Store implementation must
+// fulfil. The backends run it from their own tests:
+//
+//	func TestStore(t *testing.T) {
+//	    storetest.Run(t, func(t *testing.T) storetest.Harness {
+//	        ... // fresh, migrated database
+//	        return storetest.Harness{Store: store, UIDs: uids}
+//	    })
+//	}
+package storetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/axelrhd/hagg/internal/user"
+)
+
+// Pepper is the AUTH_UID_PEPPER of the test stores.
+const Pepper = "storetest-pepper-0123456789abcdef0123"
+
+// Harness is one fresh, empty store.
+type Harness struct {
+	Store user.Store
+	UIDs  *user.UIDHasher // the hasher of Store
+
+	// InsertLegacyUID adds a user with a plaintext UID, as stored before
+	// migration 00004. nil: the backend has no legacy rows (memory).
+	InsertLegacyUID func(t *testing.T, uid, displayName string)
+}
+
+// Run runs the contract against fresh stores returned by open (one per
+// subtest).
+func Run(t *testing.T, open func(t *testing.T) Harness) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, h Harness)
+	}{
+		{"CreateAndFind", testCreateAndFind},
+		{"UIDHash", testUIDHash},
+		{"LegacyUIDs", testLegacyUIDs},
+		{"Update", testUpdate},
+		{"SoftDelete", testSoftDelete},
+		{"Purge", testPurge},
+		{"QueryUsers", testQueryUsers},
+		{"QueryUsersOrder", testQueryUsersOrder},
+		{"QueryUsersPaging", testQueryUsersPaging},
+		{"QueryUsersFilter", testQueryUsersFilter},
+		{"Password", testPassword},
+		{"TOTP", testTOTP},
+		{"RecoveryCodes", testRecoveryCodes},
+		{"LoginEvents", testLoginEvents},
+		{"Sessions", testSessions},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, open(t))
+		})
+	}
+}
+
+// MigrationsUp returns the "+goose Up" sections of the migrations in dir,
+// in order. Tests apply them to an empty database instead of running goose.
+func MigrationsUp(t *testing.T, dir string) []string {
+	t.Helper()
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.sql"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(files)
+
+	var ups []string
+	for _, f := range files {
+		b, err := os.ReadFile(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		up, _, _ := strings.Cut(string(b), "-- +goose Down")
+		ups = append(ups, up)
+	}
+
+	return ups
+}
+
+// -----------------------------------------------------------------------------
+// Users
+// -----------------------------------------------------------------------------
+
+func testCreateAndFind(t *testing.T, h Harness) {
+	ctx := context.Background()
+
+	u := mustCreate(t, h, "UID-ALICE", "alice")
+	if u.ID == 0 || u.DisplayName != "alice" || u.Status != user.StatusActive {
+		t.Fatalf("created user = %+v", u)
+	}
+
+	for name, find := range map[string]func() (*user.User, error){
+		"FindByID":          func() (*user.User, error) { return h.Store.FindByID(ctx, u.ID) },
+		"FindByUID":         func() (*user.User, error) { return h.Store.FindByUID(ctx, "UID-ALICE") },
+		"FindByDisplayName": func() (*user.User, error) { return h.Store.FindByDisplayName(ctx, "alice") },
+	} {
+		got, err := find()
+		if err != nil || got.ID != u.ID {
+			t.Errorf("%s = %v, %v; want user %d", name, got, err, u.ID)
+		}
+	}
+
+	if _, err := h.Store.FindByUID(ctx, "UID-BOB"); !errors.Is(err, user.ErrNotFound) {
+		t.Errorf("FindByUID(unknown) err = %v, want ErrNotFound", err)
+	}
+	if _, err := h.Store.FindByID(ctx, u.ID+100); !errors.Is(err, user.ErrNotFound) {
+		t.Errorf("FindByID(unknown) err = %v, want ErrNotFound", err)
+	}
+
+	_, err := h.Store.CreateUser(ctx, user.CreateUserInput{UID: "UID-OTHER", DisplayName: "alice"})
+	if !errors.Is(err, user.ErrAlreadyExists) {
+		t.Errorf("duplicate display name err = %v, want ErrAlreadyExists", err)
+	}
+	_, err = h.Store.CreateUser(ctx, user.CreateUserInput{UID: "UID-ALICE", DisplayName: "alice2"})
+	if !errors.Is(err, user.ErrAlreadyExists) {
+		t.Errorf("duplicate UID err = %v, want ErrAlreadyExists", err)
+	}
+}
+
+func testUIDHash(t *testing.T, h Harness) {
+	ctx := context.Background()
+
+	u := mustCreate(t, h, "UID-SECRET", "alice")
+	if u.UIDHash != h.UIDs.Hash("UID-SECRET") || !user.IsUIDHash(u.UIDHash) {
+		t.Fatalf("UIDHash = %q, want the HMAC of the UID", u.UIDHash)
+	}
+	if strings.Contains(u.UIDHash, "UID-SECRET") {
+		t.Fatal("UIDHash contains the plaintext UID")
+	}
+
+	rotated, err := h.Store.RotateUID(ctx, u.ID, "UID-NEW")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rotated.SessionVersion != u.SessionVersion+1 {
+		t.Errorf("SessionVersion after RotateUID = %d, want %d", rotated.SessionVersion, u.SessionVersion+1)
+	}
+	if _, err := h.Store.FindByUID(ctx, "UID-SECRET"); !errors.Is(err, user.ErrNotFound) {
+		t.Errorf("old UID still finds the user: %v", err)
+	}
+	if got, err := h.Store.FindByUID(ctx, "UID-NEW"); err != nil || got.ID != u.ID {
+		t.Errorf("FindByUID(new UID) = %v, %v", got, err)
+	}
+
+	revoked, err := h.Store.RevokeSessions(ctx, u.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if revoked.SessionVersion != rotated.SessionVersion+1 {
+		t.Errorf("SessionVersion after RevokeSessions = %d, want %d", revoked.SessionVersion, rotated.SessionVersion+1)
+	}
+}
+
+func testLegacyUIDs(t *testing.T, h Harness) {
+	if h.InsertLegacyUID == nil {
+		t.Skip("backend has no plaintext UIDs")
+	}
+	ctx := context.Background()
+
+	mustCreate(t, h, "UID-HASHED", "hashed")
+	h.InsertLegacyUID(t, "UID-PLAIN", "legacy")
+
+	if _, err := h.Store.FindByUID(ctx, "UID-PLAIN"); !errors.Is(err, user.ErrNotFound) {
+		t.Fatalf("plaintext UID found before hashing: %v", err)
+	}
+
+	if n, err := h.Store.CountLegacyUIDs(ctx); err != nil || n != 1 {
+		t.Fatalf("CountLegacyUIDs = %d, %v; want 1", n, err)
+	}
+
+	n, err := h.Store.HashLegacyUIDs(ctx)
+	if err != nil || n != 1 {
+		t.Fatalf("HashLegacyUIDs = %d, %v; want 1", n, err)
+	}
+	if got, err := h.Store.FindByUID(ctx, "UID-PLAIN"); err != nil || got.DisplayName != "legacy" {
+		t.Fatalf("FindByUID after hashing = %v, %v", got, err)
+	}
+	if got, err := h.Store.FindByUID(ctx, "UID-HASHED"); err != nil || got.DisplayName != "hashed" {
+		t.Fatalf("hashed UID broken by HashLegacyUIDs: %v, %v", got, err)
+	}
+
+	if n, err := h.Store.CountLegacyUIDs(ctx); err != nil || n != 0 {
+		t.Fatalf("CountLegacyUIDs after hashing = %d, %v; want 0", n, err)
+	}
+	if n, err := h.Store.HashLegacyUIDs(ctx); err != nil || n != 0 {
+		t.Fatalf("second HashLegacyUIDs = %d, %v; want 0", n, err)
+	}
+}
+
+func testUpdate(t *testing.T, h Harness) {
+	ctx := context.Background()
+
+	u := mustCreate(t, h, "UID-ALICE", "alice")
+	mustCreate(t, h, "UID-BOB", "bob")
+
+	name, first, email := "alicia", "Alice", "alice@example.com"
+	attrs := user.Attributes{"team": "ops", "level": float64(3)}
+	got, err := h.Store.UpdateUser(ctx, u.ID, user.UpdateUserInput{
+		DisplayName: &name,
+		FirstName:   &first,
+		Email:       &email,
+		Attributes:  &attrs,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.DisplayName != name || got.FirstName != first || got.Email != email || got.HasVerifiedEmail() {
+		t.Errorf("updated user = %+v", got)
+	}
+	if team, _ := got.Attributes.String("team"); team != "ops" {
+		t.Errorf("attributes = %v", got.Attributes)
+	}
+
+	if found, err := h.Store.FindByEmail(ctx, email); err != nil || found.ID != u.ID {
+		t.Errorf("FindByEmail = %v, %v", found, err)
+	}
+	if _, err := h.Store.FindByDisplayName(ctx, "alice"); !errors.Is(err, user.ErrNotFound) {
+		t.Errorf("old display name still finds the user: %v", err)
+	}
+
+	taken := "bob"
+	if _, err := h.Store.UpdateUser(ctx, u.ID, user.UpdateUserInput{DisplayName: &taken}); !errors.Is(err, user.ErrAlreadyExists) {
+		t.Errorf("rename to a taken name err = %v, want ErrAlreadyExists", err)
+	}
+
+	disabled := user.StatusDisabled
+	got, err = h.Store.UpdateUser(ctx, u.ID, user.UpdateUserInput{Status: &disabled})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !errors.Is(got.CheckAccess(time.Now()), user.ErrDisabled) {
+		t.Errorf("CheckAccess of disabled user = %v", got.CheckAccess(time.Now()))
+	}
+}
+
+func testSoftDelete(t *testing.T, h Harness) {
+	ctx := context.Background()
+
+	u := mustCreate(t, h, "UID-ALICE", "alice")
+	mustCreate(t, h, "UID-BOB", "bob")
+
+	if err := h.Store.DeleteUser(ctx, u.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Store.DeleteUser(ctx, u.ID); !errors.Is(err, user.ErrNotFound) {
+		t.Errorf("second DeleteUser err = %v, want ErrNotFound", err)
+	}
+
+	if _, err := h.Store.FindByID(ctx, u.ID); !errors.Is(err, user.ErrNotFound) {
+		t.Errorf("FindByID(deleted) err = %v", err)
+	}
+	if _, err := h.Store.FindByUID(ctx, "UID-ALICE"); !errors.Is(err, user.ErrNotFound) {
+		t.Errorf("FindByUID(deleted) err = %v", err)
+	}
+
+	users, err := h.Store.ListUsers(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 1 || users[0].DisplayName != "bob" {
+		t.Errorf("ListUsers = %v, want only bob", displayNames(users))
+	}
+
+	res, err := h.Store.QueryUsers(ctx, user.ListQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Total != 1 {
+		t.Errorf("QueryUsers total = %d, want 1", res.Total)
+	}
+
+	// name and UID are free again, the new user gets a new ID
+	again := mustCreate(t, h, "UID-ALICE", "alice")
+	if again.ID == u.ID {
+		t.Errorf("recreated user reuses ID %d", u.ID)
+	}
+}
+
+func testPurge(t *testing.T, h Harness) {
+	ctx := context.Background()
+
+	alice := mustCreate(t, h, "UID-ALICE", "alice")
+	bob := mustCreate(t, h, "UID-BOB", "bob")
+	if err := h.Store.DeleteUser(ctx, bob.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	ids, err := h.Store.PurgeUsers(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(ids)
+	if !slices.Equal(ids, []int64{alice.ID, bob.ID}) {
+		t.Errorf("PurgeUsers = %v, want live and deleted user [%d %d]", ids, alice.ID, bob.ID)
+	}
+
+	if res, err := h.Store.QueryUsers(ctx, user.ListQuery{}); err != nil || res.Total != 0 {
+		t.Errorf("users after PurgeUsers = %v, %v", res, err)
+	}
+	if ids, err := h.Store.PurgeUsers(ctx); err != nil || len(ids) != 0 {
+		t.Errorf("second PurgeUsers = %v, %v; want none", ids, err)
+	}
+}
+
+func testQueryUsers(t *testing.T, h Harness) {
+	ctx := context.Background()
+
+	for _, n := range []struct{ uid, name, first, last string }{
+		{"UID-1", "anna", "Anna", "Schmidt"},
+		{"UID-2", "bernd", "Bernd", "Schmitt"},
+		{"UID-3", "carla", "Carla", "Meyer"},
+		{"UID-4", "dora_x", "Dora", "Maier"},
+		{"UID-5", "doraxy", "Dora", "Mayer"},
+	} {
+		_, err := h.Store.CreateUser(ctx, user.CreateUserInput{UID: n.uid, DisplayName: n.name, FirstName: n.first, LastName: n.last})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name  string
+		q     user.ListQuery
+		want  []string
+		total int64
+	}{
+		{"all", user.ListQuery{}, []string{"anna", "bernd", "carla", "dora_x", "doraxy"}, 5},
+		{"search last name, any case", user.ListQuery{Search: "SCHMI"}, []string{"anna", "bernd"}, 2},
+		{"search first name", user.ListQuery{Search: "carl"}, []string{"carla"}, 1},
+		{"wildcard is literal", user.ListQuery{Search: "a_x"}, []string{"dora_x"}, 1},
+		{"percent is literal", user.ListQuery{Search: "%"}, nil, 0},
+		{"sort desc", user.ListQuery{Sort: user.SortDisplayName, Desc: true, Limit: 2}, []string{"doraxy", "dora_x"}, 5},
+		{"page", user.ListQuery{Sort: user.SortDisplayName, Limit: 2, Offset: 2}, []string{"carla", "dora_x"}, 5},
+		{"offset past end", user.ListQuery{Offset: 10}, nil, 5},
+		{"never logged in, created before", user.ListQuery{InactiveSince: time.Now().Add(time.Hour)}, []string{"anna", "bernd", "carla", "dora_x", "doraxy"}, 5},
+		{"created after", user.ListQuery{InactiveSince: time.Now().Add(-time.Hour)}, nil, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := h.Store.QueryUsers(ctx, tt.q)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := displayNames(res.Users); !slices.Equal(got, tt.want) || res.Total != tt.total {
+				t.Errorf("QueryUsers = %v (total %d), want %v (total %d)", got, res.Total, tt.want, tt.total)
+			}
+		})
+	}
+
+	if _, err := h.Store.QueryUsers(ctx, user.ListQuery{Sort: "uid_hash"}); err == nil {
+		t.Error("QueryUsers accepted an unknown sort field")
+	}
+}
+
+// testQueryUsersOrder pins the order of every sort field: text sorts
+// bytewise (uppercase before lowercase before umlauts) in every backend,
+// ties are broken by id in the direction of the sort.
+func testQueryUsersOrder(t *testing.T, h Harness) {
+	ctx := context.Background()
+
+	for _, n := range []struct{ uid, name, first, last string }{
+		{"UID-1", "zoe", "anna", "Meyer"},
+		{"UID-2", "Anton", "Zoe", "meyer"},
+		{"UID-3", "ärmel", "Anton", "Meyer"},
+		{"UID-4", "bob", "Ärmel", "Meyer"},
+	} {
+		_, err := h.Store.CreateUser(ctx, user.CreateUserInput{UID: n.uid, DisplayName: n.name, FirstName: n.first, LastName: n.last})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		sort user.SortField
+		want []string // ascending
+	}{
+		{user.SortID, []string{"zoe", "Anton", "ärmel", "bob"}},
+		{user.SortDisplayName, []string{"Anton", "bob", "zoe", "ärmel"}},
+		{user.SortFirstName, []string{"ärmel", "Anton", "zoe", "bob"}},
+		{user.SortLastName, []string{"zoe", "ärmel", "bob", "Anton"}}, // ties by id
+		// created within the same second: ties by id
+		{user.SortCreatedAt, []string{"zoe", "Anton", "ärmel", "bob"}},
+		{user.SortUpdatedAt, []string{"zoe", "Anton", "ärmel", "bob"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.sort), func(t *testing.T) {
+			res, err := h.Store.QueryUsers(ctx, user.ListQuery{Sort: tt.sort})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := displayNames(res.Users); !slices.Equal(got, tt.want) {
+				t.Errorf("ascending = %q, want %q", got, tt.want)
+			}
+
+			res, err = h.Store.QueryUsers(ctx, user.ListQuery{Sort: tt.sort, Desc: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := slices.Clone(tt.want)
+			slices.Reverse(want)
+			if got := displayNames(res.Users); !slices.Equal(got, want) {
+				t.Errorf("descending = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+// testQueryUsersPaging walks every sort in pages: together they are the
+// whole listing, without gaps or repeats.
+func testQueryUsersPaging(t *testing.T, h Harness) {
+	ctx := context.Background()
+
+	const users = user.DefaultListLimit + 5
+	for i := range users {
+		// few distinct last names: many ties
+		_, err := h.Store.CreateUser(ctx, user.CreateUserInput{
+			UID:         fmt.Sprintf("UID-%03d", i),
+			DisplayName: fmt.Sprintf("user-%03d", (i*37)%users),
+			LastName:    []string{"Meyer", "Maier", "Mayer"}[i%3],
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// defaults: the first user.DefaultListLimit users by id
+	res, err := h.Store.QueryUsers(ctx, user.ListQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Users) != user.DefaultListLimit || res.Total != users {
+		t.Fatalf("default page = %d users (total %d), want %d (total %d)", len(res.Users), res.Total, user.DefaultListLimit, users)
+	}
+	if res.Users[0].ID >= res.Users[len(res.Users)-1].ID {
+		t.Error("default page not sorted by id")
+	}
+
+	// limits above user.MaxListLimit are capped, negative offsets start at 0
+	res, err = h.Store.QueryUsers(ctx, user.ListQuery{Limit: user.MaxListLimit + 1, Offset: -5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Users) != users {
+		t.Errorf("Limit %d, Offset -5 = %d users, want all %d", user.MaxListLimit+1, len(res.Users), users)
+	}
+
+	for _, sort := range user.SortFields {
+		for _, desc := range []bool{false, true} {
+			all, err := h.Store.QueryUsers(ctx, user.ListQuery{Sort: sort, Desc: desc, Limit: user.MaxListLimit})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var paged []string
+			for offset := 0; offset < users; offset += 7 {
+				page, err := h.Store.QueryUsers(ctx, user.ListQuery{Sort: sort, Desc: desc, Limit: 7, Offset: offset})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if page.Total != users {
+					t.Fatalf("%s desc=%t offset %d: total %d, want %d", sort, desc, offset, page.Total, users)
+				}
+				paged = append(paged, displayNames(page.Users)...)
+			}
+
+			if want := displayNames(all.Users); !slices.Equal(paged, want) {
+				t.Errorf("%s desc=%t: pages = %q, want %q", sort, desc, paged, want)
+			}
+		}
+	}
+}
+
+// testQueryUsersFilter combines search, inactivity and paging and checks
+// that deleted users never count.
+func testQueryUsersFilter(t *testing.T, h Harness) {
+	ctx := context.Background()
+
+	var ids []int64
+	for _, n := range []struct{ uid, name, last string }{
+		{"UID-1", "anna", "Schmidt"},
+		{"UID-2", "bernd", "Schmitt"},
+		{"UID-3", "carla", "Schmidt"},
+		{"UID-4", "dora", "Schmidt"},
+	} {
+		u, err := h.Store.CreateUser(ctx, user.CreateUserInput{UID: n.uid, DisplayName: n.name, LastName: n.last})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, u.ID)
+	}
+
+	// dora is deleted, bernd logs in
+	if err := h.Store.DeleteUser(ctx, ids[3]); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Store.RecordLogin(ctx, user.LoginEvent{UserID: ids[1], Success: true, IP: "192.0.2.1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	soon := time.Now().Add(time.Hour)
+	tests := []struct {
+		name  string
+		q     user.ListQuery
+		want  []string
+		total int64
+	}{
+		{"deleted not listed", user.ListQuery{}, []string{"anna", "bernd", "carla"}, 3},
+		{"deleted not found", user.ListQuery{Search: "dora"}, nil, 0},
+		{"search, second page", user.ListQuery{Search: "schmidt", Limit: 1, Offset: 1}, []string{"carla"}, 2},
+		{"search, descending", user.ListQuery{Search: "schmi", Sort: user.SortDisplayName, Desc: true}, []string{"carla", "bernd", "anna"}, 3},
+		{"inactive", user.ListQuery{InactiveSince: soon}, []string{"anna", "bernd", "carla"}, 3},
+		{"inactive and search", user.ListQuery{InactiveSince: soon, Search: "schmitt"}, []string{"bernd"}, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := h.Store.QueryUsers(ctx, tt.q)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := displayNames(res.Users); !slices.Equal(got, tt.want) || res.Total != tt.total {
+				t.Errorf("QueryUsers = %v (total %d), want %v (total %d)", got, res.Total, tt.want, tt.total)
+			}
+		})
+	}
+}
+
+// -----------------------------------------------------------------------------
+// Credentials
+// -----------------------------------------------------------------------------
+
+func testPassword(t *testing.T, h Harness) {
+	ctx := context.Background()
+
+	u := mustCreate(t, h, "UID-ALICE", "alice")
+
+	if _, err := h.Store.PasswordHash(ctx, u.ID); !errors.Is(err, user.ErrNoPassword) {
+		t.Fatalf("PasswordHash without password err = %v, want ErrNoPassword", err)
+	}
+
+	for _, hash := range []string{"$argon2id$first", "$argon2id$second"} {
+		if err := h.Store.SetPassword(ctx, u.ID, hash); err != nil {
+			t.Fatal(err)
+		}
+		if got, err := h.Store.PasswordHash(ctx, u.ID); err != nil || got != hash {
+			t.Fatalf("PasswordHash = %q, %v; want %q", got, err, hash)
+		}
+	}
+
+	// passwords never touch the sessions
+	if got, _ := h.Store.FindByID(ctx, u.ID); got.SessionVersion != u.SessionVersion {
+		t.Errorf("SetPassword changed SessionVersion")
+	}
+
+	if err := h.Store.SetPassword(ctx, u.ID, ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.Store.PasswordHash(ctx, u.ID); !errors.Is(err, user.ErrNoPassword) {
+		t.Errorf("PasswordHash after removal err = %v, want ErrNoPassword", err)
+	}
+
+	if _, err := h.Store.PasswordHash(ctx, u.ID+100); !errors.Is(err, user.ErrNoPassword) {
+		t.Errorf("PasswordHash(unknown user) err = %v, want ErrNoPassword", err)
+	}
+}
+
+func testTOTP(t *testing.T, h Harness) {
+	ctx := context.Background()
+
+	u := mustCreate(t, h, "UID-ALICE", "alice")
+
+	if _, err := h.Store.TOTP(ctx, u.ID); !errors.Is(err, user.ErrNoTOTP) {
+		t.Fatalf("TOTP without enrolment err = %v, want ErrNoTOTP", err)
+	}
+	if err := h.Store.UseTOTPStep(ctx, u.ID, 1); !errors.Is(err, user.ErrInvalidCode) {
+		t.Errorf("UseTOTPStep without enrolment err = %v, want ErrInvalidCode", err)
+	}
+
+	if err := h.Store.SetTOTP(ctx, u.ID, "SECRET1"); err != nil {
+		t.Fatal(err)
+	}
+	tt, err := h.Store.TOTP(ctx, u.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tt.Secret != "SECRET1" || tt.Active() {
+		t.Fatalf("new enrolment = %+v, want inactive with SECRET1", tt)
+	}
+
+	// the first code confirms, a step is never accepted twice
+	for _, step := range []struct {
+		step int64
+		ok   bool
+	}{{100, true}, {100, false}, {99, false}, {101, true}} {
+		err := h.Store.UseTOTPStep(ctx, u.ID, step.step)
+		if step.ok && err != nil || !step.ok && !errors.Is(err, user.ErrInvalidCode) {
+			t.Errorf("UseTOTPStep(%d) err = %v, want ok=%t", step.step, err, step.ok)
+		}
+	}
+	tt, _ = h.Store.TOTP(ctx, u.ID)
+	if !tt.Active() || tt.LastStep != 101 {
+		t.Errorf("enrolment after codes = %+v, want active with LastStep 101", tt)
+	}
+
+	// a new enrolment starts over
+	if err := h.Store.SetTOTP(ctx, u.ID, "SECRET2"); err != nil {
+		t.Fatal(err)
+	}
+	tt, _ = h.Store.TOTP(ctx, u.ID)
+	if tt.Secret != "SECRET2" || tt.Active() || tt.LastStep != 0 {
+		t.Errorf("replaced enrolment = %+v", tt)
+	}
+
+	if err := h.Store.DeleteTOTP(ctx, u.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.Store.TOTP(ctx, u.ID); !errors.Is(err, user.ErrNoTOTP) {
+		t.Errorf("TOTP after DeleteTOTP err = %v, want ErrNoTOTP", err)
+	}
+}
+
+func testRecoveryCodes(t *testing.T, h Harness) {
+	ctx := context.Background()
+
+	u := mustCreate(t, h, "UID-ALICE", "alice")
+	if err := h.Store.SetTOTP(ctx, u.ID, "SECRET"); err != nil {
+		t.Fatal(err)
+	}
+
+	codes, err := user.GenerateRecoveryCodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Store.SetRecoveryCodes(ctx, u.ID, codes); err != nil {
+		t.Fatal(err)
+	}
+	if tt, _ := h.Store.TOTP(ctx, u.ID); tt.RecoveryCodes != user.RecoveryCodeCount {
+		t.Fatalf("RecoveryCodes = %d, want %d", tt.RecoveryCodes, user.RecoveryCodeCount)
+	}
+
+	code := user.NormalizeRecoveryCode(strings.ToLower(codes[0]))
+	if err := h.Store.UseRecoveryCode(ctx, u.ID, code); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Store.UseRecoveryCode(ctx, u.ID, code); !errors.Is(err, user.ErrInvalidCode) {
+		t.Errorf("reused recovery code err = %v, want ErrInvalidCode", err)
+	}
+	if err := h.Store.UseRecoveryCode(ctx, u.ID, "AAAABBBBCCCC"); !errors.Is(err, user.ErrInvalidCode) {
+		t.Errorf("unknown recovery code err = %v, want ErrInvalidCode", err)
+	}
+	if tt, _ := h.Store.TOTP(ctx, u.ID); tt.RecoveryCodes != user.RecoveryCodeCount-1 {
+		t.Errorf("RecoveryCodes after use = %d, want %d", tt.RecoveryCodes, user.RecoveryCodeCount-1)
+	}
+
+	// codes of another user do not work
+	other := mustCreate(t, h, "UID-BOB", "bob")
+	if err := h.Store.UseRecoveryCode(ctx, other.ID, user.NormalizeRecoveryCode(codes[1])); !errors.Is(err, user.ErrInvalidCode) {
+		t.Errorf("recovery code of another user err = %v, want ErrInvalidCode", err)
+	}
+
+	// deleting 2FA removes the codes
+	if err := h.Store.DeleteTOTP(ctx, u.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Store.UseRecoveryCode(ctx, u.ID, user.NormalizeRecoveryCode(codes[1])); !errors.Is(err, user.ErrInvalidCode) {
+		t.Errorf("recovery code after DeleteTOTP err = %v, want ErrInvalidCode", err)
+	}
+}
+
+// -----------------------------------------------------------------------------
+// Login history
+// -----------------------------------------------------------------------------
+
+func testLoginEvents(t *testing.T, h Harness) {
+	ctx := context.Background()
+
+	u := mustCreate(t, h, "UID-ALICE", "alice")
+	for _, ev := range []user.LoginEvent{
+		{UserID: u.ID, Success: false, Reason: "wrong password", IP: "192.0.2.1"},
+		{UserID: u.ID, Success: true, IP: "192.0.2.1"},
+		{Success: false, Reason: "unknown uid", IP: "192.0.2.9"}, // no user
+	} {
+		if err := h.Store.RecordLogin(ctx, ev); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	events, err := h.Store.LoginEvents(ctx, u.ID, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 || !events[0].Success || events[1].Reason != "wrong password" {
+		t.Fatalf("LoginEvents = %+v, want success after failure, newest first", events)
+	}
+	if got, _ := h.Store.FindByID(ctx, u.ID); got.LoginCount != 1 || !got.LastLoginAt.Valid {
+		t.Errorf("after a successful login: LoginCount = %d, LastLoginAt = %v", got.LoginCount, got.LastLoginAt)
+	}
+
+	if n, err := h.Store.PruneLoginEvents(ctx, time.Now().Add(-time.Hour)); err != nil || n != 0 {
+		t.Errorf("PruneLoginEvents(an hour ago) = %d, %v; want 0", n, err)
+	}
+	if n, err := h.Store.PruneLoginEvents(ctx, time.Now().Add(time.Hour)); err != nil || n != 3 {
+		t.Errorf("PruneLoginEvents(in an hour) = %d, %v; want 3", n, err)
+	}
+	if events, _ := h.Store.LoginEvents(ctx, u.ID, 10); len(events) != 0 {
+		t.Errorf("LoginEvents after pruning = %+v", events)
+	}
+}
+
+// -----------------------------------------------------------------------------
+// Sessions
+// -----------------------------------------------------------------------------
+
+func testSessions(t *testing.T, h Harness) {
+	ctx := context.Background()
+
+	u := mustCreate(t, h, "UID-ALICE", "alice")
+	other := mustCreate(t, h, "UID-BOB", "bob")
+	later := time.Now().Add(time.Hour)
+
+	for _, s := range []user.Session{
+		{UserID: u.ID, Token: "tok-1", IP: "192.0.2.1", UserAgent: "Firefox"},
+		{UserID: u.ID, Token: "tok-2", IP: "192.0.2.2", UserAgent: "curl"},
+		{UserID: other.ID, Token: "tok-3"},
+	} {
+		if err := h.Store.AddSession(ctx, s, later); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := h.Store.AddSession(ctx, user.Session{UserID: u.ID, Token: "tok-old"}, time.Now().Add(-time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Store.AddSession(ctx, user.Session{UserID: u.ID + 100, Token: "tok-x"}, later); !errors.Is(err, user.ErrNotFound) {
+		t.Errorf("AddSession(unknown user) err = %v, want ErrNotFound", err)
+	}
+
+	if got := sessionTokens(t, h, u.ID); !slices.Equal(got, []string{"tok-2", "tok-1"}) {
+		t.Fatalf("Sessions = %v, want newest first without expired", got)
+	}
+	if s, _ := h.Store.Sessions(ctx, u.ID); s[0].IP != "192.0.2.2" || s[0].UserAgent != "curl" {
+		t.Errorf("session = %+v", s[0])
+	}
+
+	if err := h.Store.RenewSession(ctx, "tok-1", "tok-1b", later); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Store.RemoveSession(ctx, "tok-2"); err != nil {
+		t.Fatal(err)
+	}
+	if got := sessionTokens(t, h, u.ID); !slices.Equal(got, []string{"tok-1b"}) {
+		t.Fatalf("Sessions after renew and remove = %v, want [tok-1b]", got)
+	}
+
+	if err := h.Store.AddSession(ctx, user.Session{UserID: u.ID, Token: "tok-4"}, later); err != nil {
+		t.Fatal(err)
+	}
+	tokens, err := h.Store.RemoveSessions(ctx, u.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(tokens)
+	if !slices.Equal(tokens, []string{"tok-1b", "tok-4"}) {
+		t.Errorf("RemoveSessions = %v, want [tok-1b tok-4]", tokens)
+	}
+	if got := sessionTokens(t, h, u.ID); len(got) != 0 {
+		t.Errorf("Sessions after RemoveSessions = %v", got)
+	}
+	if got := sessionTokens(t, h, other.ID); !slices.Equal(got, []string{"tok-3"}) {
+		t.Errorf("sessions of another user = %v, want [tok-3]", got)
+	}
+}
+
+// -----------------------------------------------------------------------------
+// Helpers
+// -----------------------------------------------------------------------------
+
+func mustCreate(t *testing.T, h Harness, uid, displayName string) *user.User {
+	t.Helper()
+
+	u, err := h.Store.CreateUser(context.Background(), user.CreateUserInput{UID: uid, DisplayName: displayName})
+	if err != nil {
+		t.Fatalf("CreateUser(%s): %v", displayName, err)
+	}
+	return u
+}
+
+func displayNames(users []*user.User) []string {
+	var names []string
+	for _, u := range users {
+		names = append(names, u.DisplayName)
+	}
+	return names
+}
+
+func sessionTokens(t *testing.T, h Harness, userID int64) []string {
+	t.Helper()
+
+	sessions, err := h.Store.Sessions(context.Background(), userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tokens []string
+	for _, s := range sessions {
+		tokens = append(tokens, s.Token)
+	}
+	return tokens
+}
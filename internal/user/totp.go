@@ -0,0 +1,87 @@
+package user
+
+import (
+	"crypto/rand"
+	"strings"
+
+	"github.com/axelrhd/litetime"
+)
+
+// TOTP is the authenticator app enrolment of a user (see package totp).
+// An enrolment is only active once it was confirmed with a first code.
+type TOTP struct {
+	UserID      int64    `db:"user_id"`
+	Secret      string   `db:"secret"` // base32, needed to verify codes
+	ConfirmedAt NullTime `db:"confirmed_at"`
+
+	// LastStep is the time step of the last accepted code;
+	// a code is never accepted twice.
+	LastStep int64 `db:"last_step"`
+
+	// RecoveryCodes is the number of unused recovery codes.
+	RecoveryCodes int `db:"recovery_codes"`
+
+	CreatedAt litetime.Time `db:"created_at"`
+}
+
+// Active reports whether codes are required at login.
+func (t *TOTP) Active() bool {
+	return t != nil && t.ConfirmedAt.Valid
+}
+
+// -----------------------------------------------------------------------------
+// Recovery codes
+// -----------------------------------------------------------------------------
+
+const (
+	// RecoveryCodeCount is the number of codes issued at once.
+	RecoveryCodeCount = 10
+
+	recoveryCodeBytes = 8 // 64 bit → 13 base32 characters, 12 used
+	recoveryCodeLen   = 12
+	recoveryGroupSize = 4
+)
+
+// GenerateRecoveryCodes returns RecoveryCodeCount random single-use codes
+// in grouped form, e.g. "7K3M-QX9D-2HBT". Only their hashes are stored.
+func GenerateRecoveryCodes() ([]string, error) {
+	codes := make([]string, RecoveryCodeCount)
+
+	for i := range codes {
+		b := make([]byte, recoveryCodeBytes)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		codes[i] = groupCode(uidEncoding.EncodeToString(b)[:recoveryCodeLen], recoveryGroupSize)
+	}
+
+	return codes, nil
+}
+
+// NormalizeRecoveryCode turns user input into the canonical form of a
+// recovery code, like NormalizeUID. Other input is returned unchanged.
+func NormalizeRecoveryCode(input string) string {
+	var b strings.Builder
+
+	for _, r := range strings.ToUpper(strings.TrimSpace(input)) {
+		switch r {
+		case ' ', '-':
+			continue
+		case 'I', 'L':
+			r = '1'
+		case 'O':
+			r = '0'
+		}
+
+		if !strings.ContainsRune(uidAlphabet, r) {
+			return input
+		}
+		b.WriteRune(r)
+	}
+
+	if b.Len() != recoveryCodeLen {
+		return input
+	}
+
+	return groupCode(b.String(), recoveryGroupSize)
+}
@@ -0,0 +1,107 @@
+package user
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"strings"
+)
+
+// uidHashPrefix marks hashed UIDs. Rows without it still hold a plaintext
+// UID from before hashing was introduced (see Store.HashLegacyUIDs).
+const uidHashPrefix = "hmac-sha256:"
+
+// UIDHasher derives the stored lookup value of a login UID:
+// HMAC-SHA256 keyed with a server-side pepper. Without the pepper,
+// a leaked users table is useless for logging in.
+//
+// Changing the pepper invalidates all existing UIDs.
+type UIDHasher struct {
+	pepper []byte
+}
+
+func NewUIDHasher(pepper string) *UIDHasher {
+	return &UIDHasher{pepper: []byte(pepper)}
+}
+
+// Hash returns the value stored in users.uid_hash for uid.
+func (h *UIDHasher) Hash(uid string) string {
+	mac := hmac.New(sha256.New, h.pepper)
+	mac.Write([]byte(uid))
+
+	return uidHashPrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// IsUIDHash reports whether s was produced by UIDHasher.Hash.
+func IsUIDHash(s string) bool {
+	return strings.HasPrefix(s, uidHashPrefix)
+}
+
+// -----------------------------------------------------------------------------
+// Generated UIDs
+// -----------------------------------------------------------------------------
+
+// Crockford base32: no I, L, O, U – nothing to confuse when typing.
+const uidAlphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+const (
+	uidBytes     = 20 // 160 bit entropy → 32 base32 characters
+	uidGroupSize = 4
+)
+
+var uidEncoding = base32.NewEncoding(uidAlphabet).WithPadding(base32.NoPadding)
+
+// GenerateUID returns a random login secret in grouped form,
+// e.g. "7K3M-QX9D-...". Generated UIDs are stored in exactly this form.
+func GenerateUID() (string, error) {
+	b := make([]byte, uidBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return groupCode(uidEncoding.EncodeToString(b), uidGroupSize), nil
+}
+
+// NormalizeUID turns user input that looks like a generated UID into its
+// canonical form: case, spaces and dashes don't matter, and the look-alikes
+// I/L → 1 and O → 0 are corrected. Any other input is returned unchanged,
+// so hand-made UIDs stay case-sensitive.
+func NormalizeUID(input string) string {
+	var b strings.Builder
+
+	for _, r := range strings.ToUpper(input) {
+		switch r {
+		case ' ', '-':
+			continue
+		case 'I', 'L':
+			r = '1'
+		case 'O':
+			r = '0'
+		}
+
+		if !strings.ContainsRune(uidAlphabet, r) {
+			return input
+		}
+		b.WriteRune(r)
+	}
+
+	if b.Len() != uidEncoding.EncodedLen(uidBytes) {
+		return input
+	}
+
+	return groupCode(b.String(), uidGroupSize)
+}
+
+// groupCode splits s into dash-separated groups of size characters.
+func groupCode(s string, size int) string {
+	groups := make([]string, 0, len(s)/size+1)
+	for len(s) > size {
+		groups = append(groups, s[:size])
+		s = s[size:]
+	}
+	groups = append(groups, s)
+
+	return strings.Join(groups, "-")
+}
@@ -0,0 +1,111 @@
+package user
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// generatedUID matches the canonical form of GenerateUID: 8 groups of 4
+// Crockford base32 characters.
+var generatedUID = regexp.MustCompile(`^[0-9A-HJKMNP-TV-Z]{4}(-[0-9A-HJKMNP-TV-Z]{4}){7}$`)
+
+func TestGenerateUID(t *testing.T) {
+	seen := make(map[string]bool)
+	for range 100 {
+		uid, err := GenerateUID()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !generatedUID.MatchString(uid) {
+			t.Fatalf("GenerateUID = %q, want 8 groups of 4 base32 characters", uid)
+		}
+		if seen[uid] {
+			t.Fatalf("GenerateUID repeated %q", uid)
+		}
+		seen[uid] = true
+
+		// generated UIDs are stored canonical: normalizing changes nothing
+		if n := NormalizeUID(uid); n != uid {
+			t.Errorf("NormalizeUID(%q) = %q, want it unchanged", uid, n)
+		}
+	}
+}
+
+func TestNormalizeUID(t *testing.T) {
+	const canonical = "7K3M-QX9D-0A1B-2C3D-4E5F-6G7H-8J9K-MNPQ"
+
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"canonical", canonical, canonical},
+		{"lowercase", strings.ToLower(canonical), canonical},
+		{"no dashes", strings.ReplaceAll(canonical, "-", ""), canonical},
+		{"spaces instead of dashes", strings.ReplaceAll(canonical, "-", " "), canonical},
+		{"surrounding spaces", "  " + canonical + " ", canonical},
+		{"other grouping", "7K3MQX-9D0A1B-2C3D4E-5F6G7H-8J9KMNPQ", canonical},
+		{"O read as zero", "7K3M-QX9D-OA1B-2C3D-4E5F-6G7H-8J9K-MNPQ", canonical},
+		{"I and L read as one", "7K3M-QX9D-0AIB-2C3D-4E5F-6G7H-8J9K-MNPQ", canonical},
+		{"lowercase l", "7k3m-qx9d-0alb-2c3d-4e5f-6g7h-8j9k-mnpq", canonical},
+
+		// everything else stays as typed, including its case
+		{"hand-made", "UID-Alice", "UID-Alice"},
+		{"hand-made lowercase", "alice", "alice"},
+		{"empty", "", ""},
+		{"one character short", canonical[:len(canonical)-1], canonical[:len(canonical)-1]},
+		{"one character too many", canonical + "X", canonical + "X"},
+		{"U is not in the alphabet", "UK3M-QX9D-0A1B-2C3D-4E5F-6G7H-8J9K-MNPQ", "UK3M-QX9D-0A1B-2C3D-4E5F-6G7H-8J9K-MNPQ"},
+		{"punctuation", "7K3M_QX9D_0A1B_2C3D_4E5F_6G7H_8J9K_MNPQ", "7K3M_QX9D_0A1B_2C3D_4E5F_6G7H_8J9K_MNPQ"},
+		{"umlaut", "ÄK3M-QX9D-0A1B-2C3D-4E5F-6G7H-8J9K-MNPQ", "ÄK3M-QX9D-0A1B-2C3D-4E5F-6G7H-8J9K-MNPQ"},
+		{"tab", "7K3M\tQX9D-0A1B-2C3D-4E5F-6G7H-8J9K-MNPQ", "7K3M\tQX9D-0A1B-2C3D-4E5F-6G7H-8J9K-MNPQ"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NormalizeUID(tt.input); got != tt.want {
+				t.Errorf("NormalizeUID(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestNormalizeUIDHash: every way of typing a generated UID logs in as
+// the stored one, a hand-made UID only as typed.
+func TestNormalizeUIDHash(t *testing.T) {
+	h := NewUIDHasher("test-pepper-0123456789abcdef0123")
+
+	uid, err := GenerateUID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored := h.Hash(uid)
+	for _, typed := range []string{uid, strings.ToLower(uid), strings.ReplaceAll(uid, "-", "")} {
+		if h.Hash(NormalizeUID(typed)) != stored {
+			t.Errorf("%q does not match the stored hash of %q", typed, uid)
+		}
+	}
+
+	if h.Hash(NormalizeUID("uid-alice")) == h.Hash(NormalizeUID("UID-ALICE")) {
+		t.Error("hand-made UIDs are case-insensitive")
+	}
+}
+
+func TestUIDHasher(t *testing.T) {
+	a := NewUIDHasher("pepper-a")
+
+	hash := a.Hash("UID-ALICE")
+	if !IsUIDHash(hash) || len(hash) != len(uidHashPrefix)+64 {
+		t.Errorf("Hash = %q, want %s and 64 hex digits", hash, uidHashPrefix)
+	}
+	if a.Hash("UID-ALICE") != hash {
+		t.Error("Hash is not deterministic")
+	}
+	if NewUIDHasher("pepper-b").Hash("UID-ALICE") == hash {
+		t.Error("Hash ignores the pepper")
+	}
+	if IsUIDHash("UID-ALICE") {
+		t.Error("IsUIDHash(plaintext) = true")
+	}
+}
@@ -0,0 +1,64 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Soft delete: deleted users keep their row, so uid/display_name must only
+-- be unique among live users. SQLite cannot drop inline UNIQUE constraints,
+-- so the table is rebuilt.
+CREATE TABLE users_new (
+    id INTEGER PRIMARY KEY,
+    uid TEXT NOT NULL, -- random secret, handed to user
+    display_name TEXT NOT NULL,
+    last_name TEXT NOT NULL DEFAULT '',
+    first_name TEXT NOT NULL DEFAULT '',
+    created_at TEXT DEFAULT (datetime('now', 'localtime')) NOT NULL,
+    updated_at TEXT DEFAULT (datetime('now', 'localtime')) NOT NULL,
+    deleted_at TEXT
+);
+
+INSERT INTO users_new (id, uid, display_name, last_name, first_name, created_at, updated_at)
+SELECT id, uid, display_name, last_name, first_name, created_at, updated_at FROM users;
+
+DROP TABLE users;
+ALTER TABLE users_new RENAME TO users;
+
+CREATE UNIQUE INDEX users_uid_live_idx ON users(uid) WHERE deleted_at IS NULL;
+CREATE UNIQUE INDEX users_display_name_live_idx ON users(display_name) WHERE deleted_at IS NULL;
+
+CREATE TRIGGER IF NOT EXISTS on_update_ts_users
+AFTER UPDATE ON users
+WHEN OLD.updated_at <> (datetime('now', 'localtime'))
+BEGIN
+    UPDATE users
+    SET updated_at = (datetime('now', 'localtime'))
+    WHERE id = OLD.id;
+END;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+-- soft-deleted users are dropped for good
+CREATE TABLE users_old (
+    id INTEGER PRIMARY KEY,
+    uid TEXT UNIQUE NOT NULL, -- random secret, handed to user
+    display_name TEXT UNIQUE NOT NULL,
+    last_name TEXT NOT NULL DEFAULT '',
+    first_name TEXT NOT NULL DEFAULT '',
+    created_at TEXT DEFAULT (datetime('now', 'localtime')) NOT NULL,
+    updated_at TEXT DEFAULT (datetime('now', 'localtime')) NOT NULL
+);
+
+INSERT INTO users_old (id, uid, display_name, last_name, first_name, created_at, updated_at)
+SELECT id, uid, display_name, last_name, first_name, created_at, updated_at FROM users
+WHERE deleted_at IS NULL;
+
+DROP TABLE users;
+ALTER TABLE users_old RENAME TO users;
+
+CREATE TRIGGER IF NOT EXISTS on_update_ts_users
+AFTER UPDATE ON users
+WHEN OLD.updated_at <> (datetime('now', 'localtime'))
+BEGIN
+    UPDATE users
+    SET updated_at = (datetime('now', 'localtime'))
+    WHERE id = OLD.id;
+END;
+-- +goose StatementEnd
@@ -0,0 +1,13 @@
+-- +goose Up
+-- +goose StatementBegin
+-- uid now holds HMAC-SHA256(pepper, uid). SQL cannot compute the HMAC
+-- (the pepper lives in AUTH_UID_PEPPER), so existing plaintext values are
+-- converted by the application on the next start (user.Store.HashLegacyUIDs).
+ALTER TABLE users RENAME COLUMN uid TO uid_hash;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+-- hashed UIDs cannot be reverted – those users need a new UID
+ALTER TABLE users RENAME COLUMN uid_hash TO uid;
+-- +goose StatementEnd
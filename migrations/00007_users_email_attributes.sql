@@ -0,0 +1,18 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE users ADD COLUMN email TEXT; -- optional, stored in lower case
+ALTER TABLE users ADD COLUMN email_verified_at TEXT;
+ALTER TABLE users ADD COLUMN attributes TEXT NOT NULL DEFAULT '{}'
+    CHECK (json_valid(attributes) AND json_type(attributes) = 'object');
+
+CREATE UNIQUE INDEX users_email_live_idx ON users(email)
+    WHERE email IS NOT NULL AND deleted_at IS NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS users_email_live_idx;
+ALTER TABLE users DROP COLUMN attributes;
+ALTER TABLE users DROP COLUMN email_verified_at;
+ALTER TABLE users DROP COLUMN email;
+-- +goose StatementEnd
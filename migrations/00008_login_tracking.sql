@@ -0,0 +1,24 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE users ADD COLUMN last_login_at TEXT; -- last successful login, local time
+ALTER TABLE users ADD COLUMN login_count INTEGER NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS login_events (
+    id INTEGER PRIMARY KEY,
+    user_id INTEGER REFERENCES users (id) ON DELETE CASCADE, -- NULL: unknown UID
+    success INTEGER NOT NULL CHECK (success IN (0, 1)),
+    reason TEXT NOT NULL DEFAULT '', -- why a login failed
+    ip TEXT NOT NULL DEFAULT '',
+    user_agent TEXT NOT NULL DEFAULT '',
+    created_at TEXT DEFAULT (datetime('now', 'localtime')) NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS login_events_user_idx ON login_events (user_id, id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS login_events;
+ALTER TABLE users DROP COLUMN login_count;
+ALTER TABLE users DROP COLUMN last_login_at;
+-- +goose StatementEnd
@@ -0,0 +1,26 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS user_totp (
+    user_id INTEGER PRIMARY KEY REFERENCES users (id) ON DELETE CASCADE,
+    secret TEXT NOT NULL, -- base32, must stay readable to verify codes
+    confirmed_at TEXT, -- NULL: enrolment started, no code entered yet
+    last_step INTEGER NOT NULL DEFAULT 0, -- time step of the last accepted code (no replay)
+    created_at TEXT DEFAULT (datetime('now', 'localtime')) NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS user_recovery_codes (
+    id INTEGER PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    code_hash TEXT NOT NULL, -- HMAC-SHA256 like users.uid_hash
+    used_at TEXT,
+    created_at TEXT DEFAULT (datetime('now', 'localtime')) NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS user_recovery_codes_user_idx ON user_recovery_codes (user_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS user_recovery_codes;
+DROP TABLE IF EXISTS user_totp;
+-- +goose StatementEnd
@@ -0,0 +1,19 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS user_passkeys (
+    id INTEGER PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    credential_id TEXT NOT NULL UNIQUE, -- WebAuthn credential ID, base64url
+    name TEXT NOT NULL,
+    credential TEXT NOT NULL, -- credential record as JSON (public key, sign counter, flags)
+    last_used_at TEXT,
+    created_at TEXT DEFAULT (datetime('now', 'localtime')) NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS user_passkeys_user_idx ON user_passkeys (user_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS user_passkeys;
+-- +goose StatementEnd
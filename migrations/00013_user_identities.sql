@@ -0,0 +1,21 @@
+-- +goose Up
+-- +goose StatementBegin
+-- External accounts (OpenID Connect) linked to users.
+CREATE TABLE IF NOT EXISTS user_identities (
+    id INTEGER PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    issuer TEXT NOT NULL,
+    subject TEXT NOT NULL, -- "sub" claim, stable per issuer
+    roles TEXT NOT NULL DEFAULT '[]', -- Casbin roles mapped from the groups at the last login
+    last_login_at TEXT,
+    created_at TEXT DEFAULT (datetime('now', 'localtime')) NOT NULL,
+    UNIQUE (issuer, subject)
+);
+
+CREATE INDEX IF NOT EXISTS user_identities_user_idx ON user_identities (user_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS user_identities;
+-- +goose StatementEnd
@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Failed login counters per client IP ("ip:<address>") and globally ("global").
+CREATE TABLE IF NOT EXISTS login_throttle (
+    key TEXT PRIMARY KEY,
+    failures INTEGER NOT NULL DEFAULT 0, -- since the window started
+    last_failure_at INTEGER NOT NULL, -- unix seconds
+    blocked_until INTEGER NOT NULL DEFAULT 0 -- unix seconds, 0: not blocked
+);
+
+CREATE INDEX IF NOT EXISTS login_throttle_last_failure_idx ON login_throttle (last_failure_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS login_throttle;
+-- +goose StatementEnd
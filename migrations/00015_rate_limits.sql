@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Token buckets of RATELIMIT_BACKEND=sqlite ("<group>:user:<id>" or "<group>:ip:<address>").
+-- PostgreSQL has no counterpart: use RATELIMIT_BACKEND=memory there.
+CREATE TABLE IF NOT EXISTS rate_limits (
+    key TEXT PRIMARY KEY,
+    tokens REAL NOT NULL, -- left after the last request
+    updated_at INTEGER NOT NULL -- unix milliseconds of the last request
+);
+
+CREATE INDEX IF NOT EXISTS rate_limits_updated_idx ON rate_limits (updated_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS rate_limits;
+-- +goose StatementEnd
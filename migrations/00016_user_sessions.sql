@@ -0,0 +1,22 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Index of the logged-in sessions per user ("log out of all devices").
+-- token is the key of the session store (table sessions).
+CREATE TABLE IF NOT EXISTS user_sessions (
+    id INTEGER PRIMARY KEY,
+    token TEXT NOT NULL UNIQUE,
+    user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    ip TEXT NOT NULL DEFAULT '',
+    user_agent TEXT NOT NULL DEFAULT '',
+    expires_at TEXT NOT NULL, -- the session store entry is gone afterwards
+    created_at TEXT DEFAULT (datetime('now', 'localtime')) NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS user_sessions_user_idx ON user_sessions (user_id);
+CREATE INDEX IF NOT EXISTS user_sessions_expires_idx ON user_sessions (expires_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS user_sessions;
+-- +goose StatementEnd
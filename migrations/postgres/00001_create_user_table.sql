@@ -0,0 +1,29 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS users (
+    id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    uid TEXT UNIQUE NOT NULL, -- random secret, handed to user
+    display_name TEXT UNIQUE NOT NULL,
+    last_name TEXT NOT NULL DEFAULT '',
+    first_name TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT LOCALTIMESTAMP(0) NOT NULL,
+    updated_at TIMESTAMP DEFAULT LOCALTIMESTAMP(0) NOT NULL
+);
+
+CREATE OR REPLACE FUNCTION on_update_ts() RETURNS TRIGGER AS $$
+BEGIN
+    NEW.updated_at = LOCALTIMESTAMP(0);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER on_update_ts_users
+BEFORE UPDATE ON users
+FOR EACH ROW EXECUTE FUNCTION on_update_ts();
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS users;
+DROP FUNCTION IF EXISTS on_update_ts();
+-- +goose StatementEnd
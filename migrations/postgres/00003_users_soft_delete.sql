@@ -0,0 +1,25 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Soft delete: uid/display_name only have to be unique among live users.
+ALTER TABLE users ADD COLUMN deleted_at TIMESTAMP;
+
+ALTER TABLE users DROP CONSTRAINT users_uid_key;
+ALTER TABLE users DROP CONSTRAINT users_display_name_key;
+
+CREATE UNIQUE INDEX users_uid_live_idx ON users(uid) WHERE deleted_at IS NULL;
+CREATE UNIQUE INDEX users_display_name_live_idx ON users(display_name) WHERE deleted_at IS NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+-- soft-deleted users are dropped for good
+DELETE FROM users WHERE deleted_at IS NOT NULL;
+
+DROP INDEX IF EXISTS users_uid_live_idx;
+DROP INDEX IF EXISTS users_display_name_live_idx;
+
+ALTER TABLE users ADD CONSTRAINT users_uid_key UNIQUE (uid);
+ALTER TABLE users ADD CONSTRAINT users_display_name_key UNIQUE (display_name);
+
+ALTER TABLE users DROP COLUMN deleted_at;
+-- +goose StatementEnd
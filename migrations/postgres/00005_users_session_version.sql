@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Incremented to end all sessions of a user (e.g. after a UID rotation).
+-- Sessions remember the version they were created with.
+ALTER TABLE users ADD COLUMN session_version BIGINT NOT NULL DEFAULT 1;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE users DROP COLUMN session_version;
+-- +goose StatementEnd
@@ -0,0 +1,14 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE users ADD COLUMN status TEXT NOT NULL DEFAULT 'active'
+    CHECK (status IN ('active', 'disabled'));
+ALTER TABLE users ADD COLUMN locked_until TIMESTAMP; -- temporary lock
+ALTER TABLE users ADD COLUMN valid_until TIMESTAMP;  -- access expires
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE users DROP COLUMN valid_until;
+ALTER TABLE users DROP COLUMN locked_until;
+ALTER TABLE users DROP COLUMN status;
+-- +goose StatementEnd
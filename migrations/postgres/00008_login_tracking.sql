@@ -0,0 +1,24 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE users ADD COLUMN last_login_at TIMESTAMP; -- last successful login
+ALTER TABLE users ADD COLUMN login_count BIGINT NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS login_events (
+    id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    user_id BIGINT REFERENCES users (id) ON DELETE CASCADE, -- NULL: unknown UID
+    success BOOLEAN NOT NULL,
+    reason TEXT NOT NULL DEFAULT '', -- why a login failed
+    ip TEXT NOT NULL DEFAULT '',
+    user_agent TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT LOCALTIMESTAMP(0) NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS login_events_user_idx ON login_events (user_id, id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS login_events;
+ALTER TABLE users DROP COLUMN login_count;
+ALTER TABLE users DROP COLUMN last_login_at;
+-- +goose StatementEnd
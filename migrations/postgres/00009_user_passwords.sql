@@ -0,0 +1,16 @@
+-- +goose Up
+-- +goose StatementBegin
+-- own table: only users with a password have a row, the hash never
+-- shows up in SELECTs on users
+CREATE TABLE IF NOT EXISTS user_passwords (
+    user_id BIGINT PRIMARY KEY REFERENCES users (id) ON DELETE CASCADE,
+    hash TEXT NOT NULL, -- argon2id, PHC string format
+    created_at TIMESTAMP DEFAULT LOCALTIMESTAMP(0) NOT NULL,
+    updated_at TIMESTAMP DEFAULT LOCALTIMESTAMP(0) NOT NULL
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS user_passwords;
+-- +goose StatementEnd
@@ -0,0 +1,26 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS user_totp (
+    user_id BIGINT PRIMARY KEY REFERENCES users (id) ON DELETE CASCADE,
+    secret TEXT NOT NULL, -- base32, must stay readable to verify codes
+    confirmed_at TIMESTAMP, -- NULL: enrolment started, no code entered yet
+    last_step BIGINT NOT NULL DEFAULT 0, -- time step of the last accepted code (no replay)
+    created_at TIMESTAMP DEFAULT LOCALTIMESTAMP(0) NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS user_recovery_codes (
+    id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    code_hash TEXT NOT NULL, -- HMAC-SHA256 like users.uid_hash
+    used_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT LOCALTIMESTAMP(0) NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS user_recovery_codes_user_idx ON user_recovery_codes (user_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS user_recovery_codes;
+DROP TABLE IF EXISTS user_totp;
+-- +goose StatementEnd
@@ -0,0 +1,18 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Nonces of login links (magic links) that were used. A link carries its
+-- nonce in the signed token, so only used ones need to be stored.
+CREATE TABLE IF NOT EXISTS used_login_tokens (
+    nonce TEXT PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    expires_at TIMESTAMP NOT NULL, -- the link is invalid afterwards, the row can go
+    used_at TIMESTAMP DEFAULT LOCALTIMESTAMP(0) NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS used_login_tokens_expires_idx ON used_login_tokens (expires_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS used_login_tokens;
+-- +goose StatementEnd
@@ -0,0 +1,22 @@
+-- +goose Up
+-- +goose StatementBegin
+-- External accounts (OpenID Connect) linked to users.
+CREATE TABLE IF NOT EXISTS user_identities (
+    id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    issuer TEXT NOT NULL,
+    subject TEXT NOT NULL, -- "sub" claim, stable per issuer
+    roles JSONB NOT NULL DEFAULT '[]' -- Casbin roles mapped from the groups at the last login
+        CHECK (jsonb_typeof(roles) = 'array'),
+    last_login_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT LOCALTIMESTAMP(0) NOT NULL,
+    UNIQUE (issuer, subject)
+);
+
+CREATE INDEX IF NOT EXISTS user_identities_user_idx ON user_identities (user_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS user_identities;
+-- +goose StatementEnd
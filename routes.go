@@ -5,16 +5,31 @@ import (
 
 	"github.com/axelrhd/hagg-lib/handler"
 	"github.com/axelrhd/hagg/internal/app"
+	"github.com/axelrhd/hagg/internal/auth"
 	"github.com/axelrhd/hagg/internal/frontend/pages/dashboard"
 	"github.com/axelrhd/hagg/internal/frontend/pages/home"
 	"github.com/axelrhd/hagg/internal/frontend/pages/login"
+	"github.com/axelrhd/hagg/internal/frontend/pages/passkeys"
+	"github.com/axelrhd/hagg/internal/frontend/pages/password"
+	"github.com/axelrhd/hagg/internal/frontend/pages/sessions"
+	"github.com/axelrhd/hagg/internal/frontend/pages/twofactor"
+	"github.com/axelrhd/hagg/internal/frontend/pages/verifyemail"
 	"github.com/axelrhd/hagg/internal/middleware"
+	"github.com/axelrhd/hagg/internal/ratelimit"
 )
 
 // AddRoutes configures all HTTP routes for the application.
 // It registers:
-//   - Page routes (full HTML pages): /, /login, /dashboard
-//   - HTMX routes (partial HTML): /htmx/login, /htmx/logout
+//   - Page routes (full HTML pages): /, /login, /login/link, /dashboard,
+//     /verify-email, /account/password, /account/2fa, /account/passkeys,
+//     /account/sessions
+//   - SSO routes (redirects): /auth/oidc/login, /auth/oidc/callback
+//   - HTMX routes (partial HTML): /htmx/login, /htmx/login/2fa,
+//     /htmx/login/link/*, /htmx/logout, /htmx/account/password,
+//     /htmx/account/2fa/*, /htmx/account/passkeys/*,
+//     /htmx/account/sessions/logout-all
+//   - Passkey routes (static/js/passkey.js): .../begin returns JSON options,
+//     the finishing POST is a normal HTMX request
 //
 // Routes are protected by authentication middleware where appropriate.
 func AddRoutes(r chi.Router, wrapper *handler.Wrapper, deps app.Deps) {
@@ -27,19 +42,58 @@ func AddRoutes(r chi.Router, wrapper *handler.Wrapper, deps app.Deps) {
 	r.Get("/login", wrapper.Wrap(login.Page(deps)))
 	r.Post("/login", wrapper.Wrap(login.Page(deps)))
 
-	// HTMX authentication endpoints
-	r.Post("/htmx/login", wrapper.Wrap(login.HxLogin(deps)))
+	// Confirmation link from the email verification mail
+	r.Get(auth.VerifyEmailPath, wrapper.Wrap(verifyemail.Page(deps)))
+
+	// Login link from the magic link mail (asks to confirm the login)
+	r.Get(auth.MagicLinkPath, wrapper.Wrap(login.LinkPage(deps)))
+
+	// Authentication endpoints, with the stricter "auth" rate limit
+	r.Group(func(r chi.Router) {
+		r.Use(middleware.RateLimit(deps.RateLimit, ratelimit.GroupAuth))
+
+		// Login through the identity provider (OIDC_ISSUER)
+		r.Get(auth.OIDCLoginPath, wrapper.Wrap(login.SSOStart(deps)))
+		r.Get(auth.OIDCCallbackPath, wrapper.Wrap(login.SSOCallback(deps)))
+
+		r.Post("/htmx/login", wrapper.Wrap(login.HxLogin(deps)))
+		r.Post("/htmx/login/2fa", wrapper.Wrap(login.HxVerifyTOTP(deps)))
+		r.Post("/htmx/login/passkey/begin", wrapper.Wrap(login.HxPasskeyBegin(deps)))
+		r.Post("/htmx/login/passkey", wrapper.Wrap(login.HxPasskeyLogin(deps)))
+		r.Post("/htmx/login/link", wrapper.Wrap(login.HxRequestMagicLink(deps)))
+		r.Post("/htmx/login/link/confirm", wrapper.Wrap(login.HxMagicLinkLogin(deps)))
+	})
 	r.Post("/htmx/logout", wrapper.Wrap(login.HxLogout(deps)))
 
+	// 2FA setup: also used by a pending login whose role requires 2FA
+	// (the handlers check auth.Auth.EnrollingUser themselves)
+	r.Get("/account/2fa", wrapper.Wrap(twofactor.Page(deps)))
+	r.Post("/htmx/account/2fa/confirm", wrapper.Wrap(twofactor.HxConfirm(deps)))
+
 	// Protected routes (require authentication only)
 	// Use RequireAuth for routes that just need a logged-in user
-	// Example: r.Use(middleware.RequireAuth(wrapper))
+	r.Group(func(r chi.Router) {
+		r.Use(middleware.RequireAuth(wrapper, deps.Auth))
+
+		r.Get("/account/password", wrapper.Wrap(password.Page(deps)))
+		r.Post("/htmx/account/password", wrapper.Wrap(password.HxChangePassword(deps)))
+		r.Post("/htmx/account/2fa/recovery-codes", wrapper.Wrap(twofactor.HxRecoveryCodes(deps)))
+		r.Post("/htmx/account/2fa/disable", wrapper.Wrap(twofactor.HxDisable(deps)))
+
+		r.Get("/account/passkeys", wrapper.Wrap(passkeys.Page(deps)))
+		r.Post("/htmx/account/passkeys/begin", wrapper.Wrap(passkeys.HxBegin(deps)))
+		r.Post("/htmx/account/passkeys", wrapper.Wrap(passkeys.HxRegister(deps)))
+		r.Post("/htmx/account/passkeys/delete", wrapper.Wrap(passkeys.HxDelete(deps)))
+
+		r.Get("/account/sessions", wrapper.Wrap(sessions.Page(deps)))
+		r.Post("/htmx/account/sessions/logout-all", wrapper.Wrap(sessions.HxLogoutAll(deps)))
+	})
 
 	// Protected routes (require authentication + permission)
 	// The dashboard demonstrates Casbin-based permission checks.
 	// Users need the "dashboard:view" action assigned to their role.
 	r.Group(func(r chi.Router) {
-		r.Use(middleware.RequirePermission(deps.Auth, deps.Users, deps.Perms, "dashboard:view"))
+		r.Use(middleware.RequirePermission(deps.Auth, deps.Perms, "dashboard:view"))
 
 		r.Get("/dashboard", wrapper.Wrap(dashboard.Page(deps)))
 	})
@@ -1,13 +1,16 @@
 package hagg
 
 import (
+	"context"
 	"log"
 	"log/slog"
 	"net"
 	"net/http"
 	"os"
 	"path/filepath"
+	"time"
 
+	"github.com/alexedwards/scs/v2"
 	"github.com/go-chi/chi/v5"
 	chimw "github.com/go-chi/chi/v5/middleware"
 
@@ -17,9 +20,13 @@ import (
 	"github.com/axelrhd/hagg/internal/app"
 	"github.com/axelrhd/hagg/internal/auth"
 	"github.com/axelrhd/hagg/internal/config"
+	"github.com/axelrhd/hagg/internal/db"
+	"github.com/axelrhd/hagg/internal/mail"
 	"github.com/axelrhd/hagg/internal/middleware"
+	"github.com/axelrhd/hagg/internal/ratelimit"
 	"github.com/axelrhd/hagg/internal/session"
-	"github.com/axelrhd/hagg/internal/user"
+	"github.com/axelrhd/hagg/internal/store"
+	"github.com/axelrhd/hagg/internal/token"
 )
 
 // StartServer initializes and starts the HTTP server.
@@ -27,14 +34,15 @@ import (
 //   - TCP mode (development): Uses host:port from config
 //   - Unix socket mode (production): Uses socket path from config
 //
+// roles are extra role assignments by subject that are not in policy.csv
+// (the users of DB_MEMORY_FIXTURE); they are assigned in memory only.
+//
 // The server will block until an error occurs or the process is terminated.
-func StartServer(cfg *config.Config, usrStore user.Store) {
+func StartServer(cfg *config.Config, stores store.Manager, sessions scs.Store, limits ratelimit.Store, queries *db.QueryLogger, roles map[string][]string) {
 	// Initialize SCS session manager
-	if err := session.Init(cfg.Session.DBPath); err != nil {
-		log.Fatal("failed to init sessions:", err)
-	}
+	session.Init(sessions)
 
-	router := buildRouter(cfg, usrStore)
+	router := buildRouter(cfg, stores, limits, queries, roles)
 
 	// Socket or TCP?
 	if cfg.Server.Socket != "" {
@@ -50,7 +58,7 @@ func StartServer(cfg *config.Config, usrStore user.Store) {
 }
 
 // buildRouter constructs the Chi router with all middleware, dependencies, and routes.
-func buildRouter(cfg *config.Config, usrStore user.Store) http.Handler {
+func buildRouter(cfg *config.Config, stores store.Manager, limits ratelimit.Store, queries *db.QueryLogger, roles map[string][]string) http.Handler {
 	// Create logger
 	logger := slog.Default()
 
@@ -65,20 +73,97 @@ func buildRouter(cfg *config.Config, usrStore user.Store) http.Handler {
 	if err != nil {
 		log.Fatal(err)
 	}
+	for subject, subjectRoles := range roles {
+		for _, role := range subjectRoles {
+			if _, err := enforcer.AddRoleForUser(subject, role); err != nil {
+				log.Fatal(err)
+			}
+		}
+	}
+
+	// Mail (verification and login links, ...)
+	mailer, err := mail.New(cfg.Mail)
+	if err != nil {
+		log.Fatal(err)
+	}
+	signer := token.NewSigner(cfg.Auth.TokenSecret)
+
+	// Login links by mail (0: disabled)
+	var magicLinkTTL time.Duration
+	if cfg.Auth.MagicLink {
+		magicLinkTTL = cfg.Auth.MagicLinkTTL
+	}
+
+	// Passkeys (nil if AUTH_PASSKEYS=false)
+	relyingParty, err := auth.NewWebAuthn(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Request limits (nil if RATELIMIT_ENABLED=false)
+	limiter, err := ratelimit.NewLimiter(cfg.RateLimit, limits, logger)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Reverse proxies allowed to report the client address
+	trustedProxies, err := cfg.Server.TrustedProxyNets()
+	if err != nil {
+		log.Fatal(err)
+	}
 
 	// Dependencies
+	usrStore := stores.Stores().Users
+	perms := casbinx.NewPerm(enforcer)
+
+	authService := auth.New(usrStore, auth.Options{
+		Mode:   cfg.Auth.LoginMode,
+		Policy: auth.PasswordPolicy(cfg.Auth),
+		Perms:  perms,
+		Issuer: cfg.Auth.TOTPIssuer,
+
+		WebAuthn: relyingParty,
+
+		MagicLinkTTL: magicLinkTTL,
+		Signer:       signer,
+		Mailer:       mailer,
+		BaseURL:      cfg.BaseURL(),
+
+		Throttle: auth.NewThrottle(cfg.Auth, stores.Stores().Throttle, logger),
+	})
+
+	// SSO (nil if OIDC_ISSUER is empty); assigns the stored SSO roles
+	sso, err := auth.NewOIDC(context.Background(), cfg, authService, stores, enforcer)
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	deps := app.Deps{
-		Users:    usrStore,
-		Auth:     auth.New(usrStore),
-		Enforcer: enforcer,
-		Perms:    casbinx.NewPerm(enforcer),
+		Stores:  stores,
+		Queries: queries,
+		Users:   usrStore,
+		Auth:    authService,
+		Mailer:  mailer,
+		EmailVerifier: auth.NewEmailVerifier(
+			usrStore,
+			signer,
+			mailer,
+			cfg.BaseURL(),
+			cfg.Auth.EmailVerifyTTL,
+		),
+		OIDC:      sso,
+		RateLimit: limiter,
+		Enforcer:  enforcer,
+		Perms:     perms,
 	}
 
 	// Create Chi router
 	r := chi.NewRouter()
 
+	// Client address (before everything that logs or limits by IP)
+	r.Use(middleware.RealIP(trustedProxies))
+
 	// Built-in Chi middleware
-	r.Use(chimw.RealIP)
 	r.Use(chimw.Compress(5))
 
 	// SCS Session middleware - MUST come before any middleware that uses sessions!
@@ -88,7 +173,7 @@ func buildRouter(cfg *config.Config, usrStore user.Store) http.Handler {
 	r.Use(middleware.Recovery(wrapper))
 	r.Use(middleware.Logger(wrapper))
 	r.Use(middleware.CORS())
-	r.Use(middleware.RateLimit)
+	r.Use(middleware.RateLimit(limiter, ratelimit.GroupDefault))
 	r.Use(libmw.Secure)
 
 	// Static files
@@ -0,0 +1,188 @@
+// Passkey (WebAuthn) ceremonies for HTMX pages
+//
+// Buttons declare the ceremony, no page script is needed:
+//
+//   <button type="button"
+//           data-passkey="login"                      // or "register"
+//           data-passkey-begin="/htmx/login/passkey/begin"
+//           data-passkey-finish="/htmx/login/passkey"
+//           data-passkey-target="#passkeys">          // optional swap target
+//
+// 1. POST to begin → JSON options (or {"error": "..."} → error toast)
+// 2. navigator.credentials.create() / .get() with the options
+// 3. htmx.ajax POST to finish with the result in the field "credential"
+//    (register: plus the field "name" of the button's form). The response is
+//    a normal HTMX response (toasts, events, HX-Redirect, swap).
+//
+// Buttons (and elements with data-passkey-only, e.g. hints) are hidden in
+// browsers without WebAuthn.
+
+(function() {
+    function supported() {
+        return !!(window.PublicKeyCredential && navigator.credentials);
+    }
+
+    // --- base64url <-> ArrayBuffer ---
+
+    function toBuffer(value) {
+        var b64 = value.replace(/-/g, '+').replace(/_/g, '/');
+        while (b64.length % 4) {
+            b64 += '=';
+        }
+        var bin = atob(b64);
+        var bytes = new Uint8Array(bin.length);
+        for (var i = 0; i < bin.length; i++) {
+            bytes[i] = bin.charCodeAt(i);
+        }
+        return bytes.buffer;
+    }
+
+    function toBase64url(buffer) {
+        if (!buffer) {
+            return undefined;
+        }
+        var bytes = new Uint8Array(buffer);
+        var bin = '';
+        for (var i = 0; i < bytes.length; i++) {
+            bin += String.fromCharCode(bytes[i]);
+        }
+        return btoa(bin).replace(/\+/g, '-').replace(/\//g, '_').replace(/=+$/, '');
+    }
+
+    function decodeDescriptors(list) {
+        return (list || []).map(function(c) {
+            return Object.assign({}, c, { id: toBuffer(c.id) });
+        });
+    }
+
+    // --- options (server JSON) → browser API ---
+
+    function creationOptions(json) {
+        var pk = Object.assign({}, json.publicKey);
+        pk.challenge = toBuffer(pk.challenge);
+        pk.user = Object.assign({}, pk.user, { id: toBuffer(pk.user.id) });
+        pk.excludeCredentials = decodeDescriptors(pk.excludeCredentials);
+        return { publicKey: pk };
+    }
+
+    function requestOptions(json) {
+        var pk = Object.assign({}, json.publicKey);
+        pk.challenge = toBuffer(pk.challenge);
+        pk.allowCredentials = decodeDescriptors(pk.allowCredentials);
+        return { publicKey: pk };
+    }
+
+    // --- browser result → JSON for the server ---
+
+    function credentialJSON(cred) {
+        var r = cred.response;
+        var response = { clientDataJSON: toBase64url(r.clientDataJSON) };
+
+        if (r.attestationObject) {
+            // registration
+            response.attestationObject = toBase64url(r.attestationObject);
+            response.transports = r.getTransports ? r.getTransports() : [];
+        } else {
+            // login
+            response.authenticatorData = toBase64url(r.authenticatorData);
+            response.signature = toBase64url(r.signature);
+            response.userHandle = toBase64url(r.userHandle);
+        }
+
+        return JSON.stringify({
+            id: cred.id,
+            rawId: toBase64url(cred.rawId),
+            type: cred.type,
+            authenticatorAttachment: cred.authenticatorAttachment || undefined,
+            clientExtensionResults: cred.getClientExtensionResults(),
+            response: response
+        });
+    }
+
+    // --- ceremony ---
+
+    function fail(message, level) {
+        showToast({ message: message, level: level || 'error' });
+    }
+
+    function run(el) {
+        var mode = el.dataset.passkey;
+        var values = {};
+
+        if (mode === 'register') {
+            var form = el.closest('form');
+            var name = form && form.querySelector('[name="name"]');
+            if (name && !name.reportValidity()) {
+                return;
+            }
+            values.name = name ? name.value : '';
+        }
+
+        el.disabled = true;
+
+        fetch(el.dataset.passkeyBegin, {
+            method: 'POST',
+            credentials: 'same-origin',
+            headers: { 'Accept': 'application/json' }
+        })
+            .then(function(res) {
+                return res.json().then(function(body) {
+                    if (!res.ok) {
+                        throw { toast: body.error || 'Passkey-Vorgang fehlgeschlagen.' };
+                    }
+                    return body;
+                });
+            })
+            .then(function(options) {
+                return mode === 'register'
+                    ? navigator.credentials.create(creationOptions(options))
+                    : navigator.credentials.get(requestOptions(options));
+            })
+            .then(function(cred) {
+                values.credential = credentialJSON(cred);
+
+                var target = el.dataset.passkeyTarget;
+                return htmx.ajax('POST', el.dataset.passkeyFinish, {
+                    source: el,
+                    target: target || el,
+                    swap: target ? 'outerHTML' : 'none',
+                    values: values
+                });
+            })
+            .catch(function(err) {
+                if (err && err.toast) {
+                    fail(err.toast);
+                } else if (err && err.name === 'NotAllowedError') {
+                    // cancelled by the user or timed out
+                    fail('Passkey-Vorgang abgebrochen.', 'warning');
+                } else if (err && err.name === 'InvalidStateError') {
+                    fail('Dieser Passkey ist bereits registriert.');
+                } else {
+                    console.error(err);
+                    fail('Passkey-Vorgang fehlgeschlagen.');
+                }
+            })
+            .finally(function() {
+                el.disabled = false;
+            });
+    }
+
+    document.addEventListener('click', function(event) {
+        var el = event.target.closest('[data-passkey]');
+        if (!el) {
+            return;
+        }
+        event.preventDefault();
+        run(el);
+    });
+
+    // hide the buttons if the browser cannot use passkeys
+    htmx.onLoad(function(content) {
+        if (supported()) {
+            return;
+        }
+        content.querySelectorAll('[data-passkey], [data-passkey-only]').forEach(function(el) {
+            el.hidden = true;
+        });
+    });
+})();